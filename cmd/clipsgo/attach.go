@@ -0,0 +1,68 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// attachCommand connects to a shell served by env.ServeShell, copying stdin to it and its
+// output to stdout until either side closes
+func attachCommand(args []string) int {
+	flags := flag.NewFlagSet("attach", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo attach socket|host:port")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	address := flags.Arg(0)
+	network := "unix"
+	if _, err := os.Stat(address); err != nil && strings.Contains(address, ":") {
+		network = "tcp"
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo attach: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		// let the shell finish the last command before the connection closes
+		if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+			closer.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo attach: %v\n", err)
+		return 1
+	}
+	return 0
+}
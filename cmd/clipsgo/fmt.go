@@ -0,0 +1,85 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/format"
+)
+
+// fmtCommand reformats .clp files. With no files, standard input is formatted to standard output
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	list := flags.Bool("l", false, "list files whose formatting differs")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo fmt [-l] [-w] [file.clp ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo fmt: %v\n", err)
+			return 1
+		}
+		out, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo fmt: <stdin>:%v\n", err)
+			return 1
+		}
+		os.Stdout.Write(out)
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo fmt: %v\n", err)
+			status = 1
+			continue
+		}
+		out, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo fmt: %s:%v\n", path, err)
+			status = 1
+			continue
+		}
+		changed := !bytes.Equal(src, out)
+		if *list && changed {
+			fmt.Println(path)
+		}
+		if *write {
+			if changed {
+				if err := ioutil.WriteFile(path, out, 0644); err != nil {
+					fmt.Fprintf(os.Stderr, "clipsgo fmt: %v\n", err)
+					status = 1
+				}
+			}
+		} else if !*list {
+			os.Stdout.Write(out)
+		}
+	}
+	return status
+}
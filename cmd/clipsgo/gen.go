@@ -0,0 +1,187 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/gen"
+)
+
+// genCommand writes Go types for the deftemplates and defclasses in .clp files
+func genCommand(args []string) int {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	output := flags.String("o", "", "write to the named file instead of stdout")
+	// go generate sets GOPACKAGE to the package of the file holding the directive
+	pkg := flags.String("package", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo gen [-o types.go] [-package name] file.clp ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *pkg == "" {
+		*pkg = "main"
+	}
+
+	env := clips.CreateEnvironment()
+	defer env.Delete()
+	// the constructs CLIPS defines itself, such as initial-fact and USER, are left out
+	builtin := make(map[string]bool)
+	for _, tmpl := range env.Templates() {
+		builtin["deftemplate "+tmpl.Module().Name()+"::"+tmpl.Name()] = true
+	}
+	for _, class := range env.Classes() {
+		builtin["defclass "+class.Module().Name()+"::"+class.Name()] = true
+	}
+
+	var sources []string
+	for _, path := range flags.Args() {
+		if err := env.Load(path); err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo gen: %v\n", err)
+			return 1
+		}
+		sources = append(sources, filepath.Base(path))
+	}
+
+	constructs, err := genConstructs(env, builtin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo gen: %v\n", err)
+		return 1
+	}
+	var buf bytes.Buffer
+	if err := gen.Generate(&buf, *pkg, sources, constructs); err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo gen: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return 0
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo gen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// genConstructs describes the templates and classes of every module of the environment for
+// the generator
+func genConstructs(env *clips.Environment, builtin map[string]bool) ([]*gen.Construct, error) {
+	var ret []*gen.Construct
+	var templates []*clips.Template
+	var classes []*clips.Class
+	for _, module := range env.Modules() {
+		templates = append(templates, module.Templates()...)
+		classes = append(classes, module.Classes()...)
+	}
+	for _, tmpl := range templates {
+		module := tmpl.Module().Name()
+		if tmpl.Implied() || builtin["deftemplate "+module+"::"+tmpl.Name()] {
+			continue
+		}
+		c := &gen.Construct{Name: tmpl.Name(), Module: module}
+		// Slots is a map, so ask CLIPS for the order they were declared in
+		var names []clips.Symbol
+		if err := env.ExtractEval(&names, fmt.Sprintf("(deftemplate-slot-names %s::%s)", module, tmpl.Name())); err != nil {
+			return nil, err
+		}
+		slots := tmpl.Slots()
+		for _, name := range names {
+			slot := slots[string(name)]
+			s := genSlot(string(name), slot.Multifield(), slot.Types(), slot.Cardinality)
+			allowed, _ := slot.AllowedValues()
+			s.Symbols = allowedSymbols(allowed)
+			if !s.Multifield && slot.DefaultType() == clips.STATIC_DEFAULT {
+				s.NilDefault = slot.DefaultValue() == nil
+			}
+			c.Slots = append(c.Slots, s)
+		}
+		ret = append(ret, c)
+	}
+	for _, class := range classes {
+		module := class.Module().Name()
+		if builtin["defclass "+module+"::"+class.Name()] {
+			continue
+		}
+		c := &gen.Construct{Name: class.Name(), Module: module, Class: true}
+		for _, slot := range class.Slots(true) {
+			multi, dynamic := false, false
+			for _, facet := range slot.Facets() {
+				multi = multi || facet == "MLT"
+				dynamic = dynamic || facet == "DYN"
+			}
+			s := genSlot(slot.Name(), multi, slot.Types(), slot.Cardinality)
+			allowed, _ := slot.AllowedValues()
+			s.Symbols = allowedSymbols(allowed)
+			if !multi && !dynamic {
+				s.NilDefault = slot.DefaultValue() == nil
+			}
+			s.ReadOnly = !slot.Writable()
+			c.Slots = append(c.Slots, s)
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+func genSlot(name string, multi bool, types []clips.Symbol, cardinality func() (int64, int64, bool)) *gen.Slot {
+	s := &gen.Slot{Name: name, Multifield: multi}
+	for _, t := range types {
+		s.Types = append(s.Types, string(t))
+	}
+	if multi {
+		low, high, hasHigh := cardinality()
+		s.Min, s.Max = low, high
+		if !hasHigh {
+			s.Max = -1
+		}
+	}
+	return s
+}
+
+// allowedSymbols returns the allowed values as symbols, or nil unless all of them are
+// symbols. The clips package returns TRUE, FALSE and nil as Go values
+func allowedSymbols(allowed []interface{}) []string {
+	var ret []string
+	for _, v := range allowed {
+		switch v := v.(type) {
+		case clips.Symbol:
+			ret = append(ret, string(v))
+		case bool:
+			if v {
+				ret = append(ret, "TRUE")
+			} else {
+				ret = append(ret, "FALSE")
+			}
+		case nil:
+			ret = append(ret, "nil")
+		default:
+			return nil
+		}
+	}
+	return ret
+}
@@ -0,0 +1,50 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+	"gotest.tools/assert"
+)
+
+func TestGenConstructs(t *testing.T) {
+	t.Run("Modules", func(t *testing.T) {
+		env := clips.CreateEnvironment()
+		defer env.Delete()
+
+		err := env.LoadFromString(`
+(defmodule MAIN (export ?ALL))
+(deftemplate order (slot id (type INTEGER)))
+(defclass CUSTOMER (is-a USER) (slot name))
+(defmodule REPORTS (import MAIN ?ALL))
+(deftemplate summary (slot total (type FLOAT)))
+(defclass REPORT (is-a USER) (slot title))
+`)
+		assert.NilError(t, err)
+
+		constructs, err := genConstructs(env, map[string]bool{})
+		assert.NilError(t, err)
+		found := make(map[string]bool)
+		for _, c := range constructs {
+			found[c.Module+"::"+c.Name] = true
+		}
+		assert.Assert(t, found["MAIN::order"])
+		assert.Assert(t, found["MAIN::CUSTOMER"])
+		assert.Assert(t, found["REPORTS::summary"])
+		assert.Assert(t, found["REPORTS::REPORT"])
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/graph"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// graphCommand writes the dependency graph of the constructs in .clp files
+func graphCommand(args []string) int {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := flags.String("format", "dot", "output format, dot or json")
+	output := flags.String("o", "", "write to the named file instead of stdout")
+	static := flags.Bool("static", false, "parse the files instead of loading them into a CLIPS environment")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo graph [-format dot|json] [-o file] [-static] file.clp ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 || (*format != "dot" && *format != "json") {
+		flags.Usage()
+		return 2
+	}
+
+	var g *graph.Graph
+	if *static {
+		files := make([]*parser.File, 0, flags.NArg())
+		for _, path := range flags.Args() {
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "clipsgo graph: %v\n", err)
+				return 1
+			}
+			file, err := parser.ParseFile(path, src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "clipsgo graph: %s:%v\n", path, err)
+				return 1
+			}
+			files = append(files, file)
+		}
+		g = graph.Build(files)
+	} else {
+		env := clips.CreateEnvironment()
+		defer env.Delete()
+		for _, path := range flags.Args() {
+			if err := env.Load(path); err != nil {
+				fmt.Fprintf(os.Stderr, "clipsgo graph: %v\n", err)
+				return 1
+			}
+		}
+		var err error
+		if g, err = env.DependencyGraph(); err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo graph: %v\n", err)
+			return 1
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo graph: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	var err error
+	if *format == "json" {
+		err = g.WriteJSON(out)
+	} else {
+		err = g.WriteDOT(out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo graph: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lint"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// lintCommand reports likely mistakes in .clp files. The files are also loaded into a
+// scratch environment so that slot definitions can be checked against live metadata
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	static := flags.Bool("static", false, "do not load the files into a CLIPS environment")
+	disable := flags.String("disable", "", "comma-separated list of checks to skip")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo lint [-static] [-disable checks] file.clp ...")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "checks: %s\n", strings.Join(lint.Checks, ", "))
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	skip := make(map[string]bool)
+	for _, check := range strings.Split(*disable, ",") {
+		skip[strings.TrimSpace(check)] = true
+	}
+
+	status := 0
+	files := make([]*parser.File, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clipsgo lint: %v\n", err)
+			status = 1
+			continue
+		}
+		file, err := parser.ParseFile(path, src)
+		if errs, ok := err.(parser.ErrorList); ok {
+			for _, e := range errs {
+				fmt.Printf("%s:%v (syntax)\n", path, e)
+			}
+			status = 1
+		}
+		files = append(files, file)
+	}
+
+	var live *lint.Schema
+	if !*static {
+		env := clips.CreateEnvironment()
+		defer env.Delete()
+		loaded := true
+		for _, path := range flags.Args() {
+			if err := env.Load(path); err != nil {
+				fmt.Fprintf(os.Stderr, "clipsgo lint: %v\n", err)
+				loaded = false
+			}
+		}
+		if loaded {
+			live = liveSchema(env)
+		}
+	}
+
+	for _, d := range lint.Lint(files, live) {
+		if skip[d.Check] {
+			continue
+		}
+		fmt.Println(d)
+		status = 1
+	}
+	return status
+}
+
+// liveSchema describes the templates and classes defined in the environment
+func liveSchema(env *clips.Environment) *lint.Schema {
+	ret := lint.NewSchema()
+	for _, tmpl := range env.Templates() {
+		if tmpl.Implied() {
+			continue
+		}
+		def := &lint.Definition{
+			Name:   tmpl.Name(),
+			Module: tmpl.Module().Name(),
+			Slots:  make(map[string]*lint.SlotInfo),
+		}
+		for name, slot := range tmpl.Slots() {
+			allowed, _ := slot.AllowedValues()
+			def.Slots[name] = liveSlot(name, slot.Multifield(), slot.Types(), allowed)
+		}
+		ret.Templates[def.Name] = def
+	}
+	for _, class := range env.Classes() {
+		def := &lint.Definition{
+			Name:   class.Name(),
+			Module: class.Module().Name(),
+			Slots:  make(map[string]*lint.SlotInfo),
+		}
+		for _, slot := range class.Slots(true) {
+			multi := false
+			for _, facet := range slot.Facets() {
+				if facet == "MLT" {
+					multi = true
+				}
+			}
+			allowed, _ := slot.AllowedValues()
+			def.Slots[slot.Name()] = liveSlot(slot.Name(), multi, slot.Types(), allowed)
+		}
+		ret.Classes[def.Name] = def
+	}
+	return ret
+}
+
+func liveSlot(name string, multi bool, types []clips.Symbol, allowed []interface{}) *lint.SlotInfo {
+	ret := &lint.SlotInfo{Name: name, Multifield: multi}
+	for _, t := range types {
+		ret.Types = append(ret.Types, string(t))
+	}
+	if len(allowed) > 0 {
+		ret.Allowed = make(map[string][]string)
+	}
+	for _, v := range allowed {
+		switch v := v.(type) {
+		case clips.Symbol:
+			ret.Allowed["SYMBOL"] = append(ret.Allowed["SYMBOL"], string(v))
+		case clips.InstanceName:
+			ret.Allowed["INSTANCE-NAME"] = append(ret.Allowed["INSTANCE-NAME"], "["+string(v)+"]")
+		case string:
+			ret.Allowed["STRING"] = append(ret.Allowed["STRING"], strconv.Quote(v))
+		case int64:
+			ret.Allowed["INTEGER"] = append(ret.Allowed["INTEGER"], strconv.FormatInt(v, 10))
+		case float64:
+			ret.Allowed["FLOAT"] = append(ret.Allowed["FLOAT"], strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	return ret
+}
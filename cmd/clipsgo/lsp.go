@@ -0,0 +1,240 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lsp"
+)
+
+// lspCommand runs a language server for .clp files, speaking the protocol over stdin and stdout
+func lspCommand(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo lsp")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	checker := &envChecker{}
+	defer checker.close()
+	if err := lsp.NewServer(checker).Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// envChecker checks documents by building their constructs in a scratch environment. The
+// environment is kept until the next check so that hover and completion can query it
+type envChecker struct {
+	env *clips.Environment
+}
+
+func (c *envChecker) close() {
+	if c.env != nil {
+		c.env.Delete()
+		c.env = nil
+	}
+}
+
+func (c *envChecker) Check(deps []*lsp.Document, doc *lsp.Document) []lsp.Diagnostic {
+	c.close()
+	c.env = clips.CreateEnvironment()
+	// stdout carries the protocol, so CLIPS output must go elsewhere
+	clips.CreateLoggingRouter(c.env, log.New(os.Stderr, "", 0))
+	main, err := c.env.FindModule("MAIN")
+	if err != nil {
+		return nil
+	}
+
+	for _, dep := range deps {
+		c.env.SetModule(main)
+		for _, con := range dep.File.Constructs {
+			c.env.Build(dep.Source(con))
+		}
+	}
+	c.env.SetModule(main)
+	ret := []lsp.Diagnostic{}
+	for _, con := range doc.File.Constructs {
+		src := doc.Source(con)
+		err := c.env.Build(src)
+		if err == nil {
+			continue
+		}
+		diagnostic := lsp.Diagnostic{
+			Range:    doc.Range(con),
+			Severity: lsp.SeverityError,
+			Source:   "clips",
+			Message:  buildError(src, err),
+		}
+		if name := con.Header().Name; name != nil {
+			diagnostic.Range = doc.Range(name)
+		}
+		if cerr, ok := err.(*clips.Error); ok {
+			diagnostic.Code = cerr.Code
+		}
+		ret = append(ret, diagnostic)
+	}
+	return ret
+}
+
+// buildError returns the CLIPS error message for a construct which failed to build, without
+// the construct source which CLIPS and Build repeat
+func buildError(src string, err error) string {
+	msg := strings.TrimPrefix(err.Error(), fmt.Sprintf("Unable to parse construct \"%s\": ", src))
+	if idx := strings.Index(msg, "\nERROR:"); idx >= 0 {
+		msg = msg[:idx]
+	}
+	return strings.TrimSpace(msg)
+}
+
+func (c *envChecker) Describe(kind lsp.SymbolKind, name string) string {
+	if c.env == nil {
+		return ""
+	}
+	var b strings.Builder
+	switch kind {
+	case lsp.TEMPLATE:
+		tmpl, err := c.env.FindTemplate(name)
+		if err != nil || tmpl.Implied() {
+			return ""
+		}
+		fmt.Fprintf(&b, "**deftemplate %s::%s**\n", tmpl.Module().Name(), tmpl.Name())
+		slots := tmpl.Slots()
+		names := make([]string, 0, len(slots))
+		for name := range slots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			slot := slots[name]
+			allowed, _ := slot.AllowedValues()
+			var def interface{}
+			if slot.DefaultType() == clips.STATIC_DEFAULT {
+				def = slot.DefaultValue()
+			}
+			b.WriteString(describeSlot(name, slot.Multifield(), slot.Types(), allowed, def))
+		}
+	case lsp.CLASS:
+		class, err := c.env.FindClass(name)
+		if err != nil {
+			return ""
+		}
+		fmt.Fprintf(&b, "**defclass %s::%s**\n", class.Module().Name(), class.Name())
+		for _, slot := range class.Slots(true) {
+			multi, dynamic := false, false
+			for _, facet := range slot.Facets() {
+				multi = multi || facet == "MLT"
+				dynamic = dynamic || facet == "DYN"
+			}
+			allowed, _ := slot.AllowedValues()
+			var def interface{}
+			if !dynamic {
+				def = slot.DefaultValue()
+			}
+			b.WriteString(describeSlot(slot.Name(), multi, slot.Types(), allowed, def))
+		}
+	default:
+		return ""
+	}
+	return b.String()
+}
+
+// describeSlot returns a markdown list item for a slot
+func describeSlot(name string, multi bool, types []clips.Symbol, allowed []interface{}, def interface{}) string {
+	keyword := "slot"
+	if multi {
+		keyword = "multislot"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "- `(%s %s)`", keyword, name)
+	var typenames []string
+	for _, t := range types {
+		typenames = append(typenames, string(t))
+	}
+	if len(typenames) > 0 {
+		fmt.Fprintf(&b, " %s", strings.Join(typenames, " "))
+	}
+	if len(allowed) > 0 {
+		fmt.Fprintf(&b, ", allowed %s", clipsValue(allowed))
+	}
+	if def != nil {
+		fmt.Fprintf(&b, ", default %s", clipsValue(def))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// clipsValue formats a value as it would be written in CLIPS source
+func clipsValue(v interface{}) string {
+	switch v := v.(type) {
+	case clips.Symbol:
+		return string(v)
+	case clips.InstanceName:
+		return "[" + string(v) + "]"
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, clipsValue(item))
+		}
+		return "(" + strings.Join(values, " ") + ")"
+	}
+	return fmt.Sprint(v)
+}
+
+// completionKinds maps the descriptions of Environment.Complete suggestions to item kinds
+var completionKinds = map[string]int{
+	"deffunction": lsp.FunctionCompletion,
+	"defgeneric":  lsp.FunctionCompletion,
+	"function":    lsp.FunctionCompletion,
+	"deftemplate": lsp.StructCompletion,
+	"defclass":    lsp.ClassCompletion,
+	"defglobal":   lsp.VariableCompletion,
+	"construct":   lsp.KeywordCompletion,
+}
+
+func (c *envChecker) Complete(prefix string) []lsp.CompletionItem {
+	env := c.env
+	if env == nil {
+		env = clips.CreateEnvironment()
+		defer env.Delete()
+	}
+	var ret []lsp.CompletionItem
+	for _, s := range env.Complete(prefix) {
+		ret = append(ret, lsp.CompletionItem{
+			Label:  s.Text,
+			Kind:   completionKinds[s.Description],
+			Detail: s.Description,
+		})
+	}
+	return ret
+}
@@ -16,10 +16,28 @@ package main
 */
 
 import (
-	"github.com/keysight/clipsgo/pkg/clips"
+	"os"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
 )
 
+// commands maps subcommand names to their implementations. Each returns the process exit code
+var commands = map[string]func(args []string) int{
+	"attach": attachCommand,
+	"fmt":    fmtCommand,
+	"gen":    genCommand,
+	"graph":  graphCommand,
+	"lint":   lintCommand,
+	"lsp":    lspCommand,
+	"serve":  serveCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
 	env := clips.CreateEnvironment()
 	env.Shell()
 }
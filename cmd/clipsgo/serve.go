@@ -0,0 +1,84 @@
+package main
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/server"
+)
+
+// serveCommand serves the rules in a directory as an HTTP/JSON service
+func serveCommand(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	rules := flags.String("rules", "", "directory of .clp files to load, in name order")
+	addr := flags.String("addr", ":8080", "address to listen on")
+	pool := flags.Int("pool", 4, "number of environments kept ready for new sessions")
+	timeout := flags.Duration("timeout", 10*time.Second, "longest time a request may run rules for, 0 for no limit")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: clipsgo serve -rules dir [-addr :8080] [-pool 4] [-timeout 10s]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *rules == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	files, err := server.Dir(*rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo serve: %v\n", err)
+		return 1
+	}
+	srv, err := server.New(files, server.Options{PoolSize: *pool, Timeout: *timeout})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo serve: %v\n", err)
+		return 1
+	}
+	defer srv.Close()
+
+	// on SIGINT or SIGTERM, let requests in progress finish, then close the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	httpSrv := &http.Server{Addr: *addr, Handler: srv}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpSrv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "clipsgo serve: loaded %d files, listening on %s\n", len(files), *addr)
+	select {
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "clipsgo serve: %v\n", err)
+		return 1
+	case <-ctx.Done():
+	}
+	fmt.Fprintln(os.Stderr, "clipsgo serve: shutting down")
+	shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := httpSrv.Shutdown(shutdown); err != nil {
+		fmt.Fprintf(os.Stderr, "clipsgo serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -1,6 +1,6 @@
 module github.com/mattsmi/clipsgo/v0.2.0
 
-go 1.14
+go 1.16
 
 require (
 	github.com/alecthomas/chroma v0.7.2
@@ -0,0 +1,277 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Expr is CLIPS source written into a construct as is, such as a variable ?x, a constraint
+// ~shipped or a function call (+ ?x 1). Other Go values given to the builders are written as
+// CLIPS values, so a string becomes a STRING and a Symbol a SYMBOL
+type Expr string
+
+// Var returns the named variable as an Expr. The leading ? may be left out
+func Var(name string) Expr {
+	if strings.HasPrefix(name, "?") || strings.HasPrefix(name, "$?") {
+		return Expr(name)
+	}
+	return Expr("?" + name)
+}
+
+// SlotValue pairs a slot with its value, for patterns and actions. A slice value is written
+// as the values of a multislot
+type SlotValue struct {
+	Name  string
+	Value interface{}
+}
+
+// With returns a SlotValue for the given slot
+func With(slot string, value interface{}) SlotValue {
+	return SlotValue{Name: slot, Value: value}
+}
+
+// symbolDelimiters may not appear within a CLIPS symbol
+const symbolDelimiters = "()&|<~;\" \t\r\n"
+
+// validName returns an error unless name can be written as the name of a construct or slot
+func validName(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name is empty", strings.Title(kind))
+	}
+	invalid := strings.ContainsAny(name, symbolDelimiters) || strings.Contains(name, "::") ||
+		strings.HasPrefix(name, "?") || strings.HasPrefix(name, "$?")
+	if _, err := strconv.ParseFloat(name, 64); err == nil {
+		// it would be read as a number
+		invalid = true
+	}
+	if invalid {
+		return fmt.Errorf(`Invalid %s name "%s"`, kind, name)
+	}
+	return nil
+}
+
+// validVariable returns an error unless v is a single or multifield variable
+func validVariable(v Expr) error {
+	name := strings.TrimPrefix(strings.TrimPrefix(string(v), "$"), "?")
+	if !strings.HasPrefix(string(v), "?") && !strings.HasPrefix(string(v), "$?") ||
+		name == "" || strings.ContainsAny(name, symbolDelimiters+"?$") {
+		return fmt.Errorf(`Invalid variable "%s"`, v)
+	}
+	return nil
+}
+
+// typeKeyword returns the name of a type as written in a type attribute
+func typeKeyword(typ Type) (string, error) {
+	if typ < 0 || int(typ) >= len(clipsTypes) || typ == MULTIFIELD {
+		return "", fmt.Errorf("Invalid slot type %d", typ)
+	}
+	return strings.Replace(typ.String(), "_", "-", -1), nil
+}
+
+// clipsString writes s as a CLIPS string
+func clipsString(s string) string {
+	ret, _ := clipsLiteral(s)
+	return ret
+}
+
+// valueSource writes a value as CLIPS source. Actions, such as a Call, are written as the
+// function calls they make
+func valueSource(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case Expr:
+		if strings.TrimSpace(string(v)) == "" {
+			return "", fmt.Errorf("Expression is empty")
+		}
+		return string(v), nil
+	case Action:
+		return v.actionSource()
+	}
+	return clipsLiteral(value)
+}
+
+// valuesSource writes values as CLIPS source separated by spaces, spreading slices
+func valuesSource(values ...interface{}) (string, error) {
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		val := reflect.ValueOf(value)
+		if _, ok := value.(Expr); !ok && (val.Kind() == reflect.Slice || val.Kind() == reflect.Array) {
+			for ii := 0; ii < val.Len(); ii++ {
+				item, err := valueSource(val.Index(ii).Interface())
+				if err != nil {
+					return "", err
+				}
+				items = append(items, item)
+			}
+			continue
+		}
+		item, err := valueSource(value)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, " "), nil
+}
+
+// slotValuesSource writes slot values as in " (a 1) (b x y)"
+func slotValuesSource(slots []SlotValue) (string, error) {
+	var b strings.Builder
+	for _, slot := range slots {
+		if err := validName("slot", slot.Name); err != nil {
+			return "", err
+		}
+		value, err := valuesSource(slot.Value)
+		if err != nil {
+			return "", fmt.Errorf(`Slot "%s": %v`, slot.Name, err)
+		}
+		if value == "" {
+			fmt.Fprintf(&b, " (%s)", slot.Name)
+		} else {
+			fmt.Fprintf(&b, " (%s %s)", slot.Name, value)
+		}
+	}
+	return b.String(), nil
+}
+
+// qualify returns name within module, or name alone if module is empty
+func qualify(module string, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "::" + name
+}
+
+// buildIn builds the sources, leaving the current module as it was. Constructs whose names
+// are qualified with a module are defined within that module
+func (env *Environment) buildIn(module string, sources ...string) error {
+	if module != "" {
+		if _, err := env.FindModule(module); err != nil {
+			return err
+		}
+	}
+	current := env.CurrentModule()
+	defer env.SetModule(current)
+	for _, src := range sources {
+		if err := env.Build(src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slotSpec is a slot of a template or class builder
+type slotSpec struct {
+	name   string
+	multi  bool
+	types  []Type
+	facets []slotFacet
+}
+
+type slotFacet struct {
+	name   string
+	values []interface{}
+}
+
+func (s *slotSpec) source(kind string) (string, error) {
+	if err := validName("slot", s.name); err != nil {
+		return "", err
+	}
+	keyword := "slot"
+	if s.multi {
+		keyword = "multislot"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "(%s %s", keyword, s.name)
+	if len(s.types) > 0 {
+		names := make([]string, len(s.types))
+		for ii, typ := range s.types {
+			name, err := typeKeyword(typ)
+			if err != nil {
+				return "", fmt.Errorf(`Slot "%s" of %s: %v`, s.name, kind, err)
+			}
+			names[ii] = name
+		}
+		fmt.Fprintf(&b, " (type %s)", strings.Join(names, " "))
+	}
+	for _, facet := range s.facets {
+		values, err := valuesSource(facet.values...)
+		if err != nil {
+			return "", fmt.Errorf(`Slot "%s" of %s: %v`, s.name, kind, err)
+		}
+		if values == "" {
+			fmt.Fprintf(&b, " (%s)", facet.name)
+		} else {
+			fmt.Fprintf(&b, " (%s %s)", facet.name, values)
+		}
+	}
+	b.WriteString(")")
+	return b.String(), nil
+}
+
+// slotList holds the slots of a template or class builder. Facets apply to the last slot added
+type slotList struct {
+	slots []*slotSpec
+	err   error
+}
+
+func (l *slotList) add(name string, multi bool, types []Type) {
+	l.slots = append(l.slots, &slotSpec{name: name, multi: multi, types: types})
+}
+
+func (l *slotList) facet(name string, values ...interface{}) {
+	if len(l.slots) == 0 {
+		if l.err == nil {
+			l.err = fmt.Errorf(`Facet "%s" given before any slot`, name)
+		}
+		return
+	}
+	slot := l.slots[len(l.slots)-1]
+	slot.facets = append(slot.facets, slotFacet{name: name, values: values})
+}
+
+func (l *slotList) cardinality(min int, max int) {
+	var high interface{} = max
+	if max < 0 {
+		high = Expr("?VARIABLE")
+	}
+	if l.err == nil && len(l.slots) > 0 && !l.slots[len(l.slots)-1].multi {
+		l.err = fmt.Errorf(`Cardinality given for single-field slot "%s"`, l.slots[len(l.slots)-1].name)
+	}
+	l.facet("cardinality", min, high)
+}
+
+func (l *slotList) source(kind string) ([]string, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	seen := make(map[string]bool)
+	ret := make([]string, 0, len(l.slots))
+	for _, slot := range l.slots {
+		if seen[slot.name] {
+			return nil, fmt.Errorf(`Slot "%s" of %s is defined twice`, slot.name, kind)
+		}
+		seen[slot.name] = true
+		src, err := slot.source(kind)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, src)
+	}
+	return ret, nil
+}
@@ -0,0 +1,214 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestTemplateBuilder(t *testing.T) {
+	t.Run("Source", func(t *testing.T) {
+		src, err := NewTemplate("order").Comment(`an "order"`).
+			Slot("id", INTEGER).Default(Expr("?NONE")).
+			Slot("state", SYMBOL).Allowed(Symbol("new"), Symbol("shipped")).Default(Symbol("new")).
+			Slot("total", INTEGER, FLOAT).Range(0, Expr("?VARIABLE")).
+			Multislot("items", SYMBOL, STRING).Cardinality(0, 10).Default().
+			Slot("customer", INSTANCE_NAME, FACT_ADDRESS).
+			Source()
+		assert.NilError(t, err)
+		assert.Equal(t, src, `(deftemplate order "an \"order\""
+   (slot id (type INTEGER) (default ?NONE))
+   (slot state (type SYMBOL) (allowed-values new shipped) (default new))
+   (slot total (type INTEGER FLOAT) (range 0 ?VARIABLE))
+   (multislot items (type SYMBOL STRING) (cardinality 0 10) (default))
+   (slot customer (type INSTANCE-NAME FACT-ADDRESS)))`)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		for _, tc := range []struct {
+			builder  *TemplateBuilder
+			expected string
+		}{
+			{NewTemplate(""), "Template name is empty"},
+			{NewTemplate("my order"), `Invalid template name "my order"`},
+			{NewTemplate("42"), `Invalid template name "42"`},
+			{NewTemplate("order").Slot("(id)"), `Invalid slot name "(id)"`},
+			{NewTemplate("order").Slot("id", MULTIFIELD), `Slot "id" of template "order": Invalid slot type 4`},
+			{NewTemplate("order").Slot("id").Slot("id"), `Slot "id" of template "order" is defined twice`},
+			{NewTemplate("order").Default(1), `Facet "default" given before any slot`},
+			{NewTemplate("order").Slot("id").Cardinality(1, 2), `Cardinality given for single-field slot "id"`},
+			{NewTemplate("order").Slot("id").Default(struct{}{}), `Slot "id" of template "order": Unable to write struct {} as a CLIPS value`},
+		} {
+			assert.Error(t, tc.builder.Validate(), tc.expected)
+		}
+	})
+
+	t.Run("Build", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		tmpl, err := NewTemplate("order").Slot("id", INTEGER).Multislot("items").Build(env, "")
+		assert.NilError(t, err)
+		assert.Equal(t, tmpl.Name(), "order")
+		assert.Equal(t, len(tmpl.Slots()), 2)
+
+		err = env.Build(`(defmodule SHIPPING (export ?ALL))`)
+		assert.NilError(t, err)
+		main, err := env.FindModule("MAIN")
+		assert.NilError(t, err)
+		env.SetModule(main)
+
+		tmpl, err = NewTemplate("parcel").Slot("weight", FLOAT).Build(env, "SHIPPING")
+		assert.NilError(t, err)
+		assert.Equal(t, tmpl.Module().Name(), "SHIPPING")
+		assert.Equal(t, env.CurrentModule().Name(), "MAIN")
+
+		_, err = NewTemplate("parcel").Build(env, "NOWHERE")
+		assert.ErrorContains(t, err, `Module "NOWHERE" not found`)
+	})
+}
+
+func TestClassBuilder(t *testing.T) {
+	t.Run("Source", func(t *testing.T) {
+		src, err := NewClass("Person").IsA("USER").Comment("a person").
+			Slot("name", STRING).Facet("access", "initialize-only").
+			Slot("age", INTEGER).Default(0).Facet("visibility", "public").
+			Multislot("tags").
+			Handler("greet", PRIMARY, []string{"greeting"}, Printout("t", Var("greeting"), " ", Expr("?self:name"), Symbol("crlf"))).
+			Source()
+		assert.NilError(t, err)
+		assert.Equal(t, src, `(defclass Person "a person"
+   (is-a USER)
+   (slot name (type STRING) (access initialize-only))
+   (slot age (type INTEGER) (default 0) (visibility public))
+   (multislot tags))
+
+(defmessage-handler Person greet primary (?greeting)
+   (printout t ?greeting " " ?self:name crlf))`)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		for _, tc := range []struct {
+			builder  *ClassBuilder
+			expected string
+		}{
+			{NewClass("Person").Slot("name").Facet("access", "write-only"), `Invalid facet (access write-only)`},
+			{NewClass("Person").Slot("name").Facet("color", "red"), `Invalid facet (color red)`},
+			{NewClass("Person").IsA("a b"), `Invalid class name "a b"`},
+			{NewClass("Person").Handler("greet", "sideways", nil), `class "Person": Invalid type "sideways" of message handler "greet"`},
+			{NewClass("Person").Handler("greet", PRIMARY, []string{"$?rest", "x"}),
+				`class "Person": Message handler "greet": wildcard parameter "$?rest" must be last`},
+		} {
+			assert.Error(t, tc.builder.Validate(), tc.expected)
+		}
+	})
+
+	t.Run("Build", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		class, err := NewClass("Animal").Abstract().Slot("name", STRING).Build(env, "")
+		assert.NilError(t, err)
+		assert.Assert(t, class.Abstract())
+
+		class, err = NewClass("Dog").IsA("Animal").
+			Slot("legs", INTEGER).Default(4).Facet("create-accessor", "read-write").
+			Handler("describe", PRIMARY, nil, Expr("(str-cat ?self:name \" has \" ?self:legs \" legs\")")).
+			Build(env, "")
+		assert.NilError(t, err)
+		assert.Equal(t, len(class.Slots(true)), 2)
+
+		inst, err := class.NewInstance("rex", false)
+		assert.NilError(t, err)
+		assert.NilError(t, inst.SetSlot("name", "Rex"))
+		assert.Equal(t, inst.Send("describe", ""), "Rex has 4 legs")
+	})
+}
+
+func TestRuleBuilder(t *testing.T) {
+	t.Run("Source", func(t *testing.T) {
+		src, err := NewRule("ship").Comment("ship new orders").Salience(10).AutoFocus(true).
+			When(
+				Pattern("order", With("id", Var("id")), With("state", Symbol("new"))).As("o"),
+				OrderedPattern("stock", Var("id"), Expr("?n&:(> ?n 0)")),
+				Not(Pattern("hold", With("order", Var("id")))),
+				Test(Expr("(< ?id 100)")),
+			).
+			Then(
+				Modify("o", With("state", Symbol("shipped"))),
+				Assert("shipment", With("order", Var("id")), With("items", []interface{}{Symbol("a"), "b"})),
+				AssertOrdered("shipped", Var("id")),
+				Bind("count", Call("+", Var("count"), 1)),
+				Printout("t", "Shipped ", Var("id"), Symbol("crlf")),
+			).
+			Source()
+		assert.NilError(t, err)
+		assert.Equal(t, src, `(defrule ship "ship new orders"
+   (declare (salience 10) (auto-focus TRUE))
+   ?o <- (order (id ?id) (state new))
+   (stock ?id ?n&:(> ?n 0))
+   (not (hold (order ?id)))
+   (test (< ?id 100))
+   =>
+   (modify ?o (state shipped))
+   (assert (shipment (order ?id) (items a "b")))
+   (assert (shipped ?id))
+   (bind ?count (+ ?count 1))
+   (printout t "Shipped " ?id crlf))`)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		for _, tc := range []struct {
+			builder  *RuleBuilder
+			expected string
+		}{
+			{NewRule("r").Salience(20000), `Salience 20000 of rule "r" is outside -10000 to 10000`},
+			{NewRule("r").When(Pattern("order").As("?")), `Rule "r": Invalid variable "?"`},
+			{NewRule("r").When(And()), `Rule "r": Empty "and" conditional element`},
+			{NewRule("r").Then(Retract()), `Rule "r": Action "retract": No facts to retract`},
+			{NewRule("r").Then(Modify("bad var")), `Rule "r": Action "modify": Invalid variable "?bad var"`},
+			{NewRule("r").Then(Call("(oops)")), `Rule "r": Action "(oops)": Invalid function name "(oops)"`},
+		} {
+			assert.Error(t, tc.builder.Validate(), tc.expected)
+		}
+	})
+
+	t.Run("Build", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := NewTemplate("order").Slot("id", INTEGER).Slot("state", SYMBOL).Build(env, "")
+		assert.NilError(t, err)
+		rule, err := NewRule("ship").Salience(10).
+			When(Pattern("order", With("state", Symbol("new"))).As("o")).
+			Then(Modify("o", With("state", Symbol("shipped")))).
+			Build(env, "")
+		assert.NilError(t, err)
+		assert.Equal(t, rule.Name(), "ship")
+
+		_, err = env.AssertString(`(order (id 1) (state new))`)
+		assert.NilError(t, err)
+		assert.Equal(t, env.Run(-1), int64(1))
+		facts, err := env.FindFacts("order", SlotEquals("state", Symbol("shipped")))
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 1)
+
+		// CLIPS itself reports rules which don't make sense
+		_, err = NewRule("broken").When(Pattern("nosuch", With("a", 1))).Build(env, "")
+		assert.Assert(t, err != nil)
+	})
+}
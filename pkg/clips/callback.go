@@ -30,13 +30,13 @@ func printError(env *Environment, err string) {
 	fullerr := fmt.Sprintf("\nERROR: \n%s\n", err)
 	cerr := C.CString(fullerr)
 	defer C.free(unsafe.Pointer(werror))
-	C.EnvPrintRouter(env.env, werror, cerr)
-	C.SetEvaluationError(env.env, 1)
+	C.EnvPrintRouter(env.ptr(), werror, cerr)
+	C.SetEvaluationError(env.ptr(), 1)
 }
 
 //export goFunction
 func goFunction(envptr unsafe.Pointer, dataObject *C.struct_dataObject) {
-	env, ok := environmentObj[envptr]
+	env, ok := lookupEnvironment(envptr)
 	if !ok {
 		panic("Got a callback from an unknown environment")
 	}
@@ -58,25 +58,31 @@ func goFunction(envptr unsafe.Pointer, dataObject *C.struct_dataObject) {
 		printError(env, "Unexpected argument type in callback")
 		return
 	}
+	stats := env.stats.callback(string(funcname))
+	stats.calls++
+	fail := func(err string) {
+		stats.errors++
+		printError(env, err)
+	}
 	fn, ok := env.callback[string(funcname)]
 	if !ok {
-		printError(env, fmt.Sprintf(`Unknown callback name "%s"`, funcname))
+		fail(fmt.Sprintf(`Unknown callback name "%s"`, funcname))
 		return
 	}
 
 	typ := fn.Type()
 	if !typ.IsVariadic() {
 		if argnum < typ.NumIn() {
-			printError(env, fmt.Sprintf(`Not enough arguments to "%s"`, funcname))
+			fail(fmt.Sprintf(`Not enough arguments to "%s"`, funcname))
 			return
 		}
 		if argnum > typ.NumIn() {
-			printError(env, fmt.Sprintf(`Too many arguments to "%s"`, funcname))
+			fail(fmt.Sprintf(`Too many arguments to "%s"`, funcname))
 			return
 		}
 	} else {
 		if argnum < typ.NumIn()-1 {
-			printError(env, fmt.Sprintf(`Not enough arguments to "%s"`, funcname))
+			fail(fmt.Sprintf(`Not enough arguments to "%s"`, funcname))
 			return
 		}
 	}
@@ -101,7 +107,7 @@ func goFunction(envptr unsafe.Pointer, dataObject *C.struct_dataObject) {
 		arg := temp.Value()
 		err := env.convertArg(paramVal, reflect.ValueOf(arg), true, knownInstances)
 		if err != nil {
-			printError(env, fmt.Sprintf("error calling function %s: %v", funcname, err.Error()))
+			fail(fmt.Sprintf("error calling function %s: %v", funcname, err.Error()))
 			return
 		}
 		arguments = append(arguments, paramVal)
@@ -117,7 +123,7 @@ func goFunction(envptr unsafe.Pointer, dataObject *C.struct_dataObject) {
 		// if it is, treat it as an error not a return
 		if !errVal.IsNil() {
 			err := errVal.MethodByName("Error").Call([]reflect.Value{})
-			printError(env, fmt.Sprintf(`Error from user function: %s: %s`,
+			fail(fmt.Sprintf(`Error from user function: %s: %s`,
 				errVal.Type().String(), err))
 			return
 		}
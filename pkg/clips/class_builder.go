@@ -0,0 +1,274 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// classFacets lists the values allowed for each facet which Facet may set. The value of
+// override-message is the name of a message
+var classFacets = map[string][]string{
+	"storage":          {"local", "shared"},
+	"access":           {"read-write", "read-only", "initialize-only"},
+	"propagation":      {"inherit", "no-inherit"},
+	"source":           {"exclusive", "composite"},
+	"pattern-match":    {"reactive", "non-reactive"},
+	"visibility":       {"private", "public"},
+	"create-accessor":  {"?NONE", "read", "write", "read-write"},
+	"override-message": nil,
+}
+
+// ClassBuilder builds a defclass, and its message handlers, from Go. Facets such as Default
+// apply to the slot added last
+type ClassBuilder struct {
+	slotList
+	name         string
+	comment      string
+	superclasses []string
+	role         string
+	patternMatch string
+	handlers     []*handlerSpec
+}
+
+type handlerSpec struct {
+	name    string
+	htype   MessageHandlerType
+	params  []string
+	actions []Action
+}
+
+// NewClass returns a builder for a defclass of the given name. Unless IsA is called, the
+// class inherits from USER
+func NewClass(name string) *ClassBuilder {
+	return &ClassBuilder{name: name}
+}
+
+// Comment sets the comment of the class
+func (c *ClassBuilder) Comment(text string) *ClassBuilder {
+	c.comment = text
+	return c
+}
+
+// IsA sets the superclasses of the class
+func (c *ClassBuilder) IsA(superclasses ...string) *ClassBuilder {
+	c.superclasses = superclasses
+	return c
+}
+
+// Abstract makes the class abstract, so that it cannot have direct instances
+func (c *ClassBuilder) Abstract() *ClassBuilder {
+	c.role = "abstract"
+	return c
+}
+
+// Reactive sets whether instances of the class can match object patterns
+func (c *ClassBuilder) Reactive(reactive bool) *ClassBuilder {
+	c.patternMatch = "non-reactive"
+	if reactive {
+		c.patternMatch = "reactive"
+	}
+	return c
+}
+
+// Slot adds a single-field slot accepting the given types, or any type if none are given
+func (c *ClassBuilder) Slot(name string, types ...Type) *ClassBuilder {
+	c.add(name, false, types)
+	return c
+}
+
+// Multislot adds a multifield slot whose values are of the given types, or any type if none
+// are given
+func (c *ClassBuilder) Multislot(name string, types ...Type) *ClassBuilder {
+	c.add(name, true, types)
+	return c
+}
+
+// Default sets the default value of the last slot. Expr("?NONE") makes the slot required
+func (c *ClassBuilder) Default(values ...interface{}) *ClassBuilder {
+	c.facet("default", values...)
+	return c
+}
+
+// DefaultDynamic sets an expression evaluated for the last slot each time an instance is made
+func (c *ClassBuilder) DefaultDynamic(expr Expr) *ClassBuilder {
+	c.facet("default-dynamic", expr)
+	return c
+}
+
+// Allowed restricts the last slot to the given values
+func (c *ClassBuilder) Allowed(values ...interface{}) *ClassBuilder {
+	c.facet("allowed-values", values...)
+	return c
+}
+
+// Range restricts the last slot to numbers between low and high. Expr("?VARIABLE") leaves a
+// bound open
+func (c *ClassBuilder) Range(low interface{}, high interface{}) *ClassBuilder {
+	c.facet("range", low, high)
+	return c
+}
+
+// Cardinality restricts the number of values of the last slot, which must be a multislot. A
+// negative max leaves the number unbounded
+func (c *ClassBuilder) Cardinality(min int, max int) *ClassBuilder {
+	c.cardinality(min, max)
+	return c
+}
+
+// Facet sets a COOL facet of the last slot, such as Facet("access", "read-only") or
+// Facet("visibility", "public")
+func (c *ClassBuilder) Facet(name string, value string) *ClassBuilder {
+	allowed, ok := classFacets[name]
+	valid := ok && (containsString(allowed, value) || allowed == nil && validName("message", value) == nil)
+	if !valid && c.err == nil {
+		c.err = fmt.Errorf(`Invalid facet (%s %s)`, name, value)
+	}
+	c.facet(name, Expr(value))
+	return c
+}
+
+// Handler adds a message handler to the class. params are the names of its parameters, the
+// last of which may be a multifield wildcard such as $?rest
+func (c *ClassBuilder) Handler(name string, htype MessageHandlerType, params []string, actions ...Action) *ClassBuilder {
+	c.handlers = append(c.handlers, &handlerSpec{name: name, htype: htype, params: params, actions: actions})
+	return c
+}
+
+// Validate checks the names, types and facets of the class and its handlers
+func (c *ClassBuilder) Validate() error {
+	_, err := c.sources("")
+	return err
+}
+
+// Source returns the defclass, followed by its defmessage-handlers, as CLIPS source
+func (c *ClassBuilder) Source() (string, error) {
+	sources, err := c.sources("")
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(sources, "\n\n"), nil
+}
+
+func (c *ClassBuilder) sources(module string) ([]string, error) {
+	if err := validName("class", c.name); err != nil {
+		return nil, err
+	}
+	kind := fmt.Sprintf(`class "%s"`, c.name)
+	slots, err := c.slotList.source(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "(defclass %s", qualify(module, c.name))
+	if c.comment != "" {
+		fmt.Fprintf(&b, " %s", clipsString(c.comment))
+	}
+	superclasses := c.superclasses
+	if len(superclasses) == 0 {
+		superclasses = []string{"USER"}
+	}
+	for _, super := range superclasses {
+		if err := validName("class", strings.TrimPrefix(super, moduleOf(super))); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintf(&b, "\n   (is-a %s)", strings.Join(superclasses, " "))
+	if c.role != "" {
+		fmt.Fprintf(&b, "\n   (role %s)", c.role)
+	}
+	if c.patternMatch != "" {
+		fmt.Fprintf(&b, "\n   (pattern-match %s)", c.patternMatch)
+	}
+	for _, slot := range slots {
+		fmt.Fprintf(&b, "\n   %s", slot)
+	}
+	b.WriteString(")")
+
+	ret := []string{b.String()}
+	for _, h := range c.handlers {
+		src, err := h.source(qualify(module, c.name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", kind, err)
+		}
+		ret = append(ret, src)
+	}
+	return ret, nil
+}
+
+// moduleOf returns the module qualifier of a name, such as "MAIN::" for MAIN::foo
+func moduleOf(name string) string {
+	if idx := strings.Index(name, "::"); idx >= 0 {
+		return name[:idx+2]
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *handlerSpec) source(class string) (string, error) {
+	if err := validName("message handler", h.name); err != nil {
+		return "", err
+	}
+	switch h.htype {
+	case PRIMARY, AROUND, BEFORE, AFTER:
+	default:
+		return "", fmt.Errorf(`Invalid type "%s" of message handler "%s"`, h.htype, h.name)
+	}
+	params := make([]string, len(h.params))
+	for ii, param := range h.params {
+		v := Var(param)
+		if err := validVariable(v); err != nil {
+			return "", fmt.Errorf(`Message handler "%s": %v`, h.name, err)
+		}
+		if strings.HasPrefix(string(v), "$?") && ii != len(h.params)-1 {
+			return "", fmt.Errorf(`Message handler "%s": wildcard parameter "%s" must be last`, h.name, v)
+		}
+		params[ii] = string(v)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "(defmessage-handler %s %s %s (%s)", class, h.name, h.htype, strings.Join(params, " "))
+	for _, action := range h.actions {
+		src, err := action.actionSource()
+		if err != nil {
+			return "", fmt.Errorf(`Message handler "%s": %v`, h.name, err)
+		}
+		fmt.Fprintf(&b, "\n   %s", src)
+	}
+	b.WriteString(")")
+	return b.String(), nil
+}
+
+// Build defines the class and its message handlers within the named module, or the current
+// module if module is empty. The current module is left unchanged
+func (c *ClassBuilder) Build(env *Environment, module string) (*Class, error) {
+	sources, err := c.sources(module)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.buildIn(module, sources...); err != nil {
+		return nil, err
+	}
+	return env.FindClass(qualify(module, c.name))
+}
@@ -21,7 +21,8 @@ import (
 	"unsafe"
 )
 
-// ClassSlot is a reference to a slot within a particular class
+// ClassSlot is a reference to a slot within a particular class. Its methods give zero values
+// once the class is stale, and panic with ErrEnvironmentClosed after the environment is deleted
 type ClassSlot struct {
 	class *Class
 	name  string
@@ -50,9 +51,12 @@ func (cs *ClassSlot) Equal(other *ClassSlot) bool {
 
 // Public returns true if the slot is public
 func (cs *ClassSlot) Public() bool {
+	if !valid(cs.class.check()) {
+		return false
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvSlotPublicP(cs.class.env.env, cs.class.clptr, cname)
+	ret := C.EnvSlotPublicP(cs.class.env.ptr(), cs.class.clptr, cname)
 	if ret == 1 {
 		return true
 	}
@@ -61,9 +65,12 @@ func (cs *ClassSlot) Public() bool {
 
 // Initable returns true if the slot is initable
 func (cs *ClassSlot) Initable() bool {
+	if !valid(cs.class.check()) {
+		return false
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvSlotInitableP(cs.class.env.env, cs.class.clptr, cname)
+	ret := C.EnvSlotInitableP(cs.class.env.ptr(), cs.class.clptr, cname)
 	if ret == 1 {
 		return true
 	}
@@ -72,9 +79,12 @@ func (cs *ClassSlot) Initable() bool {
 
 // Writable returns true if the slot is writable
 func (cs *ClassSlot) Writable() bool {
+	if !valid(cs.class.check()) {
+		return false
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvSlotWritableP(cs.class.env.env, cs.class.clptr, cname)
+	ret := C.EnvSlotWritableP(cs.class.env.ptr(), cs.class.clptr, cname)
 	if ret == 1 {
 		return true
 	}
@@ -83,9 +93,12 @@ func (cs *ClassSlot) Writable() bool {
 
 // Accessible returns true if the slot is accessible
 func (cs *ClassSlot) Accessible() bool {
+	if !valid(cs.class.check()) {
+		return false
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvSlotDirectAccessP(cs.class.env.env, cs.class.clptr, cname)
+	ret := C.EnvSlotDirectAccessP(cs.class.env.ptr(), cs.class.clptr, cname)
 	if ret == 1 {
 		return true
 	}
@@ -94,11 +107,14 @@ func (cs *ClassSlot) Accessible() bool {
 
 // Types returns a list of value types for this slot. Equivalent to slot-types
 func (cs *ClassSlot) Types() []Symbol {
+	if !valid(cs.class.check()) {
+		return nil
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
-	C.EnvSlotTypes(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotTypes(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 
 	types, ok := data.Value().([]interface{})
 	if !ok {
@@ -117,11 +133,14 @@ func (cs *ClassSlot) Types() []Symbol {
 
 // Sources returns a list of names of class sources for this slot. Equivalent to slot-sources
 func (cs *ClassSlot) Sources() []Symbol {
+	if !valid(cs.class.check()) {
+		return nil
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
-	C.EnvSlotSources(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotSources(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 
 	sources, ok := data.Value().([]interface{})
 	if !ok {
@@ -140,12 +159,15 @@ func (cs *ClassSlot) Sources() []Symbol {
 
 // IntRange returns the numeric range for the slot for integer values - e.g. low, haslow, high, hashigh := ts.Range()
 func (cs *ClassSlot) IntRange() (low int64, hasLow bool, high int64, hasHigh bool) {
+	if !valid(cs.class.check()) {
+		return
+	}
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvSlotRange(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotRange(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok {
@@ -164,12 +186,15 @@ func (cs *ClassSlot) IntRange() (low int64, hasLow bool, high int64, hasHigh boo
 
 // FloatRange returns the numeric range for the slot for floating point values - e.g. low, haslow, high, hashigh := ts.Range()
 func (cs *ClassSlot) FloatRange() (low float64, hasLow bool, high float64, hasHigh bool) {
+	if !valid(cs.class.check()) {
+		return
+	}
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvSlotRange(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotRange(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok {
@@ -188,11 +213,14 @@ func (cs *ClassSlot) FloatRange() (low float64, hasLow bool, high float64, hasHi
 
 // Facets returns a list of facets for this slot
 func (cs *ClassSlot) Facets() []Symbol {
+	if !valid(cs.class.check()) {
+		return nil
+	}
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
-	C.EnvSlotFacets(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotFacets(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 
 	facets, ok := data.Value().([]interface{})
 	if !ok {
@@ -211,12 +239,15 @@ func (cs *ClassSlot) Facets() []Symbol {
 
 // Cardinality returns the cardinality for the slot
 func (cs *ClassSlot) Cardinality() (low int64, high int64, hasHigh bool) {
+	if !valid(cs.class.check()) {
+		return
+	}
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvSlotCardinality(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotCardinality(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok || len(ilist) != 2 {
@@ -229,23 +260,29 @@ func (cs *ClassSlot) Cardinality() (low int64, high int64, hasHigh bool) {
 
 // DefaultValue returns a default value for the slot.  (This might be a new, unique value for DYNAMIC_DEFAULT defaults)
 func (cs *ClassSlot) DefaultValue() interface{} {
+	if !valid(cs.class.check()) {
+		return nil
+	}
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvSlotDefaultValue(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotDefaultValue(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 	return data.Value()
 }
 
 // AllowedValues returns the set of allowed values for this slot, if specified
 func (cs *ClassSlot) AllowedValues() (values []interface{}, ok bool) {
+	if !valid(cs.class.check()) {
+		return
+	}
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvSlotAllowedValues(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotAllowedValues(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 	dv := data.Value()
 	values, ok = dv.([]interface{})
 	return
@@ -253,12 +290,15 @@ func (cs *ClassSlot) AllowedValues() (values []interface{}, ok bool) {
 
 // AllowedClasses returns the names of allowed classes for this slot, if specified. Equivalent to slot-allowed-classes
 func (cs *ClassSlot) AllowedClasses() (values []Symbol, ok bool) {
+	if !valid(cs.class.check()) {
+		return
+	}
 	data := createDataObject(cs.class.env)
 	defer data.Delete()
 	cname := C.CString(cs.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvSlotAllowedClasses(cs.class.env.env, cs.class.clptr, cname, data.byRef())
+	C.EnvSlotAllowedClasses(cs.class.env.ptr(), cs.class.clptr, cname, data.byRef())
 	dv := data.Value()
 	ret, ok := dv.([]interface{})
 	if !ok {
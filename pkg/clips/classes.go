@@ -23,16 +23,24 @@ import (
 	"unsafe"
 )
 
-// Class is a reference to a CLIPS class
+// Class is a reference to a CLIPS class. Like every Construct, its methods without an error
+// result panic with ErrEnvironmentClosed after the environment is deleted
 type Class struct {
-	env   *Environment
-	clptr unsafe.Pointer
+	env     *Environment
+	clptr   unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
 }
 
-// MessageHandler is a reference to a messagehandler for a particular class
+// MessageHandler is a reference to a messagehandler for a particular class. It is stale once
+// undefined or once its class is, and like the class, panics with ErrEnvironmentClosed from
+// methods without an error result after the environment is deleted
 type MessageHandler struct {
-	class *Class
-	index C.int
+	class       *Class
+	index       C.int
+	name        string
+	handlerType MessageHandlerType
 }
 
 // ClassDefaultsMode defines the mode for defaults in a class
@@ -68,31 +76,34 @@ const (
 
 // ClassDefaultsMode returns the current class defaults mode. Equivalent to (get-class-defaults-mode)
 func (env *Environment) ClassDefaultsMode() ClassDefaultsMode {
-	ret := C.EnvGetClassDefaultsMode(env.env)
+	ret := C.EnvGetClassDefaultsMode(env.ptr())
 	return ClassDefaultsMode(ret)
 }
 
 // SetClassDefaultsMode sets the class defaults mode
 func (env *Environment) SetClassDefaultsMode(mode ClassDefaultsMode) {
-	C.EnvSetClassDefaultsMode(env.env, mode.CVal())
+	C.EnvSetClassDefaultsMode(env.ptr(), mode.CVal())
 }
 
 // Classes returns the set of defined classes
 func (env *Environment) Classes() []*Class {
-	clptr := C.EnvGetNextDefclass(env.env, nil)
+	clptr := C.EnvGetNextDefclass(env.ptr(), nil)
 	ret := make([]*Class, 0, 10)
 	for clptr != nil {
 		ret = append(ret, createClass(env, clptr))
-		clptr = C.EnvGetNextDefclass(env.env, clptr)
+		clptr = C.EnvGetNextDefclass(env.ptr(), clptr)
 	}
 	return ret
 }
 
 // FindClass returns a reference to the given class
 func (env *Environment) FindClass(name string) (*Class, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	clptr := C.EnvFindDefclass(env.env, cname)
+	clptr := C.EnvFindDefclass(env.ptr(), cname)
 	if clptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Class "%s" not found`, name))
 	}
@@ -101,19 +112,33 @@ func (env *Environment) FindClass(name string) (*Class, error) {
 
 func createClass(env *Environment, clptr unsafe.Pointer) *Class {
 	return &Class{
-		env:   env,
-		clptr: clptr,
+		env:     env,
+		clptr:   clptr,
+		name:    C.GoString(C.EnvGetDefclassName(env.ptr(), clptr)),
+		module:  C.GoString(C.EnvDefclassModule(env.ptr(), clptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the class can no longer be used. A class is
+// stale once undefined or cleared
+func (cl *Class) check() error {
+	return checkConstruct(cl.env, DEFCLASS, cl.clptr, qualify(cl.module, cl.name), cl.cleared)
+}
+
 // Name returns the name of this class
 func (cl *Class) Name() string {
-	ret := C.EnvGetDefclassName(cl.env.env, cl.clptr)
-	return C.GoString(ret)
+	if err := cl.env.check(); err != nil {
+		panic(err)
+	}
+	return cl.name
 }
 
 func (cl *Class) String() string {
-	ret := C.EnvGetDefclassPPForm(cl.env.env, cl.clptr)
+	if !valid(cl.check()) {
+		return fmt.Sprintf("<Class-%s stale>", cl.name)
+	}
+	ret := C.EnvGetDefclassPPForm(cl.env.ptr(), cl.clptr)
 	if ret == nil {
 		return ""
 	}
@@ -127,7 +152,10 @@ func (cl *Class) Equal(other *Class) bool {
 
 // Abstract returns true if the class is abstract
 func (cl *Class) Abstract() bool {
-	ret := C.EnvClassAbstractP(cl.env.env, cl.clptr)
+	if !valid(cl.check()) {
+		return false
+	}
+	ret := C.EnvClassAbstractP(cl.env.ptr(), cl.clptr)
 	if ret == 1 {
 		return true
 	}
@@ -136,23 +164,32 @@ func (cl *Class) Abstract() bool {
 
 // Reactive returns true if the class is reactive
 func (cl *Class) Reactive() bool {
-	ret := C.EnvClassReactiveP(cl.env.env, cl.clptr)
+	if !valid(cl.check()) {
+		return false
+	}
+	ret := C.EnvClassReactiveP(cl.env.ptr(), cl.clptr)
 	if ret == 1 {
 		return true
 	}
 	return false
 }
 
-// Module returns the module in which this class is defined
+// Module returns the module in which this class is defined, or nil if the class is stale
 func (cl *Class) Module() *Module {
-	modname := C.EnvDefclassModule(cl.env.env, cl.clptr)
-	modptr := C.EnvFindDefmodule(cl.env.env, modname)
+	if !valid(cl.check()) {
+		return nil
+	}
+	modname := C.EnvDefclassModule(cl.env.ptr(), cl.clptr)
+	modptr := C.EnvFindDefmodule(cl.env.ptr(), modname)
 	return createModule(cl.env, modptr)
 }
 
 // Deletable returns true if the class is unreferenced and therefore deletable
 func (cl *Class) Deletable() bool {
-	ret := C.EnvIsDefclassDeletable(cl.env.env, cl.clptr)
+	if !valid(cl.check()) {
+		return false
+	}
+	ret := C.EnvIsDefclassDeletable(cl.env.ptr(), cl.clptr)
 	if ret == 1 {
 		return true
 	}
@@ -161,7 +198,10 @@ func (cl *Class) Deletable() bool {
 
 // WatchedInstances returns true if the class instances are being watched
 func (cl *Class) WatchedInstances() bool {
-	ret := C.EnvGetDefclassWatchInstances(cl.env.env, cl.clptr)
+	if !valid(cl.check()) {
+		return false
+	}
+	ret := C.EnvGetDefclassWatchInstances(cl.env.ptr(), cl.clptr)
 	if ret == 1 {
 		return true
 	}
@@ -170,16 +210,22 @@ func (cl *Class) WatchedInstances() bool {
 
 // WatchInstances sets whether instances of this class should be watched
 func (cl *Class) WatchInstances(val bool) {
+	if !valid(cl.check()) {
+		return
+	}
 	var flag C.uint
 	if val {
 		flag = 1
 	}
-	C.EnvSetDefclassWatchInstances(cl.env.env, flag, cl.clptr)
+	C.EnvSetDefclassWatchInstances(cl.env.ptr(), flag, cl.clptr)
 }
 
 // WatchedSlots returns true if the class slots are being watched
 func (cl *Class) WatchedSlots() bool {
-	ret := C.EnvGetDefclassWatchSlots(cl.env.env, cl.clptr)
+	if !valid(cl.check()) {
+		return false
+	}
+	ret := C.EnvGetDefclassWatchSlots(cl.env.ptr(), cl.clptr)
 	if ret == 1 {
 		return true
 	}
@@ -188,17 +234,23 @@ func (cl *Class) WatchedSlots() bool {
 
 // WatchSlots sets whether instances of this class should be watched
 func (cl *Class) WatchSlots(val bool) {
+	if !valid(cl.check()) {
+		return
+	}
 	var flag C.uint
 	if val {
 		flag = 1
 	}
-	C.EnvSetDefclassWatchSlots(cl.env.env, flag, cl.clptr)
+	C.EnvSetDefclassWatchSlots(cl.env.ptr(), flag, cl.clptr)
 }
 
 // NewInstance creates an instance of this class. If skipInit is true, a new,
 // uninitialized instance of this class. Slots will be unset until the caller
 // calls SetSlot on each one, or calls (initialize-instance [instname])
 func (cl *Class) NewInstance(name string, skipInit bool) (*Instance, error) {
+	if err := cl.check(); err != nil {
+		return nil, err
+	}
 	if !skipInit {
 		var cmd string
 		if name == "" {
@@ -215,7 +267,7 @@ func (cl *Class) NewInstance(name string, skipInit bool) (*Instance, error) {
 	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	instptr := C.EnvCreateRawInstance(cl.env.env, cl.clptr, cname)
+	instptr := C.EnvCreateRawInstance(cl.env.ptr(), cl.clptr, cname)
 	if instptr == nil {
 		return nil, EnvError(cl.env, "Unable to create instance")
 	}
@@ -224,23 +276,29 @@ func (cl *Class) NewInstance(name string, skipInit bool) (*Instance, error) {
 
 // MessageHandlers returns a list of all message handlers for this class
 func (cl *Class) MessageHandlers() []*MessageHandler {
-	index := C.EnvGetNextDefmessageHandler(cl.env.env, cl.clptr, 0)
+	if !valid(cl.check()) {
+		return nil
+	}
+	index := C.EnvGetNextDefmessageHandler(cl.env.ptr(), cl.clptr, 0)
 
 	ret := make([]*MessageHandler, 0, 10)
 	for index != 0 {
 		ret = append(ret, createMessageHandler(cl, index))
-		index = C.EnvGetNextDefmessageHandler(cl.env.env, cl.clptr, index)
+		index = C.EnvGetNextDefmessageHandler(cl.env.ptr(), cl.clptr, index)
 	}
 	return ret
 }
 
 // FindMessageHandler returns a reference to the named message handler
 func (cl *Class) FindMessageHandler(name string, handlerType MessageHandlerType) (*MessageHandler, error) {
+	if err := cl.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	chandler := C.CString(string(handlerType))
 	defer C.free(unsafe.Pointer(chandler))
-	index := C.EnvFindDefmessageHandler(cl.env.env, cl.clptr, cname, chandler)
+	index := C.EnvFindDefmessageHandler(cl.env.ptr(), cl.clptr, cname, chandler)
 	if index == 0 {
 		return nil, EnvError(cl.env, `MessageHandler "%s" of type "%s" not found`, name, handlerType)
 	}
@@ -249,10 +307,13 @@ func (cl *Class) FindMessageHandler(name string, handlerType MessageHandlerType)
 
 // Subclass returns true if this class is a subclass of the given one
 func (cl *Class) Subclass(other *Class) bool {
+	if cl.check() != nil || other.check() != nil {
+		return false
+	}
 	if cl.env != other.env {
 		return false
 	}
-	ret := C.EnvSubclassP(cl.env.env, cl.clptr, other.clptr)
+	ret := C.EnvSubclassP(cl.env.ptr(), cl.clptr, other.clptr)
 	if ret == 1 {
 		return true
 	}
@@ -261,10 +322,13 @@ func (cl *Class) Subclass(other *Class) bool {
 
 // Superclass returns true if this class is a superclass of the given one
 func (cl *Class) Superclass(other *Class) bool {
+	if cl.check() != nil || other.check() != nil {
+		return false
+	}
 	if cl.env != other.env {
 		return false
 	}
-	ret := C.EnvSuperclassP(cl.env.env, cl.clptr, other.clptr)
+	ret := C.EnvSuperclassP(cl.env.ptr(), cl.clptr, other.clptr)
 	if ret == 1 {
 		return true
 	}
@@ -273,6 +337,9 @@ func (cl *Class) Superclass(other *Class) bool {
 
 // Slots returns a list of all slots for this class. inhereted determines whether inhereted slots are included
 func (cl *Class) Slots(inherited bool) []*ClassSlot {
+	if !valid(cl.check()) {
+		return nil
+	}
 	data := createDataObject(cl.env)
 	defer data.Delete()
 
@@ -281,7 +348,7 @@ func (cl *Class) Slots(inherited bool) []*ClassSlot {
 		flag = 1
 	}
 
-	C.EnvClassSlots(cl.env.env, cl.clptr, data.byRef(), flag)
+	C.EnvClassSlots(cl.env.ptr(), cl.clptr, data.byRef(), flag)
 	dv := data.Value()
 	slots, ok := dv.([]interface{})
 	if !ok {
@@ -302,6 +369,9 @@ func (cl *Class) Slots(inherited bool) []*ClassSlot {
 
 // Slot returns the given slot by name
 func (cl *Class) Slot(name string) (*ClassSlot, error) {
+	if err := cl.check(); err != nil {
+		return nil, err
+	}
 	slots := cl.Slots(true)
 	for _, slot := range slots {
 		if slot.Name() == name {
@@ -313,18 +383,45 @@ func (cl *Class) Slot(name string) (*ClassSlot, error) {
 
 // Instances returns the list of instances of this class
 func (cl *Class) Instances() []*Instance {
-	instptr := C.EnvGetNextInstanceInClass(cl.env.env, cl.clptr, nil)
+	if !valid(cl.check()) {
+		return nil
+	}
+	instptr := C.EnvGetNextInstanceInClass(cl.env.ptr(), cl.clptr, nil)
 
 	ret := make([]*Instance, 0, 10)
 	for instptr != nil {
 		ret = append(ret, createInstance(cl.env, instptr))
-		instptr = C.EnvGetNextInstanceInClass(cl.env.env, cl.clptr, instptr)
+		instptr = C.EnvGetNextInstanceInClass(cl.env.ptr(), cl.clptr, instptr)
+	}
+	return ret
+}
+
+// AllInstances returns the list of instances of this class, and optionally those of its subclasses
+func (cl *Class) AllInstances(includeSubclasses bool) []*Instance {
+	if !valid(cl.check()) {
+		return nil
+	}
+	if !includeSubclasses {
+		return cl.Instances()
+	}
+	iteration := createDataObject(cl.env)
+	defer iteration.Delete()
+
+	clptr := cl.clptr
+	ret := make([]*Instance, 0, 10)
+	instptr := C.EnvGetNextInstanceInClassAndSubclasses(cl.env.ptr(), &clptr, nil, iteration.byRef())
+	for instptr != nil {
+		ret = append(ret, createInstance(cl.env, instptr))
+		instptr = C.EnvGetNextInstanceInClassAndSubclasses(cl.env.ptr(), &clptr, instptr, iteration.byRef())
 	}
 	return ret
 }
 
 // Subclasses returns the list of subclasses of this class
 func (cl *Class) Subclasses(inherited bool) ([]*Class, error) {
+	if err := cl.check(); err != nil {
+		return nil, err
+	}
 	data := createDataObject(cl.env)
 	defer data.Delete()
 
@@ -333,12 +430,15 @@ func (cl *Class) Subclasses(inherited bool) ([]*Class, error) {
 		flag = 1
 	}
 
-	C.EnvClassSubclasses(cl.env.env, cl.clptr, data.byRef(), flag)
+	C.EnvClassSubclasses(cl.env.ptr(), cl.clptr, data.byRef(), flag)
 	return classes(cl.env, data.Value())
 }
 
 // Superclasses returns the list of superclasses of this class
 func (cl *Class) Superclasses(inherited bool) ([]*Class, error) {
+	if err := cl.check(); err != nil {
+		return nil, err
+	}
 	data := createDataObject(cl.env)
 	defer data.Delete()
 
@@ -347,13 +447,16 @@ func (cl *Class) Superclasses(inherited bool) ([]*Class, error) {
 		flag = 1
 	}
 
-	C.EnvClassSuperclasses(cl.env.env, cl.clptr, data.byRef(), flag)
+	C.EnvClassSuperclasses(cl.env.ptr(), cl.clptr, data.byRef(), flag)
 	return classes(cl.env, data.Value())
 }
 
 // Undefine undefines the class within CLIPS. Equivalent to undefclass
 func (cl *Class) Undefine() error {
-	ret := C.EnvUndefclass(cl.env.env, cl.clptr)
+	if err := cl.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefclass(cl.env.ptr(), cl.clptr)
 	if ret != 1 {
 		return EnvError(cl.env, "Unable to undefine class")
 	}
@@ -362,20 +465,45 @@ func (cl *Class) Undefine() error {
 }
 
 func createMessageHandler(class *Class, index C.int) *MessageHandler {
+	envptr := class.env.ptr()
 	return &MessageHandler{
-		class: class,
-		index: index,
+		class:       class,
+		index:       index,
+		name:        C.GoString(C.EnvGetDefmessageHandlerName(envptr, class.clptr, index)),
+		handlerType: MessageHandlerType(C.GoString(C.EnvGetDefmessageHandlerType(envptr, class.clptr, index))),
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the message handler can no longer be used.
+// A handler is stale once it or its class is undefined, or the environment cleared. Handlers
+// are found again by name and type, since undefining one moves the others
+func (mh *MessageHandler) check() error {
+	if err := mh.class.check(); err != nil {
+		return err
+	}
+	cname := C.CString(mh.name)
+	defer C.free(unsafe.Pointer(cname))
+	ctype := C.CString(string(mh.handlerType))
+	defer C.free(unsafe.Pointer(ctype))
+	if mh.index == 0 || C.int(C.EnvFindDefmessageHandler(mh.class.env.ptr(), mh.class.clptr, cname, ctype)) != mh.index {
+		return fmt.Errorf("Message handler %s %s of class %s no longer exists: %w", mh.name, mh.handlerType, mh.class.name, ErrStale)
+	}
+	return nil
+}
+
 // Name returns the name of this message handler
 func (mh *MessageHandler) Name() string {
-	ret := C.EnvGetDefmessageHandlerName(mh.class.env.env, mh.class.clptr, mh.index)
-	return C.GoString(ret)
+	if err := mh.class.env.check(); err != nil {
+		panic(err)
+	}
+	return mh.name
 }
 
 func (mh *MessageHandler) String() string {
-	ret := C.EnvGetDefmessageHandlerPPForm(mh.class.env.env, mh.class.clptr, mh.index)
+	if !valid(mh.check()) {
+		return fmt.Sprintf("<MessageHandler-%s stale>", mh.name)
+	}
+	ret := C.EnvGetDefmessageHandlerPPForm(mh.class.env.ptr(), mh.class.clptr, mh.index)
 	return strings.TrimRight(C.GoString(ret), "\n")
 }
 
@@ -386,13 +514,15 @@ func (mh *MessageHandler) Equal(other *MessageHandler) bool {
 
 // Type returns the messagehandler type
 func (mh *MessageHandler) Type() MessageHandlerType {
-	ret := C.EnvGetDefmessageHandlerType(mh.class.env.env, mh.class.clptr, mh.index)
-	return MessageHandlerType(C.GoString(ret))
+	return mh.handlerType
 }
 
 // Watched returns true if this messagehandler is being watched
 func (mh *MessageHandler) Watched() bool {
-	ret := C.EnvGetDefmessageHandlerWatch(mh.class.env.env, mh.class.clptr, mh.index)
+	if !valid(mh.check()) {
+		return false
+	}
+	ret := C.EnvGetDefmessageHandlerWatch(mh.class.env.ptr(), mh.class.clptr, mh.index)
 	if ret == 1 {
 		return true
 	}
@@ -401,16 +531,22 @@ func (mh *MessageHandler) Watched() bool {
 
 // Watch sets whether this messagehandler should be watched
 func (mh *MessageHandler) Watch(val bool) {
+	if !valid(mh.check()) {
+		return
+	}
 	var flag C.int
 	if val {
 		flag = 1
 	}
-	C.EnvSetDefmessageHandlerWatch(mh.class.env.env, flag, mh.class.clptr, mh.index)
+	C.EnvSetDefmessageHandlerWatch(mh.class.env.ptr(), flag, mh.class.clptr, mh.index)
 }
 
 // Deletable returns true if this messagehandler can be deleted
 func (mh *MessageHandler) Deletable() bool {
-	ret := C.EnvIsDefmessageHandlerDeletable(mh.class.env.env, mh.class.clptr, mh.index)
+	if !valid(mh.check()) {
+		return false
+	}
+	ret := C.EnvIsDefmessageHandlerDeletable(mh.class.env.ptr(), mh.class.clptr, mh.index)
 	if ret == 1 {
 		return true
 	}
@@ -419,7 +555,10 @@ func (mh *MessageHandler) Deletable() bool {
 
 // Undefine undefines the message handler. Equivalent to undefmessage-handler
 func (mh *MessageHandler) Undefine() error {
-	ret := C.EnvUndefmessageHandler(mh.class.env.env, mh.class.clptr, mh.index)
+	if err := mh.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefmessageHandler(mh.class.env.ptr(), mh.class.clptr, mh.index)
 	if ret != 1 {
 		return EnvError(mh.class.env, "Unable to undef message handler")
 	}
@@ -441,7 +580,7 @@ func classes(env *Environment, classlist interface{}) ([]*Class, error) {
 		}
 		cname := C.CString(string(classname))
 		defer C.free(unsafe.Pointer(cname))
-		clptr := C.EnvFindDefclass(env.env, cname)
+		clptr := C.EnvFindDefclass(env.ptr(), cname)
 		if clptr == nil {
 			return nil, EnvError(env, `Class "%s" not found`, classname)
 		}
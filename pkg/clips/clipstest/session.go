@@ -0,0 +1,87 @@
+// Package clipstest provides helpers for testing CLIPS rules which interact with a user
+package clipstest
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+)
+
+// Session scripts an interactive session with a CLIPS environment. Lines given to Input are
+// read by (read) and (readline), and what is printed to t is collected for Output
+type Session struct {
+	env    *clips.Environment
+	input  bytes.Buffer
+	reader *clips.ReaderRouter
+	writer *clips.WriterRouter
+	output strings.Builder
+}
+
+// NewSession starts a session with env, serving stdin from the lines given to Input
+func NewSession(env *clips.Environment) *Session {
+	ret := &Session{env: env}
+	ret.reader = clips.CreateReaderRouter(env, &ret.input)
+	writers := make(map[string]io.Writer)
+	for _, name := range []string{"t", "stdout", "wdisplay", "wprompt", "wdialog"} {
+		writers[name] = &ret.output
+	}
+	ret.writer = clips.CreateWriterRouter(env, writers)
+	return ret
+}
+
+// Input queues lines of input, as if typed by the user
+func (s *Session) Input(lines ...string) *Session {
+	for _, line := range lines {
+		s.input.WriteString(line)
+		s.input.WriteString("\n")
+	}
+	return s
+}
+
+// Run runs the agenda, as for Environment.Run, and returns the output printed meanwhile
+func (s *Session) Run(limit int64) string {
+	s.env.Run(limit)
+	return s.Output()
+}
+
+// Command sends a command as if typed at the CLIPS prompt, and returns the output printed
+func (s *Session) Command(cmd string) (string, error) {
+	err := s.env.SendCommand(cmd)
+	return s.Output(), err
+}
+
+// Output returns the output printed since the last call
+func (s *Session) Output() string {
+	ret := s.output.String()
+	s.output.Reset()
+	return ret
+}
+
+// Pending returns the input queued but not yet read
+func (s *Session) Pending() string {
+	return s.input.String()
+}
+
+// Close removes the routers of the session from the environment
+func (s *Session) Close() error {
+	if err := s.reader.Delete(); err != nil {
+		return err
+	}
+	return s.writer.Delete()
+}
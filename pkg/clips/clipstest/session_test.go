@@ -0,0 +1,59 @@
+package clipstest
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+	"gotest.tools/assert"
+)
+
+func TestSession(t *testing.T) {
+	env := clips.CreateEnvironment()
+	defer env.Delete()
+
+	err := env.Build(`(defrule ask-name
+   (initial-fact)
+   =>
+   (printout t "Name? ")
+   (bind ?name (readline))
+   (printout t "Age? ")
+   (bind ?age (read))
+   (assert (person ?name ?age))
+   (printout t "Hello " ?name crlf))`)
+	assert.NilError(t, err)
+
+	session := NewSession(env)
+	defer session.Close()
+
+	env.Reset()
+	session.Input("Ann Smith", "34")
+	assert.Equal(t, session.Run(-1), "Name? Age? Hello Ann Smith\n")
+	assert.Equal(t, session.Pending(), "")
+
+	out, err := session.Command(`(facts)`)
+	assert.NilError(t, err)
+	assert.Assert(t, len(out) > 0)
+
+	fact, err := env.FindFactByIndex(1)
+	assert.NilError(t, err)
+	assert.Equal(t, fact.String(), `(person "Ann Smith" 34)`)
+
+	t.Run("Input runs out", func(t *testing.T) {
+		env.Reset()
+		assert.Equal(t, session.Run(-1), "Name? Age? Hello EOF\n")
+	})
+}
@@ -0,0 +1,281 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// ConstructKind is an enumeration of the kinds of CLIPS constructs
+type ConstructKind int
+
+const (
+	DEFRULE ConstructKind = iota
+	DEFTEMPLATE
+	DEFCLASS
+	DEFFUNCTION
+	DEFGENERIC
+	DEFGLOBAL
+	DEFMODULE
+	DEFFACTS
+	DEFINSTANCES
+)
+
+var clipsConstructKinds = [...]string{
+	"defrule",
+	"deftemplate",
+	"defclass",
+	"deffunction",
+	"defgeneric",
+	"defglobal",
+	"defmodule",
+	"deffacts",
+	"definstances",
+}
+
+// String returns the keyword defining the construct, such as "defrule"
+func (kind ConstructKind) String() string {
+	if kind < 0 || int(kind) >= len(clipsConstructKinds) {
+		return fmt.Sprintf("ConstructKind(%d)", int(kind))
+	}
+	return clipsConstructKinds[int(kind)]
+}
+
+// Construct is implemented by the wrappers of every kind of CLIPS construct. Once a construct
+// is undefined or cleared, its methods return errors wrapping ErrStale, or zero values if they
+// have no error result; Name and Kind still answer. After the environment is deleted, methods
+// return ErrEnvironmentClosed, and those with no error result panic with it
+type Construct interface {
+	// Kind returns the kind of construct
+	Kind() ConstructKind
+
+	// Name returns the name of the construct
+	Name() string
+
+	// String returns the CLIPS source of the construct
+	String() string
+
+	// Module returns the module in which the construct is defined
+	Module() *Module
+
+	// Deletable returns true if the construct can be undefined
+	Deletable() bool
+
+	// Undefine undefines the construct within CLIPS
+	Undefine() error
+}
+
+// WatchedConstruct is a Construct with a single watch flag. Rules and classes have separate
+// flags for each item watched, so do not implement it
+type WatchedConstruct interface {
+	Construct
+
+	// Watched returns true if the construct is being watched
+	Watched() bool
+
+	// Watch sets whether the construct is watched
+	Watch(val bool)
+}
+
+// Kind returns DEFRULE
+func (r *Rule) Kind() ConstructKind { return DEFRULE }
+
+// Kind returns DEFTEMPLATE
+func (t *Template) Kind() ConstructKind { return DEFTEMPLATE }
+
+// Kind returns DEFCLASS
+func (cl *Class) Kind() ConstructKind { return DEFCLASS }
+
+// Kind returns DEFFUNCTION
+func (f *Function) Kind() ConstructKind { return DEFFUNCTION }
+
+// Kind returns DEFGENERIC
+func (g *Generic) Kind() ConstructKind { return DEFGENERIC }
+
+// Kind returns DEFGLOBAL
+func (g *Global) Kind() ConstructKind { return DEFGLOBAL }
+
+// Kind returns DEFMODULE
+func (m *Module) Kind() ConstructKind { return DEFMODULE }
+
+// Kind returns DEFFACTS
+func (df *Deffacts) Kind() ConstructKind { return DEFFACTS }
+
+// Kind returns DEFINSTANCES
+func (di *Definstances) Kind() ConstructKind { return DEFINSTANCES }
+
+// Constructs returns the constructs of the given kind defined in module, or in every module
+// if module is nil. For DEFMODULE, it returns every module, or module alone
+func (env *Environment) Constructs(kind ConstructKind, module *Module) ([]Construct, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	if kind == DEFMODULE {
+		if module != nil {
+			return []Construct{module}, nil
+		}
+		ret := make([]Construct, 0, 10)
+		for _, m := range env.Modules() {
+			ret = append(ret, m)
+		}
+		return ret, nil
+	}
+	if kind < 0 || int(kind) >= len(clipsConstructKinds) {
+		return nil, fmt.Errorf("Invalid construct kind %d", int(kind))
+	}
+	modules := []*Module{module}
+	if module == nil {
+		modules = env.Modules()
+	}
+	ret := make([]Construct, 0, 10)
+	for _, m := range modules {
+		m.within(func() {
+			ret = env.appendConstructs(ret, kind)
+		})
+	}
+	return ret, nil
+}
+
+// appendConstructs appends the constructs of the given kind in the current module
+func (env *Environment) appendConstructs(ret []Construct, kind ConstructKind) []Construct {
+	switch kind {
+	case DEFRULE:
+		for _, c := range env.Rules() {
+			ret = append(ret, c)
+		}
+	case DEFTEMPLATE:
+		for _, c := range env.Templates() {
+			ret = append(ret, c)
+		}
+	case DEFCLASS:
+		for _, c := range env.Classes() {
+			ret = append(ret, c)
+		}
+	case DEFFUNCTION:
+		for _, c := range env.Functions() {
+			ret = append(ret, c)
+		}
+	case DEFGENERIC:
+		for _, c := range env.Generics() {
+			ret = append(ret, c)
+		}
+	case DEFGLOBAL:
+		for _, c := range env.Globals() {
+			ret = append(ret, c)
+		}
+	case DEFFACTS:
+		for _, c := range env.Deffacts() {
+			ret = append(ret, c)
+		}
+	case DEFINSTANCES:
+		for _, c := range env.Definstances() {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// FindConstruct returns the construct of the given kind and name
+func (env *Environment) FindConstruct(kind ConstructKind, name string) (Construct, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case DEFRULE:
+		return constructOf(env.FindRule(name))
+	case DEFTEMPLATE:
+		return constructOf(env.FindTemplate(name))
+	case DEFCLASS:
+		return constructOf(env.FindClass(name))
+	case DEFFUNCTION:
+		return constructOf(env.FindFunction(name))
+	case DEFGENERIC:
+		return constructOf(env.FindGeneric(name))
+	case DEFGLOBAL:
+		return constructOf(env.FindGlobal(name))
+	case DEFMODULE:
+		return constructOf(env.FindModule(name))
+	case DEFFACTS:
+		return constructOf(env.FindDeffacts(name))
+	case DEFINSTANCES:
+		return constructOf(env.FindDefinstances(name))
+	}
+	return nil, fmt.Errorf("Invalid construct kind %d", int(kind))
+}
+
+// constructOf avoids returning a nil pointer within a non-nil Construct when a Find fails
+func constructOf(construct Construct, err error) (Construct, error) {
+	if err != nil {
+		return nil, err
+	}
+	return construct, nil
+}
+
+// checkConstruct returns ErrEnvironmentClosed after Delete, or ErrStale if the construct at ptr
+// has been freed since its wrapper was created, by undefining it or clearing the environment.
+// It is found again by its qualified name, which must still give ptr, so that ptr is never
+// dereferenced once freed. Modules are found by their name alone
+func checkConstruct(env *Environment, kind ConstructKind, ptr unsafe.Pointer, name string, cleared uint64) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	if ptr == nil || cleared != env.cleared || findConstruct(env, kind, name) != ptr {
+		return fmt.Errorf("%s %s no longer exists: %w", kind, name, ErrStale)
+	}
+	return nil
+}
+
+// valid returns true if err, from checking a construct, is nil. Methods with no error result
+// return zero values for stale constructs, but panic with ErrEnvironmentClosed after Delete
+func valid(err error) bool {
+	if errors.Is(err, ErrEnvironmentClosed) {
+		panic(err)
+	}
+	return err == nil
+}
+
+// findConstruct returns the construct of the given kind and name, or nil if there is none
+func findConstruct(env *Environment, kind ConstructKind, name string) unsafe.Pointer {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	switch kind {
+	case DEFRULE:
+		return C.EnvFindDefrule(env.ptr(), cname)
+	case DEFTEMPLATE:
+		return C.EnvFindDeftemplate(env.ptr(), cname)
+	case DEFCLASS:
+		return C.EnvFindDefclass(env.ptr(), cname)
+	case DEFFUNCTION:
+		return C.EnvFindDeffunction(env.ptr(), cname)
+	case DEFGENERIC:
+		return C.EnvFindDefgeneric(env.ptr(), cname)
+	case DEFGLOBAL:
+		return C.EnvFindDefglobal(env.ptr(), cname)
+	case DEFMODULE:
+		return C.EnvFindDefmodule(env.ptr(), cname)
+	case DEFFACTS:
+		return C.EnvFindDeffacts(env.ptr(), cname)
+	case DEFINSTANCES:
+		return C.EnvFindDefinstances(env.ptr(), cname)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+var (
+	_ Construct        = (*Rule)(nil)
+	_ Construct        = (*Class)(nil)
+	_ Construct        = (*Module)(nil)
+	_ Construct        = (*Deffacts)(nil)
+	_ Construct        = (*Definstances)(nil)
+	_ WatchedConstruct = (*Template)(nil)
+	_ WatchedConstruct = (*Function)(nil)
+	_ WatchedConstruct = (*Generic)(nil)
+	_ WatchedConstruct = (*Global)(nil)
+)
+
+func TestConstructs(t *testing.T) {
+	t.Run("Kind names", func(t *testing.T) {
+		assert.Equal(t, DEFRULE.String(), "defrule")
+		assert.Equal(t, DEFINSTANCES.String(), "definstances")
+		assert.Equal(t, ConstructKind(42).String(), "ConstructKind(42)")
+	})
+
+	t.Run("List constructs", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deffunction MAIN::double (?x) (* ?x 2))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defmodule Foo (export ?ALL))`)
+		assert.NilError(t, err)
+		err = env.Build(`(deffunction Foo::triple (?x) (* ?x 3))`)
+		assert.NilError(t, err)
+
+		constructs, err := env.Constructs(DEFFUNCTION, nil)
+		assert.NilError(t, err)
+		assert.Equal(t, len(constructs), 2)
+		assert.Equal(t, constructs[0].Name(), "double")
+		assert.Equal(t, constructs[0].Kind(), DEFFUNCTION)
+		assert.Equal(t, constructs[1].Name(), "triple")
+		assert.Equal(t, constructs[1].Module().Name(), "Foo")
+
+		foo, err := env.FindModule("Foo")
+		assert.NilError(t, err)
+		constructs, err = env.Constructs(DEFFUNCTION, foo)
+		assert.NilError(t, err)
+		assert.Equal(t, len(constructs), 1)
+		assert.Equal(t, constructs[0].Name(), "triple")
+
+		constructs, err = env.Constructs(DEFMODULE, nil)
+		assert.NilError(t, err)
+		assert.Equal(t, len(constructs), 2)
+		assert.Assert(t, !constructs[1].Deletable())
+		assert.ErrorContains(t, constructs[1].Undefine(), "cannot be undefined")
+
+		_, err = env.Constructs(ConstructKind(42), nil)
+		assert.ErrorContains(t, err, "Invalid construct kind")
+	})
+
+	t.Run("Find construct", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defrule foo (a) =>)`)
+		assert.NilError(t, err)
+		err = env.Build(`(defglobal ?*count* = 0)`)
+		assert.NilError(t, err)
+
+		construct, err := env.FindConstruct(DEFRULE, "foo")
+		assert.NilError(t, err)
+		assert.Equal(t, construct.Kind(), DEFRULE)
+		assert.Equal(t, construct.Name(), "foo")
+		assert.Assert(t, construct.Deletable())
+
+		construct, err = env.FindConstruct(DEFGLOBAL, "count")
+		assert.NilError(t, err)
+		watched, ok := construct.(WatchedConstruct)
+		assert.Assert(t, ok)
+		watched.Watch(true)
+		assert.Assert(t, watched.Watched())
+
+		construct, err = env.FindConstruct(DEFTEMPLATE, "bar")
+		assert.ErrorContains(t, err, "not found")
+		assert.Assert(t, construct == nil)
+
+		construct, err = env.FindConstruct(DEFRULE, "foo")
+		assert.NilError(t, err)
+		err = construct.Undefine()
+		assert.NilError(t, err)
+		assert.Equal(t, len(env.Rules()), 0)
+	})
+}
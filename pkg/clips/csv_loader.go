@@ -0,0 +1,261 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVOptions configure LoadCSV
+type CSVOptions struct {
+	// Comma is the field delimiter. It is ',' if zero
+	Comma rune
+	// Columns maps the headers of columns to the slots they fill, for columns not named after
+	// their slots
+	Columns map[string]string
+	// IgnoreUnknown skips columns which fill no slot. Otherwise they are an error
+	IgnoreUnknown bool
+	// Separator splits the cells of multislot columns, such as "|". Cells are split on white
+	// space if it is empty
+	Separator string
+}
+
+// CSVError is a cell, or a column of the header, which could not be loaded
+type CSVError struct {
+	// Row is the number of the record, counting the header as row 1, and Column the number of
+	// the field within it, counting from 1
+	Row    int
+	Column int
+	Header string
+	Msg    string
+}
+
+func (e *CSVError) Error() string {
+	return fmt.Sprintf("row %d, column %d (%s): %s", e.Row, e.Column, e.Header, e.Msg)
+}
+
+// CSVErrorList is returned when one or more cells could not be loaded
+type CSVErrorList []*CSVError
+
+func (l CSVErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// csvColumn is a column of the CSV and the slot it fills
+type csvColumn struct {
+	header     string
+	slot       string
+	types      []Symbol
+	multifield bool
+}
+
+// LoadCSV asserts a fact of the template for each record of CSV read from r. The first record
+// is the header, naming the slot each column fills. Each cell is converted to a type the slot
+// allows, as given by TemplateSlot.Types: an INTEGER or FLOAT if it is a number, a SYMBOL if it
+// is a valid symbol, and otherwise a STRING. Cells of multislots are split into fields which
+// are converted the same way. Empty cells leave the slot its default value.
+//
+// Every cell is converted before any fact is asserted, so that if any cannot be, no facts are
+// asserted and a CSVErrorList giving the row and column of each is returned. Otherwise the
+// number of facts asserted is returned
+func (env *Environment) LoadCSV(r io.Reader, template string, opts CSVOptions) (int, error) {
+	if err := env.check(); err != nil {
+		return 0, err
+	}
+	tmpl, err := env.FindTemplate(template)
+	if err != nil {
+		return 0, err
+	}
+	if tmpl.Implied() {
+		return 0, fmt.Errorf(`Template "%s" is an ordered template, with no slots`, template)
+	}
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+
+	var errs CSVErrorList
+	slots := tmpl.Slots()
+	columns := make([]*csvColumn, len(header))
+	filled := make(map[string]string, len(header))
+	for ii, name := range header {
+		name = strings.TrimSpace(name)
+		slotname := name
+		if mapped, ok := opts.Columns[name]; ok {
+			slotname = mapped
+		}
+		slot, ok := slots[slotname]
+		if !ok {
+			if !opts.IgnoreUnknown {
+				errs = append(errs, &CSVError{Row: 1, Column: ii + 1, Header: name, Msg: fmt.Sprintf(`Template "%s" has no slot "%s"`, template, slotname)})
+			}
+			continue
+		}
+		if other, ok := filled[slotname]; ok {
+			errs = append(errs, &CSVError{Row: 1, Column: ii + 1, Header: name, Msg: fmt.Sprintf(`Slot "%s" is already filled by column "%s"`, slotname, other)})
+			continue
+		}
+		filled[slotname] = name
+		columns[ii] = &csvColumn{header: name, slot: slotname, types: slot.Types(), multifield: slot.Multifield()}
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		values := make(map[string]interface{}, len(columns))
+		for ii, cell := range record {
+			column := columns[ii]
+			if column == nil {
+				continue
+			}
+			value, err := column.convert(cell, opts.Separator)
+			if err != nil {
+				errs = append(errs, &CSVError{Row: row, Column: ii + 1, Header: column.header, Msg: err.Error()})
+				continue
+			}
+			if value != nil {
+				values[column.slot] = value
+			}
+		}
+		rows = append(rows, values)
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+
+	for ii, values := range rows {
+		if err := assertCSVRow(tmpl, values); err != nil {
+			return ii, fmt.Errorf("row %d: %v", ii+2, err)
+		}
+	}
+	return len(rows), nil
+}
+
+func assertCSVRow(tmpl *Template, values map[string]interface{}) error {
+	fact, err := tmpl.NewFact()
+	if err != nil {
+		return err
+	}
+	// the fact stays in CLIPS once asserted, so the reference can go at once
+	defer fact.Drop()
+	tfact := fact.(*TemplateFact)
+	for slot, value := range values {
+		if err := tfact.Set(slot, value); err != nil {
+			return err
+		}
+	}
+	return fact.Assert()
+}
+
+// convert returns the value of a cell for the slot of the column, or nil if the cell is empty
+func (c *csvColumn) convert(cell string, separator string) (interface{}, error) {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return nil, nil
+	}
+	if !c.multifield {
+		return csvValue(cell, c.types)
+	}
+	var fields []string
+	if separator == "" {
+		fields = strings.Fields(cell)
+	} else {
+		fields = strings.Split(cell, separator)
+	}
+	ret := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		value, err := csvValue(field, c.types)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, value)
+	}
+	return ret, nil
+}
+
+// csvValue converts the text of a cell to the first of the types allowed which can represent it
+func csvValue(text string, types []Symbol) (interface{}, error) {
+	allowed := make(map[Symbol]bool, len(types))
+	for _, typ := range types {
+		allowed[typ] = true
+	}
+	number := strings.ContainsAny(text[:1], "0123456789+-.")
+	if allowed["INTEGER"] && number {
+		if val, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return val, nil
+		}
+	}
+	if allowed["FLOAT"] && number {
+		if val, err := strconv.ParseFloat(text, 64); err == nil {
+			return val, nil
+		}
+	}
+	if allowed["SYMBOL"] && csvSymbol(text) {
+		return Symbol(text), nil
+	}
+	if allowed["STRING"] {
+		return text, nil
+	}
+	if allowed["INSTANCE-NAME"] {
+		if name := strings.TrimSuffix(strings.TrimPrefix(text, "["), "]"); csvSymbol(name) {
+			return InstanceName(name), nil
+		}
+	}
+	names := make([]string, len(types))
+	for ii, typ := range types {
+		names[ii] = string(typ)
+	}
+	return nil, fmt.Errorf(`"%s" is not a valid %s`, text, strings.Join(names, " or "))
+}
+
+// csvSymbol returns true if text reads as a single symbol in CLIPS
+func csvSymbol(text string) bool {
+	if text == "" || strings.ContainsAny(text, " \t\r\n\"()&|<~;") || strings.HasPrefix(text, "?") || strings.HasPrefix(text, "$?") {
+		return false
+	}
+	if strings.ContainsAny(text[:1], "0123456789+-.") {
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestLoadCSV(t *testing.T) {
+	const product = `(deftemplate product
+		(slot sku (type SYMBOL))
+		(slot name (type STRING))
+		(slot price (type FLOAT))
+		(slot stock (type INTEGER) (default 0))
+		(slot supplier)
+		(multislot tags))`
+
+	t.Run("Load", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+		err := env.Build(product)
+		assert.NilError(t, err)
+
+		n, err := env.LoadCSV(strings.NewReader(
+			"sku,name,price,stock,supplier,tags\n"+
+				"A-1,Bolt,0.25,100,acme,metal small\n"+
+				"B-2,\"Nut, large\",1,,Acme Corp,\n"+
+				"C-3,42,3.5,7,12,metal 2\n"), "product", CSVOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, n, 3)
+
+		facts := env.Facts()
+		assert.Equal(t, len(facts), 4)
+		assert.Equal(t, facts[1].String(), `(product (sku A-1) (name "Bolt") (price 0.25) (stock 100) (supplier acme) (tags metal small))`)
+		assert.Equal(t, facts[2].String(), `(product (sku B-2) (name "Nut, large") (price 1.0) (stock 0) (supplier "Acme Corp") (tags))`)
+		assert.Equal(t, facts[3].String(), `(product (sku C-3) (name "42") (price 3.5) (stock 7) (supplier 12) (tags metal 2))`)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+		err := env.Build(product)
+		assert.NilError(t, err)
+
+		n, err := env.LoadCSV(strings.NewReader(
+			"code;label;notes;tags\n"+
+				"A-1;Bolt;ignored;metal|small parts\n"), "product", CSVOptions{
+			Comma:         ';',
+			Columns:       map[string]string{"code": "sku", "label": "name"},
+			IgnoreUnknown: true,
+			Separator:     "|",
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1)
+		assert.Equal(t, env.Facts()[1].String(), `(product (sku A-1) (name "Bolt") (price 0.0) (stock 0) (supplier nil) (tags metal "small parts"))`)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+		err := env.Build(product)
+		assert.NilError(t, err)
+
+		_, err = env.LoadCSV(strings.NewReader("sku,colour\n"), "product", CSVOptions{})
+		assert.Error(t, err, `row 1, column 2 (colour): Template "product" has no slot "colour"`)
+
+		_, err = env.LoadCSV(strings.NewReader("sku,code\nA-1,A-1\n"), "product", CSVOptions{Columns: map[string]string{"code": "sku"}})
+		assert.Error(t, err, `row 1, column 2 (code): Slot "sku" is already filled by column "sku"`)
+
+		_, err = env.LoadCSV(strings.NewReader(
+			"sku,price,stock\n"+
+				"A-1,cheap,1\n"+
+				"B-2,1.5,many\n"+
+				"two words,1.5,1\n"), "product", CSVOptions{})
+		errs, ok := err.(CSVErrorList)
+		assert.Assert(t, ok)
+		assert.Equal(t, len(errs), 3)
+		assert.Equal(t, errs[0].Error(), `row 2, column 2 (price): "cheap" is not a valid FLOAT`)
+		assert.DeepEqual(t, *errs[1], CSVError{Row: 3, Column: 3, Header: "stock", Msg: `"many" is not a valid INTEGER`})
+		assert.Equal(t, errs[2].Row, 4)
+		assert.Equal(t, errs[2].Column, 1)
+		assert.ErrorContains(t, err, "(and 2 more errors)")
+		// nothing is asserted when any cell is in error
+		assert.Equal(t, len(env.Facts()), 1)
+
+		_, err = env.LoadCSV(strings.NewReader("sku\n"), "nosuchtemplate", CSVOptions{})
+		assert.ErrorContains(t, err, "")
+	})
+}
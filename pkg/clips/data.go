@@ -120,6 +120,7 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"unsafe"
 )
@@ -267,24 +268,72 @@ func (do *DataObject) goValue(dtype Type, dvalue unsafe.Pointer) interface{} {
 	return nil
 }
 
+// clipsLiteral formats a Go value as CLIPS source, as it would be written in an expression
+func clipsLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "nil", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case Symbol:
+		return string(v), nil
+	case InstanceName:
+		return "[" + string(v) + "]", nil
+	case *Instance:
+		return "[" + string(v.Name()) + "]", nil
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`, nil
+	}
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(val.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		ret := strconv.FormatFloat(val.Float(), 'g', -1, 64)
+		if !strings.ContainsAny(ret, ".eEnN") {
+			// without a decimal point CLIPS would read an integer
+			ret += ".0"
+		}
+		return ret, nil
+	case reflect.String:
+		return clipsLiteral(val.String())
+	case reflect.Array, reflect.Slice:
+		items := []string{"create$"}
+		for ii := 0; ii < val.Len(); ii++ {
+			item, err := clipsLiteral(val.Index(ii).Interface())
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		return "(" + strings.Join(items, " ") + ")", nil
+	}
+	return "", fmt.Errorf("Unable to write %T as a CLIPS value", value)
+}
+
 // clipsValue convers a Go data structure into a CLIPS data value
 func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 	if dvalue == nil {
 		vstr := C.CString("nil")
 		defer C.free(unsafe.Pointer(vstr))
-		return C.EnvAddSymbol(do.env.env, vstr)
+		return C.EnvAddSymbol(do.env.ptr(), vstr)
 	}
 	switch v := dvalue.(type) {
 	case unsafe.Pointer:
-		return C.EnvAddExternalAddress(do.env.env, v, C.C_POINTER_EXTERNAL_ADDRESS)
+		return C.EnvAddExternalAddress(do.env.ptr(), v, C.C_POINTER_EXTERNAL_ADDRESS)
 	case Symbol:
 		vstr := C.CString(string(v))
 		defer C.free(unsafe.Pointer(vstr))
-		return C.EnvAddSymbol(do.env.env, vstr)
+		return C.EnvAddSymbol(do.env.ptr(), vstr)
 	case InstanceName:
 		vstr := C.CString(string(v))
 		defer C.free(unsafe.Pointer(vstr))
-		return C.EnvAddSymbol(do.env.env, vstr)
+		return C.EnvAddSymbol(do.env.ptr(), vstr)
 	case []interface{}:
 		return do.listToMultifield(v)
 	case *ImpliedFact:
@@ -305,17 +354,17 @@ func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 		if v {
 			vstr := C.CString("TRUE")
 			defer C.free(unsafe.Pointer(vstr))
-			return C.EnvAddSymbol(do.env.env, vstr)
+			return C.EnvAddSymbol(do.env.ptr(), vstr)
 		}
 		vstr := C.CString("FALSE")
 		defer C.free(unsafe.Pointer(vstr))
-		return C.EnvAddSymbol(do.env.env, vstr)
+		return C.EnvAddSymbol(do.env.ptr(), vstr)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		v := val.Int()
-		return C.EnvAddLong(do.env.env, C.longlong(v))
+		return C.EnvAddLong(do.env.ptr(), C.longlong(v))
 	case reflect.Float32, reflect.Float64:
 		v := val.Float()
-		return C.EnvAddDouble(do.env.env, C.double(v))
+		return C.EnvAddDouble(do.env.ptr(), C.double(v))
 	case reflect.Slice, reflect.Array:
 		mvalue := make([]interface{}, val.Len())
 		for i := 0; i < val.Len(); i++ {
@@ -326,7 +375,7 @@ func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 		v := val.String()
 		vstr := C.CString(v)
 		defer C.free(unsafe.Pointer(vstr))
-		return C.EnvAddSymbol(do.env.env, vstr)
+		return C.EnvAddSymbol(do.env.ptr(), vstr)
 	case reflect.Struct:
 		// need to insert the struct first, then store its INSTANCE-NAME
 		instname := "nil"
@@ -339,12 +388,12 @@ func (do *DataObject) clipsValue(dvalue interface{}) unsafe.Pointer {
 		}
 		vstr := C.CString(instname)
 		defer C.free(unsafe.Pointer(vstr))
-		return C.EnvAddSymbol(do.env.env, vstr)
+		return C.EnvAddSymbol(do.env.ptr(), vstr)
 	}
 	// Fall back to FALSE in typical CLIPS style
 	vstr := C.CString("FALSE")
 	defer C.free(unsafe.Pointer(vstr))
-	return C.EnvAddSymbol(do.env.env, vstr)
+	return C.EnvAddSymbol(do.env.ptr(), vstr)
 }
 
 func (do *DataObject) multifieldToList() []interface{} {
@@ -363,7 +412,7 @@ func (do *DataObject) multifieldToList() []interface{} {
 
 func (do *DataObject) listToMultifield(values []interface{}) unsafe.Pointer {
 	size := C.long(len(values))
-	ret := C.EnvCreateMultifield(do.env.env, size)
+	ret := C.EnvCreateMultifield(do.env.ptr(), size)
 	multifield := C.multifield_ptr(ret)
 	for i, v := range values {
 		C.set_multifield_type(multifield, C.long(i+1), C.short(clipsTypeFor(reflect.TypeOf(v))))
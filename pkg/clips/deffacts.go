@@ -0,0 +1,283 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// Deffacts references a CLIPS deffacts, a set of facts asserted on every reset. Like every
+// Construct, its methods without an error result panic with ErrEnvironmentClosed after the
+// environment is deleted
+type Deffacts struct {
+	env     *Environment
+	dfptr   unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
+}
+
+// FactValue describes a fact to DefineFacts. Slots may be a map of slot name to value or a
+// struct, with slot names taken from the fields as for Extract. If Slots is a slice, an
+// ordered fact is described, with Template as its relation name
+type FactValue struct {
+	Template string
+	Slots    interface{}
+}
+
+// Deffacts returns the set of all deffacts in CLIPS
+func (env *Environment) Deffacts() []*Deffacts {
+	ret := make([]*Deffacts, 0, 10)
+	for dfptr := C.EnvGetNextDeffacts(env.ptr(), nil); dfptr != nil; dfptr = C.EnvGetNextDeffacts(env.ptr(), dfptr) {
+		ret = append(ret, createDeffacts(env, dfptr))
+	}
+	return ret
+}
+
+// FindDeffacts returns the deffacts of the given name
+func (env *Environment) FindDeffacts(name string) (*Deffacts, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	dfptr := C.EnvFindDeffacts(env.ptr(), cname)
+	if dfptr == nil {
+		return nil, NotFoundError(fmt.Errorf(`Deffacts "%s" not found`, name))
+	}
+	return createDeffacts(env, dfptr), nil
+}
+
+// DefineFacts defines a deffacts holding the given facts, so that they are asserted again
+// after every Reset. Each fact may be a string of CLIPS source such as "(point 1 2)", a Fact,
+// or a FactValue
+func (env *Environment) DefineFacts(name string, facts ...interface{}) (*Deffacts, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "(deffacts %s", name)
+	for _, fact := range facts {
+		src, err := factSource(fact)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "\n   %s", src)
+	}
+	b.WriteString(")")
+	if err := env.Build(b.String()); err != nil {
+		return nil, err
+	}
+	return env.FindDeffacts(name)
+}
+
+func factSource(fact interface{}) (string, error) {
+	switch v := fact.(type) {
+	case string:
+		return v, nil
+	case Fact:
+		return v.String(), nil
+	case FactValue:
+		return v.source()
+	case *FactValue:
+		return v.source()
+	}
+	return "", fmt.Errorf("Unable to define a fact from %T", fact)
+}
+
+func (fv FactValue) source() (string, error) {
+	if ordered := reflect.ValueOf(fv.Slots); ordered.Kind() == reflect.Slice || ordered.Kind() == reflect.Array {
+		items := []string{fv.Template}
+		for ii := 0; ii < ordered.Len(); ii++ {
+			item, err := clipsLiteral(ordered.Index(ii).Interface())
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		return "(" + strings.Join(items, " ") + ")", nil
+	}
+	slots, err := slotSource(fv.Slots)
+	if err != nil {
+		return "", err
+	}
+	return "(" + fv.Template + slots + ")", nil
+}
+
+// slotSource writes the slot values of a map or struct as CLIPS source, as in " (a 1) (b x y)".
+// Slices are written as the values of a multislot, and nil pointers are left out so that the
+// slot gets its default
+func slotSource(slots interface{}) (string, error) {
+	var b strings.Builder
+	write := func(name string, value interface{}) error {
+		val := reflect.ValueOf(value)
+		if val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return nil
+			}
+			if _, ok := value.(*Instance); !ok {
+				value = val.Elem().Interface()
+				val = val.Elem()
+			}
+		}
+		fmt.Fprintf(&b, " (%s", name)
+		if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+			for ii := 0; ii < val.Len(); ii++ {
+				item, err := clipsLiteral(val.Index(ii).Interface())
+				if err != nil {
+					return err
+				}
+				b.WriteString(" " + item)
+			}
+		} else {
+			item, err := clipsLiteral(value)
+			if err != nil {
+				return err
+			}
+			b.WriteString(" " + item)
+		}
+		b.WriteString(")")
+		return nil
+	}
+
+	val := reflect.Indirect(reflect.ValueOf(slots))
+	switch val.Kind() {
+	case reflect.Invalid:
+		return "", nil
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return "", fmt.Errorf("Key type must be type string")
+		}
+		// maps are unordered, so sort the slots to write the same source each time
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, key := range keys {
+			if err := write(key.String(), val.MapIndex(key).Interface()); err != nil {
+				return "", err
+			}
+		}
+	case reflect.Struct:
+		var fields func(val reflect.Value) error
+		fields = func(val reflect.Value) error {
+			typ := val.Type()
+			for ii := 0; ii < typ.NumField(); ii++ {
+				field := typ.Field(ii)
+				if field.Anonymous && field.Type.Kind() == reflect.Struct {
+					if err := fields(val.Field(ii)); err != nil {
+						return err
+					}
+					continue
+				}
+				if field.PkgPath != "" {
+					// unexported
+					continue
+				}
+				if err := write(slotNameFor(field), val.Field(ii).Interface()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := fields(val); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("Unable to write slots from %T", slots)
+	}
+	return b.String(), nil
+}
+
+func createDeffacts(env *Environment, dfptr unsafe.Pointer) *Deffacts {
+	return &Deffacts{
+		env:     env,
+		dfptr:   dfptr,
+		name:    C.GoString(C.EnvGetDeffactsName(env.ptr(), dfptr)),
+		module:  C.GoString(C.EnvDeffactsModule(env.ptr(), dfptr)),
+		cleared: env.cleared,
+	}
+}
+
+// check returns ErrEnvironmentClosed or ErrStale if the deffacts can no longer be used. A deffacts
+// is stale once undefined or cleared
+func (df *Deffacts) check() error {
+	return checkConstruct(df.env, DEFFACTS, df.dfptr, qualify(df.module, df.name), df.cleared)
+}
+
+// Equal returns true if the other deffacts represents the same CLIPS deffacts as this one
+func (df *Deffacts) Equal(other *Deffacts) bool {
+	return df.dfptr == other.dfptr
+}
+
+func (df *Deffacts) String() string {
+	if !valid(df.check()) {
+		return fmt.Sprintf("<Deffacts-%s stale>", df.name)
+	}
+	cstr := C.EnvGetDeffactsPPForm(df.env.ptr(), df.dfptr)
+	return strings.TrimRight(C.GoString(cstr), "\n")
+}
+
+// Name returns the name of this deffacts
+func (df *Deffacts) Name() string {
+	if err := df.env.check(); err != nil {
+		panic(err)
+	}
+	return df.name
+}
+
+// Module returns the module in which this deffacts is defined, or nil if it is stale
+func (df *Deffacts) Module() *Module {
+	if !valid(df.check()) {
+		return nil
+	}
+	cmodname := C.EnvDeffactsModule(df.env.ptr(), df.dfptr)
+	modptr := C.EnvFindDefmodule(df.env.ptr(), cmodname)
+
+	return createModule(df.env, modptr)
+}
+
+// Deletable returns true if the deffacts can be deleted from CLIPS
+func (df *Deffacts) Deletable() bool {
+	if !valid(df.check()) {
+		return false
+	}
+	ret := C.EnvIsDeffactsDeletable(df.env.ptr(), df.dfptr)
+	if ret == 1 {
+		return true
+	}
+	return false
+}
+
+// Undefine undefines the deffacts within CLIPS. Equivalent to undeffacts
+func (df *Deffacts) Undefine() error {
+	if err := df.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndeffacts(df.env.ptr(), df.dfptr)
+	if ret != 1 {
+		return EnvError(df.env, `Unable to undefine deffacts "%s"`, df.Name())
+	}
+	df.dfptr = nil
+	return nil
+}
@@ -0,0 +1,127 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestDeffacts(t *testing.T) {
+	t.Run("Find deffacts", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deffacts startup (foo a) (foo b))`)
+		assert.NilError(t, err)
+
+		df, err := env.FindDeffacts("startup")
+		assert.NilError(t, err)
+		assert.Equal(t, df.Name(), "startup")
+		assert.Equal(t, df.Module().Name(), "MAIN")
+		assert.Assert(t, df.Deletable())
+		assert.Assert(t, strings.HasPrefix(df.String(), "(deffacts MAIN::startup"))
+
+		// initial-fact is a deffacts too
+		all := env.Deffacts()
+		assert.Equal(t, len(all), 2)
+		assert.Assert(t, all[1].Equal(df))
+
+		_, err = env.FindDeffacts("bogus")
+		assert.ErrorContains(t, err, `Deffacts "bogus" not found`)
+
+		err = df.Undefine()
+		assert.NilError(t, err)
+		assert.Equal(t, len(env.Deffacts()), 1)
+	})
+
+	t.Run("Define facts", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deftemplate order (slot id) (slot state) (multislot items) (slot note (default none)))`)
+		assert.NilError(t, err)
+
+		type order struct {
+			ID    int           `clips:"id"`
+			State Symbol        `clips:"state"`
+			Items []interface{} `clips:"items"`
+			Note  *string       `clips:"note"`
+			extra int
+		}
+		note := "rush"
+		df, err := env.DefineFacts("seed",
+			`(point 1 2)`,
+			FactValue{Template: "point", Slots: []interface{}{3, 4.5}},
+			FactValue{Template: "order", Slots: map[string]interface{}{"id": 1, "state": Symbol("new")}},
+			&FactValue{Template: "order", Slots: order{ID: 2, State: "shipped", Items: []interface{}{Symbol("a"), "b"}, Note: &note}},
+			FactValue{Template: "order", Slots: &order{ID: 3}},
+		)
+		assert.NilError(t, err)
+		assert.Equal(t, df.Name(), "seed")
+
+		env.Reset()
+		facts, err := env.FindFacts("order")
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 3)
+		assert.Equal(t, facts[0].String(), `(order (id 1) (state new) (items) (note none))`)
+		assert.Equal(t, facts[1].String(), `(order (id 2) (state shipped) (items a "b") (note "rush"))`)
+		assert.Equal(t, facts[2].String(), `(order (id 3) (state nil) (items) (note none))`)
+
+		facts, err = env.FindFacts("point")
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+		assert.Equal(t, facts[1].String(), "(point 3 4.5)")
+
+		// and again after the facts are retracted
+		for _, fact := range facts {
+			assert.NilError(t, fact.Retract())
+		}
+		env.Reset()
+		facts, err = env.FindFacts("point")
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+	})
+
+	t.Run("Define facts from a fact", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		fact, err := env.AssertString(`(color red)`)
+		assert.NilError(t, err)
+		_, err = env.DefineFacts("colors", fact)
+		assert.NilError(t, err)
+		env.Reset()
+		facts, err := env.FindFacts("color")
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 1)
+	})
+
+	t.Run("Define facts errors", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		_, err := env.DefineFacts("bad", 42)
+		assert.ErrorContains(t, err, "Unable to define a fact from int")
+
+		_, err = env.DefineFacts("bad", FactValue{Template: "nosuch", Slots: map[string]interface{}{"a": 1}})
+		assert.Assert(t, err != nil)
+
+		_, err = env.DefineFacts("bad", FactValue{Template: "point", Slots: []interface{}{struct{}{}}})
+		assert.ErrorContains(t, err, "Unable to write")
+	})
+}
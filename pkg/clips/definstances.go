@@ -0,0 +1,190 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Definstances references a CLIPS definstances, a set of instances made on every reset. Like
+// every Construct, its methods without an error result panic with ErrEnvironmentClosed after
+// the environment is deleted
+type Definstances struct {
+	env     *Environment
+	diptr   unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
+}
+
+// InstanceValue describes an instance to DefineInstances. Slots may be a map of slot name to
+// value or a struct, with slot names taken from the fields as for Extract. If Name is empty,
+// CLIPS generates one
+type InstanceValue struct {
+	Name  InstanceName
+	Class string
+	Slots interface{}
+}
+
+// Definstances returns the set of all definstances in CLIPS
+func (env *Environment) Definstances() []*Definstances {
+	ret := make([]*Definstances, 0, 10)
+	for diptr := C.EnvGetNextDefinstances(env.ptr(), nil); diptr != nil; diptr = C.EnvGetNextDefinstances(env.ptr(), diptr) {
+		ret = append(ret, createDefinstances(env, diptr))
+	}
+	return ret
+}
+
+// FindDefinstances returns the definstances of the given name
+func (env *Environment) FindDefinstances(name string) (*Definstances, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	diptr := C.EnvFindDefinstances(env.ptr(), cname)
+	if diptr == nil {
+		return nil, NotFoundError(fmt.Errorf(`Definstances "%s" not found`, name))
+	}
+	return createDefinstances(env, diptr), nil
+}
+
+// DefineInstances defines a definstances holding the given instances, so that they are made
+// again after every Reset. Each instance may be a string of CLIPS source such as
+// "([p1] of point (x 1))", an *Instance, or an InstanceValue
+func (env *Environment) DefineInstances(name string, instances ...interface{}) (*Definstances, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "(definstances %s", name)
+	for _, inst := range instances {
+		src, err := instanceSource(inst)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "\n   %s", src)
+	}
+	b.WriteString(")")
+	if err := env.Build(b.String()); err != nil {
+		return nil, err
+	}
+	return env.FindDefinstances(name)
+}
+
+func instanceSource(inst interface{}) (string, error) {
+	switch v := inst.(type) {
+	case string:
+		return v, nil
+	case *Instance:
+		return InstanceValue{Name: v.Name(), Class: v.Class().Name(), Slots: v.Slots(true)}.source()
+	case InstanceValue:
+		return v.source()
+	case *InstanceValue:
+		return v.source()
+	}
+	return "", fmt.Errorf("Unable to define an instance from %T", inst)
+}
+
+func (iv InstanceValue) source() (string, error) {
+	slots, err := slotSource(iv.Slots)
+	if err != nil {
+		return "", err
+	}
+	name := ""
+	if iv.Name != "" {
+		name = "[" + string(iv.Name) + "] "
+	}
+	return fmt.Sprintf("(%sof %s%s)", name, iv.Class, slots), nil
+}
+
+func createDefinstances(env *Environment, diptr unsafe.Pointer) *Definstances {
+	return &Definstances{
+		env:     env,
+		diptr:   diptr,
+		name:    C.GoString(C.EnvGetDefinstancesName(env.ptr(), diptr)),
+		module:  C.GoString(C.EnvDefinstancesModule(env.ptr(), diptr)),
+		cleared: env.cleared,
+	}
+}
+
+// check returns ErrEnvironmentClosed or ErrStale if the definstances can no longer be used. A definstances
+// is stale once undefined or cleared
+func (di *Definstances) check() error {
+	return checkConstruct(di.env, DEFINSTANCES, di.diptr, qualify(di.module, di.name), di.cleared)
+}
+
+// Equal returns true if the other definstances represents the same CLIPS definstances as this one
+func (di *Definstances) Equal(other *Definstances) bool {
+	return di.diptr == other.diptr
+}
+
+func (di *Definstances) String() string {
+	if !valid(di.check()) {
+		return fmt.Sprintf("<Definstances-%s stale>", di.name)
+	}
+	cstr := C.EnvGetDefinstancesPPForm(di.env.ptr(), di.diptr)
+	return strings.TrimRight(C.GoString(cstr), "\n")
+}
+
+// Name returns the name of this definstances
+func (di *Definstances) Name() string {
+	if err := di.env.check(); err != nil {
+		panic(err)
+	}
+	return di.name
+}
+
+// Module returns the module in which this definstances is defined, or nil if it is stale
+func (di *Definstances) Module() *Module {
+	if !valid(di.check()) {
+		return nil
+	}
+	cmodname := C.EnvDefinstancesModule(di.env.ptr(), di.diptr)
+	modptr := C.EnvFindDefmodule(di.env.ptr(), cmodname)
+
+	return createModule(di.env, modptr)
+}
+
+// Deletable returns true if the definstances can be deleted from CLIPS
+func (di *Definstances) Deletable() bool {
+	if !valid(di.check()) {
+		return false
+	}
+	ret := C.EnvIsDefinstancesDeletable(di.env.ptr(), di.diptr)
+	if ret == 1 {
+		return true
+	}
+	return false
+}
+
+// Undefine undefines the definstances within CLIPS. Equivalent to undefinstances
+func (di *Definstances) Undefine() error {
+	if err := di.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefinstances(di.env.ptr(), di.diptr)
+	if ret != 1 {
+		return EnvError(di.env, `Unable to undefine definstances "%s"`, di.Name())
+	}
+	di.diptr = nil
+	return nil
+}
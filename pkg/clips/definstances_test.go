@@ -0,0 +1,101 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestDefinstances(t *testing.T) {
+	t.Run("Find definstances", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defclass Foo (is-a USER) (slot bar))`)
+		assert.NilError(t, err)
+		err = env.Build(`(definstances foos ([f1] of Foo (bar 1)))`)
+		assert.NilError(t, err)
+
+		di, err := env.FindDefinstances("foos")
+		assert.NilError(t, err)
+		assert.Equal(t, di.Name(), "foos")
+		assert.Equal(t, di.Module().Name(), "MAIN")
+		assert.Assert(t, di.Deletable())
+		assert.Assert(t, strings.HasPrefix(di.String(), "(definstances MAIN::foos"))
+
+		found := false
+		for _, other := range env.Definstances() {
+			found = found || other.Equal(di)
+		}
+		assert.Assert(t, found)
+
+		_, err = env.FindDefinstances("bogus")
+		assert.ErrorContains(t, err, `Definstances "bogus" not found`)
+
+		err = di.Undefine()
+		assert.NilError(t, err)
+		_, err = env.FindDefinstances("foos")
+		assert.Assert(t, err != nil)
+	})
+
+	t.Run("Define instances", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defclass Person (is-a USER) (slot name) (slot age) (multislot tags))`)
+		assert.NilError(t, err)
+
+		type person struct {
+			Name string   `clips:"name"`
+			Age  int      `clips:"age"`
+			Tags []Symbol `clips:"tags"`
+		}
+		class, err := env.FindClass("Person")
+		assert.NilError(t, err)
+		made, err := class.NewInstance("carl", false)
+		assert.NilError(t, err)
+		assert.NilError(t, made.SetSlot("age", 60))
+
+		_, err = env.DefineInstances("people",
+			`([ann] of Person (name "Ann") (age 34))`,
+			InstanceValue{Name: "bob", Class: "Person", Slots: person{Name: "Bob", Age: 17, Tags: []Symbol{"minor"}}},
+			&InstanceValue{Class: "Person", Slots: map[string]interface{}{"age": 1}},
+			made,
+		)
+		assert.NilError(t, err)
+
+		env.Reset()
+		instances := class.Instances()
+		assert.Equal(t, len(instances), 4)
+
+		bob, err := env.FindInstance("bob", "")
+		assert.NilError(t, err)
+		var extracted person
+		assert.NilError(t, bob.Extract(&extracted))
+		assert.DeepEqual(t, extracted, person{Name: "Bob", Age: 17, Tags: []Symbol{"minor"}})
+
+		carl, err := env.FindInstance("carl", "")
+		assert.NilError(t, err)
+		age, err := carl.Slot("age")
+		assert.NilError(t, err)
+		assert.Equal(t, age, int64(60))
+
+		_, err = env.DefineInstances("bad", 42)
+		assert.ErrorContains(t, err, "Unable to define an instance from int")
+	})
+}
@@ -0,0 +1,76 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/graph"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// DependencyGraph returns the dependencies between the constructs defined in the environment,
+// built by parsing their pretty-print forms. Constructs loaded with conserve-mem enabled have no
+// pretty-print form and are left out
+func (env *Environment) DependencyGraph() (*graph.Graph, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	var src strings.Builder
+	add := func(ppform string) {
+		if ppform != "" {
+			src.WriteString(ppform)
+			src.WriteString("\n")
+		}
+	}
+	// most listings cover only the current module, so each module is visited in turn, with
+	// its constructs following its definition so that the parser places them within it
+	for _, module := range env.Modules() {
+		add(module.String())
+		module.within(func() {
+			for _, tmpl := range env.Templates() {
+				if !tmpl.Implied() {
+					add(tmpl.String())
+				}
+			}
+			for _, class := range env.Classes() {
+				add(class.String())
+			}
+			for _, fn := range env.Functions() {
+				add(fn.String())
+			}
+			for _, gen := range env.Generics() {
+				add(gen.String())
+				for _, method := range gen.Methods() {
+					add(method.String())
+				}
+			}
+			for _, class := range env.Classes() {
+				for _, handler := range class.MessageHandlers() {
+					add(handler.String())
+				}
+			}
+			for _, rule := range env.Rules() {
+				add(rule.String())
+			}
+		})
+	}
+
+	file, err := parser.ParseString(src.String())
+	if err != nil {
+		return nil, err
+	}
+	return graph.Build([]*parser.File{file}), nil
+}
@@ -0,0 +1,91 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/graph"
+	"gotest.tools/assert"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	t.Run("Loaded constructs", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Load("testdata/dopey.clp")
+		assert.NilError(t, err)
+		err = env.Build(`(deffunction age-in-years (?months) (/ ?months 12))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule birthday
+			?p <- (prospect (age ?months))
+			=>
+			(modify ?p (age (+ ?months 12)))
+			(printout t (age-in-years ?months) crlf))`)
+		assert.NilError(t, err)
+
+		g, err := env.DependencyGraph()
+		assert.NilError(t, err)
+
+		tmpl := graph.NodeID(graph.TEMPLATE, "MAIN", "prospect")
+		assert.Assert(t, g.Node(tmpl) != nil)
+		assert.Assert(t, g.Node(graph.NodeID(graph.RULE, "MAIN", "happy_relationship")) != nil)
+
+		rule := graph.NodeID(graph.RULE, "MAIN", "birthday")
+		kinds := make(map[graph.EdgeKind]string)
+		for _, e := range g.EdgesFrom(rule) {
+			kinds[e.Kind] = e.To
+		}
+		assert.Equal(t, kinds[graph.MATCHES_ON], tmpl)
+		assert.Equal(t, kinds[graph.MODIFIES], tmpl)
+		assert.Equal(t, kinds[graph.CALLS], graph.NodeID(graph.FUNCTION, "MAIN", "age-in-years"))
+	})
+
+	t.Run("Modules", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defmodule MAIN (export deftemplate order))`)
+		assert.NilError(t, err)
+		err = env.Build(`(deftemplate MAIN::order (slot id))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule MAIN::new-order (order (id ?id)) =>)`)
+		assert.NilError(t, err)
+		// defining REPORTS makes it the current module
+		err = env.Build(`(defmodule REPORTS (import MAIN deftemplate order))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule REPORTS::report (order (id ?id)) =>)`)
+		assert.NilError(t, err)
+
+		g, err := env.DependencyGraph()
+		assert.NilError(t, err)
+
+		tmpl := graph.NodeID(graph.TEMPLATE, "MAIN", "order")
+		assert.Assert(t, g.Node(tmpl) != nil)
+		assert.Assert(t, g.Node(graph.NodeID(graph.RULE, "MAIN", "new-order")) != nil)
+		edges := g.EdgesFrom(graph.NodeID(graph.RULE, "REPORTS", "report"))
+		assert.Equal(t, len(edges), 1)
+		assert.Equal(t, edges[0].Kind, graph.MATCHES_ON)
+		assert.Equal(t, edges[0].To, tmpl)
+
+		edges = g.EdgesFrom(graph.NodeID(graph.MODULE, "REPORTS", "REPORTS"))
+		assert.Equal(t, len(edges), 1)
+		assert.Equal(t, edges[0].Kind, graph.IMPORTS)
+		edges = g.EdgesFrom(graph.NodeID(graph.MODULE, "MAIN", "MAIN"))
+		assert.Equal(t, len(edges), 1)
+		assert.Equal(t, edges[0].Kind, graph.EXPORTS)
+	})
+}
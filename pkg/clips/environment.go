@@ -16,6 +16,27 @@ package clips
 //         environment, "go-function", 'u',
 //         PTIEF callGoFunction, "callGoFunction");
 // }
+//
+// void ruleFiring(void *env, void *rule);
+//
+// static void beforeRuleFires(void *env, void *activation)
+// {
+//     ruleFiring(env, ((struct activation *) activation)->theRule);
+// }
+//
+// int add_rule_stats(void *environment)
+// {
+//     return EnvAddBeforeRunFunction(environment, "go-rule-stats", beforeRuleFires, 0);
+// }
+//
+// void environmentCleared(void *env);
+// void environmentReset(void *env);
+//
+// int add_stale_functions(void *environment)
+// {
+//     return EnvAddClearFunction(environment, "go-stale-clear", environmentCleared, 0) &&
+//         EnvAddResetFunction(environment, "go-stale-reset", environmentReset, 0);
+// }
 import "C"
 /*
    Copyright 2020 Keysight Technologies
@@ -31,10 +52,13 @@ import "C"
    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 */
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -49,43 +73,140 @@ type Environment struct {
 	callback map[string]reflect.Value
 	router   map[string]Router
 	errRtr   *ErrorRouter
+	id       uint64
+	// fired counts the firings of each rule, by qualified name, for RuleStats
+	fired map[string]int64
+	stats envStats
+	// cleared and resets count the clears and resets of the environment, so that references to
+	// the constructs and activations they free are found to be stale
+	cleared uint64
+	resets  uint64
 }
 
+// environmentObj maps CLIPS environments to their Environment, for callbacks from CLIPS. It is
+// guarded by environmentLock, since environments may be used from several goroutines at once
 var environmentObj = make(map[unsafe.Pointer]*Environment)
+var environmentLock sync.RWMutex
+
+// lifecycleLock serialises creating and destroying environments, which change state CLIPS
+// shares between them
+var lifecycleLock sync.Mutex
+
+// lookupEnvironment returns the Environment of a CLIPS environment
+func lookupEnvironment(envptr unsafe.Pointer) (*Environment, bool) {
+	environmentLock.RLock()
+	defer environmentLock.RUnlock()
+	env, ok := environmentObj[envptr]
+	return env, ok
+}
 
-// CreateEnvironment creates a new instance of a CLIPS environment
-func CreateEnvironment() *Environment {
+// lastEnvironmentID is the ID given to the environment created last
+var lastEnvironmentID uint64
+
+// liveEnvironments is the number of environments created and not yet deleted
+var liveEnvironments int64
+
+// CreateEnvironment creates a new instance of a CLIPS environment, configured by the given
+// options. It panics if an option fails; use NewEnvironment to handle the error instead
+func CreateEnvironment(opts ...Option) *Environment {
+	ret, err := NewEnvironment(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// NewEnvironment creates a new instance of a CLIPS environment, applying the given options in
+// order. If an option fails, the environment is deleted and the error returned
+func NewEnvironment(opts ...Option) (*Environment, error) {
+	lifecycleLock.Lock()
 	ret := &Environment{
 		env:      C.CreateEnvironment(),
 		callback: make(map[string]reflect.Value),
 		router:   make(map[string]Router),
+		id:       atomic.AddUint64(&lastEnvironmentID, 1),
+		fired:    make(map[string]int64),
+		stats:    newEnvStats(),
 	}
 	ret.errRtr = CreateErrorRouter(ret)
 	runtime.SetFinalizer(ret, func(env *Environment) {
 		env.Delete()
 	})
 	C.define_function(ret.env)
+	C.add_rule_stats(ret.env)
+	C.add_stale_functions(ret.env)
+	environmentLock.Lock()
 	environmentObj[ret.env] = ret
+	environmentLock.Unlock()
+	lifecycleLock.Unlock()
+	atomic.AddInt64(&liveEnvironments, 1)
 
-	return ret
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			ret.Delete()
+			return nil, err
+		}
+	}
+	return ret, nil
 }
 
 // Delete destroys the CLIPS environment
 func (env *Environment) Delete() {
 	if env.env != nil {
+		lifecycleLock.Lock()
+		defer lifecycleLock.Unlock()
+		environmentLock.Lock()
 		delete(environmentObj, env.env)
+		environmentLock.Unlock()
 		C.DestroyEnvironment(env.env)
 		env.env = nil
+		atomic.AddInt64(&liveEnvironments, -1)
+	}
+}
+
+// MemUsed returns the number of bytes of memory CLIPS has in use for the environment.
+// Equivalent to (mem-used)
+func (env *Environment) MemUsed() int64 {
+	return int64(C.EnvMemUsed(env.ptr()))
+}
+
+// ID returns a number identifying the environment, unique within the process
+func (env *Environment) ID() uint64 {
+	return env.id
+}
+
+// ptr returns the CLIPS environment for a C call, panicking with ErrEnvironmentClosed after
+// Delete rather than passing CLIPS a nil environment
+func (env *Environment) ptr() unsafe.Pointer {
+	if env.env == nil {
+		panic(ErrEnvironmentClosed)
 	}
+	return env.env
+}
+
+// check returns ErrEnvironmentClosed after Delete
+func (env *Environment) check() error {
+	if env.env == nil {
+		return ErrEnvironmentClosed
+	}
+	return nil
 }
 
 // Load loads a set of constructs into the CLIPS data base. Constructs can be in text or binary format. Equivalent to CLIPS (load)
 func (env *Environment) Load(path string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	defer env.endCall()
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	errint := int(C.EnvBload(env.env, cpath))
-	if errint != 1 {
-		errint = int(C.EnvLoad(env.env, cpath))
+	errint := int(C.EnvBload(env.ptr(), cpath))
+	if errint == 1 {
+		// a binary image replaces every construct
+		env.cleared++
+		env.resets++
+	} else {
+		errint = int(C.EnvLoad(env.ptr(), cpath))
 	}
 	if errint != 1 {
 		return EnvError(env, "Unable to load file \"%s\"", path)
@@ -93,15 +214,39 @@ func (env *Environment) Load(path string) error {
 	return nil
 }
 
+// LoadFromString loads the constructs in source into the CLIPS data base
+func (env *Environment) LoadFromString(source string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	defer env.endCall()
+	cname := C.CString("clipsgo-load")
+	defer C.free(unsafe.Pointer(cname))
+	csource := C.CString(source)
+	defer C.free(unsafe.Pointer(csource))
+
+	if C.OpenStringSource(env.ptr(), cname, csource, 0) != 1 {
+		return EnvError(env, "Unable to open string source")
+	}
+	defer C.CloseStringSource(env.ptr(), cname)
+	if C.EnvLoadConstructsFromLogicalName(env.ptr(), cname) != 1 {
+		return EnvError(env, "Unable to load constructs from string")
+	}
+	return nil
+}
+
 // Save saves the current state of the environment
 func (env *Environment) Save(path string, binary bool) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 	var errint int
 	if binary {
-		errint = int(C.EnvBsave(env.env, cpath))
+		errint = int(C.EnvBsave(env.ptr(), cpath))
 	} else {
-		errint = int(C.EnvSave(env.env, cpath))
+		errint = int(C.EnvSave(env.ptr(), cpath))
 	}
 	if errint != 1 {
 		return EnvError(env, "Unable to save to file \"%s\"", path)
@@ -111,9 +256,13 @@ func (env *Environment) Save(path string, binary bool) error {
 
 // BatchStar executes the CLIPS code found in path. Equivalent to CLIPS (batch*)
 func (env *Environment) BatchStar(path string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	defer env.endCall()
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	if C.EnvBatchStar(env.env, cpath) != 1 {
+	if C.EnvBatchStar(env.ptr(), cpath) != 1 {
 		return EnvError(env, "Unable to open file \"%s\"", path)
 	}
 	return nil
@@ -121,9 +270,13 @@ func (env *Environment) BatchStar(path string) error {
 
 // Build builds a single construct within the CLIPS environment
 func (env *Environment) Build(construct string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	defer env.endCall()
 	cconstruct := C.CString(construct)
 	defer C.free(unsafe.Pointer(cconstruct))
-	if C.EnvBuild(env.env, cconstruct) != 1 {
+	if C.EnvBuild(env.ptr(), cconstruct) != 1 {
 		return EnvError(env, "Unable to parse construct \"%s\"", construct)
 	}
 	return nil
@@ -131,12 +284,16 @@ func (env *Environment) Build(construct string) error {
 
 // Eval evaluates an expression returning its value
 func (env *Environment) Eval(construct string) (interface{}, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	defer env.endCall()
 	cconstruct := C.CString(construct)
 	defer C.free(unsafe.Pointer(cconstruct))
 
 	data := createDataObject(env)
 	defer data.Delete()
-	errint := int(C.EnvEval(env.env, cconstruct, data.byRef()))
+	errint := int(C.EnvEval(env.ptr(), cconstruct, data.byRef()))
 
 	if errint != 1 {
 		return nil, EnvError(env, "Unable to parse construct \"%s\"", construct)
@@ -144,14 +301,38 @@ func (env *Environment) Eval(construct string) (interface{}, error) {
 	return data.Value(), nil
 }
 
+// EvalContext evaluates an expression as Eval does, stopping early when ctx is done. CLIPS is
+// halted as soon as the context is done, even within a (run) or a loop, and the error of the
+// context returned
+func (env *Environment) EvalContext(ctx context.Context, construct string) (interface{}, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	var evalErr error
+	if err := env.haltWhenDone(ctx, func() {
+		ret, evalErr = env.Eval(construct)
+	}); err != nil {
+		return nil, err
+	}
+	return ret, evalErr
+}
+
 // ExtractEval evaluates an expression, storing its return value into the object passed by the user
 func (env *Environment) ExtractEval(retval interface{}, construct string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	defer env.endCall()
 	cconstruct := C.CString(construct)
 	defer C.free(unsafe.Pointer(cconstruct))
 
 	data := createDataObject(env)
 	defer data.Delete()
-	errint := int(C.EnvEval(env.env, cconstruct, data.byRef()))
+	errint := int(C.EnvEval(env.ptr(), cconstruct, data.byRef()))
 
 	if errint != 1 {
 		return EnvError(env, "Unable to parse construct \"%s\"", construct)
@@ -161,16 +342,21 @@ func (env *Environment) ExtractEval(retval interface{}, construct string) error
 
 // Reset resets the CLIPS environment
 func (env *Environment) Reset() {
-	C.EnvReset(env.env)
+	defer env.endCall()
+	C.EnvReset(env.ptr())
 }
 
 // Clear clears the CLIPS environment
 func (env *Environment) Clear() {
-	C.EnvClear(env.env)
+	defer env.endCall()
+	C.EnvClear(env.ptr())
 }
 
 // DefineFunction defines a Go function within the CLIPS environment. If the given name is "", the name of the go funciton will be used
 func (env *Environment) DefineFunction(name string, callback interface{}) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	val := reflect.ValueOf(callback)
 	if val.Kind() != reflect.Func {
 		return fmt.Errorf(`Invalid function pointer %v"`, callback)
@@ -202,6 +388,9 @@ func (env *Environment) DefineFunction(name string, callback interface{}) error
 
 // CompleteCommand checks the string to see if it is a complete command yet
 func (env *Environment) CompleteCommand(cmd string) (bool, error) {
+	if err := env.check(); err != nil {
+		return false, err
+	}
 	ccmd := C.CString(cmd + "\n")
 	defer C.free(unsafe.Pointer(ccmd))
 
@@ -217,19 +406,23 @@ func (env *Environment) CompleteCommand(cmd string) (bool, error) {
 
 // SendCommand evaluates a command as if it were typed in the CLIPS shell
 func (env *Environment) SendCommand(cmd string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	defer env.endCall()
 	ccmd := C.CString(cmd)
 	defer C.free(unsafe.Pointer(ccmd))
 
 	// Commands cribbed from the CLIPS shell, and inspired by PyCLIPS
-	C.FlushPPBuffer(env.env)
-	C.SetPPBufferStatus(env.env, 0)
-	ret := C.RouteCommand(env.env, ccmd, 1)
-	res := C.GetEvaluationError(env.env)
-	C.FlushPPBuffer(env.env)
-	C.SetHaltExecution(env.env, 0)
-	C.SetEvaluationError(env.env, 0)
-	C.CleanCurrentGarbageFrame(env.env, nil)
-	C.CallPeriodicTasks(env.env)
+	C.FlushPPBuffer(env.ptr())
+	C.SetPPBufferStatus(env.ptr(), 0)
+	ret := C.RouteCommand(env.ptr(), ccmd, 1)
+	res := C.GetEvaluationError(env.ptr())
+	C.FlushPPBuffer(env.ptr())
+	C.SetHaltExecution(env.ptr(), 0)
+	C.SetEvaluationError(env.ptr(), 0)
+	C.CleanCurrentGarbageFrame(env.ptr(), nil)
+	C.CallPeriodicTasks(env.ptr())
 	if ret == 0 || res != 0 {
 		return EnvError(env, `Unable to execute command "%s"`, cmd)
 	}
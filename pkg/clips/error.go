@@ -5,6 +5,7 @@ package clips
 // #include <clips/clips.h>
 import "C"
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -27,6 +28,30 @@ import (
    limitations under the License.
 */
 
+// ErrEnvironmentClosed is returned when an environment is used after Delete. Methods which do
+// not return an error panic with it instead
+var ErrEnvironmentClosed = errors.New("Environment has been deleted")
+
+// ErrStale is returned when a fact or instance is used after it has been retracted, unmade,
+// cleared or dropped, a construct after it has been undefined or cleared, or an activation
+// after it has left the agenda. Methods which do not return an error return zero values instead
+var ErrStale = errors.New("Reference is stale")
+
+//export environmentCleared
+func environmentCleared(envptr unsafe.Pointer) {
+	if env, ok := lookupEnvironment(envptr); ok {
+		env.cleared++
+		env.resets++
+	}
+}
+
+//export environmentReset
+func environmentReset(envptr unsafe.Pointer) {
+	if env, ok := lookupEnvironment(envptr); ok {
+		env.resets++
+	}
+}
+
 // Error error returned from CLIPS
 type Error struct {
 	Err  error
@@ -92,7 +117,7 @@ func (r *ErrorRouter) Print(name string, message string) {
 	defer C.free(unsafe.Pointer(cmessage))
 	r.Deactivate()
 	defer r.Activate()
-	C.EnvPrintRouter(r.core.env.env, cname, cmessage)
+	C.EnvPrintRouter(r.core.env.ptr(), cname, cmessage)
 }
 
 // LastMessage returns the accumulated error message and resets it
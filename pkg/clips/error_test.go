@@ -14,6 +14,8 @@ package clips
 */
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"gotest.tools/assert"
@@ -40,3 +42,376 @@ func TestError(t *testing.T) {
 		assert.Equal(t, err.Error(), "Unable to parse construct \"(create$ 1 2 3\": [EXPRNPSR2] Expected a constant, variable, or expression.")
 	})
 }
+
+func TestStaleHandles(t *testing.T) {
+	setup := func(t *testing.T) (*Environment, Fact, Fact, *Instance) {
+		env := CreateEnvironment()
+		err := env.Build(`(deftemplate point (slot x) (slot y))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defclass Foo (is-a USER) (slot bar))`)
+		assert.NilError(t, err)
+
+		implied, err := env.AssertString(`(foo a b c)`)
+		assert.NilError(t, err)
+		tmpl, err := env.AssertString(`(point (x 1) (y 2))`)
+		assert.NilError(t, err)
+		inst, err := env.MakeInstance(`([foo1] of Foo (bar 1))`)
+		assert.NilError(t, err)
+		return env, implied, tmpl, inst
+	}
+
+	assertStaleFact := func(t *testing.T, fact Fact, target error) {
+		assert.Assert(t, !fact.Asserted())
+		assert.Assert(t, fact.Template() == nil)
+		assert.Assert(t, errors.Is(fact.Retract(), target))
+		assert.Assert(t, errors.Is(fact.Assert(), target))
+		_, err := fact.Slots()
+		assert.Assert(t, errors.Is(err, target))
+		var retval interface{}
+		assert.Assert(t, errors.Is(fact.Extract(&retval), target))
+	}
+
+	assertStaleInstance := func(t *testing.T, inst *Instance, target error) {
+		assert.Equal(t, inst.Name(), InstanceName("foo1"))
+		assert.Equal(t, inst.String(), "<Instance-foo1 stale>")
+		assert.Assert(t, inst.Class() == nil)
+		assert.Assert(t, inst.Slots(true) == nil)
+		assert.Assert(t, inst.Send("print", "") == nil)
+		_, err := inst.Slot("bar")
+		assert.Assert(t, errors.Is(err, target))
+		assert.Assert(t, errors.Is(inst.SetSlot("bar", 2), target))
+		assert.Assert(t, errors.Is(inst.Unmake(), target))
+		assert.Assert(t, errors.Is(inst.Delete(), target))
+	}
+
+	t.Run("Retract and unmake", func(t *testing.T) {
+		env, implied, tmpl, inst := setup(t)
+		defer env.Delete()
+
+		index := tmpl.Index()
+		assert.NilError(t, implied.Retract())
+		assert.NilError(t, tmpl.Retract())
+		assert.NilError(t, inst.Unmake())
+
+		assertStaleFact(t, implied, ErrStale)
+		assertStaleFact(t, tmpl, ErrStale)
+		assert.Equal(t, tmpl.Index(), index)
+		assert.Equal(t, tmpl.String(), fmt.Sprintf("<Fact-%d stale>", index))
+		assertStaleInstance(t, inst, ErrStale)
+	})
+
+	t.Run("Modify", func(t *testing.T) {
+		env, _, tmpl, _ := setup(t)
+		defer env.Delete()
+
+		_, err := env.Eval(fmt.Sprintf(`(modify %d (x 3))`, tmpl.Index()))
+		assert.NilError(t, err)
+		_, err = tmpl.Slot("x")
+		assert.Assert(t, errors.Is(err, ErrStale))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		env, implied, tmpl, inst := setup(t)
+		defer env.Delete()
+
+		env.Reset()
+		assertStaleFact(t, implied, ErrStale)
+		assertStaleFact(t, tmpl, ErrStale)
+		assertStaleInstance(t, inst, ErrStale)
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		env, implied, tmpl, inst := setup(t)
+		defer env.Delete()
+
+		env.Clear()
+		assertStaleFact(t, implied, ErrStale)
+		assertStaleFact(t, tmpl, ErrStale)
+		assertStaleInstance(t, inst, ErrStale)
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		env, implied, _, inst := setup(t)
+		defer env.Delete()
+
+		implied.Drop()
+		inst.Drop()
+		assertStaleFact(t, implied, ErrStale)
+		assertStaleInstance(t, inst, ErrStale)
+	})
+
+	t.Run("Still valid", func(t *testing.T) {
+		env, implied, tmpl, inst := setup(t)
+		defer env.Delete()
+
+		assert.Assert(t, implied.Asserted())
+		assert.Assert(t, tmpl.Asserted())
+		value, err := tmpl.Slot("x")
+		assert.NilError(t, err)
+		assert.Equal(t, value, int64(1))
+		value, err = inst.Slot("bar")
+		assert.NilError(t, err)
+		assert.Equal(t, value, int64(1))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		env, implied, tmpl, inst := setup(t)
+		construct, err := env.FindConstruct(DEFTEMPLATE, "point")
+		assert.NilError(t, err)
+		env.Delete()
+
+		assertStaleFact(t, implied, ErrEnvironmentClosed)
+		assertStaleFact(t, tmpl, ErrEnvironmentClosed)
+		assertStaleInstance(t, inst, ErrEnvironmentClosed)
+		implied.Drop()
+		inst.Drop()
+
+		assert.Assert(t, errors.Is(env.Build(`(defrule foo =>)`), ErrEnvironmentClosed))
+		_, err = env.Eval(`(+ 1 2)`)
+		assert.Assert(t, errors.Is(err, ErrEnvironmentClosed))
+		_, err = env.FindRule("foo")
+		assert.Assert(t, errors.Is(err, ErrEnvironmentClosed))
+		_, err = env.AssertString(`(foo)`)
+		assert.Assert(t, errors.Is(err, ErrEnvironmentClosed))
+
+		assertPanics := func(fn func()) {
+			defer func() {
+				err, _ := recover().(error)
+				assert.Assert(t, errors.Is(err, ErrEnvironmentClosed))
+			}()
+			fn()
+		}
+		assertPanics(func() { env.Facts() })
+		assertPanics(func() { env.Reset() })
+		assertPanics(func() { env.Run(-1) })
+		assertPanics(func() { construct.Name() })
+
+		// deleting twice is harmless
+		env.Delete()
+	})
+}
+
+func TestStaleConstructs(t *testing.T) {
+	type constructs struct {
+		tmpl    *Template
+		slot    *TemplateSlot
+		rule    *Rule
+		class   *Class
+		cslot   *ClassSlot
+		handler *MessageHandler
+		fn      *Function
+		generic *Generic
+		method  *Method
+		global  *Global
+		module  *Module
+		facts   *Deffacts
+		insts   *Definstances
+	}
+
+	setup := func(t *testing.T) (*Environment, *constructs) {
+		env := CreateEnvironment()
+		err := env.LoadFromString(`
+(defmodule MAIN (export ?ALL))
+(deftemplate point (slot x) (slot y))
+(defrule origin (point (x 0) (y 0)) =>)
+(defclass Foo (is-a USER) (slot bar))
+(defmessage-handler Foo hello () (return 1))
+(deffunction twice (?x) (* 2 ?x))
+(defgeneric area)
+(defmethod area ((?x INTEGER)) (* ?x ?x))
+(defglobal ?*limit* = 3)
+(deffacts points (point (x 0) (y 0)))
+(definstances foos ([foo1] of Foo))
+(defmodule OTHER)
+`)
+		assert.NilError(t, err)
+
+		c := &constructs{}
+		c.tmpl, err = env.FindTemplate("point")
+		assert.NilError(t, err)
+		c.slot = c.tmpl.Slots()["x"]
+		c.rule, err = env.FindRule("origin")
+		assert.NilError(t, err)
+		c.class, err = env.FindClass("Foo")
+		assert.NilError(t, err)
+		c.cslot, err = c.class.Slot("bar")
+		assert.NilError(t, err)
+		c.handler, err = c.class.FindMessageHandler("hello", PRIMARY)
+		assert.NilError(t, err)
+		c.fn, err = env.FindFunction("twice")
+		assert.NilError(t, err)
+		c.generic, err = env.FindGeneric("area")
+		assert.NilError(t, err)
+		c.method = c.generic.Methods()[0]
+		c.global, err = env.FindGlobal("limit")
+		assert.NilError(t, err)
+		c.module, err = env.FindModule("OTHER")
+		assert.NilError(t, err)
+		c.facts, err = env.FindDeffacts("points")
+		assert.NilError(t, err)
+		c.insts, err = env.FindDefinstances("foos")
+		assert.NilError(t, err)
+		return env, c
+	}
+
+	t.Run("Clear", func(t *testing.T) {
+		env, c := setup(t)
+		defer env.Delete()
+
+		env.Clear()
+
+		assert.Equal(t, c.tmpl.Name(), "point")
+		assert.Equal(t, c.tmpl.String(), "<Template-point stale>")
+		assert.Assert(t, c.tmpl.Module() == nil)
+		assert.Assert(t, c.tmpl.Slots() == nil)
+		_, err := c.tmpl.NewFact()
+		assert.Assert(t, errors.Is(err, ErrStale))
+		assert.Assert(t, c.slot.Types() == nil)
+		assert.Assert(t, !c.slot.Multifield())
+
+		assert.Equal(t, c.rule.String(), "<Rule-origin stale>")
+		_, err = c.rule.Matches(SUCCINCT)
+		assert.Assert(t, errors.Is(err, ErrStale))
+
+		assert.Equal(t, c.class.String(), "<Class-Foo stale>")
+		assert.Assert(t, c.class.Slots(true) == nil)
+		_, err = c.class.NewInstance("foo2", false)
+		assert.Assert(t, errors.Is(err, ErrStale))
+		assert.Assert(t, c.cslot.Types() == nil)
+		assert.Equal(t, c.handler.String(), "<MessageHandler-hello stale>")
+		assert.Assert(t, !c.handler.Deletable())
+
+		assert.Equal(t, c.fn.String(), "<Function-twice stale>")
+		_, err = c.fn.Call("3")
+		assert.Assert(t, errors.Is(err, ErrStale))
+		assert.Equal(t, c.generic.String(), "<Generic-area stale>")
+		_, err = c.generic.Call("3")
+		assert.Assert(t, errors.Is(err, ErrStale))
+		assert.Assert(t, c.generic.Methods() == nil)
+		assert.Equal(t, c.method.String(), "<Method-area#1 stale>")
+		assert.Assert(t, c.method.Restrictions() == nil)
+
+		assert.Equal(t, c.global.String(), "<Global-limit stale>")
+		_, err = c.global.Value()
+		assert.Assert(t, errors.Is(err, ErrStale))
+		assert.Assert(t, errors.Is(c.global.SetValue(4), ErrStale))
+
+		assert.Equal(t, c.module.Name(), "OTHER")
+		assert.Equal(t, c.module.String(), "<Module-OTHER stale>")
+		assert.Assert(t, c.module.Rules() == nil)
+		assert.Assert(t, errors.Is(c.module.Build(`(deftemplate bar)`), ErrStale))
+
+		assert.Equal(t, c.facts.String(), "<Deffacts-points stale>")
+		assert.Assert(t, errors.Is(c.facts.Undefine(), ErrStale))
+		assert.Equal(t, c.insts.String(), "<Definstances-foos stale>")
+		assert.Assert(t, errors.Is(c.insts.Undefine(), ErrStale))
+
+		// a construct defined again under the same name is a new construct
+		err = env.Build(`(deftemplate point (slot x))`)
+		assert.NilError(t, err)
+		assert.Assert(t, c.tmpl.Slots() == nil)
+		assert.Assert(t, errors.Is(c.tmpl.Undefine(), ErrStale))
+	})
+
+	t.Run("Undefine", func(t *testing.T) {
+		env, c := setup(t)
+		defer env.Delete()
+
+		assert.NilError(t, c.rule.Undefine())
+		assert.NilError(t, c.facts.Undefine())
+		// other references to an undefined construct are stale too
+		tmpl, err := env.FindTemplate("point")
+		assert.NilError(t, err)
+		assert.NilError(t, tmpl.Undefine())
+		assert.Equal(t, c.tmpl.String(), "<Template-point stale>")
+		assert.Assert(t, errors.Is(c.tmpl.Undefine(), ErrStale))
+		assert.Assert(t, c.slot.DefaultValue() == nil)
+		assert.Equal(t, c.rule.String(), "<Rule-origin stale>")
+		assert.Assert(t, errors.Is(c.rule.Undefine(), ErrStale))
+		assert.Assert(t, errors.Is(c.facts.Undefine(), ErrStale))
+
+		assert.NilError(t, c.handler.Undefine())
+		assert.Assert(t, errors.Is(c.handler.Undefine(), ErrStale))
+		assert.NilError(t, c.insts.Undefine())
+		assert.NilError(t, c.class.Undefine())
+		assert.Equal(t, c.class.String(), "<Class-Foo stale>")
+		assert.Assert(t, c.cslot.DefaultValue() == nil)
+
+		assert.NilError(t, c.fn.Undefine())
+		_, err = c.fn.Call("3")
+		assert.Assert(t, errors.Is(err, ErrStale))
+		assert.NilError(t, c.method.Undefine())
+		assert.Equal(t, c.method.String(), "<Method-area#1 stale>")
+		assert.NilError(t, c.generic.Undefine())
+		assert.Assert(t, errors.Is(c.generic.Undefine(), ErrStale))
+		assert.NilError(t, c.global.Undefine())
+		_, err = c.global.Value()
+		assert.Assert(t, errors.Is(err, ErrStale))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		env, c := setup(t)
+		defer env.Delete()
+
+		env.Reset()
+		acts := env.Activations()
+		assert.Equal(t, len(acts), 1)
+		act := acts[0]
+		assert.Equal(t, act.Salience(), 0)
+		// checking an activation neither needs nor changes the current module
+		env.SetModule(c.module)
+		assert.Assert(t, act.String() != "<Activation-origin stale>")
+		assert.Equal(t, env.CurrentModule().Name(), "OTHER")
+
+		// constructs survive a reset, but activations do not
+		env.Reset()
+		assert.Equal(t, c.rule.Name(), "origin")
+		assert.Equal(t, c.tmpl.Module().Name(), "MAIN")
+		assert.Equal(t, act.Name(), "origin")
+		assert.Equal(t, act.String(), "<Activation-origin stale>")
+		assert.Assert(t, errors.Is(act.Remove(), ErrStale))
+
+		act = env.Activations()[0]
+		env.Run(-1)
+		assert.Assert(t, errors.Is(act.Remove(), ErrStale))
+	})
+
+	t.Run("Still valid", func(t *testing.T) {
+		env, c := setup(t)
+		defer env.Delete()
+
+		assert.Assert(t, c.tmpl.Slots() != nil)
+		assert.Assert(t, c.slot.Types() != nil)
+		assert.Equal(t, len(c.module.Rules()), 0)
+		value, err := c.global.Value()
+		assert.NilError(t, err)
+		assert.Equal(t, value, int64(3))
+		value, err = c.generic.Call("3")
+		assert.NilError(t, err)
+		assert.Equal(t, value, int64(9))
+		assert.Equal(t, c.handler.Type(), PRIMARY)
+
+		env.Reset()
+		act := env.Activations()[0]
+		assert.NilError(t, act.Remove())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		env, c := setup(t)
+		env.Delete()
+
+		assert.Assert(t, errors.Is(c.tmpl.Undefine(), ErrEnvironmentClosed))
+		_, err := c.global.Value()
+		assert.Assert(t, errors.Is(err, ErrEnvironmentClosed))
+		assertPanics := func(fn func()) {
+			defer func() {
+				err, _ := recover().(error)
+				assert.Assert(t, errors.Is(err, ErrEnvironmentClosed))
+			}()
+			fn()
+		}
+		assertPanics(func() { c.rule.WatchedFirings() })
+		assertPanics(func() { c.class.Slots(true) })
+		assertPanics(func() { c.module.Rules() })
+	})
+}
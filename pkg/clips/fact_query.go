@@ -0,0 +1,143 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Condition selects the facts returned by FindFacts
+type Condition func(fact Fact) bool
+
+// SlotEquals returns a Condition matching facts whose slot has the given value. Go integer
+// and float types match the CLIPS INTEGER and FLOAT values they would be stored as
+func SlotEquals(slot string, value interface{}) Condition {
+	value = normalizeValue(value)
+	return func(fact Fact) bool {
+		current, err := fact.Slot(slot)
+		if err != nil {
+			return false
+		}
+		return reflect.DeepEqual(current, value)
+	}
+}
+
+// normalizeValue converts Go numbers to the int64 and float64 values that CLIPS returns
+func normalizeValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice:
+		if _, ok := value.([]interface{}); ok {
+			ret := make([]interface{}, v.Len())
+			for i := range ret {
+				ret[i] = normalizeValue(v.Index(i).Interface())
+			}
+			return ret
+		}
+	}
+	return value
+}
+
+// FindFacts returns the facts of the named template which match all of the given conditions
+func (env *Environment) FindFacts(template string, where ...Condition) ([]Fact, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	tmpl, err := env.FindTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Fact, 0, 10)
+facts:
+	for _, fact := range tmpl.Facts() {
+		for _, cond := range where {
+			if !cond(fact) {
+				continue facts
+			}
+		}
+		ret = append(ret, fact)
+	}
+	return ret, nil
+}
+
+// FindAllFacts runs a CLIPS fact-set query, given as the arguments to find-all-facts. For
+// example, "((?o order)) (eq ?o:state new)". If the fact-set has more than one member, the
+// members of each matching set are returned one after another
+func (env *Environment) FindAllFacts(query string) ([]Fact, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	ret, err := env.Eval(fmt.Sprintf("(find-all-facts %s)", query))
+	if err != nil {
+		return nil, err
+	}
+	values, ok := ret.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf(`Unexpected result of fact query "%s"`, query)
+	}
+	facts := make([]Fact, 0, len(values))
+	for _, value := range values {
+		fact, ok := value.(Fact)
+		if !ok {
+			return nil, fmt.Errorf(`Unexpected result of fact query "%s"`, query)
+		}
+		facts = append(facts, fact)
+	}
+	return facts, nil
+}
+
+// DoForAllFacts runs a CLIPS action for each fact-set matching a query, given as the
+// arguments to find-all-facts. The result of the last action is returned
+func (env *Environment) DoForAllFacts(query string, action string) (interface{}, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	return env.Eval(fmt.Sprintf("(do-for-all-facts %s %s)", query, action))
+}
+
+// ExtractFacts unmarshals each fact into an element of the user provided slice pointer, such
+// as *[]T or *[]*T
+func (env *Environment) ExtractFacts(retval interface{}, facts []Fact) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	return extractSlice(retval, len(facts), func(ii int, elem interface{}) error {
+		return facts[ii].Extract(elem)
+	})
+}
+
+// extractSlice replaces the slice retval points to with one of n elements, each of which is
+// filled in by extract given a pointer to it
+func extractSlice(retval interface{}, n int, extract func(ii int, elem interface{}) error) error {
+	ptr := reflect.ValueOf(retval)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Unable to extract to %T, a pointer to a slice is required", retval)
+	}
+	slice := reflect.MakeSlice(ptr.Elem().Type(), n, n)
+	for ii := 0; ii < n; ii++ {
+		if err := extract(ii, slice.Index(ii).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	ptr.Elem().Set(slice)
+	return nil
+}
@@ -0,0 +1,145 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestFactQuery(t *testing.T) {
+	setup := func(t *testing.T) *Environment {
+		env := CreateEnvironment()
+		err := env.Build(`(deftemplate order (slot id) (slot state) (multislot items))`)
+		assert.NilError(t, err)
+		err = env.LoadFactsFromString(`
+		(order (id 1) (state new) (items a b))
+		(foo bar)
+		(order (id 2) (state shipped))
+		(order (id 3) (state new) (items c))
+		`)
+		assert.NilError(t, err)
+		return env
+	}
+
+	t.Run("Template facts", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		tmpl, err := env.FindTemplate("order")
+		assert.NilError(t, err)
+		facts := tmpl.Facts()
+		assert.Equal(t, len(facts), 3)
+		assert.Equal(t, facts[0].String(), "(order (id 1) (state new) (items a b))")
+		assert.Equal(t, facts[2].String(), "(order (id 3) (state new) (items c))")
+	})
+
+	t.Run("Find by index", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		fact, err := env.FindFactByIndex(2)
+		assert.NilError(t, err)
+		assert.Equal(t, fact.String(), "(foo bar)")
+
+		_, err = env.FindFactByIndex(99)
+		assert.ErrorContains(t, err, `"f-99" not found`)
+	})
+
+	t.Run("Find facts", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		facts, err := env.FindFacts("order", SlotEquals("state", Symbol("new")))
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+		assert.Equal(t, facts[1].Index(), 4)
+
+		facts, err = env.FindFacts("order", SlotEquals("state", Symbol("new")), SlotEquals("id", 3))
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 1)
+
+		facts, err = env.FindFacts("order", func(f Fact) bool {
+			items, _ := f.Slot("items")
+			return len(items.([]interface{})) == 0
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 1)
+		assert.Equal(t, facts[0].Index(), 3)
+
+		_, err = env.FindFacts("bogus")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("Find all facts", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		facts, err := env.FindAllFacts(`((?o order)) (eq ?o:state new)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+		assert.Equal(t, facts[0].Index(), 1)
+		assert.Equal(t, facts[1].Index(), 4)
+
+		facts, err = env.FindAllFacts(`((?o order)) (> ?o:id 10)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 0)
+
+		_, err = env.FindAllFacts(`((?o order)`)
+		assert.Assert(t, err != nil)
+	})
+
+	t.Run("Do for all facts", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		_, err := env.DoForAllFacts(`((?o order)) (eq ?o:state new)`, `(modify ?o (state packed))`)
+		assert.NilError(t, err)
+		facts, err := env.FindFacts("order", SlotEquals("state", Symbol("packed")))
+		assert.NilError(t, err)
+		assert.Equal(t, len(facts), 2)
+	})
+
+	t.Run("Extract facts", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		type order struct {
+			ID    int64         `clips:"id"`
+			State Symbol        `clips:"state"`
+			Items []interface{} `clips:"items"`
+		}
+		facts, err := env.FindAllFacts(`((?o order)) TRUE`)
+		assert.NilError(t, err)
+
+		var orders []order
+		err = env.ExtractFacts(&orders, facts)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, orders, []order{
+			{ID: 1, State: "new", Items: []interface{}{Symbol("a"), Symbol("b")}},
+			{ID: 2, State: "shipped", Items: []interface{}{}},
+			{ID: 3, State: "new", Items: []interface{}{Symbol("c")}},
+		})
+
+		var ptrs []*order
+		err = env.ExtractFacts(&ptrs, facts[:1])
+		assert.NilError(t, err)
+		assert.Equal(t, ptrs[0].ID, int64(1))
+
+		err = env.ExtractFacts(orders, facts)
+		assert.ErrorContains(t, err, "pointer to a slice")
+	})
+}
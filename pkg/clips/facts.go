@@ -8,6 +8,11 @@ package clips
 // {
 //   return ((struct deftemplate*)template)->implied;
 // }
+//
+// long long fact_timetag(void *fact)
+// {
+//   return (long long)((struct fact*)fact)->factHeader.timeTag;
+// }
 import "C"
 /*
    Copyright 2020 Keysight Technologies
@@ -69,19 +74,49 @@ type Fact interface {
 // Facts returns a slice of all facts known to CLIPS
 func (env *Environment) Facts() []Fact {
 	ret := make([]Fact, 0, 10)
-	factptr := C.EnvGetNextFact(env.env, nil)
+	factptr := C.EnvGetNextFact(env.ptr(), nil)
 	for factptr != nil {
 		ret = append(ret, env.newFact(factptr))
-		factptr = C.EnvGetNextFact(env.env, factptr)
+		factptr = C.EnvGetNextFact(env.ptr(), factptr)
+	}
+	return ret
+}
+
+// factCount returns the number of facts, without creating a Fact for each
+func (env *Environment) factCount() int {
+	ret := 0
+	for factptr := C.EnvGetNextFact(env.ptr(), nil); factptr != nil; factptr = C.EnvGetNextFact(env.ptr(), factptr) {
+		ret++
 	}
 	return ret
 }
 
+// FindFactByIndex returns the fact with the given index, such as 3 for f-3
+func (env *Environment) FindFactByIndex(index int) (Fact, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	for factptr := C.EnvGetNextFact(env.ptr(), nil); factptr != nil; factptr = C.EnvGetNextFact(env.ptr(), factptr) {
+		current := int(C.EnvFactIndex(env.ptr(), factptr))
+		if current == index {
+			return env.newFact(factptr), nil
+		}
+		// the fact list is kept in index order
+		if current > index {
+			break
+		}
+	}
+	return nil, NotFoundError(fmt.Errorf(`Fact "f-%d" not found`, index))
+}
+
 // AssertString asserts a fact as a string.
 func (env *Environment) AssertString(factstr string) (Fact, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cfactstr := C.CString(factstr)
 	defer C.free(unsafe.Pointer(cfactstr))
-	factptr := C.EnvAssertString(env.env, cfactstr)
+	factptr := C.EnvAssertString(env.ptr(), cfactstr)
 	if factptr == nil {
 		return nil, EnvError(env, `Error asserting fact "%s"`, factstr)
 	}
@@ -90,10 +125,13 @@ func (env *Environment) AssertString(factstr string) (Fact, error) {
 
 // LoadFacts loads facts from the given file
 func (env *Environment) LoadFacts(filename string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cfilename := C.CString(filename)
 	defer C.free(unsafe.Pointer(cfilename))
 
-	retcode := C.EnvLoadFacts(env.env, cfilename)
+	retcode := C.EnvLoadFacts(env.ptr(), cfilename)
 	if retcode == -1 {
 		return EnvError(env, `Error loading facts from "%s"`, filename)
 	}
@@ -102,10 +140,13 @@ func (env *Environment) LoadFacts(filename string) error {
 
 // LoadFactsFromString loads facts from the given string
 func (env *Environment) LoadFactsFromString(factstr string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cfactstr := C.CString(factstr)
 	defer C.free(unsafe.Pointer(cfactstr))
 
-	retcode := C.EnvLoadFactsFromString(env.env, cfactstr, -1)
+	retcode := C.EnvLoadFactsFromString(env.ptr(), cfactstr, -1)
 	if retcode == -1 {
 		return EnvError(env, `Error loading facts from string`)
 	}
@@ -114,10 +155,13 @@ func (env *Environment) LoadFactsFromString(factstr string) error {
 
 // SaveFacts saves facts to the given file
 func (env *Environment) SaveFacts(filename string, savemode SaveMode) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cfilename := C.CString(filename)
 	defer C.free(unsafe.Pointer(cfilename))
 
-	retcode := C.EnvSaveFacts(env.env, cfilename, savemode.CVal())
+	retcode := C.EnvSaveFacts(env.ptr(), cfilename, savemode.CVal())
 	if retcode == -1 {
 		return EnvError(env, `Error saving facts to "%s"`, filename)
 	}
@@ -127,7 +171,7 @@ func (env *Environment) SaveFacts(filename string, savemode SaveMode) error {
 // Templates returns a slice of all defined templates
 func (env *Environment) Templates() []*Template {
 	ret := make([]*Template, 0, 10)
-	for tplptr := C.EnvGetNextDeftemplate(env.env, nil); tplptr != nil; tplptr = C.EnvGetNextDeftemplate(env.env, tplptr) {
+	for tplptr := C.EnvGetNextDeftemplate(env.ptr(), nil); tplptr != nil; tplptr = C.EnvGetNextDeftemplate(env.ptr(), tplptr) {
 		ret = append(ret, createTemplate(env, tplptr))
 	}
 	return ret
@@ -135,9 +179,12 @@ func (env *Environment) Templates() []*Template {
 
 // FindTemplate returns an object representing the given template name
 func (env *Environment) FindTemplate(name string) (*Template, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	tplptr := C.EnvFindDeftemplate(env.env, cname)
+	tplptr := C.EnvFindDeftemplate(env.ptr(), cname)
 	if tplptr == nil {
 		return nil, fmt.Errorf(`Template "%s" not found`, name)
 	}
@@ -145,24 +192,56 @@ func (env *Environment) FindTemplate(name string) (*Template, error) {
 }
 
 func (env *Environment) newFact(fact unsafe.Pointer) Fact {
-	templ := C.EnvFactDeftemplate(env.env, fact)
+	templ := C.EnvFactDeftemplate(env.ptr(), fact)
 	if C.implied_deftemplate(templ) == 1 {
 		return createImpliedFact(env, fact)
 	}
 	return createTemplateFact(env, fact)
 }
 
+// factID identifies the asserted fact a pointer refers to, so that a pointer to a fact since
+// retracted is detected. Index is 0 until the fact is asserted
+type factID struct {
+	index   int
+	timetag int64
+}
+
+func readFactID(env *Environment, factptr unsafe.Pointer) factID {
+	if C.EnvFactExistp(env.ptr(), factptr) != 1 {
+		return factID{}
+	}
+	return factID{
+		index:   int(C.EnvFactIndex(env.ptr(), factptr)),
+		timetag: int64(C.fact_timetag(factptr)),
+	}
+}
+
+// checkFact returns ErrEnvironmentClosed or ErrStale if the fact can no longer be used. A fact
+// is stale once dropped, or once retracted if it had been asserted
+func checkFact(env *Environment, factptr unsafe.Pointer, id factID) error {
+	if env.env == nil {
+		return ErrEnvironmentClosed
+	}
+	if factptr == nil {
+		return fmt.Errorf("Fact has been dropped: %w", ErrStale)
+	}
+	if id.index != 0 && readFactID(env, factptr) != id {
+		return fmt.Errorf("Fact f-%d is no longer asserted: %w", id.index, ErrStale)
+	}
+	return nil
+}
+
 func factPPString(env *Environment, factptr unsafe.Pointer) string {
 	// TODO grow buf if we fill the 1k buffer, and try again
 	var bufsize C.ulong = 1024
 	buf := (*C.char)(C.malloc(C.sizeof_char * bufsize))
 	defer C.free(unsafe.Pointer(buf))
-	C.EnvGetFactPPForm(env.env, buf, bufsize-1, factptr)
+	C.EnvGetFactPPForm(env.ptr(), buf, bufsize-1, factptr)
 	return C.GoString(buf)
 }
 
 func slotValue(env *Environment, factptr unsafe.Pointer, slot Symbol) (*DataObject, error) {
-	implied := C.implied_deftemplate(C.EnvFactDeftemplate(env.env, factptr))
+	implied := C.implied_deftemplate(C.EnvFactDeftemplate(env.ptr(), factptr))
 
 	if implied == 1 && slot != "" {
 		return nil, fmt.Errorf("Invalid call to slotValue")
@@ -174,7 +253,7 @@ func slotValue(env *Environment, factptr unsafe.Pointer, slot Symbol) (*DataObje
 		defer C.free(unsafe.Pointer(cslot))
 	}
 	data := createDataObject(env)
-	ret := C.EnvGetFactSlot(env.env, factptr, cslot, data.byRef())
+	ret := C.EnvGetFactSlot(env.ptr(), factptr, cslot, data.byRef())
 	if ret != 1 {
 		data.Delete()
 		return nil, EnvError(env, "Unable to get slot value")
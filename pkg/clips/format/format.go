@@ -0,0 +1,366 @@
+package format
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+)
+
+// Indent is the indentation used for each nesting level. It matches the
+// pretty-print form produced by CLIPS itself
+const Indent = "   "
+
+// Width is the line width beyond which lists are broken over several lines
+const Width = 80
+
+type node struct {
+	tok      lexer.Token
+	children []*node
+	list     bool
+	glued    bool
+	trailing bool
+	newlines int
+}
+
+// Source formats CLIPS source into its canonical layout. Comments are kept.
+// Formatting already formatted source returns it unchanged
+func Source(src []byte) ([]byte, error) {
+	toks, err := lexer.Tokenize(string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	top, err := p.parseItems(true)
+	if err != nil {
+		return nil, err
+	}
+	pr := &printer{}
+	pr.topLevel(top)
+	return []byte(pr.out.String()), nil
+}
+
+// String is a convenience wrapper around Source
+func String(src string) (string, error) {
+	ret, err := Source([]byte(src))
+	return string(ret), err
+}
+
+type parser struct {
+	toks []lexer.Token
+	idx  int
+}
+
+func (p *parser) parseItems(top bool) ([]*node, error) {
+	ret := make([]*node, 0, 4)
+	for p.idx < len(p.toks) {
+		tok := p.toks[p.idx]
+		n := &node{
+			tok:      tok,
+			glued:    !tok.Spaced,
+			newlines: tok.Newlines,
+		}
+		switch tok.Kind {
+		case lexer.RPAREN:
+			if top {
+				return nil, &lexer.Error{Pos: tok.Pos, Msg: "unexpected )"}
+			}
+			return ret, nil
+		case lexer.LPAREN:
+			p.idx++
+			children, err := p.parseItems(false)
+			if err != nil {
+				return nil, err
+			}
+			if p.idx >= len(p.toks) {
+				return nil, &lexer.Error{Pos: tok.Pos, Msg: "unbalanced ("}
+			}
+			n.list = true
+			n.children = children
+		case lexer.COMMENT:
+			n.tok.Value = strings.TrimRight(tok.Value, " \t\r")
+			n.trailing = len(ret) > 0 && tok.Newlines == 0
+		}
+		p.idx++
+		ret = append(ret, n)
+	}
+	if !top {
+		return nil, &lexer.Error{Pos: p.toks[len(p.toks)-1].End, Msg: "unexpected end of input"}
+	}
+	return ret, nil
+}
+
+func (n *node) comment() bool {
+	return !n.list && n.tok.Kind == lexer.COMMENT
+}
+
+func (n *node) hasComment() bool {
+	if n.comment() {
+		return true
+	}
+	for _, c := range n.children {
+		if c.hasComment() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) construct() bool {
+	return lexer.IsConstruct(n.head())
+}
+
+func (n *node) head() string {
+	if !n.list || len(n.children) == 0 || n.children[0].list {
+		return ""
+	}
+	return n.children[0].tok.Value
+}
+
+// joined returns true if no space is wanted between the previous node and this one
+func (n *node) joined(prev *node) bool {
+	if prev == nil || n.comment() {
+		return false
+	}
+	if !n.list && n.tok.Kind == lexer.OPERATOR {
+		// & and | join the constraints either side of them, while ~ only follows another
+		// connective, as in ~red&~blue
+		if n.tok.Value != "~" {
+			return true
+		}
+		return !prev.list && prev.tok.Kind == lexer.OPERATOR
+	}
+	if prev.list {
+		return false
+	}
+	if prev.tok.Kind == lexer.OPERATOR {
+		return true
+	}
+	// connective constraints such as ?x&:(> ?x 1) or =(+ 1 2)
+	return n.list && n.glued && (prev.tok.Value == ":" || prev.tok.Value == "=")
+}
+
+// groups splits children into runs which must be printed without a line break between them
+func groups(children []*node) [][]*node {
+	ret := make([][]*node, 0, len(children))
+	var prev *node
+	for _, c := range children {
+		if len(ret) > 0 && c.joined(prev) {
+			ret[len(ret)-1] = append(ret[len(ret)-1], c)
+		} else {
+			ret = append(ret, []*node{c})
+		}
+		prev = c
+	}
+	return ret
+}
+
+func (n *node) flat() string {
+	if !n.list {
+		return n.tok.Value
+	}
+	var b strings.Builder
+	b.WriteString("(")
+	for ii, g := range groups(n.children) {
+		if ii > 0 {
+			b.WriteString(" ")
+		}
+		for _, c := range g {
+			b.WriteString(c.flat())
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+type printer struct {
+	out strings.Builder
+	col int
+	// comment is true when the last thing written was a comment, so a line break must follow
+	comment bool
+}
+
+func (pr *printer) write(s string) {
+	pr.out.WriteString(s)
+	if idx := strings.LastIndex(s, "\n"); idx >= 0 {
+		pr.col = len(s) - idx - 1
+	} else {
+		pr.col += len(s)
+	}
+	pr.comment = false
+}
+
+func (pr *printer) newline(indent int) {
+	pr.out.WriteString("\n")
+	pr.out.WriteString(strings.Repeat(" ", indent))
+	pr.col = indent
+	pr.comment = false
+}
+
+func (pr *printer) topLevel(items []*node) {
+	var prev *node
+	for _, n := range items {
+		if prev != nil {
+			switch {
+			case n.comment() && n.trailing:
+				pr.write(" ")
+			case prev.comment() && !prev.trailing && n.newlines < 2:
+				// comments stay attached to whatever follows them
+				pr.newline(0)
+			case !prev.comment() && !n.comment() && !prev.construct() && !n.construct() && n.newlines < 2:
+				// plain data, such as a facts file, keeps one item per line
+				pr.newline(0)
+			default:
+				pr.write("\n")
+				pr.newline(0)
+			}
+		}
+		pr.node(n)
+		prev = n
+	}
+	if prev != nil {
+		pr.write("\n")
+	}
+}
+
+func (pr *printer) node(n *node) {
+	if !n.list {
+		pr.write(n.tok.Value)
+		pr.comment = n.comment()
+		return
+	}
+	if n.construct() {
+		pr.construct(n)
+		return
+	}
+	if !n.hasComment() {
+		flat := n.flat()
+		if pr.col+len(flat) <= Width {
+			pr.write(flat)
+			return
+		}
+	}
+	pr.broken(n)
+}
+
+func (pr *printer) group(g []*node) {
+	for _, c := range g {
+		pr.node(c)
+	}
+}
+
+// separate writes what is needed between two groups of a broken list
+func (pr *printer) separate(g []*node, indent int, sameLine bool) {
+	switch {
+	case g[0].comment() && g[0].trailing && !pr.comment:
+		pr.write(" ")
+	case sameLine && !pr.comment && !g[0].comment():
+		pr.write(" ")
+	default:
+		pr.newline(indent)
+	}
+}
+
+func (pr *printer) close(indent int) {
+	if pr.comment {
+		pr.newline(indent)
+	}
+	pr.write(")")
+}
+
+// broken prints a list over several lines, keeping the head and its first argument together
+func (pr *printer) broken(n *node) {
+	inner := pr.col + len(Indent)
+	pr.write("(")
+	gs := groups(n.children)
+	for ii := 0; ii < len(gs); ii++ {
+		if ii > 0 {
+			pr.separate(gs[ii], inner, ii == 1 && !n.children[0].list)
+		}
+		ii = pr.binding(gs, ii)
+	}
+	pr.close(inner)
+}
+
+// binding prints the group at ii, along with the rest of a pattern binding such as
+// ?f <- (a ?x) if it starts one, and returns the index of the last group printed
+func (pr *printer) binding(gs [][]*node, ii int) int {
+	pr.group(gs[ii])
+	if ii+2 >= len(gs) || pr.comment || len(gs[ii]) > 1 || gs[ii][0].list || gs[ii][0].tok.Kind != lexer.VARIABLE {
+		return ii
+	}
+	arrow := gs[ii+1][0]
+	if len(gs[ii+1]) > 1 || arrow.list || arrow.tok.Value != "<-" || gs[ii+2][0].comment() {
+		return ii
+	}
+	pr.write(" <- ")
+	pr.group(gs[ii+2])
+	return ii + 2
+}
+
+// construct prints a construct with its header on the first line and each remaining element on its own line
+func (pr *printer) construct(n *node) {
+	inner := pr.col + len(Indent)
+	head := n.head()
+	pr.write("(")
+	gs := groups(n.children)
+	ii := 0
+	for ; ii < len(gs); ii++ {
+		c := gs[ii][0]
+		if ii > 0 && (len(gs[ii]) > 1 || !headerAtom(c)) {
+			break
+		}
+		if ii > 0 {
+			pr.write(" ")
+		}
+		pr.group(gs[ii])
+	}
+	for ; ii < len(gs); ii++ {
+		g := gs[ii]
+		if head == "defglobal" && !g[0].comment() && strings.HasPrefix(g[0].tok.Value, "?*") {
+			// keep each ?*name* = value assignment on one line
+			pr.separate(g, inner, false)
+			pr.group(g)
+			for ii+1 < len(gs) && !gs[ii+1][0].comment() {
+				ii++
+				pr.write(" ")
+				pr.group(gs[ii])
+				if gs[ii][0].tok.Value != "=" || len(gs[ii]) > 1 {
+					break
+				}
+			}
+			continue
+		}
+		pr.separate(g, inner, false)
+		ii = pr.binding(gs, ii)
+	}
+	pr.close(inner)
+}
+
+func headerAtom(n *node) bool {
+	if n.list || n.comment() {
+		return false
+	}
+	switch n.tok.Kind {
+	case lexer.SYMBOL, lexer.INTEGER:
+	default:
+		return false
+	}
+	if n.tok.Value == "=>" {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package format
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestFormat(t *testing.T) {
+	t.Run("Rule layout", func(t *testing.T) {
+		out, err := String(`(defrule foo "a rule" (declare (salience 10)) (a ?x) (b ?x) => (assert (c ?x)))`)
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(defrule foo
+   "a rule"
+   (declare (salience 10))
+   (a ?x)
+   (b ?x)
+   =>
+   (assert (c ?x)))
+`)
+	})
+
+	t.Run("Template slots", func(t *testing.T) {
+		out, err := String("(deftemplate foo (slot bar (type INTEGER)) (multislot baz))")
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(deftemplate foo
+   (slot bar (type INTEGER))
+   (multislot baz))
+`)
+	})
+
+	t.Run("Long calls are broken", func(t *testing.T) {
+		out, err := String(`(deffunction f (?x) (if (> ?x 3) then (printout t "a fairly long message that overflows" crlf) else (bind ?y 3)))`)
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(deffunction f
+   (?x)
+   (if (> ?x 3)
+      then
+      (printout t "a fairly long message that overflows" crlf)
+      else
+      (bind ?y 3)))
+`)
+	})
+
+	t.Run("Comments are kept", func(t *testing.T) {
+		out, err := String(`; header
+
+; about foo
+(defrule foo   ; trailing
+  (a)
+  ; before the arrow
+  => )`)
+		assert.NilError(t, err)
+		assert.Equal(t, out, `; header
+
+; about foo
+(defrule foo ; trailing
+   (a)
+   ; before the arrow
+   =>)
+`)
+	})
+
+	t.Run("Constraints stay together", func(t *testing.T) {
+		out, err := String("(defrule foo (a ?x & :(> ?x 1) | ~ red) =>)")
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(defrule foo
+   (a ?x&:(> ?x 1)|~red)
+   =>)
+`)
+	})
+
+	t.Run("Negated constraints keep their space", func(t *testing.T) {
+		out, err := String("(defrule foo (color ~red&~blue) (size ?s&~big | small) =>)")
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(defrule foo
+   (color ~red&~blue)
+   (size ?s&~big|small)
+   =>)
+`)
+	})
+
+	t.Run("Pattern bindings stay on one line", func(t *testing.T) {
+		out, err := String("(defrule foo ?f <- (a ?x) (not (b ?x)) => (retract ?f))")
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(defrule foo
+   ?f <- (a ?x)
+   (not (b ?x))
+   =>
+   (retract ?f))
+`)
+	})
+
+	t.Run("Globals", func(t *testing.T) {
+		out, err := String("(defglobal ?*x* = 3 ?*y* = (create$ a b))")
+		assert.NilError(t, err)
+		assert.Equal(t, out, `(defglobal
+   ?*x* = 3
+   ?*y* = (create$ a b))
+`)
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		for _, name := range []string{"dopey.clp", "factfile.clp", "instancesfile.clp"} {
+			src, err := ioutil.ReadFile("../testdata/" + name)
+			assert.NilError(t, err)
+			once, err := Source(src)
+			assert.NilError(t, err)
+			twice, err := Source(once)
+			assert.NilError(t, err)
+			assert.Equal(t, string(twice), string(once))
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := String("(defrule foo (a) =>")
+		assert.ErrorContains(t, err, "unexpected end of input")
+		_, err = String("(a))")
+		assert.ErrorContains(t, err, "1:4: unexpected )")
+	})
+}
@@ -23,28 +23,35 @@ import (
 	"unsafe"
 )
 
-// Function references a CLIPS function
+// Function references a CLIPS function. Like every Construct, its methods without an error
+// result panic with ErrEnvironmentClosed after the environment is deleted
 type Function struct {
-	env  *Environment
-	fptr unsafe.Pointer
+	env     *Environment
+	fptr    unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
 }
 
 // Functions returns the set of all functions in CLIPS
 func (env *Environment) Functions() []*Function {
-	fptr := C.EnvGetNextDeffunction(env.env, nil)
+	fptr := C.EnvGetNextDeffunction(env.ptr(), nil)
 	ret := make([]*Function, 0, 10)
 	for fptr != nil {
 		ret = append(ret, createFunction(env, fptr))
-		fptr = C.EnvGetNextDeffunction(env.env, fptr)
+		fptr = C.EnvGetNextDeffunction(env.ptr(), fptr)
 	}
 	return ret
 }
 
 // FindFunction returns the function of the given name
 func (env *Environment) FindFunction(name string) (*Function, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	fptr := C.EnvFindDeffunction(env.env, cname)
+	fptr := C.EnvFindDeffunction(env.ptr(), cname)
 	if fptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Function "%s" not found`, name))
 	}
@@ -53,30 +60,47 @@ func (env *Environment) FindFunction(name string) (*Function, error) {
 
 func createFunction(env *Environment, fptr unsafe.Pointer) *Function {
 	return &Function{
-		env:  env,
-		fptr: fptr,
+		env:     env,
+		fptr:    fptr,
+		name:    C.GoString(C.EnvGetDeffunctionName(env.ptr(), fptr)),
+		module:  C.GoString(C.EnvDeffunctionModule(env.ptr(), fptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the function can no longer be used. A
+// function is stale once undefined or cleared
+func (f *Function) check() error {
+	return checkConstruct(f.env, DEFFUNCTION, f.fptr, qualify(f.module, f.name), f.cleared)
+}
+
 // Equal returns true if the other function represents the same CLIPS function as this one
 func (f *Function) Equal(other *Function) bool {
 	return f.fptr == other.fptr
 }
 
 func (f *Function) String() string {
-	cstr := C.EnvGetDeffunctionPPForm(f.env.env, f.fptr)
+	if !valid(f.check()) {
+		return fmt.Sprintf("<Function-%s stale>", f.name)
+	}
+	cstr := C.EnvGetDeffunctionPPForm(f.env.ptr(), f.fptr)
 	return strings.TrimRight(C.GoString(cstr), "\n")
 }
 
 // Name returns the name of this function
 func (f *Function) Name() string {
-	cstr := C.EnvGetDeffunctionName(f.env.env, f.fptr)
-	return C.GoString(cstr)
+	if err := f.env.check(); err != nil {
+		panic(err)
+	}
+	return f.name
 }
 
 // Call calls the CLIPS function with the given arguments (must be a space-delimited string)
 func (f *Function) Call(arguments string) (interface{}, error) {
-	cname := C.EnvGetDeffunctionName(f.env.env, f.fptr)
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	cname := C.EnvGetDeffunctionName(f.env.ptr(), f.fptr)
 	data := createDataObject(f.env)
 	defer data.Delete()
 	var cargs *C.char
@@ -85,24 +109,30 @@ func (f *Function) Call(arguments string) (interface{}, error) {
 		defer C.free(unsafe.Pointer(cargs))
 	}
 
-	ret := C.EnvFunctionCall(f.env.env, cname, cargs, data.byRef())
+	ret := C.EnvFunctionCall(f.env.ptr(), cname, cargs, data.byRef())
 	if ret == 1 {
 		return nil, EnvError(f.env, `Unable to call function "%s"`, f.Name())
 	}
 	return data.Value(), nil
 }
 
-// Module returns the module in which this function is defined
+// Module returns the module in which this function is defined, or nil if the function is stale
 func (f *Function) Module() *Module {
-	cmodname := C.EnvDeffunctionModule(f.env.env, f.fptr)
-	modptr := C.EnvFindDefmodule(f.env.env, cmodname)
+	if !valid(f.check()) {
+		return nil
+	}
+	cmodname := C.EnvDeffunctionModule(f.env.ptr(), f.fptr)
+	modptr := C.EnvFindDefmodule(f.env.ptr(), cmodname)
 
 	return createModule(f.env, modptr)
 }
 
 // Deletable returns true if function is unreferenced and deletable
 func (f *Function) Deletable() bool {
-	ret := C.EnvIsDeffunctionDeletable(f.env.env, f.fptr)
+	if !valid(f.check()) {
+		return false
+	}
+	ret := C.EnvIsDeffunctionDeletable(f.env.ptr(), f.fptr)
 	if ret == 1 {
 		return true
 	}
@@ -111,7 +141,10 @@ func (f *Function) Deletable() bool {
 
 // Watched returns true if function is being watched
 func (f *Function) Watched() bool {
-	ret := C.EnvGetDeffunctionWatch(f.env.env, f.fptr)
+	if !valid(f.check()) {
+		return false
+	}
+	ret := C.EnvGetDeffunctionWatch(f.env.ptr(), f.fptr)
 	if ret == 1 {
 		return true
 	}
@@ -120,16 +153,22 @@ func (f *Function) Watched() bool {
 
 // Watch sets whether the function is being watched
 func (f *Function) Watch(val bool) {
+	if !valid(f.check()) {
+		return
+	}
 	var flag C.uint
 	if val {
 		flag = 1
 	}
-	C.EnvSetDeffunctionWatch(f.env.env, flag, f.fptr)
+	C.EnvSetDeffunctionWatch(f.env.ptr(), flag, f.fptr)
 }
 
 // Undefine undefines the function within CLIPS
 func (f *Function) Undefine() error {
-	ret := C.EnvUndeffunction(f.env.env, f.fptr)
+	if err := f.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndeffunction(f.env.ptr(), f.fptr)
 	if ret != 1 {
 		return EnvError(f.env, `Unable to undef function "%s"`, f.Name())
 	}
@@ -0,0 +1,337 @@
+package gen
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Construct describes a deftemplate or defclass to generate a Go type for
+type Construct struct {
+	Name   string
+	Module string
+	// Class is true for a defclass, false for a deftemplate
+	Class bool
+	Slots []*Slot
+}
+
+// Slot describes a slot of a template or class
+type Slot struct {
+	Name       string
+	Multifield bool
+	// Types are the CLIPS types the slot accepts, such as INTEGER or SYMBOL
+	Types []string
+	// Min and Max are the cardinality of a multislot. Max is -1 if there is no limit
+	Min int64
+	Max int64
+	// Symbols are the allowed values, if every allowed value is a symbol
+	Symbols []string
+	// NilDefault is true if the slot defaults to the symbol nil
+	NilDefault bool
+	// ReadOnly is true for class slots which cannot be set after the instance is made
+	ReadOnly bool
+}
+
+// goTypes maps a single CLIPS type to the Go type the clips package extracts it as
+var goTypes = map[string]string{
+	"INTEGER":          "int64",
+	"FLOAT":            "float64",
+	"STRING":           "string",
+	"SYMBOL":           "clips.Symbol",
+	"INSTANCE-NAME":    "clips.InstanceName",
+	"INSTANCE-ADDRESS": "*clips.Instance",
+	"FACT-ADDRESS":     "clips.Fact",
+}
+
+// initialisms are written in upper case within Go names
+var initialisms = map[string]bool{
+	"API":  true,
+	"HTTP": true,
+	"ID":   true,
+	"IP":   true,
+	"JSON": true,
+	"URI":  true,
+	"URL":  true,
+	"UUID": true,
+	"XML":  true,
+}
+
+// GoName converts a CLIPS name, such as order-line, to an exported Go identifier
+func GoName(name string) string {
+	var b strings.Builder
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, part := range parts {
+		if initialisms[strings.ToUpper(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		b.WriteRune(unicode.ToUpper(runes[0]))
+		b.WriteString(string(runes[1:]))
+	}
+	ret := b.String()
+	if ret == "" || !unicode.IsLetter([]rune(ret)[0]) {
+		ret = "X" + ret
+	}
+	return ret
+}
+
+type field struct {
+	slot *Slot
+	name string
+	// elem is the Go type of a value, enum is set if it is a generated enum type
+	elem    string
+	enum    bool
+	pointer bool
+}
+
+func (f *field) goType() string {
+	if f.slot.Multifield {
+		return "[]" + f.elem
+	}
+	if f.pointer {
+		return "*" + f.elem
+	}
+	return f.elem
+}
+
+type generator struct {
+	out  bytes.Buffer
+	used map[string]bool
+}
+
+// unique returns name, or name with suffix appended if it is already in use
+func (g *generator) unique(name string, suffix string) string {
+	ret := name
+	for i := 2; g.used[ret]; i++ {
+		ret = name + suffix
+		if i > 2 {
+			ret += strconv.Itoa(i - 1)
+		}
+	}
+	g.used[ret] = true
+	return ret
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+// Generate writes Go source declaring a struct for each construct, with enum types for slots
+// restricted to symbols, and functions to assert or make and to extract each type. The source
+// is described as generated from the named files
+func Generate(w io.Writer, pkg string, sources []string, constructs []*Construct) error {
+	g := &generator{used: make(map[string]bool)}
+	templates := false
+	for _, c := range constructs {
+		g.construct(c)
+		templates = templates || !c.Class
+	}
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by clipsgo gen from %s. DO NOT EDIT.\n\n", strings.Join(sources, ", "))
+	fmt.Fprintf(&file, "package %s\n\nimport (\n", pkg)
+	if templates {
+		// only the extract functions of templates report errors of their own
+		fmt.Fprintf(&file, "\"fmt\"\n\n")
+	}
+	fmt.Fprintf(&file, "\"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips\"\n)\n")
+	file.Write(g.out.Bytes())
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated source: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func (g *generator) construct(c *Construct) {
+	suffix, keyword := "Fact", "deftemplate"
+	if c.Class {
+		suffix, keyword = "Object", "defclass"
+	}
+	typename := g.unique(GoName(c.Name), suffix)
+	qualified := c.Module + "::" + c.Name
+
+	fieldNames := make(map[string]bool)
+	var fields []*field
+	for _, s := range c.Slots {
+		f := &field{slot: s, name: GoName(s.Name)}
+		for i := 2; fieldNames[f.name]; i++ {
+			f.name = GoName(s.Name) + strconv.Itoa(i)
+		}
+		fieldNames[f.name] = true
+		g.fieldType(typename, f)
+		fields = append(fields, f)
+	}
+
+	for _, f := range fields {
+		if f.enum {
+			g.enum(typename, qualified, keyword, f)
+		}
+	}
+
+	g.printf("\n// %s is %s of %s %s\n", typename, article(c.Class), keyword, qualified)
+	g.printf("type %s struct {\n", typename)
+	for _, f := range fields {
+		if f.slot.Multifield && (f.slot.Min > 0 || f.slot.Max >= 0) {
+			g.printf("// %s holds %s\n", f.name, cardinality(f.slot))
+		}
+		g.printf("%s %s `clips:%s`\n", f.name, f.goType(), strconv.Quote(f.slot.Name))
+	}
+	g.printf("}\n")
+
+	if c.Class {
+		g.class(typename, qualified, fields)
+	} else {
+		g.template(typename, qualified, c, fields)
+	}
+}
+
+func article(class bool) string {
+	if class {
+		return "an instance"
+	}
+	return "a fact"
+}
+
+func cardinality(s *Slot) string {
+	values := func(n int64) string {
+		if n == 1 {
+			return "1 value"
+		}
+		return fmt.Sprintf("%d values", n)
+	}
+	switch {
+	case s.Max < 0:
+		return "at least " + values(s.Min)
+	case s.Min == s.Max:
+		return "exactly " + values(s.Min)
+	}
+	return fmt.Sprintf("%d to %s", s.Min, values(s.Max))
+}
+
+// fieldType decides the Go type of a field
+func (g *generator) fieldType(typename string, f *field) {
+	s := f.slot
+	f.elem = "interface{}"
+	if len(s.Symbols) > 0 {
+		bools := true
+		for _, sym := range s.Symbols {
+			bools = bools && (sym == "TRUE" || sym == "FALSE")
+		}
+		if bools {
+			f.elem = "bool"
+		} else {
+			f.elem = g.unique(typename+f.name, "Value")
+			f.enum = true
+		}
+	} else if len(s.Types) == 1 && goTypes[s.Types[0]] != "" {
+		f.elem = goTypes[s.Types[0]]
+	}
+	// nil is extracted as a Go nil, which needs a pointer unless the type already has one
+	f.pointer = s.NilDefault && !s.Multifield && f.elem != "interface{}" &&
+		f.elem != "clips.Fact" && !strings.HasPrefix(f.elem, "*")
+}
+
+func (g *generator) enum(typename string, qualified string, keyword string, f *field) {
+	g.printf("\n// %s is an allowed value of slot %s of %s %s\n", f.elem, f.slot.Name, keyword, qualified)
+	g.printf("type %s clips.Symbol\n\n", f.elem)
+	g.printf("// Allowed values of %s\n", f.elem)
+	g.printf("const (\n")
+	var names []string
+	for _, sym := range f.slot.Symbols {
+		name := g.unique(f.elem+GoName(sym), "Value")
+		names = append(names, name)
+		g.printf("%s %s = %s\n", name, f.elem, strconv.Quote(sym))
+	}
+	g.printf(")\n\n")
+	g.printf("// %sValues lists the allowed values of %s\n", f.elem, f.elem)
+	g.printf("var %sValues = []%s{%s}\n", f.elem, f.elem, strings.Join(names, ", "))
+}
+
+// setters writes the statements setting each slot from v, using the given setter method. If
+// a setter fails, cleanup is run before the error is returned
+func (g *generator) setters(target string, method string, cleanup string, fields []*field) {
+	for _, f := range fields {
+		if f.slot.ReadOnly {
+			continue
+		}
+		value := "v." + f.name
+		switch {
+		case f.slot.Multifield && f.enum:
+			// enum values must be passed as symbols rather than strings
+			g.printf("{\nvalues := make([]interface{}, len(%s))\n", value)
+			g.printf("for i, value := range %s {\nvalues[i] = clips.Symbol(value)\n}\n", value)
+			g.printf("if err := %s.%s(%s, values); err != nil {\n%sreturn nil, err\n}\n}\n",
+				target, method, strconv.Quote(f.slot.Name), cleanup)
+			continue
+		case f.pointer:
+			g.printf("if %s != nil {\n", value)
+			value = "*" + value
+		}
+		if f.enum {
+			value = "clips.Symbol(" + value + ")"
+		}
+		g.printf("if err := %s.%s(%s, %s); err != nil {\n%sreturn nil, err\n}\n",
+			target, method, strconv.Quote(f.slot.Name), value, cleanup)
+		if f.pointer {
+			g.printf("}\n")
+		}
+	}
+}
+
+func (g *generator) template(typename string, qualified string, c *Construct, fields []*field) {
+	g.printf("\n// Assert%s asserts a fact of deftemplate %s with the slot values of v\n", typename, qualified)
+	g.printf("func Assert%s(env *clips.Environment, v *%s) (clips.Fact, error) {\n", typename, typename)
+	g.printf("tmpl, err := env.FindTemplate(%s)\nif err != nil {\nreturn nil, err\n}\n", strconv.Quote(qualified))
+	g.printf("fact, err := tmpl.NewFact()\nif err != nil {\nreturn nil, err\n}\n")
+	g.printf("f := fact.(*clips.TemplateFact)\n")
+	g.setters("f", "Set", "", fields)
+	g.printf("if err := f.Assert(); err != nil {\nreturn nil, err\n}\nreturn f, nil\n}\n")
+
+	g.printf("\n// Extract%s returns the slot values of a fact of deftemplate %s\n", typename, qualified)
+	g.printf("func Extract%s(fact clips.Fact) (*%s, error) {\n", typename, typename)
+	g.printf("tmpl := fact.Template()\n")
+	g.printf("if tmpl == nil {\nreturn nil, fmt.Errorf(\"fact %%d no longer exists: %%w\", fact.Index(), clips.ErrStale)\n}\n")
+	g.printf("if tmpl.Name() != %s || tmpl.Module().Name() != %s {\n",
+		strconv.Quote(c.Name), strconv.Quote(c.Module))
+	g.printf("return nil, fmt.Errorf(\"fact %%d is not of deftemplate %s\", fact.Index())\n}\n", qualified)
+	g.printf("ret := &%s{}\nif err := fact.Extract(ret); err != nil {\nreturn nil, err\n}\nreturn ret, nil\n}\n", typename)
+}
+
+func (g *generator) class(typename string, qualified string, fields []*field) {
+	g.printf("\n// Make%s makes an instance of defclass %s with the slot values of v. If name is\n", typename, qualified)
+	g.printf("// empty a unique name is generated\n")
+	g.printf("func Make%s(env *clips.Environment, name string, v *%s) (*clips.Instance, error) {\n", typename, typename)
+	g.printf("class, err := env.FindClass(%s)\nif err != nil {\nreturn nil, err\n}\n", strconv.Quote(qualified))
+	g.printf("inst, err := class.NewInstance(name, false)\nif err != nil {\nreturn nil, err\n}\n")
+	// an instance left half made would stay in CLIPS
+	g.setters("inst", "SetSlot", "inst.Unmake()\n", fields)
+	g.printf("return inst, nil\n}\n")
+
+	g.printf("\n// Extract%s returns the slot values of an instance of defclass %s\n", typename, qualified)
+	g.printf("func Extract%s(inst *clips.Instance) (*%s, error) {\n", typename, typename)
+	g.printf("ret := &%s{}\nif err := inst.Extract(ret); err != nil {\nreturn nil, err\n}\nreturn ret, nil\n}\n", typename)
+}
@@ -0,0 +1,101 @@
+package gen
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestGoName(t *testing.T) {
+	assert.Equal(t, GoName("order-line"), "OrderLine")
+	assert.Equal(t, GoName("customer_id"), "CustomerID")
+	assert.Equal(t, GoName("Customer"), "Customer")
+	assert.Equal(t, GoName("2nd-address"), "X2ndAddress")
+	assert.Equal(t, GoName("-"), "X")
+}
+
+func TestGenerate(t *testing.T) {
+	constructs := []*Construct{
+		{Name: "order", Module: "MAIN", Slots: []*Slot{
+			{Name: "id", Types: []string{"INTEGER"}},
+			{Name: "state", Types: []string{"SYMBOL"}, Symbols: []string{"new", "shipped"}},
+			{Name: "tags", Multifield: true, Types: []string{"SYMBOL"}, Symbols: []string{"rush", "gift-wrap"}, Max: 3},
+			{Name: "note", Types: []string{"SYMBOL"}, NilDefault: true},
+			{Name: "paid", Symbols: []string{"TRUE", "FALSE"}},
+			{Name: "total", Types: []string{"INTEGER", "FLOAT"}},
+		}},
+		{Name: "Order", Module: "SHOP", Class: true, Slots: []*Slot{
+			{Name: "lines", Multifield: true, Types: []string{"INSTANCE-NAME"}, Min: 1, Max: -1},
+			{Name: "created", Types: []string{"INTEGER"}, ReadOnly: true},
+		}},
+	}
+
+	var buf bytes.Buffer
+	assert.NilError(t, Generate(&buf, "shop", []string{"shop.clp"}, constructs))
+	src := buf.String()
+	_, err := parser.ParseFile(token.NewFileSet(), "types.go", src, 0)
+	assert.NilError(t, err)
+
+	t.Run("Header", func(t *testing.T) {
+		assert.Assert(t, strings.HasPrefix(src, "// Code generated by clipsgo gen from shop.clp. DO NOT EDIT.\n\npackage shop\n"))
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		for _, field := range []string{
+			"ID    int64      `clips:\"id\"`",
+			"State OrderState `clips:\"state\"`",
+			"// Tags holds 0 to 3 values\n\tTags  []OrderTags   `clips:\"tags\"`",
+			"Note  *clips.Symbol `clips:\"note\"`",
+			"Paid  bool          `clips:\"paid\"`",
+			"Total interface{}   `clips:\"total\"`",
+			"// Lines holds at least 1 value\n\tLines   []clips.InstanceName `clips:\"lines\"`",
+		} {
+			assert.Assert(t, strings.Contains(src, field), field)
+		}
+	})
+
+	t.Run("Enums", func(t *testing.T) {
+		assert.Assert(t, strings.Contains(src, "type OrderState clips.Symbol\n"))
+		assert.Assert(t, strings.Contains(src, "OrderTagsGiftWrap OrderTags = \"gift-wrap\""))
+		assert.Assert(t, strings.Contains(src, "var OrderStateValues = []OrderState{OrderStateNew, OrderStateShipped}"))
+	})
+
+	t.Run("Functions", func(t *testing.T) {
+		assert.Assert(t, strings.Contains(src, "func AssertOrder(env *clips.Environment, v *Order) (clips.Fact, error) {"))
+		assert.Assert(t, strings.Contains(src, `env.FindTemplate("MAIN::order")`))
+		assert.Assert(t, strings.Contains(src, `f.Set("state", clips.Symbol(v.State))`))
+		assert.Assert(t, strings.Contains(src, "if v.Note != nil {\n\t\tif err := f.Set(\"note\", *v.Note)"))
+		assert.Assert(t, strings.Contains(src, "func ExtractOrder(fact clips.Fact) (*Order, error) {"))
+		assert.Assert(t, strings.Contains(src, "if tmpl == nil {\n\t\treturn nil, fmt.Errorf(\"fact %d no longer exists: %w\", fact.Index(), clips.ErrStale)"))
+		// the class is renamed as the template has taken its name
+		assert.Assert(t, strings.Contains(src, "type OrderObject struct {"))
+		assert.Assert(t, strings.Contains(src, "func MakeOrderObject(env *clips.Environment, name string, v *OrderObject) (*clips.Instance, error) {"))
+		assert.Assert(t, strings.Contains(src, "if err := inst.SetSlot(\"lines\", v.Lines); err != nil {\n\t\tinst.Unmake()\n\t\treturn nil, err"))
+		assert.Assert(t, !strings.Contains(src, `inst.SetSlot("created"`))
+		assert.Assert(t, strings.Contains(src, "func ExtractOrderObject(inst *clips.Instance) (*OrderObject, error) {"))
+	})
+
+	t.Run("Classes only", func(t *testing.T) {
+		buf.Reset()
+		assert.NilError(t, Generate(&buf, "shop", []string{"shop.clp"}, constructs[1:]))
+		assert.Assert(t, !strings.Contains(buf.String(), `"fmt"`))
+	})
+}
@@ -23,13 +23,18 @@ import (
 	"unsafe"
 )
 
-// Generic represents a CLIPS genneric
+// Generic represents a CLIPS genneric. Like every Construct, its methods without an error
+// result panic with ErrEnvironmentClosed after the environment is deleted
 type Generic struct {
-	env    *Environment
-	genptr unsafe.Pointer
+	env     *Environment
+	genptr  unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
 }
 
-// Method represents one method of a CLIPS generic
+// Method represents one method of a CLIPS generic. It is stale once undefined or once its
+// generic is, and panics as its generic does after the environment is deleted
 type Method struct {
 	gen   *Generic
 	index C.long
@@ -37,21 +42,24 @@ type Method struct {
 
 // Generics returns a list of all generics in CLIPS
 func (env *Environment) Generics() []*Generic {
-	genptr := C.EnvGetNextDefgeneric(env.env, nil)
+	genptr := C.EnvGetNextDefgeneric(env.ptr(), nil)
 
 	ret := make([]*Generic, 0, 10)
 	for genptr != nil {
 		ret = append(ret, createGeneric(env, genptr))
-		genptr = C.EnvGetNextDefgeneric(env.env, genptr)
+		genptr = C.EnvGetNextDefgeneric(env.ptr(), genptr)
 	}
 	return ret
 }
 
 // FindGeneric returns the generic identified by name
 func (env *Environment) FindGeneric(name string) (*Generic, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	genptr := C.EnvFindDefgeneric(env.env, cname)
+	genptr := C.EnvFindDefgeneric(env.ptr(), cname)
 	if genptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Generic "%s" not found`, name))
 	}
@@ -60,30 +68,47 @@ func (env *Environment) FindGeneric(name string) (*Generic, error) {
 
 func createGeneric(env *Environment, genptr unsafe.Pointer) *Generic {
 	return &Generic{
-		env:    env,
-		genptr: genptr,
+		env:     env,
+		genptr:  genptr,
+		name:    C.GoString(C.EnvGetDefgenericName(env.ptr(), genptr)),
+		module:  C.GoString(C.EnvDefgenericModule(env.ptr(), genptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the generic can no longer be used. A
+// generic is stale once undefined or cleared
+func (g *Generic) check() error {
+	return checkConstruct(g.env, DEFGENERIC, g.genptr, qualify(g.module, g.name), g.cleared)
+}
+
 // Equal returns true if the other generic represents the same CLIPS generic
 func (g *Generic) Equal(other *Generic) bool {
 	return g.genptr == other.genptr
 }
 
 func (g *Generic) String() string {
-	cstr := C.EnvGetDefgenericPPForm(g.env.env, g.genptr)
+	if !valid(g.check()) {
+		return fmt.Sprintf("<Generic-%s stale>", g.name)
+	}
+	cstr := C.EnvGetDefgenericPPForm(g.env.ptr(), g.genptr)
 	return strings.TrimRight(C.GoString(cstr), "\n")
 }
 
 // Name returns the name of this generic
 func (g *Generic) Name() string {
-	cstr := C.EnvGetDefgenericName(g.env.env, g.genptr)
-	return C.GoString(cstr)
+	if err := g.env.check(); err != nil {
+		panic(err)
+	}
+	return g.name
 }
 
 // Call calls the CLIPS generic function. Arguments must be passed as a string
 func (g *Generic) Call(arguments string) (interface{}, error) {
-	cname := C.EnvGetDefgenericName(g.env.env, g.genptr)
+	if err := g.check(); err != nil {
+		return nil, err
+	}
+	cname := C.EnvGetDefgenericName(g.env.ptr(), g.genptr)
 	data := createDataObject(g.env)
 	defer data.Delete()
 
@@ -93,7 +118,7 @@ func (g *Generic) Call(arguments string) (interface{}, error) {
 		defer C.free(unsafe.Pointer(cargs))
 	}
 
-	ret := C.EnvFunctionCall(g.env.env, cname, cargs, data.byRef())
+	ret := C.EnvFunctionCall(g.env.ptr(), cname, cargs, data.byRef())
 	// the sense of this return is backwards from the usual convention
 	if ret == 1 {
 		return nil, EnvError(g.env, `Unable to call generic function "%s"`, g.Name())
@@ -101,16 +126,22 @@ func (g *Generic) Call(arguments string) (interface{}, error) {
 	return data.Value(), nil
 }
 
-// Module returns a reference to the module of this generic
+// Module returns a reference to the module of this generic, or nil if the generic is stale
 func (g *Generic) Module() *Module {
-	cmodname := C.EnvDefgenericModule(g.env.env, g.genptr)
-	modptr := C.EnvFindDefmodule(g.env.env, cmodname)
+	if !valid(g.check()) {
+		return nil
+	}
+	cmodname := C.EnvDefgenericModule(g.env.ptr(), g.genptr)
+	modptr := C.EnvFindDefmodule(g.env.ptr(), cmodname)
 	return createModule(g.env, modptr)
 }
 
 // Deletable returns true if the generic is unreferenced and can be deleted
 func (g *Generic) Deletable() bool {
-	ret := C.EnvIsDefgenericDeletable(g.env.env, g.genptr)
+	if !valid(g.check()) {
+		return false
+	}
+	ret := C.EnvIsDefgenericDeletable(g.env.ptr(), g.genptr)
 	if ret == 1 {
 		return true
 	}
@@ -119,7 +150,10 @@ func (g *Generic) Deletable() bool {
 
 // Watched returns true if the generic is watched
 func (g *Generic) Watched() bool {
-	ret := C.EnvGetDefgenericWatch(g.env.env, g.genptr)
+	if !valid(g.check()) {
+		return false
+	}
+	ret := C.EnvGetDefgenericWatch(g.env.ptr(), g.genptr)
 	if ret == 1 {
 		return true
 	}
@@ -128,27 +162,36 @@ func (g *Generic) Watched() bool {
 
 // Watch sets whether this generic is watched
 func (g *Generic) Watch(val bool) {
+	if !valid(g.check()) {
+		return
+	}
 	var flag C.uint
 	if val {
 		flag = C.uint(1)
 	}
-	C.EnvSetDefgenericWatch(g.env.env, flag, g.genptr)
+	C.EnvSetDefgenericWatch(g.env.ptr(), flag, g.genptr)
 }
 
 // Methods returns a list of all methods for this generic
 func (g *Generic) Methods() []*Method {
-	index := C.EnvGetNextDefmethod(g.env.env, g.genptr, 0)
+	if !valid(g.check()) {
+		return nil
+	}
+	index := C.EnvGetNextDefmethod(g.env.ptr(), g.genptr, 0)
 	ret := make([]*Method, 0, 10)
 	for index != 0 {
 		ret = append(ret, createMethod(g, index))
-		index = C.EnvGetNextDefmethod(g.env.env, g.genptr, index)
+		index = C.EnvGetNextDefmethod(g.env.ptr(), g.genptr, index)
 	}
 	return ret
 }
 
 // Undefine undefines the Generic
 func (g *Generic) Undefine() error {
-	ret := C.EnvUndefgeneric(g.env.env, g.genptr)
+	if err := g.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefgeneric(g.env.ptr(), g.genptr)
 	if ret != 1 {
 		return EnvError(g.env, `Unable to undefine generic "%s"`, g.Name())
 	}
@@ -163,19 +206,39 @@ func createMethod(gen *Generic, index C.long) *Method {
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the method can no longer be used. A method
+// is stale once it or its generic is undefined, or the environment cleared
+func (m *Method) check() error {
+	if err := m.gen.check(); err != nil {
+		return err
+	}
+	for index := C.EnvGetNextDefmethod(m.gen.env.ptr(), m.gen.genptr, 0); index != 0; index = C.EnvGetNextDefmethod(m.gen.env.ptr(), m.gen.genptr, index) {
+		if index == m.index {
+			return nil
+		}
+	}
+	return fmt.Errorf("Method %d of generic %s no longer exists: %w", int64(m.index), m.gen.name, ErrStale)
+}
+
 // Equal returns true of other represents the same CLIPS method as this
 func (m *Method) Equal(other *Method) bool {
 	return m.gen.genptr == other.gen.genptr && m.index == other.index
 }
 
 func (m *Method) String() string {
-	cstr := C.EnvGetDefmethodPPForm(m.gen.env.env, m.gen.genptr, m.index)
+	if !valid(m.check()) {
+		return fmt.Sprintf("<Method-%s#%d stale>", m.gen.name, int64(m.index))
+	}
+	cstr := C.EnvGetDefmethodPPForm(m.gen.env.ptr(), m.gen.genptr, m.index)
 	return strings.TrimRight(C.GoString(cstr), "\n")
 }
 
 // Watched returns true if watch is enabled on this method
 func (m *Method) Watched() bool {
-	ret := C.EnvGetDefmethodWatch(m.gen.env.env, m.gen.genptr, m.index)
+	if !valid(m.check()) {
+		return false
+	}
+	ret := C.EnvGetDefmethodWatch(m.gen.env.ptr(), m.gen.genptr, m.index)
 	if ret == 1 {
 		return true
 	}
@@ -184,16 +247,22 @@ func (m *Method) Watched() bool {
 
 // Watch sets whether this method is watched
 func (m *Method) Watch(val bool) {
+	if !valid(m.check()) {
+		return
+	}
 	var flag C.uint
 	if val {
 		flag = C.uint(1)
 	}
-	C.EnvSetDefmethodWatch(m.gen.env.env, flag, m.gen.genptr, m.index)
+	C.EnvSetDefmethodWatch(m.gen.env.ptr(), flag, m.gen.genptr, m.index)
 }
 
 // Deletable returns true if this method is unreferenced and deletable
 func (m *Method) Deletable() bool {
-	ret := C.EnvIsDefmethodDeletable(m.gen.env.env, m.gen.genptr, m.index)
+	if !valid(m.check()) {
+		return false
+	}
+	ret := C.EnvIsDefmethodDeletable(m.gen.env.ptr(), m.gen.genptr, m.index)
 	if ret == 1 {
 		return true
 	}
@@ -202,26 +271,35 @@ func (m *Method) Deletable() bool {
 
 // Restrictions returns the method restrictions for this method
 func (m *Method) Restrictions() interface{} {
+	if !valid(m.check()) {
+		return nil
+	}
 	data := createDataObject(m.gen.env)
 	defer data.Delete()
-	C.EnvGetMethodRestrictions(m.gen.env.env, m.gen.genptr, m.index, data.byRef())
+	C.EnvGetMethodRestrictions(m.gen.env.ptr(), m.gen.genptr, m.index, data.byRef())
 	return data.Value()
 }
 
 // Description returns the description of this method
 func (m *Method) Description() string {
+	if !valid(m.check()) {
+		return ""
+	}
 	// TODO grow buf if we fill the 1k buffer, and try again
 	var bufsize C.ulong = 1024
 	buf := (*C.char)(C.malloc(C.sizeof_char * bufsize))
 	defer C.free(unsafe.Pointer(buf))
-	C.EnvGetDefmethodDescription(m.gen.env.env, buf, bufsize-1, m.gen.genptr, m.index)
+	C.EnvGetDefmethodDescription(m.gen.env.ptr(), buf, bufsize-1, m.gen.genptr, m.index)
 
 	return C.GoString(buf)
 }
 
 // Undefine undefines the method
 func (m *Method) Undefine() error {
-	ret := C.EnvUndefmethod(m.gen.env.env, m.gen.genptr, m.index)
+	if err := m.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefmethod(m.gen.env.ptr(), m.gen.genptr, m.index)
 	if ret != 1 {
 		return EnvError(m.gen.env, "Unable to undefine method")
 	}
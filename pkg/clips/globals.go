@@ -23,16 +23,20 @@ import (
 	"unsafe"
 )
 
-// Global represents a global variable within CLIPS
+// Global represents a global variable within CLIPS. Like every Construct, its methods without
+// an error result panic with ErrEnvironmentClosed after the environment is deleted
 type Global struct {
-	env    *Environment
-	glbptr unsafe.Pointer
+	env     *Environment
+	glbptr  unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
 }
 
 // GlobalsChanged returns true if any global has changed since last call
 func (env *Environment) GlobalsChanged() bool {
-	ret := C.EnvGetGlobalsChanged(env.env)
-	C.EnvSetGlobalsChanged(env.env, 0)
+	ret := C.EnvGetGlobalsChanged(env.ptr())
+	C.EnvSetGlobalsChanged(env.ptr(), 0)
 	if ret == 1 {
 		return true
 	}
@@ -41,21 +45,24 @@ func (env *Environment) GlobalsChanged() bool {
 
 // Globals returns a slice containing references to all globals
 func (env *Environment) Globals() []*Global {
-	glbptr := C.EnvGetNextDefglobal(env.env, nil)
+	glbptr := C.EnvGetNextDefglobal(env.ptr(), nil)
 
 	ret := make([]*Global, 0, 10)
 	for glbptr != nil {
 		ret = append(ret, createGlobal(env, glbptr))
-		glbptr = C.EnvGetNextDefglobal(env.env, glbptr)
+		glbptr = C.EnvGetNextDefglobal(env.ptr(), glbptr)
 	}
 	return ret
 }
 
 // FindGlobal finds the global by name
 func (env *Environment) FindGlobal(name string) (*Global, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	glbptr := C.EnvFindDefglobal(env.env, cname)
+	glbptr := C.EnvFindDefglobal(env.ptr(), cname)
 	if glbptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Global "%s" not found`, name))
 	}
@@ -64,19 +71,31 @@ func (env *Environment) FindGlobal(name string) (*Global, error) {
 
 func createGlobal(env *Environment, glbptr unsafe.Pointer) *Global {
 	return &Global{
-		env:    env,
-		glbptr: glbptr,
+		env:     env,
+		glbptr:  glbptr,
+		name:    C.GoString(C.EnvGetDefglobalName(env.ptr(), glbptr)),
+		module:  C.GoString(C.EnvDefglobalModule(env.ptr(), glbptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the global can no longer be used. A global
+// is stale once undefined or cleared
+func (g *Global) check() error {
+	return checkConstruct(g.env, DEFGLOBAL, g.glbptr, qualify(g.module, g.name), g.cleared)
+}
+
 // Equal returns true if the other object represents the same global in CLIPS
 func (g *Global) Equal(other *Global) bool {
 	return g.glbptr == other.glbptr
 }
 
 func (g *Global) String() string {
+	if !valid(g.check()) {
+		return fmt.Sprintf("<Global-%s stale>", g.name)
+	}
 	ret := ""
-	cstr := C.EnvGetDefglobalPPForm(g.env.env, g.glbptr)
+	cstr := C.EnvGetDefglobalPPForm(g.env.ptr(), g.glbptr)
 	if cstr != nil {
 		ret = C.GoString(cstr)
 	}
@@ -85,18 +104,23 @@ func (g *Global) String() string {
 
 // Name returns the name of this global
 func (g *Global) Name() string {
-	cstr := C.EnvGetDefglobalName(g.env.env, g.glbptr)
-	return C.GoString(cstr)
+	if err := g.env.check(); err != nil {
+		panic(err)
+	}
+	return g.name
 }
 
 // Value returns the value of this global
 func (g *Global) Value() (interface{}, error) {
+	if err := g.check(); err != nil {
+		return nil, err
+	}
 	data := createDataObject(g.env)
 	defer data.Delete()
 	name := g.Name()
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvGetDefglobalValue(g.env.env, cname, data.byRef())
+	ret := C.EnvGetDefglobalValue(g.env.ptr(), cname, data.byRef())
 	if ret != 1 {
 		return nil, EnvError(g.env, `Unable to get value for global "%s"`, name)
 	}
@@ -105,6 +129,9 @@ func (g *Global) Value() (interface{}, error) {
 
 // SetValue sets the value of this global
 func (g *Global) SetValue(value interface{}) error {
+	if err := g.check(); err != nil {
+		return err
+	}
 	name := g.Name()
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
@@ -113,23 +140,29 @@ func (g *Global) SetValue(value interface{}) error {
 	defer data.Delete()
 	data.SetValue(value)
 
-	ret := C.EnvSetDefglobalValue(g.env.env, cname, data.byRef())
+	ret := C.EnvSetDefglobalValue(g.env.ptr(), cname, data.byRef())
 	if ret != 1 {
 		return EnvError(g.env, `Unable to set value for global "%s"`, name)
 	}
 	return nil
 }
 
-// Module returns a referece to the module of this global
+// Module returns a referece to the module of this global, or nil if the global is stale
 func (g *Global) Module() *Module {
-	modname := C.EnvDefglobalModule(g.env.env, g.glbptr)
-	modptr := C.EnvFindDefmodule(g.env.env, modname)
+	if !valid(g.check()) {
+		return nil
+	}
+	modname := C.EnvDefglobalModule(g.env.ptr(), g.glbptr)
+	modptr := C.EnvFindDefmodule(g.env.ptr(), modname)
 	return createModule(g.env, modptr)
 }
 
 // Deletable returns true if the global can be deleted
 func (g *Global) Deletable() bool {
-	ret := C.EnvIsDefglobalDeletable(g.env.env, g.glbptr)
+	if !valid(g.check()) {
+		return false
+	}
+	ret := C.EnvIsDefglobalDeletable(g.env.ptr(), g.glbptr)
 	if ret == 1 {
 		return true
 	}
@@ -138,7 +171,10 @@ func (g *Global) Deletable() bool {
 
 // Watched returns true if the global can be deleted
 func (g *Global) Watched() bool {
-	ret := C.EnvGetDefglobalWatch(g.env.env, g.glbptr)
+	if !valid(g.check()) {
+		return false
+	}
+	ret := C.EnvGetDefglobalWatch(g.env.ptr(), g.glbptr)
 	if ret == 1 {
 		return true
 	}
@@ -147,16 +183,22 @@ func (g *Global) Watched() bool {
 
 // Watch sets whether the global is watched
 func (g *Global) Watch(val bool) {
+	if !valid(g.check()) {
+		return
+	}
 	var flag C.uint
 	if val {
 		flag = C.uint(1)
 	}
-	C.EnvSetDefglobalWatch(g.env.env, flag, g.glbptr)
+	C.EnvSetDefglobalWatch(g.env.ptr(), flag, g.glbptr)
 }
 
 // Undefine undefines the global
 func (g *Global) Undefine() error {
-	ret := C.EnvUndefglobal(g.env.env, g.glbptr)
+	if err := g.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefglobal(g.env.ptr(), g.glbptr)
 	if ret != 1 {
 		return EnvError(g.env, `Unable to undefine global "%s"`, g.Name())
 	}
@@ -0,0 +1,419 @@
+// Package graph builds a dependency graph of the constructs in a CLIPS rule base
+package graph
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"sort"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// NodeKind is the type of construct a node represents
+type NodeKind string
+
+const (
+	RULE     NodeKind = "rule"
+	TEMPLATE NodeKind = "template"
+	CLASS    NodeKind = "class"
+	FUNCTION NodeKind = "function"
+	GENERIC  NodeKind = "generic"
+	MODULE   NodeKind = "module"
+)
+
+// EdgeKind is the relationship an edge represents
+type EdgeKind string
+
+const (
+	// MATCHES_ON links a rule to the templates and classes its patterns match
+	MATCHES_ON EdgeKind = "matches-on"
+	// ASSERTS links a construct to the templates it asserts or duplicates and the classes it makes instances of
+	ASSERTS EdgeKind = "asserts"
+	// MODIFIES links a construct to the templates or classes it modifies
+	MODIFIES EdgeKind = "modifies"
+	// RETRACTS links a construct to the templates it retracts and the classes it unmakes
+	RETRACTS EdgeKind = "retracts"
+	// CALLS links a construct to the deffunctions and generics it calls
+	CALLS EdgeKind = "calls"
+	// SENDS_TO links a construct to the classes it sends messages to
+	SENDS_TO EdgeKind = "sends-to"
+	// IMPORTS links a module to the modules it imports from
+	IMPORTS EdgeKind = "imports"
+	// EXPORTS links a module to the constructs it exports
+	EXPORTS EdgeKind = "exports"
+)
+
+// Node is a construct in the graph
+type Node struct {
+	ID     string   `json:"id"`
+	Kind   NodeKind `json:"kind"`
+	Name   string   `json:"name"`
+	Module string   `json:"module"`
+	// Implied is set for templates of ordered facts, which have no deftemplate
+	Implied bool `json:"implied,omitempty"`
+}
+
+// Edge is a dependency between two nodes
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// Graph holds the nodes and edges of a rule base, sorted by ID
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Node returns the node with the given ID, or nil
+func (g *Graph) Node(id string) *Node {
+	idx := sort.Search(len(g.Nodes), func(i int) bool { return g.Nodes[i].ID >= id })
+	if idx < len(g.Nodes) && g.Nodes[idx].ID == id {
+		return g.Nodes[idx]
+	}
+	return nil
+}
+
+// EdgesFrom returns the edges leaving the given node
+func (g *Graph) EdgesFrom(id string) []*Edge {
+	var ret []*Edge
+	for _, e := range g.Edges {
+		if e.From == id {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// EdgesTo returns the edges arriving at the given node
+func (g *Graph) EdgesTo(id string) []*Edge {
+	var ret []*Edge
+	for _, e := range g.Edges {
+		if e.To == id {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// NodeID returns the ID used for a construct
+func NodeID(kind NodeKind, module string, name string) string {
+	return string(kind) + ":" + module + "::" + name
+}
+
+type builder struct {
+	nodes map[string]*Node
+	edges map[Edge]bool
+	// byName indexes nodes by kind and unqualified name
+	byName map[NodeKind]map[string][]*Node
+}
+
+// Build constructs the dependency graph of the given files
+func Build(files []*parser.File) *Graph {
+	b := &builder{
+		nodes:  make(map[string]*Node),
+		edges:  make(map[Edge]bool),
+		byName: make(map[NodeKind]map[string][]*Node),
+	}
+	b.node(MODULE, "MAIN", "MAIN")
+	for _, file := range files {
+		for _, c := range file.Constructs {
+			h := c.Header()
+			switch c.(type) {
+			case *parser.Defrule:
+				b.node(RULE, h.Module, h.Name.Name)
+			case *parser.Deftemplate:
+				b.node(TEMPLATE, h.Module, h.Name.Name)
+			case *parser.Defclass:
+				b.node(CLASS, h.Module, h.Name.Name)
+			case *parser.Deffunction:
+				b.node(FUNCTION, h.Module, h.Name.Name)
+			case *parser.Defgeneric, *parser.Defmethod:
+				// a defmethod without a defgeneric declares the generic implicitly
+				b.node(GENERIC, h.Module, h.Name.Name)
+			case *parser.Defmodule:
+				b.node(MODULE, h.Module, h.Name.Name)
+			}
+		}
+	}
+	for _, file := range files {
+		for _, c := range file.Constructs {
+			b.construct(c)
+		}
+	}
+
+	g := &Graph{Nodes: []*Node{}, Edges: []*Edge{}}
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	for e := range b.edges {
+		edge := e
+		g.Edges = append(g.Edges, &edge)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Kind < b.Kind
+	})
+	return g
+}
+
+func (b *builder) node(kind NodeKind, module string, name string) *Node {
+	id := NodeID(kind, module, name)
+	if n, ok := b.nodes[id]; ok {
+		return n
+	}
+	n := &Node{ID: id, Kind: kind, Name: name, Module: module}
+	b.nodes[id] = n
+	if b.byName[kind] == nil {
+		b.byName[kind] = make(map[string][]*Node)
+	}
+	b.byName[kind][name] = append(b.byName[kind][name], n)
+	return n
+}
+
+// lookup resolves a reference made from within module, preferring a construct
+// defined in the same module
+func (b *builder) lookup(kind NodeKind, module string, id *parser.Ident) *Node {
+	if id.Module != "" {
+		return b.nodes[NodeID(kind, id.Module, id.Name)]
+	}
+	candidates := b.byName[kind][id.Name]
+	for _, n := range candidates {
+		if n.Module == module {
+			return n
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return nil
+}
+
+// template resolves a template reference, adding an implied template for ordered facts
+func (b *builder) template(module string, id *parser.Ident) *Node {
+	if n := b.lookup(TEMPLATE, module, id); n != nil {
+		return n
+	}
+	if id.Module != "" {
+		module = id.Module
+	}
+	n := b.node(TEMPLATE, module, id.Name)
+	n.Implied = true
+	return n
+}
+
+func (b *builder) edge(from *Node, to *Node, kind EdgeKind) {
+	if from != nil && to != nil {
+		b.edges[Edge{From: from.ID, To: to.ID, Kind: kind}] = true
+	}
+}
+
+func (b *builder) construct(c parser.Construct) {
+	h := c.Header()
+	switch c := c.(type) {
+	case *parser.Defrule:
+		from := b.nodes[NodeID(RULE, h.Module, h.Name.Name)]
+		bound := make(map[string][]*Node)
+		b.ces(from, h.Module, c.LHS, bound)
+		b.body(from, h.Module, c.RHS, bound)
+	case *parser.Deffunction:
+		b.body(b.nodes[NodeID(FUNCTION, h.Module, h.Name.Name)], h.Module, c.Body, nil)
+	case *parser.Defmethod:
+		b.body(b.lookup(GENERIC, h.Module, h.Name), h.Module, c.Body, nil)
+	case *parser.DefmessageHandler:
+		b.body(b.lookup(CLASS, h.Module, c.Class), h.Module, c.Body, nil)
+	case *parser.Defmodule:
+		b.module(c)
+	}
+}
+
+// ces adds matches-on edges and records the nodes each pattern variable is bound to
+func (b *builder) ces(from *Node, module string, ces []parser.CE, bound map[string][]*Node) {
+	for _, ce := range ces {
+		switch ce := ce.(type) {
+		case *parser.GroupCE:
+			b.ces(from, module, ce.CEs, bound)
+		case *parser.PatternCE:
+			var targets []*Node
+			if ce.Object {
+				for _, s := range ce.Slots {
+					if s.Name.Name != "is-a" {
+						continue
+					}
+					for _, c := range s.Fields {
+						for _, alt := range c.Alternatives {
+							for _, term := range alt {
+								name, ok := term.Value.(*parser.Constant)
+								if ok && term.Kind == parser.LITERAL_TERM && !term.Not && name.Kind == lexer.SYMBOL {
+									targets = append(targets, b.lookup(CLASS, module, &parser.Ident{Name: name.Value}))
+								}
+							}
+						}
+					}
+				}
+			} else {
+				targets = append(targets, b.template(module, ce.Template))
+			}
+			for _, t := range targets {
+				b.edge(from, t, MATCHES_ON)
+			}
+			if ce.Binding != nil && bound != nil {
+				bound[ce.Binding.Name] = targets
+			}
+		}
+	}
+}
+
+// body adds edges for the actions in a rule's RHS or a function body
+func (b *builder) body(from *Node, module string, exprs []parser.Expr, bound map[string][]*Node) {
+	if from == nil {
+		return
+	}
+	targets := func(e parser.Expr) []*Node {
+		if v, ok := e.(*parser.Variable); ok {
+			return bound[v.Name]
+		}
+		return nil
+	}
+	for _, e := range exprs {
+		parser.Inspect(e, func(n parser.Node) bool {
+			call, ok := n.(*parser.Call)
+			if !ok {
+				return true
+			}
+			name := call.Function.Name
+			switch name {
+			case "assert":
+				for _, arg := range call.Args {
+					fact, ok := arg.(*parser.Call)
+					if !ok {
+						b.body(from, module, []parser.Expr{arg}, bound)
+						continue
+					}
+					b.edge(from, b.template(module, fact.Function), ASSERTS)
+					f := parser.FactFromCall(fact)
+					b.body(from, module, f.Values, bound)
+					b.slotValues(from, module, f.Slots, bound)
+				}
+				// the template and slot names are not function calls
+				return false
+			case "make-instance":
+				if inst := parser.InstanceFromCall(call); inst != nil {
+					b.edge(from, b.lookup(CLASS, module, inst.Class), ASSERTS)
+					b.slotValues(from, module, inst.Slots, bound)
+					return false
+				}
+			case "duplicate", "modify", "modify-instance", "message-modify-instance",
+				"active-modify-instance", "active-message-modify-instance":
+				if len(call.Args) == 0 {
+					break
+				}
+				kind := MODIFIES
+				if name == "duplicate" {
+					kind = ASSERTS
+				}
+				for _, t := range targets(call.Args[0]) {
+					b.edge(from, t, kind)
+				}
+				b.body(from, module, call.Args[:1], bound)
+				for _, arg := range call.Args[1:] {
+					if override, ok := arg.(*parser.Call); ok {
+						b.body(from, module, override.Args, bound)
+					} else {
+						b.body(from, module, []parser.Expr{arg}, bound)
+					}
+				}
+				return false
+			case "retract", "unmake-instance":
+				for _, arg := range call.Args {
+					for _, t := range targets(arg) {
+						b.edge(from, t, RETRACTS)
+					}
+				}
+			case "send":
+				if len(call.Args) > 0 {
+					for _, t := range targets(call.Args[0]) {
+						b.edge(from, t, SENDS_TO)
+					}
+				}
+			}
+			if fn := b.lookup(FUNCTION, module, call.Function); fn != nil {
+				b.edge(from, fn, CALLS)
+			} else if gen := b.lookup(GENERIC, module, call.Function); gen != nil {
+				b.edge(from, gen, CALLS)
+			}
+			return true
+		})
+	}
+}
+
+func (b *builder) slotValues(from *Node, module string, slots []*parser.SlotValue, bound map[string][]*Node) {
+	for _, s := range slots {
+		b.body(from, module, s.Values, bound)
+	}
+}
+
+// portKinds maps the construct types a module may export to node kinds
+var portKinds = map[string]NodeKind{
+	"deftemplate": TEMPLATE,
+	"defclass":    CLASS,
+	"deffunction": FUNCTION,
+	"defgeneric":  GENERIC,
+}
+
+func (b *builder) module(m *parser.Defmodule) {
+	from := b.nodes[NodeID(MODULE, m.Name.Name, m.Name.Name)]
+	for _, spec := range m.Imports {
+		if spec.None {
+			continue
+		}
+		b.edge(from, b.node(MODULE, spec.Module, spec.Module), IMPORTS)
+	}
+	for _, spec := range m.Exports {
+		if spec.None {
+			continue
+		}
+		var kinds []NodeKind
+		if spec.Construct == "" {
+			kinds = []NodeKind{TEMPLATE, CLASS, FUNCTION, GENERIC}
+		} else if kind := portKinds[spec.Construct]; kind != "" {
+			kinds = []NodeKind{kind}
+		}
+		for _, kind := range kinds {
+			if spec.All {
+				for _, nodes := range b.byName[kind] {
+					for _, n := range nodes {
+						if n.Module == m.Name.Name {
+							b.edge(from, n, EXPORTS)
+						}
+					}
+				}
+				continue
+			}
+			for _, name := range spec.Names {
+				b.edge(from, b.nodes[NodeID(kind, m.Name.Name, name.Name)], EXPORTS)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package graph
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+	"gotest.tools/assert"
+)
+
+const source = `
+(deftemplate order (slot id) (slot state))
+(defclass Customer (is-a USER) (slot name))
+(deffunction next-id () 1)
+(defgeneric describe)
+(defmethod describe ((?x INTEGER)) (next-id))
+(defmessage-handler Customer greet () (describe 1))
+(defrule ship
+   ?o <- (order (state new))
+   ?c <- (object (is-a Customer))
+   (audit ?id)
+   =>
+   (modify ?o (state shipped))
+   (assert (order (id (next-id)) (state new)))
+   (retract ?o)
+   (send ?c greet))
+(defmodule REPORTS (import MAIN deftemplate order) (export ?ALL))
+(deftemplate summary (slot total))
+(defrule REPORTS::count (order) => (make-instance of Customer (name x)))`
+
+func edges(g *Graph) []string {
+	var ret []string
+	for _, e := range g.Edges {
+		ret = append(ret, e.From+" -"+string(e.Kind)+"-> "+e.To)
+	}
+	return ret
+}
+
+func TestBuild(t *testing.T) {
+	file, err := parser.ParseString(source)
+	assert.NilError(t, err)
+	g := Build([]*parser.File{file})
+
+	t.Run("Nodes", func(t *testing.T) {
+		var ids []string
+		for _, n := range g.Nodes {
+			ids = append(ids, n.ID)
+		}
+		assert.DeepEqual(t, ids, []string{
+			"class:MAIN::Customer",
+			"function:MAIN::next-id",
+			"generic:MAIN::describe",
+			"module:MAIN::MAIN",
+			"module:REPORTS::REPORTS",
+			"rule:MAIN::ship",
+			"rule:REPORTS::count",
+			"template:MAIN::audit",
+			"template:MAIN::order",
+			"template:REPORTS::summary",
+		})
+		assert.Assert(t, g.Node("template:MAIN::audit").Implied)
+		assert.Assert(t, g.Node("template:MAIN::missing") == nil)
+	})
+
+	t.Run("Edges", func(t *testing.T) {
+		assert.DeepEqual(t, edges(g), []string{
+			"class:MAIN::Customer -calls-> generic:MAIN::describe",
+			"generic:MAIN::describe -calls-> function:MAIN::next-id",
+			"module:REPORTS::REPORTS -imports-> module:MAIN::MAIN",
+			"module:REPORTS::REPORTS -exports-> template:REPORTS::summary",
+			"rule:MAIN::ship -matches-on-> class:MAIN::Customer",
+			"rule:MAIN::ship -sends-to-> class:MAIN::Customer",
+			"rule:MAIN::ship -calls-> function:MAIN::next-id",
+			"rule:MAIN::ship -matches-on-> template:MAIN::audit",
+			"rule:MAIN::ship -asserts-> template:MAIN::order",
+			"rule:MAIN::ship -matches-on-> template:MAIN::order",
+			"rule:MAIN::ship -modifies-> template:MAIN::order",
+			"rule:MAIN::ship -retracts-> template:MAIN::order",
+			"rule:REPORTS::count -asserts-> class:MAIN::Customer",
+			"rule:REPORTS::count -matches-on-> template:MAIN::order",
+		})
+		assert.Equal(t, len(g.EdgesTo("template:MAIN::order")), 5)
+		assert.Equal(t, len(g.EdgesFrom("rule:REPORTS::count")), 2)
+	})
+
+	t.Run("DOT", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NilError(t, g.WriteDOT(&buf))
+		out := buf.String()
+		assert.Assert(t, strings.HasPrefix(out, "digraph clips {\n"))
+		assert.Assert(t, strings.Contains(out, `subgraph "cluster_REPORTS" {`))
+		assert.Assert(t, strings.Contains(out, `"template:MAIN::audit" [label="audit", shape=note, style=dashed];`))
+		assert.Assert(t, strings.Contains(out, `"rule:MAIN::ship" -> "template:MAIN::order" [label="modifies", style=solid];`))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NilError(t, g.WriteJSON(&buf))
+		var decoded Graph
+		assert.NilError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.DeepEqual(t, decoded, *g)
+
+		buf.Reset()
+		assert.NilError(t, Build(nil).WriteJSON(&buf))
+		assert.Assert(t, strings.Contains(buf.String(), `"edges": []`))
+	})
+}
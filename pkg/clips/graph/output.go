@@ -0,0 +1,91 @@
+package graph
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var nodeShapes = map[NodeKind]string{
+	RULE:     "box",
+	TEMPLATE: "note",
+	CLASS:    "component",
+	FUNCTION: "ellipse",
+	GENERIC:  "hexagon",
+	MODULE:   "folder",
+}
+
+var edgeStyles = map[EdgeKind]string{
+	MATCHES_ON: "dashed",
+	ASSERTS:    "solid",
+	MODIFIES:   "solid",
+	RETRACTS:   "dotted",
+	CALLS:      "solid",
+	SENDS_TO:   "solid",
+	IMPORTS:    "bold",
+	EXPORTS:    "bold",
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Constructs are grouped into a cluster
+// per module
+func (g *Graph) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph clips {")
+	fmt.Fprintln(out, "   rankdir=LR;")
+	fmt.Fprintln(out, "   node [fontname=\"Helvetica\"];")
+
+	var modules []string
+	byModule := make(map[string][]*Node)
+	for _, n := range g.Nodes {
+		if n.Kind == MODULE {
+			fmt.Fprintf(out, "   %s [label=%s, shape=%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Name), nodeShapes[n.Kind])
+			continue
+		}
+		if _, ok := byModule[n.Module]; !ok {
+			modules = append(modules, n.Module)
+		}
+		byModule[n.Module] = append(byModule[n.Module], n)
+	}
+	for _, module := range modules {
+		fmt.Fprintf(out, "   subgraph %s {\n", strconv.Quote("cluster_"+module))
+		fmt.Fprintf(out, "      label=%s;\n", strconv.Quote(module))
+		for _, n := range byModule[module] {
+			style := ""
+			if n.Implied {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(out, "      %s [label=%s, shape=%s%s];\n",
+				strconv.Quote(n.ID), strconv.Quote(n.Name), nodeShapes[n.Kind], style)
+		}
+		fmt.Fprintln(out, "   }")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(out, "   %s -> %s [label=%s, style=%s];\n",
+			strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(string(e.Kind)), edgeStyles[e.Kind])
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// WriteJSON writes the graph as a JSON object with "nodes" and "edges" arrays
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
@@ -28,6 +28,7 @@ import (
 type ImpliedFact struct {
 	env        *Environment
 	factptr    unsafe.Pointer
+	id         factID
 	multifield []interface{}
 }
 
@@ -42,7 +43,8 @@ func createImpliedFact(env *Environment, factptr unsafe.Pointer) *ImpliedFact {
 		env:     env,
 		factptr: factptr,
 	}
-	C.EnvIncrementFactCount(env.env, factptr)
+	C.EnvIncrementFactCount(env.ptr(), factptr)
+	ret.id = readFactID(env, factptr)
 	runtime.SetFinalizer(ret, func(*ImpliedFact) {
 		ret.Drop()
 	})
@@ -51,23 +53,31 @@ func createImpliedFact(env *Environment, factptr unsafe.Pointer) *ImpliedFact {
 
 // Drop drops the reference to the fact in CLIPS. should be called when done with the fact
 func (f *ImpliedFact) Drop() {
-	if f.factptr != nil {
-		C.EnvDecrementFactCount(f.env.env, f.factptr)
-		f.factptr = nil
+	if f.factptr != nil && f.env.env != nil {
+		C.EnvDecrementFactCount(f.env.ptr(), f.factptr)
 	}
+	f.factptr = nil
+}
+
+// check returns ErrEnvironmentClosed or ErrStale if the fact can no longer be used
+func (f *ImpliedFact) check() error {
+	return checkFact(f.env, f.factptr, f.id)
 }
 
 // Index returns the index number of this fact within CLIPS
 func (f *ImpliedFact) Index() int {
-	return int(C.EnvFactIndex(f.env.env, f.factptr))
+	if f.check() != nil {
+		return f.id.index
+	}
+	return int(C.EnvFactIndex(f.env.ptr(), f.factptr))
 }
 
 // Asserted returns true if the fact has been asserted.
 func (f *ImpliedFact) Asserted() bool {
-	if f.Index() == 0 {
+	if f.check() != nil || f.Index() == 0 {
 		return false
 	}
-	if C.EnvFactExistp(f.env.env, f.factptr) != 1 {
+	if C.EnvFactExistp(f.env.ptr(), f.factptr) != 1 {
 		return false
 	}
 	return true
@@ -75,6 +85,9 @@ func (f *ImpliedFact) Asserted() bool {
 
 // Assert asserts the fact
 func (f *ImpliedFact) Assert() error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Fact already asserted")
 	}
@@ -84,39 +97,49 @@ func (f *ImpliedFact) Assert() error {
 		f.multifield = make([]interface{}, 0)
 	}
 	data.SetValue(f.multifield)
-	ret := C.EnvPutFactSlot(f.env.env, f.factptr, nil, data.byRef())
+	ret := C.EnvPutFactSlot(f.env.ptr(), f.factptr, nil, data.byRef())
 	if ret != 1 {
 		return EnvError(f.env, "Unable to set slot for fact")
 	}
-	ret = C.EnvAssignFactSlotDefaults(f.env.env, f.factptr)
+	ret = C.EnvAssignFactSlotDefaults(f.env.ptr(), f.factptr)
 	if ret != 1 {
 		return EnvError(f.env, "Unable to set defaults for fact")
 	}
 
-	factptr := C.EnvAssert(f.env.env, f.factptr)
+	factptr := C.EnvAssert(f.env.ptr(), f.factptr)
 	if factptr == nil {
 		return EnvError(f.env, "Unable to assert fact")
 	}
+	f.id = readFactID(f.env, f.factptr)
 	return nil
 }
 
 // Retract retracts the fact from CLIPS
 func (f *ImpliedFact) Retract() error {
-	ret := C.EnvRetract(f.env.env, f.factptr)
+	if err := f.check(); err != nil {
+		return err
+	}
+	ret := C.EnvRetract(f.env.ptr(), f.factptr)
 	if ret != 1 {
 		return EnvError(f.env, "Unable to retract fact")
 	}
 	return nil
 }
 
-// Template returns the template defining this fact
+// Template returns the template defining this fact, or nil if the fact is stale
 func (f *ImpliedFact) Template() *Template {
-	tplptr := C.EnvFactDeftemplate(f.env.env, f.factptr)
+	if f.check() != nil {
+		return nil
+	}
+	tplptr := C.EnvFactDeftemplate(f.env.ptr(), f.factptr)
 	return createTemplate(f.env, tplptr)
 }
 
 // String returns a string representation of the fact
 func (f *ImpliedFact) String() string {
+	if f.check() != nil {
+		return fmt.Sprintf("<Fact-%d stale>", f.id.index)
+	}
 	ret := factPPString(f.env, f.factptr)
 	split := strings.SplitN(ret, "     ", 2)
 	return strings.TrimRight(split[len(split)-1], "\n")
@@ -133,6 +156,9 @@ func (f *ImpliedFact) Equal(otherfact Fact) bool {
 
 // Slots returns a function that can be called to get the next slot for this fact. Will return nil when no more slots remain
 func (f *ImpliedFact) Slots() (map[string]interface{}, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
 	data, err := slotValue(f.env, f.factptr, "")
 	if err != nil {
 		return nil, err
@@ -145,6 +171,9 @@ func (f *ImpliedFact) Slots() (map[string]interface{}, error) {
 
 // Slot returns the value of the given slot. For Implied Facts, the only valid slot name is ""
 func (f *ImpliedFact) Slot(slotname string) (interface{}, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
 	if slotname != "" {
 		return nil, fmt.Errorf(`Invalid slot name "%s"`, slotname)
 	}
@@ -158,6 +187,9 @@ func (f *ImpliedFact) Slot(slotname string) (interface{}, error) {
 
 // ExtractSlot unmarshals the value of the given slot into the user provided object. For Implied Facts, the only valid slot name is ""
 func (f *ImpliedFact) ExtractSlot(retval interface{}, slotname string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if slotname != "" {
 		return fmt.Errorf(`Invalid slot name "%s"`, slotname)
 	}
@@ -171,6 +203,9 @@ func (f *ImpliedFact) ExtractSlot(retval interface{}, slotname string) error {
 
 // Set alters the item at a specific in the multifield
 func (f *ImpliedFact) Set(index int, value interface{}) error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Unable to change asserted fact")
 	}
@@ -183,6 +218,9 @@ func (f *ImpliedFact) Set(index int, value interface{}) error {
 
 // Append an element to the fact
 func (f *ImpliedFact) Append(value interface{}) error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Unable to change asserted fact")
 	}
@@ -195,6 +233,9 @@ func (f *ImpliedFact) Append(value interface{}) error {
 
 // Extend Appends the contents of a slice to the fact
 func (f *ImpliedFact) Extend(values []interface{}) error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Unable to change asserted fact")
 	}
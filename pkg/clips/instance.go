@@ -29,12 +29,13 @@ import (
 type Instance struct {
 	env     *Environment
 	instptr unsafe.Pointer
+	name    InstanceName
 }
 
 // InstancesChanged returns true if any instance has changed
 func (env *Environment) InstancesChanged() bool {
-	ret := C.EnvGetInstancesChanged(env.env)
-	C.EnvSetInstancesChanged(env.env, 0)
+	ret := C.EnvGetInstancesChanged(env.ptr())
+	C.EnvSetInstancesChanged(env.ptr(), 0)
 	if ret == 1 {
 		return true
 	}
@@ -43,29 +44,41 @@ func (env *Environment) InstancesChanged() bool {
 
 // Instances returns all defined instances
 func (env *Environment) Instances() []*Instance {
-	instptr := C.EnvGetNextInstance(env.env, nil)
+	instptr := C.EnvGetNextInstance(env.ptr(), nil)
 	ret := make([]*Instance, 0, 10)
 	for instptr != nil {
 		ret = append(ret, createInstance(env, instptr))
-		instptr = C.EnvGetNextInstance(env.env, instptr)
+		instptr = C.EnvGetNextInstance(env.ptr(), instptr)
+	}
+	return ret
+}
+
+// instanceCount returns the number of instances, without creating an Instance for each
+func (env *Environment) instanceCount() int {
+	ret := 0
+	for instptr := C.EnvGetNextInstance(env.ptr(), nil); instptr != nil; instptr = C.EnvGetNextInstance(env.ptr(), instptr) {
+		ret++
 	}
 	return ret
 }
 
 // FindInstance returns the instance of the given name. module may be the empty string to use the current module
 func (env *Environment) FindInstance(name InstanceName, module string) (*Instance, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	var modptr unsafe.Pointer
 	if module != "" {
 		cmod := C.CString(module)
 		defer C.free(unsafe.Pointer(cmod))
-		modptr = C.EnvFindDefmodule(env.env, cmod)
+		modptr = C.EnvFindDefmodule(env.ptr(), cmod)
 		if modptr == nil {
 			return nil, NotFoundError(fmt.Errorf(`Module "%s" not found`, module))
 		}
 	}
 	cname := C.CString(string(name))
 	defer C.free(unsafe.Pointer(cname))
-	instptr := C.EnvFindInstance(env.env, modptr, cname, 1)
+	instptr := C.EnvFindInstance(env.ptr(), modptr, cname, 1)
 	if instptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Instance "%s" not found`, name))
 	}
@@ -74,9 +87,12 @@ func (env *Environment) FindInstance(name InstanceName, module string) (*Instanc
 
 // LoadInstancesFromString loads a set of instances into the CLIPS database. Equivalent to the load-instances command
 func (env *Environment) LoadInstancesFromString(instances string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cstr := C.CString(instances)
 	defer C.free(unsafe.Pointer(cstr))
-	ret := int(C.EnvLoadInstancesFromString(env.env, cstr, -1))
+	ret := int(C.EnvLoadInstancesFromString(env.ptr(), cstr, -1))
 	if ret == -1 {
 		return EnvError(env, "Unable to load instances")
 	}
@@ -85,13 +101,16 @@ func (env *Environment) LoadInstancesFromString(instances string) error {
 
 // LoadInstances loads a set of instances into the CLIPS database. Equivalent to the load-instances command
 func (env *Environment) LoadInstances(filename string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cstr := C.CString(filename)
 	defer C.free(unsafe.Pointer(cstr))
-	ret := C.EnvBinaryLoadInstances(env.env, cstr)
+	ret := C.EnvBinaryLoadInstances(env.ptr(), cstr)
 	if ret != -1 {
 		return nil
 	}
-	ret = C.EnvLoadInstances(env.env, cstr)
+	ret = C.EnvLoadInstances(env.ptr(), cstr)
 	if ret == -1 {
 		return EnvError(env, "Unable to load instances")
 	}
@@ -100,9 +119,12 @@ func (env *Environment) LoadInstances(filename string) error {
 
 // RestoreInstancesFromString loads a set of instances into CLIPS, bypassing message handling. Intended for use with save. Equivalent to restore-isntances command
 func (env *Environment) RestoreInstancesFromString(instances string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cstr := C.CString(instances)
 	defer C.free(unsafe.Pointer(cstr))
-	ret := C.EnvRestoreInstancesFromString(env.env, cstr, -1)
+	ret := C.EnvRestoreInstancesFromString(env.ptr(), cstr, -1)
 	if ret == -1 {
 		return EnvError(env, "Unable to restore instances")
 	}
@@ -111,9 +133,12 @@ func (env *Environment) RestoreInstancesFromString(instances string) error {
 
 // RestoreInstances loads a set of instances into CLIPS, bypassing message handling. Intended for use with save. Equivalent to restore-isntances command
 func (env *Environment) RestoreInstances(filename string) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cstr := C.CString(filename)
 	defer C.free(unsafe.Pointer(cstr))
-	ret := C.EnvRestoreInstances(env.env, cstr)
+	ret := C.EnvRestoreInstances(env.ptr(), cstr)
 	if ret == -1 {
 		return EnvError(env, "Unable to restore instances")
 	}
@@ -122,13 +147,16 @@ func (env *Environment) RestoreInstances(filename string) error {
 
 // SaveInstances saves the instances in the system to the specified file. If binary is true, instances will be aaved in binary format. Equivalent to save-instances
 func (env *Environment) SaveInstances(path string, binary bool, mode SaveMode) error {
+	if err := env.check(); err != nil {
+		return err
+	}
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 	var ret C.long
 	if binary {
-		ret = C.EnvBinarySaveInstances(env.env, cpath, mode.CVal())
+		ret = C.EnvBinarySaveInstances(env.ptr(), cpath, mode.CVal())
 	} else {
-		ret = C.EnvSaveInstances(env.env, cpath, mode.CVal())
+		ret = C.EnvSaveInstances(env.ptr(), cpath, mode.CVal())
 	}
 	if ret == 0 {
 		return EnvError(env, "Unable to save instances")
@@ -140,9 +168,12 @@ func (env *Environment) SaveInstances(path string, binary bool, mode SaveMode) e
 // ([<instance-name>] of <class-name> <slot-override>*)
 // <slot-override> :== (<slot-name> <constant>*)
 func (env *Environment) MakeInstance(command string) (*Instance, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	ccmd := C.CString(command)
 	defer C.free(unsafe.Pointer(ccmd))
-	instptr := C.EnvMakeInstance(env.env, ccmd)
+	instptr := C.EnvMakeInstance(env.ptr(), ccmd)
 	if instptr == nil {
 		return nil, EnvError(env, "Unable to create instance")
 	}
@@ -154,7 +185,8 @@ func createInstance(env *Environment, instptr unsafe.Pointer) *Instance {
 		env:     env,
 		instptr: instptr,
 	}
-	C.EnvIncrementInstanceCount(env.env, instptr)
+	C.EnvIncrementInstanceCount(env.ptr(), instptr)
+	ret.name = InstanceName(C.GoString(C.EnvGetInstanceName(env.ptr(), instptr)))
 	runtime.SetFinalizer(ret, func(*Instance) {
 		ret.Drop()
 	})
@@ -164,10 +196,25 @@ func createInstance(env *Environment, instptr unsafe.Pointer) *Instance {
 
 // Drop drops the reference to the instance in CLIPS. should be called when done with the instance
 func (inst *Instance) Drop() {
-	if inst.instptr != nil {
-		C.EnvDecrementInstanceCount(inst.env.env, inst.instptr)
-		inst.instptr = nil
+	if inst.instptr != nil && inst.env.env != nil {
+		C.EnvDecrementInstanceCount(inst.env.ptr(), inst.instptr)
 	}
+	inst.instptr = nil
+}
+
+// check returns ErrEnvironmentClosed or ErrStale if the instance can no longer be used. An
+// instance is stale once dropped, deleted or unmade
+func (inst *Instance) check() error {
+	if inst.env.env == nil {
+		return ErrEnvironmentClosed
+	}
+	if inst.instptr == nil {
+		return fmt.Errorf("Instance [%s] has been dropped: %w", inst.name, ErrStale)
+	}
+	if C.EnvValidInstanceAddress(inst.env.ptr(), inst.instptr) != 1 {
+		return fmt.Errorf("Instance [%s] no longer exists: %w", inst.name, ErrStale)
+	}
+	return nil
 }
 
 // Equal returns true if the other instance represents the same CLIPS inst as this one
@@ -176,27 +223,35 @@ func (inst *Instance) Equal(other *Instance) bool {
 }
 
 func (inst *Instance) String() string {
+	if inst.check() != nil {
+		return fmt.Sprintf("<Instance-%s stale>", inst.name)
+	}
 	var bufsize C.ulong = 1024
 	buf := (*C.char)(C.malloc(C.sizeof_char * bufsize))
 	defer C.free(unsafe.Pointer(buf))
-	C.EnvGetInstancePPForm(inst.env.env, buf, bufsize-1, inst.instptr)
+	C.EnvGetInstancePPForm(inst.env.ptr(), buf, bufsize-1, inst.instptr)
 	return C.GoString(buf)
 }
 
 // Name returns the name of this instance
 func (inst *Instance) Name() InstanceName {
-	ret := C.EnvGetInstanceName(inst.env.env, inst.instptr)
-	return InstanceName(C.GoString(ret))
+	return inst.name
 }
 
-// Class returns a reference to the class of this instance
+// Class returns a reference to the class of this instance, or nil if the instance is stale
 func (inst *Instance) Class() *Class {
-	clptr := C.EnvGetInstanceClass(inst.env.env, inst.instptr)
+	if inst.check() != nil {
+		return nil
+	}
+	clptr := C.EnvGetInstanceClass(inst.env.ptr(), inst.instptr)
 	return createClass(inst.env, clptr)
 }
 
-// Slots returns a map of values for each slot by name
+// Slots returns a map of values for each slot by name, or nil if the instance is stale
 func (inst *Instance) Slots(inherited bool) map[string]interface{} {
+	if inst.check() != nil {
+		return nil
+	}
 	cl := inst.Class()
 	slots := cl.Slots(inherited)
 	ret := make(map[string]interface{}, len(slots))
@@ -209,6 +264,9 @@ func (inst *Instance) Slots(inherited bool) map[string]interface{} {
 
 // Slot returns the value of the given slot. Warning, this function bypasses message-passing
 func (inst *Instance) Slot(name string) (interface{}, error) {
+	if err := inst.check(); err != nil {
+		return nil, err
+	}
 	cl := inst.Class()
 	_, err := cl.Slot(name)
 	if err != nil {
@@ -222,12 +280,15 @@ func (inst *Instance) slotValue(name string) interface{} {
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(inst.env)
 	defer data.Delete()
-	C.EnvDirectGetSlot(inst.env.env, inst.instptr, cname, data.byRef())
+	C.EnvDirectGetSlot(inst.env.ptr(), inst.instptr, cname, data.byRef())
 	return data.Value()
 }
 
 // SetSlot sets the slot to the given value. Warning, this function bypasses message-passing
 func (inst *Instance) SetSlot(name string, value interface{}) error {
+	if err := inst.check(); err != nil {
+		return err
+	}
 	typ := reflect.TypeOf(value)
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
@@ -247,15 +308,19 @@ func (inst *Instance) SetSlot(name string, value interface{}) error {
 
 	data.SetValue(value)
 
-	ret := C.EnvDirectPutSlot(inst.env.env, inst.instptr, cname, data.byRef())
+	ret := C.EnvDirectPutSlot(inst.env.ptr(), inst.instptr, cname, data.byRef())
 	if ret == 0 {
 		return EnvError(inst.env, `Unable to set slot "%s"`, name)
 	}
 	return nil
 }
 
-// Send sends a message tot his instance. Message arguments must be provided as a string
+// Send sends a message tot his instance. Message arguments must be provided as a string. It
+// returns nil if the instance is stale
 func (inst *Instance) Send(message string, arguments string) interface{} {
+	if inst.check() != nil {
+		return nil
+	}
 	data := createDataObject(inst.env)
 	defer data.Delete()
 
@@ -271,13 +336,16 @@ func (inst *Instance) Send(message string, arguments string) interface{} {
 		cargs = C.CString(arguments)
 		defer C.free(unsafe.Pointer(cargs))
 	}
-	C.EnvSend(inst.env.env, instaddr.byRef(), cmsg, cargs, data.byRef())
+	C.EnvSend(inst.env.ptr(), instaddr.byRef(), cmsg, cargs, data.byRef())
 	return data.Value()
 }
 
 // Delete unmakes the instance within CLIPS, bypassing message passing
 func (inst *Instance) Delete() error {
-	ret := C.EnvDeleteInstance(inst.env.env, inst.instptr)
+	if err := inst.check(); err != nil {
+		return err
+	}
+	ret := C.EnvDeleteInstance(inst.env.ptr(), inst.instptr)
 	if ret != 1 {
 		return EnvError(inst.env, "Unable to delete instance")
 	}
@@ -286,7 +354,10 @@ func (inst *Instance) Delete() error {
 
 // Unmake unmakes the instance within CLIPS, using message passing
 func (inst *Instance) Unmake() error {
-	ret := C.EnvUnmakeInstance(inst.env.env, inst.instptr)
+	if err := inst.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUnmakeInstance(inst.env.ptr(), inst.instptr)
 	if ret != 1 {
 		return EnvError(inst.env, "Unable to unmake instance")
 	}
@@ -295,11 +366,14 @@ func (inst *Instance) Unmake() error {
 
 // ExtractSlot obtains the given slot value into the user-provided object
 func (inst *Instance) ExtractSlot(retval interface{}, name string) error {
+	if err := inst.check(); err != nil {
+		return err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	data := createDataObject(inst.env)
 	defer data.Delete()
-	C.EnvDirectGetSlot(inst.env.env, inst.instptr, cname, data.byRef())
+	C.EnvDirectGetSlot(inst.env.ptr(), inst.instptr, cname, data.byRef())
 	return data.ExtractValue(retval, true)
 }
 
@@ -307,6 +381,9 @@ func (inst *Instance) ExtractSlot(retval interface{}, name string) error {
 // The return value can be a struct or a map of string to another datatype. If retval points
 // to a valid object, that object will be populated. If it is not, one will be created
 func (inst *Instance) Extract(retval interface{}) error {
+	if err := inst.check(); err != nil {
+		return err
+	}
 	slots := inst.Slots(true)
 	knownInstances := make(map[InstanceName]interface{})
 	knownInstances[inst.Name()] = retval
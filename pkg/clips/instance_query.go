@@ -0,0 +1,239 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryMember binds a variable of an instance-set query to the instances of one or more classes
+type QueryMember struct {
+	// Variable is the name of the variable, without the leading ?
+	Variable string
+	Classes  []string
+}
+
+// Member returns a QueryMember binding the variable to the instances of the given classes
+func Member(variable string, classes ...string) QueryMember {
+	return QueryMember{Variable: variable, Classes: classes}
+}
+
+// InstanceQuery is a COOL instance-set query. Query is a CLIPS expression which may refer to
+// the slots of the members, as in ?p:age, and to Args by position, as ?0, ?1 and so on. Args
+// are written into the query as CLIPS values, so strings stay strings and Symbols stay
+// symbols. An empty Query matches every instance-set
+type InstanceQuery struct {
+	Members []QueryMember
+	Query   string
+	Args    []interface{}
+}
+
+// NewInstanceQuery returns a query over the instances of a single class, bound to variable
+func NewInstanceQuery(variable string, class string, query string, args ...interface{}) *InstanceQuery {
+	return &InstanceQuery{
+		Members: []QueryMember{Member(variable, class)},
+		Query:   query,
+		Args:    args,
+	}
+}
+
+// render returns the instance-set template and query as the arguments of a query function
+func (q *InstanceQuery) render() (string, error) {
+	if len(q.Members) == 0 {
+		return "", fmt.Errorf("Instance query has no members")
+	}
+	var b strings.Builder
+	b.WriteString("(")
+	for ii, member := range q.Members {
+		if len(member.Classes) == 0 {
+			return "", fmt.Errorf(`Query member "%s" has no classes`, member.Variable)
+		}
+		if ii > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "(?%s %s)", member.Variable, strings.Join(member.Classes, " "))
+	}
+	b.WriteString(") ")
+	query := strings.TrimSpace(q.Query)
+	if query == "" {
+		query = "TRUE"
+	}
+	query, err := bindArgs(query, q.Args)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(query)
+	return b.String(), nil
+}
+
+// bindArgs replaces ?0, ?1 and so on outside of strings with the given arguments as CLIPS values
+func bindArgs(expr string, args []interface{}) (string, error) {
+	isDigit := func(c byte) bool {
+		return c >= '0' && c <= '9'
+	}
+	var b strings.Builder
+	inString := false
+	for ii := 0; ii < len(expr); ii++ {
+		c := expr[ii]
+		switch {
+		case inString && c == '\\' && ii+1 < len(expr):
+			b.WriteByte(c)
+			ii++
+			c = expr[ii]
+		case inString && c == '"':
+			inString = false
+		case c == '"':
+			inString = true
+		case !inString && c == '?' && ii+1 < len(expr) && isDigit(expr[ii+1]):
+			end := ii + 1
+			for end < len(expr) && isDigit(expr[end]) {
+				end++
+			}
+			pos, _ := strconv.Atoi(expr[ii+1 : end])
+			if pos >= len(args) {
+				return "", fmt.Errorf("Query refers to ?%d but has %d arguments", pos, len(args))
+			}
+			value, err := clipsLiteral(args[pos])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			ii = end - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+// FindAllInstances returns every instance-set matching the query. Each set holds an instance
+// for each member of the query, in order
+func (env *Environment) FindAllInstances(q *InstanceQuery) ([][]*Instance, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	args, err := q.render()
+	if err != nil {
+		return nil, err
+	}
+	ret, err := env.Eval(fmt.Sprintf("(find-all-instances %s)", args))
+	if err != nil {
+		return nil, err
+	}
+	values, ok := ret.([]interface{})
+	if !ok || len(values)%len(q.Members) != 0 {
+		return nil, fmt.Errorf(`Unexpected result of instance query "%s"`, args)
+	}
+	sets := make([][]*Instance, 0, len(values)/len(q.Members))
+	for start := 0; start < len(values); start += len(q.Members) {
+		set := make([]*Instance, 0, len(q.Members))
+		for _, value := range values[start : start+len(q.Members)] {
+			name, ok := value.(InstanceName)
+			if !ok {
+				return nil, fmt.Errorf(`Unexpected result of instance query "%s"`, args)
+			}
+			inst, err := env.FindInstance(name, "")
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, inst)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// FindInstances returns the instances matching a query with a single member
+func (env *Environment) FindInstances(q *InstanceQuery) ([]*Instance, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	if len(q.Members) != 1 {
+		return nil, fmt.Errorf("FindInstances requires a query with one member, not %d", len(q.Members))
+	}
+	sets, err := env.FindAllInstances(q)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Instance, len(sets))
+	for ii, set := range sets {
+		ret[ii] = set[0]
+	}
+	return ret, nil
+}
+
+// DoForAllInstances runs a CLIPS action for each instance-set matching the query. The action
+// may refer to the query arguments in the same way as the query. The result of the last
+// action is returned
+func (env *Environment) DoForAllInstances(q *InstanceQuery, action string) (interface{}, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	args, err := q.render()
+	if err != nil {
+		return nil, err
+	}
+	action, err = bindArgs(action, q.Args)
+	if err != nil {
+		return nil, err
+	}
+	return env.Eval(fmt.Sprintf("(do-for-all-instances %s %s)", args, action))
+}
+
+// AnyInstance returns true if any instance-set matches the query
+func (env *Environment) AnyInstance(q *InstanceQuery) (bool, error) {
+	if err := env.check(); err != nil {
+		return false, err
+	}
+	args, err := q.render()
+	if err != nil {
+		return false, err
+	}
+	ret, err := env.Eval(fmt.Sprintf("(any-instancep %s)", args))
+	if err != nil {
+		return false, err
+	}
+	found, ok := ret.(bool)
+	if !ok {
+		return false, fmt.Errorf(`Unexpected result of instance query "%s"`, args)
+	}
+	return found, nil
+}
+
+// ExtractInstances unmarshals each instance into an element of the user provided slice
+// pointer, such as *[]T or *[]*T
+func (env *Environment) ExtractInstances(retval interface{}, instances []*Instance) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	return extractSlice(retval, len(instances), func(ii int, elem interface{}) error {
+		return instances[ii].Extract(elem)
+	})
+}
+
+// ExtractAll unmarshals every instance of the named class and its subclasses into the user
+// provided slice pointer, such as *[]T or *[]*T
+func (env *Environment) ExtractAll(class string, retval interface{}) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	cl, err := env.FindClass(class)
+	if err != nil {
+		return err
+	}
+	return env.ExtractInstances(retval, cl.AllInstances(true))
+}
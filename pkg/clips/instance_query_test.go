@@ -0,0 +1,182 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestInstanceQuery(t *testing.T) {
+	setup := func(t *testing.T) *Environment {
+		env := CreateEnvironment()
+		err := env.Build(`(defclass Person (is-a USER) (slot name (type STRING)) (slot age (type INTEGER)))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defclass Employee (is-a Person) (slot employer))`)
+		assert.NilError(t, err)
+		err = env.LoadInstancesFromString(`
+		([ann] of Person (name "Ann") (age 34))
+		([bob] of Person (name "Bob") (age 17))
+		([cat] of Employee (name "Cat") (age 51) (employer acme))
+		`)
+		assert.NilError(t, err)
+		return env
+	}
+
+	t.Run("All instances", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		class, err := env.FindClass("Person")
+		assert.NilError(t, err)
+		assert.Equal(t, len(class.AllInstances(false)), 2)
+		instances := class.AllInstances(true)
+		assert.Equal(t, len(instances), 3)
+		assert.Equal(t, instances[2].Name(), InstanceName("cat"))
+	})
+
+	t.Run("Find instances", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		instances, err := env.FindInstances(NewInstanceQuery("p", "Person", "(>= ?p:age ?0)", 18))
+		assert.NilError(t, err)
+		assert.Equal(t, len(instances), 2)
+		assert.Equal(t, instances[0].Name(), InstanceName("ann"))
+		assert.Equal(t, instances[1].Name(), InstanceName("cat"))
+
+		instances, err = env.FindInstances(NewInstanceQuery("p", "Person", `(eq ?p:name ?0)`, "Bob"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(instances), 1)
+
+		// a symbol does not match a string slot
+		instances, err = env.FindInstances(NewInstanceQuery("p", "Person", `(eq ?p:name ?0)`, Symbol("Bob")))
+		assert.NilError(t, err)
+		assert.Equal(t, len(instances), 0)
+
+		instances, err = env.FindInstances(NewInstanceQuery("e", "Employee", ""))
+		assert.NilError(t, err)
+		assert.Equal(t, len(instances), 1)
+
+		_, err = env.FindInstances(NewInstanceQuery("p", "Person", "(> ?p:age ?1)", 18))
+		assert.ErrorContains(t, err, "refers to ?1")
+	})
+
+	t.Run("Find instance sets", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		sets, err := env.FindAllInstances(&InstanceQuery{
+			Members: []QueryMember{Member("a", "Person"), Member("b", "Person")},
+			Query:   "(and (> ?a:age ?b:age) (< ?b:age ?0))",
+			Args:    []interface{}{18},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(sets), 2)
+		assert.Equal(t, sets[0][0].Name(), InstanceName("ann"))
+		assert.Equal(t, sets[0][1].Name(), InstanceName("bob"))
+		assert.Equal(t, sets[1][0].Name(), InstanceName("cat"))
+
+		_, err = env.FindAllInstances(&InstanceQuery{})
+		assert.ErrorContains(t, err, "no members")
+	})
+
+	t.Run("Any instance", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		found, err := env.AnyInstance(NewInstanceQuery("p", "Person", "(> ?p:age ?0)", 50))
+		assert.NilError(t, err)
+		assert.Assert(t, found)
+
+		found, err = env.AnyInstance(NewInstanceQuery("p", "Person", "(> ?p:age ?0)", 60.5))
+		assert.NilError(t, err)
+		assert.Assert(t, !found)
+	})
+
+	t.Run("Do for all instances", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		q := NewInstanceQuery("p", "Person", "(< ?p:age ?0)", 40)
+		_, err := env.DoForAllInstances(q, "(send ?p put-age (+ ?p:age ?0))")
+		assert.NilError(t, err)
+
+		inst, err := env.FindInstance("bob", "")
+		assert.NilError(t, err)
+		age, err := inst.Slot("age")
+		assert.NilError(t, err)
+		assert.Equal(t, age, int64(57))
+	})
+
+	t.Run("Extract all", func(t *testing.T) {
+		env := setup(t)
+		defer env.Delete()
+
+		type person struct {
+			Name string `clips:"name"`
+			Age  int    `clips:"age"`
+		}
+		var people []person
+		err := env.ExtractAll("Person", &people)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, people, []person{{"Ann", 34}, {"Bob", 17}, {"Cat", 51}})
+
+		var adults []*person
+		instances, err := env.FindInstances(NewInstanceQuery("p", "Person", "(>= ?p:age 18)"))
+		assert.NilError(t, err)
+		err = env.ExtractInstances(&adults, instances)
+		assert.NilError(t, err)
+		assert.Equal(t, len(adults), 2)
+		assert.Equal(t, adults[1].Name, "Cat")
+
+		err = env.ExtractAll("Nobody", &people)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestClipsLiteral(t *testing.T) {
+	for _, tc := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "nil"},
+		{true, "TRUE"},
+		{3, "3"},
+		{uint8(7), "7"},
+		{2.0, "2.0"},
+		{1.5e20, "1.5e+20"},
+		{"say \"hi\"\\", `"say \"hi\"\\"`},
+		{Symbol("abc"), "abc"},
+		{InstanceName("i1"), "[i1]"},
+		{[]interface{}{1, Symbol("a"), "b"}, `(create$ 1 a "b")`},
+	} {
+		ret, err := clipsLiteral(tc.value)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, tc.expected)
+	}
+	_, err := clipsLiteral(struct{}{})
+	assert.ErrorContains(t, err, "Unable to write")
+}
+
+func TestBindArgs(t *testing.T) {
+	ret, err := bindArgs(`(and (> ?p:age ?0) (eq ?p:name "?1 \"?0") (neq ?p ?1))`, []interface{}{18, "Bob"})
+	assert.NilError(t, err)
+	assert.Equal(t, ret, `(and (> ?p:age 18) (eq ?p:name "?1 \"?0") (neq ?p "Bob"))`)
+
+	_, err = bindArgs(`(> ?p:age ?2)`, []interface{}{1})
+	assert.ErrorContains(t, err, "refers to ?2 but has 1 arguments")
+}
@@ -0,0 +1,316 @@
+package lexer
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind identifies the class of a token. The syntax highlighter of the interactive
+// shell colours source by these classes too
+type Kind int
+
+const (
+	EOF Kind = iota
+	LPAREN
+	RPAREN
+	COMMENT
+	STRING
+	INTEGER
+	FLOAT
+	INSTANCE_NAME
+	VARIABLE
+	GLOBAL_VARIABLE
+	SYMBOL
+	OPERATOR
+)
+
+var kindNames = [...]string{
+	"EOF",
+	"LPAREN",
+	"RPAREN",
+	"COMMENT",
+	"STRING",
+	"INTEGER",
+	"FLOAT",
+	"INSTANCE_NAME",
+	"VARIABLE",
+	"GLOBAL_VARIABLE",
+	"SYMBOL",
+	"OPERATOR",
+}
+
+func (k Kind) String() string {
+	return kindNames[int(k)]
+}
+
+// Pos is a position within CLIPS source. Line and Column are 1-based, Offset is 0-based
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Token is a single lexical element of CLIPS source
+type Token struct {
+	Kind  Kind
+	Value string
+	Pos   Pos
+	// End is the position immediately following the token
+	End Pos
+	// Newlines is the number of line breaks in the whitespace preceding the token
+	Newlines int
+	// Spaced is true if the token is preceded by whitespace or is the first token
+	Spaced bool
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%s %s %q", t.Pos, t.Kind, t.Value)
+}
+
+// Error is returned for malformed source
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Scanner splits CLIPS source into tokens
+type Scanner struct {
+	src  string
+	pos  Pos
+	prev Kind
+}
+
+// NewScanner returns a scanner reading from the given source
+func NewScanner(src string) *Scanner {
+	return &Scanner{
+		src:  src,
+		pos:  Pos{Line: 1, Column: 1},
+		prev: EOF,
+	}
+}
+
+// Tokenize returns all tokens in the source, excluding the final EOF
+func Tokenize(src string) ([]Token, error) {
+	s := NewScanner(src)
+	ret := make([]Token, 0, len(src)/4)
+	for {
+		tok, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Kind == EOF {
+			return ret, nil
+		}
+		ret = append(ret, tok)
+	}
+}
+
+func (s *Scanner) peek(n int) byte {
+	if s.pos.Offset+n >= len(s.src) {
+		return 0
+	}
+	return s.src[s.pos.Offset+n]
+}
+
+func (s *Scanner) advance() {
+	if s.src[s.pos.Offset] == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
+	s.pos.Offset++
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f' || ch == '\v'
+}
+
+// IsDelimiter returns true if the character ends a symbol
+func IsDelimiter(ch byte) bool {
+	switch ch {
+	case 0, '(', ')', '"', ';', '&', '|', '~':
+		return true
+	}
+	return isSpace(ch)
+}
+
+// Next returns the next token from the source. At the end of input a token of kind EOF is returned
+func (s *Scanner) Next() (Token, error) {
+	tok := Token{Spaced: s.prev == EOF}
+	for s.pos.Offset < len(s.src) && isSpace(s.peek(0)) {
+		if s.peek(0) == '\n' {
+			tok.Newlines++
+		}
+		tok.Spaced = true
+		s.advance()
+	}
+	tok.Pos = s.pos
+	start := s.pos.Offset
+	if start >= len(s.src) {
+		tok.Kind = EOF
+		tok.End = s.pos
+		return tok, nil
+	}
+
+	ch := s.peek(0)
+	switch {
+	case ch == '(':
+		tok.Kind = LPAREN
+		s.advance()
+	case ch == ')':
+		tok.Kind = RPAREN
+		s.advance()
+	case ch == ';':
+		tok.Kind = COMMENT
+		for s.pos.Offset < len(s.src) && s.peek(0) != '\n' {
+			s.advance()
+		}
+	case ch == '"':
+		tok.Kind = STRING
+		s.advance()
+		for {
+			if s.pos.Offset >= len(s.src) {
+				return tok, &Error{Pos: tok.Pos, Msg: "unterminated string"}
+			}
+			c := s.peek(0)
+			s.advance()
+			if c == '\\' && s.pos.Offset < len(s.src) {
+				s.advance()
+				continue
+			}
+			if c == '"' {
+				break
+			}
+		}
+	case ch == '&' || ch == '|' || ch == '~':
+		tok.Kind = OPERATOR
+		s.advance()
+	case ch == '[':
+		tok.Kind = INSTANCE_NAME
+		for s.pos.Offset < len(s.src) && s.peek(0) != ']' && !IsDelimiter(s.peek(0)) {
+			s.advance()
+		}
+		if s.peek(0) != ']' {
+			return tok, &Error{Pos: tok.Pos, Msg: "unterminated instance name"}
+		}
+		s.advance()
+	default:
+		// a stray NUL is not a delimiter within the input, so always consume a character
+		s.advance()
+		for !IsDelimiter(s.peek(0)) {
+			s.advance()
+		}
+		tok.Kind = classify(s.src[start:s.pos.Offset])
+	}
+	tok.Value = s.src[start:s.pos.Offset]
+	tok.End = s.pos
+	s.prev = tok.Kind
+	return tok, nil
+}
+
+func classify(word string) Kind {
+	switch {
+	case strings.HasPrefix(word, "?*") || strings.HasPrefix(word, "$?*"):
+		if len(word) > 3 && strings.HasSuffix(word, "*") {
+			return GLOBAL_VARIABLE
+		}
+	case strings.HasPrefix(word, "?") || strings.HasPrefix(word, "$?"):
+		return VARIABLE
+	}
+	if isInteger(word) {
+		return INTEGER
+	}
+	if isFloat(word) {
+		return FLOAT
+	}
+	return SYMBOL
+}
+
+func isInteger(word string) bool {
+	if word != "" && (word[0] == '-' || word[0] == '+') {
+		word = word[1:]
+	}
+	if word == "" {
+		return false
+	}
+	for ii := 0; ii < len(word); ii++ {
+		if word[ii] < '0' || word[ii] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isFloat(word string) bool {
+	if word != "" && (word[0] == '-' || word[0] == '+') {
+		word = word[1:]
+	}
+	mantissa := word
+	if idx := strings.IndexAny(word, "eE"); idx >= 0 {
+		if !isInteger(word[idx+1:]) {
+			return false
+		}
+		mantissa = word[:idx]
+	}
+	digits := 0
+	dots := 0
+	for ii := 0; ii < len(mantissa); ii++ {
+		switch {
+		case mantissa[ii] >= '0' && mantissa[ii] <= '9':
+			digits++
+		case mantissa[ii] == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
+
+// Constructs lists the CLIPS construct keywords
+var Constructs = []string{
+	"defclass",
+	"deffacts",
+	"deffunction",
+	"defgeneric",
+	"defglobal",
+	"definstances",
+	"defmessage-handler",
+	"defmethod",
+	"defmodule",
+	"defrule",
+	"deftemplate",
+}
+
+// IsConstruct returns true if the given symbol begins a construct
+func IsConstruct(word string) bool {
+	for _, c := range Constructs {
+		if c == word {
+			return true
+		}
+	}
+	return false
+}
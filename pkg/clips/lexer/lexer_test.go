@@ -0,0 +1,68 @@
+package lexer
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestScanner(t *testing.T) {
+	t.Run("Token kinds", func(t *testing.T) {
+		toks, err := Tokenize(`(foo "a \"b\"" 12 -1.5 1e3 [inst] ?x $?y ?*g* ; note` + "\n)")
+		assert.NilError(t, err)
+		kinds := make([]Kind, len(toks))
+		for ii, tok := range toks {
+			kinds[ii] = tok.Kind
+		}
+		assert.DeepEqual(t, kinds, []Kind{
+			LPAREN, SYMBOL, STRING, INTEGER, FLOAT, FLOAT, INSTANCE_NAME,
+			VARIABLE, VARIABLE, GLOBAL_VARIABLE, COMMENT, RPAREN,
+		})
+		assert.Equal(t, toks[2].Value, `"a \"b\""`)
+		assert.Equal(t, toks[10].Value, "; note")
+	})
+
+	t.Run("Positions", func(t *testing.T) {
+		toks, err := Tokenize("(a\n\n  b)")
+		assert.NilError(t, err)
+		assert.Equal(t, toks[2].Pos, Pos{Offset: 6, Line: 3, Column: 3})
+		assert.Equal(t, toks[2].Newlines, 2)
+		assert.Assert(t, toks[2].Spaced)
+		assert.Assert(t, !toks[3].Spaced)
+	})
+
+	t.Run("Constraint operators", func(t *testing.T) {
+		toks, err := Tokenize("?x&:(> ?x 1)|~red")
+		assert.NilError(t, err)
+		values := make([]string, len(toks))
+		for ii, tok := range toks {
+			values[ii] = tok.Value
+		}
+		assert.DeepEqual(t, values, []string{"?x", "&", ":", "(", ">", "?x", "1", ")", "|", "~", "red"})
+	})
+
+	t.Run("Binary input", func(t *testing.T) {
+		toks, err := Tokenize("a\x00b")
+		assert.NilError(t, err)
+		assert.Equal(t, len(toks), 2)
+	})
+
+	t.Run("Unterminated string", func(t *testing.T) {
+		_, err := Tokenize(`(printout t "oops)`)
+		assert.ErrorContains(t, err, "1:13: unterminated string")
+	})
+}
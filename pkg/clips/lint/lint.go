@@ -0,0 +1,211 @@
+// Package lint finds common mistakes in CLIPS rule bases without running them
+package lint
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// Names of the checks performed, as reported in Diagnostic.Check
+const (
+	UndefinedTemplate = "undefined-template"
+	UndefinedClass    = "undefined-class"
+	UndefinedSlot     = "undefined-slot"
+	UnusedVariable    = "unused-variable"
+	UnboundVariable   = "unbound-variable"
+	ModifyUnbound     = "modify-unbound"
+	SlotValue         = "slot-value"
+	Shadowed          = "shadowed-construct"
+	UnusedFunction    = "unused-function"
+)
+
+// Checks lists every check, in the order they are documented
+var Checks = []string{
+	UndefinedTemplate,
+	UndefinedClass,
+	UndefinedSlot,
+	UnusedVariable,
+	UnboundVariable,
+	ModifyUnbound,
+	SlotValue,
+	Shadowed,
+	UnusedFunction,
+}
+
+// Diagnostic is a single problem found by the linter
+type Diagnostic struct {
+	File  string
+	Pos   lexer.Pos
+	Check string
+	Msg   string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%s: %s (%s)", d.File, d.Pos, d.Msg, d.Check)
+}
+
+type linter struct {
+	schema *Schema
+	file   *parser.File
+	diags  []Diagnostic
+	// handler is the class of the message handler being checked, if any
+	handler string
+}
+
+func (l *linter) report(node parser.Node, check string, format string, args ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{
+		File:  l.file.Name,
+		Pos:   node.Pos(),
+		Check: check,
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Lint checks the given files as a single rule base. Templates and classes in live,
+// typically read from an environment the files were loaded into, take precedence over
+// those parsed from the files; live may be nil
+func Lint(files []*parser.File, live *Schema) []Diagnostic {
+	l := &linter{schema: StaticSchema(files)}
+	l.schema.Merge(live)
+
+	for _, file := range files {
+		l.file = file
+		for _, c := range file.Constructs {
+			switch c := c.(type) {
+			case *parser.Defrule:
+				l.rule(c)
+			case *parser.Deffunction:
+				l.body(c.Params, c.Wildcard, c.Body)
+			case *parser.Defmethod:
+				var params []*parser.Variable
+				for _, param := range c.Params {
+					params = append(params, param.Var)
+				}
+				var wildcard *parser.Variable
+				if c.Wildcard != nil {
+					wildcard = c.Wildcard.Var
+				}
+				l.body(params, wildcard, c.Body)
+			case *parser.DefmessageHandler:
+				params := append([]*parser.Variable{{Name: "self"}}, c.Params...)
+				l.handler = c.Class.Name
+				l.body(params, c.Wildcard, c.Body)
+				l.handler = ""
+			case *parser.Deffacts:
+				for _, fact := range c.Facts {
+					l.fact(fact)
+				}
+			case *parser.Definstances:
+				for _, inst := range c.Instances {
+					l.instance(inst)
+				}
+			}
+		}
+	}
+	l.shadowing(files)
+	l.unusedFunctions(files)
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		a, b := l.diags[i], l.diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Pos.Offset < b.Pos.Offset
+	})
+	return l.diags
+}
+
+// shadowing reports constructs defined under the same name in more than one module
+func (l *linter) shadowing(files []*parser.File) {
+	type definition struct {
+		file      *parser.File
+		construct parser.Construct
+	}
+	seen := make(map[string]definition)
+	check := func(file *parser.File, c parser.Construct, key string, node parser.Node, what string) {
+		prev, ok := seen[key]
+		if !ok {
+			seen[key] = definition{file, c}
+			return
+		}
+		if prev.construct.Header().Module != c.Header().Module {
+			l.file = file
+			l.report(node, Shadowed, "%s in module %s shadows the definition in module %s at %s:%s",
+				what, c.Header().Module, prev.construct.Header().Module, prev.file.Name, prev.construct.Pos())
+		}
+	}
+	for _, file := range files {
+		for _, c := range file.Constructs {
+			switch c := c.(type) {
+			case *parser.Defmethod, *parser.DefmessageHandler, *parser.Defmodule:
+			case *parser.Defglobal:
+				for _, g := range c.Globals {
+					check(file, c, "defglobal "+g.Var.Name, g, "defglobal "+g.Var.String())
+				}
+			default:
+				what := c.Keyword() + " " + c.Header().Name.Name
+				check(file, c, what, c.Header().Name, what)
+			}
+		}
+	}
+}
+
+// unusedFunctions reports deffunctions which are never called nor named as a value
+func (l *linter) unusedFunctions(files []*parser.File) {
+	used := make(map[string]bool)
+	collect := func(node parser.Node, self string) {
+		parser.Inspect(node, func(n parser.Node) bool {
+			name := ""
+			switch n := n.(type) {
+			case *parser.Call:
+				name = n.Function.Name
+			case *parser.Constant:
+				if n.Kind == lexer.SYMBOL {
+					name = n.Value
+				}
+			}
+			// recursive calls do not count as a use
+			if name != "" && name != self {
+				used[name] = true
+			}
+			return true
+		})
+	}
+	for _, file := range files {
+		for _, c := range file.Constructs {
+			self := ""
+			if fn, ok := c.(*parser.Deffunction); ok {
+				self = fn.Name.Name
+			}
+			collect(c, self)
+		}
+		for _, cmd := range file.Commands {
+			collect(cmd, "")
+		}
+	}
+	for _, file := range files {
+		l.file = file
+		for _, c := range file.Constructs {
+			if fn, ok := c.(*parser.Deffunction); ok && !used[fn.Name.Name] {
+				l.report(fn.Name, UnusedFunction, "deffunction %s is never called", fn.Name.Name)
+			}
+		}
+	}
+}
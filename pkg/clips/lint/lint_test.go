@@ -0,0 +1,191 @@
+package lint
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+	"gotest.tools/assert"
+)
+
+func lintString(t *testing.T, src string, live *Schema) []string {
+	file, err := parser.ParseFile("test.clp", []byte(src))
+	assert.NilError(t, err)
+	var ret []string
+	for _, d := range Lint([]*parser.File{file}, live) {
+		ret = append(ret, d.String())
+	}
+	return ret
+}
+
+func TestLint(t *testing.T) {
+	t.Run("Clean testdata", func(t *testing.T) {
+		src, err := ioutil.ReadFile("../testdata/dopey.clp")
+		assert.NilError(t, err)
+		file, err := parser.ParseFile("dopey.clp", src)
+		assert.NilError(t, err)
+		assert.Equal(t, len(Lint([]*parser.File{file}, nil)), 0)
+	})
+
+	t.Run("Undefined templates and slots", func(t *testing.T) {
+		diags := lintString(t, `
+(deftemplate person (slot name))
+(defrule r
+   (person (name ?n) (age ?a))
+   (persn (name ?n))
+   (ordered ?a)
+   =>)`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:4:23: deftemplate person has no slot age (undefined-slot)",
+			"test.clp:5:5: deftemplate persn is not defined (undefined-template)",
+		})
+	})
+
+	t.Run("Variables", func(t *testing.T) {
+		diags := lintString(t, `
+(defrule r
+   ?f <- (a ?x ?unused)
+   (not (b ?hidden))
+   =>
+   (bind ?y (+ ?x 1))
+   (printout t ?y ?z ?hidden crlf)
+   (foreach ?item (create$ 1 2) (printout t ?item ?item-index crlf))
+   (do-for-all-facts ((?g a)) TRUE (retract ?g)))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:3:4: variable ?f is bound but never used (unused-variable)",
+			"test.clp:3:16: variable ?unused is bound but never used (unused-variable)",
+			"test.clp:4:12: variable ?hidden is bound but never used (unused-variable)",
+			"test.clp:7:19: variable ?z is used but never bound (unbound-variable)",
+			"test.clp:7:22: variable ?hidden is used but never bound (unbound-variable)",
+		})
+	})
+
+	t.Run("Negated variables", func(t *testing.T) {
+		diags := lintString(t, `
+(deftemplate order (slot id) (slot qty))
+(defrule r
+   (order (id ?x))
+   (not (order (id ?y&:(> ?y ?x))))
+   (exists (order (qty ?q)) (test (> ?q 1)))
+   =>
+   (printout t ?y crlf))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:8:16: variable ?y is used but never bound (unbound-variable)",
+		})
+	})
+
+	t.Run("Query slots", func(t *testing.T) {
+		diags := lintString(t, `
+(deftemplate order (slot id) (slot qty))
+(defrule r
+   =>
+   (do-for-all-facts ((?f order)) (> ?f:qty 1) (printout t ?f:id ?g:id crlf)))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:5:66: variable ?g:id is used but never bound (unbound-variable)",
+		})
+	})
+
+	t.Run("Modify", func(t *testing.T) {
+		diags := lintString(t, `
+(deftemplate counter (slot value (type INTEGER)))
+(defrule r
+   ?f <- (counter (value ?v))
+   (counter (value ?w&:(> ?w ?v)))
+   =>
+   (modify ?f (value (+ ?v 1)) (valu 3))
+   (modify ?w (value 0)))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:7:33: deftemplate counter has no slot valu (undefined-slot)",
+			"test.clp:8:12: modify of ?w, which is not bound to a fact on the LHS (modify-unbound)",
+		})
+	})
+
+	t.Run("Slot values", func(t *testing.T) {
+		diags := lintString(t, `
+(deftemplate order
+   (slot id (type INTEGER))
+   (slot state (allowed-symbols new done))
+   (multislot items))
+(deffacts orders
+   (order (id abc) (state new) (items a b))
+   (order (id 1 2) (state lost) (state "lost")))
+(defrule r (order (state shipped)) => (assert (order (id 2.5))))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:7:15: SYMBOL abc does not match the type of slot id of order (INTEGER) (slot-value)",
+			"test.clp:8:11: slot id of order is single-field but is given 2 values (slot-value)",
+			"test.clp:8:27: lost is not an allowed value for slot state of order (done new) (slot-value)",
+			"test.clp:9:26: shipped is not an allowed value for slot state of order (done new) (slot-value)",
+			"test.clp:9:58: FLOAT 2.5 does not match the type of slot id of order (INTEGER) (slot-value)",
+		})
+	})
+
+	t.Run("Classes", func(t *testing.T) {
+		diags := lintString(t, `
+(defclass A (is-a USER) (slot x (type INTEGER)))
+(defclass B (is-a A) (slot y))
+(definstances things (b1 of B (x "one") (z 1)) (of C))
+(defrule r (object (is-a B) (x ?x) (w ?x)) => (make-instance of B (y ?x)))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:4:34: STRING \"one\" does not match the type of slot x of B (INTEGER) (slot-value)",
+			"test.clp:4:42: defclass B has no slot z (undefined-slot)",
+			"test.clp:4:52: defclass C is not defined (undefined-class)",
+			"test.clp:5:37: defclass B has no slot w (undefined-slot)",
+		})
+	})
+
+	t.Run("Self slot references", func(t *testing.T) {
+		diags := lintString(t, `
+(defclass A (is-a USER) (slot name))
+(defclass B (is-a A) (slot age))
+(defmessage-handler B greet ()
+   (bind ?self:age (+ ?self:age 1))
+   (printout t ?self:name ?self:nam crlf))`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:6:27: defclass B has no slot nam (undefined-slot)",
+		})
+	})
+
+	t.Run("Live schema", func(t *testing.T) {
+		live := NewSchema()
+		live.Templates["remote"] = &Definition{
+			Name: "remote",
+			Slots: map[string]*SlotInfo{
+				"level": {Name: "level", Types: []string{"INTEGER"}, Allowed: map[string][]string{"INTEGER": {"1", "2"}}},
+			},
+		}
+		diags := lintString(t, `(defrule r (remote (level 3)) =>)`, live)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:1:27: 3 is not an allowed value for slot level of remote (1 2) (slot-value)",
+		})
+	})
+
+	t.Run("Shadowing and unused functions", func(t *testing.T) {
+		diags := lintString(t, `
+(deffunction used () 1)
+(deffunction unused () (unused))
+(deftemplate thing)
+(defglobal ?*g* = (used))
+(defmodule OTHER)
+(deftemplate thing)
+(defglobal ?*g* = 2)`, nil)
+		assert.DeepEqual(t, diags, []string{
+			"test.clp:3:14: deffunction unused is never called (unused-function)",
+			"test.clp:7:14: deftemplate thing in module OTHER shadows the definition in module MAIN at test.clp:4:1 (shadowed-construct)",
+			"test.clp:8:12: defglobal ?*g* in module OTHER shadows the definition in module MAIN at test.clp:5:1 (shadowed-construct)",
+		})
+	})
+}
@@ -0,0 +1,482 @@
+package lint
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// binding tracks a variable within a rule or function body
+type binding struct {
+	first *parser.Variable
+	uses  int
+	// pattern is the pattern a fact-address variable is bound to
+	pattern *parser.PatternCE
+}
+
+type scope struct {
+	parent   *scope
+	vars     map[string]*binding
+	order    []string
+	reported map[string]bool
+}
+
+func newScope(parent *scope) *scope {
+	ret := &scope{parent: parent, vars: make(map[string]*binding)}
+	if parent != nil {
+		ret.reported = parent.reported
+	} else {
+		ret.reported = make(map[string]bool)
+	}
+	return ret
+}
+
+func (sc *scope) lookup(name string) *binding {
+	for s := sc; s != nil; s = s.parent {
+		if b, ok := s.vars[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (sc *scope) bind(v *parser.Variable) *binding {
+	b := &binding{first: v}
+	sc.vars[v.Name] = b
+	sc.order = append(sc.order, v.Name)
+	return b
+}
+
+// named returns true for variables which refer to a value, rather than wildcards and globals
+func named(v *parser.Variable) bool {
+	return v.Name != "" && !v.Global
+}
+
+// querySets are the functions whose first argument binds variables to fact or instance sets
+var querySets = map[string]bool{
+	"any-factp":                    true,
+	"find-fact":                    true,
+	"find-all-facts":               true,
+	"do-for-fact":                  true,
+	"do-for-all-facts":             true,
+	"delayed-do-for-all-facts":     true,
+	"any-instancep":                true,
+	"find-instance":                true,
+	"find-all-instances":           true,
+	"do-for-instance":              true,
+	"do-for-all-instances":         true,
+	"delayed-do-for-all-instances": true,
+}
+
+func (l *linter) rule(r *parser.Defrule) {
+	sc := newScope(nil)
+	l.ces(r.LHS, sc)
+	for _, e := range r.RHS {
+		l.expr(e, sc)
+	}
+	l.unused(sc)
+}
+
+// unused reports the variables bound in a scope which were never used
+func (l *linter) unused(sc *scope) {
+	for _, name := range sc.order {
+		b := sc.vars[name]
+		if b.uses == 0 {
+			l.report(b.first, UnusedVariable, "variable %s is bound but never used", b.first)
+		}
+	}
+}
+
+// body checks a deffunction, defmethod or defmessage-handler
+func (l *linter) body(params []*parser.Variable, wildcard *parser.Variable, body []parser.Expr) {
+	sc := newScope(nil)
+	for _, v := range params {
+		sc.bind(v)
+	}
+	if wildcard != nil {
+		sc.bind(wildcard)
+	}
+	for _, e := range body {
+		l.expr(e, sc)
+	}
+}
+
+func (l *linter) ces(ces []parser.CE, sc *scope) {
+	for _, ce := range ces {
+		switch ce := ce.(type) {
+		case *parser.PatternCE:
+			l.pattern(ce, sc)
+		case *parser.TestCE:
+			l.expr(ce.Expr, sc)
+		case *parser.GroupCE:
+			switch ce.Kind {
+			case "not", "exists", "forall":
+				// variables bound within are seen by the group alone, not by later CEs or the RHS
+				inner := newScope(sc)
+				l.ces(ce.CEs, inner)
+				l.unused(inner)
+			default:
+				l.ces(ce.CEs, sc)
+			}
+		}
+	}
+}
+
+func (l *linter) pattern(p *parser.PatternCE, sc *scope) {
+	if p.Binding != nil && named(p.Binding) {
+		if b := sc.lookup(p.Binding.Name); b != nil {
+			b.uses++
+		} else {
+			sc.bind(p.Binding).pattern = p
+		}
+	}
+	slots := l.patternSlots(p)
+	for _, c := range p.Fields {
+		l.constraint(c, sc, nil, "")
+	}
+	for _, s := range p.Slots {
+		var info *SlotInfo
+		if slots != nil {
+			info = slots[s.Name.Name]
+		}
+		for _, c := range s.Fields {
+			l.constraint(c, sc, info, p.Template.String())
+		}
+	}
+}
+
+// patternSlots checks the template or classes a pattern refers to, returning their slots
+// or nil if they are not known
+func (l *linter) patternSlots(p *parser.PatternCE) map[string]*SlotInfo {
+	if p.Object {
+		return l.objectSlots(p)
+	}
+	if len(p.Slots) == 0 {
+		return nil
+	}
+	def, ok := l.schema.Templates[p.Template.Name]
+	if !ok {
+		l.report(p.Template, UndefinedTemplate, "deftemplate %s is not defined", p.Template)
+		return nil
+	}
+	for _, s := range p.Slots {
+		if _, ok := def.Slots[s.Name.Name]; !ok {
+			l.report(s.Name, UndefinedSlot, "deftemplate %s has no slot %s", def.Name, s.Name.Name)
+		}
+	}
+	return def.Slots
+}
+
+func (l *linter) objectSlots(p *parser.PatternCE) map[string]*SlotInfo {
+	var classes []*Definition
+	for _, s := range p.Slots {
+		if s.Name.Name != "is-a" {
+			continue
+		}
+		for _, c := range s.Fields {
+			for _, alt := range c.Alternatives {
+				for _, term := range alt {
+					name, ok := term.Value.(*parser.Constant)
+					if !ok || term.Kind != parser.LITERAL_TERM || term.Not {
+						continue
+					}
+					def, ok := l.schema.Classes[name.Value]
+					if !ok {
+						l.report(name, UndefinedClass, "defclass %s is not defined", name.Value)
+						return nil
+					}
+					classes = append(classes, def)
+				}
+			}
+		}
+	}
+	if len(classes) == 0 {
+		return nil
+	}
+	slots := make(map[string]*SlotInfo)
+	var names []string
+	for _, def := range classes {
+		names = append(names, def.Name)
+		for name, info := range def.Slots {
+			if _, ok := slots[name]; !ok {
+				slots[name] = info
+			}
+		}
+	}
+	for _, s := range p.Slots {
+		switch s.Name.Name {
+		case "is-a", "name":
+			continue
+		}
+		if _, ok := slots[s.Name.Name]; !ok {
+			l.report(s.Name, UndefinedSlot, "defclass %s has no slot %s", strings.Join(names, " or "), s.Name.Name)
+		}
+	}
+	return slots
+}
+
+func (l *linter) constraint(c *parser.Constraint, sc *scope, info *SlotInfo, owner string) {
+	for _, alt := range c.Alternatives {
+		for _, term := range alt {
+			switch term.Kind {
+			case parser.VARIABLE_TERM:
+				v := term.Value.(*parser.Variable)
+				if !named(v) {
+					continue
+				}
+				if b := sc.lookup(v.Name); b != nil {
+					b.uses++
+				} else {
+					sc.bind(v)
+				}
+			case parser.PREDICATE_TERM, parser.RETURN_VALUE_TERM:
+				l.expr(term.Value, sc)
+			case parser.LITERAL_TERM:
+				if c, ok := term.Value.(*parser.Constant); ok && info != nil && !term.Not {
+					l.value(info, owner, c)
+				}
+			}
+		}
+	}
+}
+
+func (l *linter) expr(e parser.Expr, sc *scope) {
+	switch e := e.(type) {
+	case *parser.Variable:
+		l.use(e, sc)
+	case *parser.List:
+		for _, elem := range e.Elems {
+			l.expr(elem, sc)
+		}
+	case *parser.Call:
+		l.call(e, sc)
+	}
+}
+
+func (l *linter) use(v *parser.Variable, sc *scope) {
+	if !named(v) || l.selfSlot(v) {
+		return
+	}
+	// ?f:slot refers to a slot of the fact or instance bound to ?f by a query function
+	name := v.Name
+	if idx := strings.IndexByte(name, ':'); idx > 0 {
+		name = name[:idx]
+	}
+	if b := sc.lookup(name); b != nil {
+		b.uses++
+		return
+	}
+	if !sc.reported[name] {
+		sc.reported[name] = true
+		l.report(v, UnboundVariable, "variable %s is used but never bound", v)
+	}
+}
+
+// selfSlot returns true if v is a ?self:slot reference within a message handler, reporting
+// it if the class of the handler has no such slot
+func (l *linter) selfSlot(v *parser.Variable) bool {
+	if l.handler == "" || !strings.HasPrefix(v.Name, "self:") {
+		return false
+	}
+	slot := strings.TrimPrefix(v.Name, "self:")
+	if def, ok := l.schema.Classes[l.handler]; ok {
+		if _, ok := def.Slots[slot]; !ok {
+			l.report(v, UndefinedSlot, "defclass %s has no slot %s", def.Name, slot)
+		}
+	}
+	return true
+}
+
+func (l *linter) call(c *parser.Call, sc *scope) {
+	args := c.Args
+	switch name := c.Function.Name; {
+	case name == "bind" && len(args) > 0:
+		if v, ok := args[0].(*parser.Variable); ok && named(v) {
+			for _, arg := range args[1:] {
+				l.expr(arg, sc)
+			}
+			if l.selfSlot(v) {
+				return
+			}
+			if b := sc.lookup(v.Name); b != nil {
+				b.uses++
+			} else {
+				sc.bind(v)
+			}
+			return
+		}
+	case name == "foreach" && len(args) > 1:
+		if v, ok := args[0].(*parser.Variable); ok {
+			l.expr(args[1], sc)
+			l.loop(v, args[2:], sc)
+			return
+		}
+	case (name == "progn$" || name == "loop-for-count") && len(args) > 0:
+		if list, ok := args[0].(*parser.List); ok && len(list.Elems) > 0 {
+			if v, ok := list.Elems[0].(*parser.Variable); ok {
+				for _, arg := range list.Elems[1:] {
+					l.expr(arg, sc)
+				}
+				l.loop(v, args[1:], sc)
+				return
+			}
+		}
+	case querySets[name] && len(args) > 0:
+		if list, ok := args[0].(*parser.List); ok {
+			inner := newScope(sc)
+			for _, set := range list.Elems {
+				if set, ok := set.(*parser.List); ok && len(set.Elems) > 0 {
+					if v, ok := set.Elems[0].(*parser.Variable); ok && named(v) {
+						inner.bind(v)
+					}
+				}
+			}
+			for _, arg := range args[1:] {
+				l.expr(arg, inner)
+			}
+			return
+		}
+	case (name == "modify" || name == "duplicate") && len(args) > 0:
+		l.modify(name, args, sc)
+		return
+	case name == "assert":
+		for _, arg := range args {
+			if call, ok := arg.(*parser.Call); ok {
+				l.fact(parser.FactFromCall(call))
+			}
+		}
+	case name == "make-instance":
+		if inst := parser.InstanceFromCall(c); inst != nil {
+			l.instance(inst)
+		}
+	}
+	for _, arg := range args {
+		l.expr(arg, sc)
+	}
+}
+
+// loop checks the body of foreach, progn$ or loop-for-count with the loop variable bound
+func (l *linter) loop(v *parser.Variable, body []parser.Expr, sc *scope) {
+	inner := newScope(sc)
+	if named(v) {
+		inner.bind(v)
+		inner.bind(&parser.Variable{Name: v.Name + "-index"})
+	}
+	for _, e := range body {
+		l.expr(e, inner)
+	}
+}
+
+func (l *linter) modify(name string, args []parser.Expr, sc *scope) {
+	var slots map[string]*SlotInfo
+	var template string
+	switch target := args[0].(type) {
+	case *parser.Variable:
+		b := sc.lookup(target.Name)
+		if !named(target) || b == nil || b.pattern == nil {
+			sc.reported[target.Name] = true
+			l.report(target, ModifyUnbound, "%s of %s, which is not bound to a fact on the LHS", name, target)
+			break
+		}
+		b.uses++
+		if p := b.pattern; !p.Object && p.Template != nil {
+			if def, ok := l.schema.Templates[p.Template.Name]; ok {
+				slots = def.Slots
+				template = def.Name
+			}
+		}
+	default:
+		l.expr(target, sc)
+	}
+	for _, arg := range args[1:] {
+		call, ok := arg.(*parser.Call)
+		if !ok {
+			l.expr(arg, sc)
+			continue
+		}
+		if slots != nil {
+			if info, ok := slots[call.Function.Name]; ok {
+				l.values(info, template, call.Args, call)
+			} else {
+				l.report(call.Function, UndefinedSlot, "deftemplate %s has no slot %s", template, call.Function.Name)
+			}
+		}
+		for _, value := range call.Args {
+			l.expr(value, sc)
+		}
+	}
+}
+
+// fact checks the slots of a template fact whose deftemplate is known
+func (l *linter) fact(f *parser.Fact) {
+	def, ok := l.schema.Templates[f.Template.Name]
+	if !ok || len(f.Slots) == 0 {
+		return
+	}
+	for _, s := range f.Slots {
+		info, ok := def.Slots[s.Name.Name]
+		if !ok {
+			l.report(s.Name, UndefinedSlot, "deftemplate %s has no slot %s", def.Name, s.Name.Name)
+			continue
+		}
+		l.values(info, def.Name, s.Values, s)
+	}
+}
+
+func (l *linter) instance(inst *parser.InstanceDef) {
+	def, ok := l.schema.Classes[inst.Class.Name]
+	if !ok {
+		l.report(inst.Class, UndefinedClass, "defclass %s is not defined", inst.Class)
+		return
+	}
+	for _, s := range inst.Slots {
+		info, ok := def.Slots[s.Name.Name]
+		if !ok {
+			l.report(s.Name, UndefinedSlot, "defclass %s has no slot %s", def.Name, s.Name.Name)
+			continue
+		}
+		l.values(info, def.Name, s.Values, s)
+	}
+}
+
+func (l *linter) values(info *SlotInfo, owner string, values []parser.Expr, node parser.Node) {
+	if !info.Multifield && len(values) > 1 {
+		l.report(node, SlotValue, "slot %s of %s is single-field but is given %d values", info.Name, owner, len(values))
+		return
+	}
+	for _, v := range values {
+		if c, ok := v.(*parser.Constant); ok {
+			l.value(info, owner, c)
+		}
+	}
+}
+
+func (l *linter) value(info *SlotInfo, owner string, c *parser.Constant) {
+	t := TypeOf(c.Kind)
+	if !info.accepts(t) {
+		l.report(c, SlotValue, "%s %s does not match the type of slot %s of %s (%s)",
+			t, c.Value, info.Name, owner, strings.Join(info.Types, " "))
+		return
+	}
+	if !info.allows(c) {
+		allowed := append([]string(nil), info.Allowed[t]...)
+		sort.Strings(allowed)
+		l.report(c, SlotValue, "%s is not an allowed value for slot %s of %s (%s)",
+			c.Value, info.Name, owner, strings.Join(allowed, " "))
+	}
+}
@@ -0,0 +1,262 @@
+package lint
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// Schema describes the templates and classes slot values are checked against
+type Schema struct {
+	Templates map[string]*Definition
+	Classes   map[string]*Definition
+}
+
+// Definition is a deftemplate or defclass with its slots
+type Definition struct {
+	Name   string
+	Module string
+	// Superclasses lists the direct superclasses of a class. Slots of a class
+	// include inherited slots once the schema is complete
+	Superclasses []string
+	Slots        map[string]*SlotInfo
+}
+
+// SlotInfo describes the constraints on a slot
+type SlotInfo struct {
+	Name       string
+	Multifield bool
+	// Types lists the allowed CLIPS types, or is nil if any type is allowed
+	Types []string
+	// Allowed maps a CLIPS type to the values allowed for it. Types which are
+	// not present are unrestricted
+	Allowed map[string][]string
+}
+
+// NewSchema returns an empty schema
+func NewSchema() *Schema {
+	return &Schema{
+		Templates: make(map[string]*Definition),
+		Classes:   make(map[string]*Definition),
+	}
+}
+
+// systemClasses are predefined by CLIPS
+var systemClasses = []string{
+	"OBJECT", "PRIMITIVE", "NUMBER", "INTEGER", "FLOAT", "INSTANCE", "INSTANCE-NAME",
+	"INSTANCE-ADDRESS", "ADDRESS", "FACT-ADDRESS", "EXTERNAL-ADDRESS", "MULTIFIELD",
+	"LEXEME", "SYMBOL", "STRING", "USER", "INITIAL-OBJECT",
+}
+
+// StaticSchema builds a schema from the deftemplates and defclasses in the given files
+func StaticSchema(files []*parser.File) *Schema {
+	ret := NewSchema()
+	for _, name := range systemClasses {
+		ret.Classes[name] = &Definition{Name: name, Module: "MAIN", Slots: make(map[string]*SlotInfo)}
+	}
+	for _, file := range files {
+		for _, c := range file.Constructs {
+			switch c := c.(type) {
+			case *parser.Deftemplate:
+				def := &Definition{Name: c.Name.Name, Module: c.Module, Slots: make(map[string]*SlotInfo)}
+				for _, slot := range c.Slots {
+					def.Slots[slot.Name.Name] = staticSlot(slot)
+				}
+				ret.Templates[def.Name] = def
+			case *parser.Defclass:
+				def := &Definition{Name: c.Name.Name, Module: c.Module, Slots: make(map[string]*SlotInfo)}
+				for _, super := range c.Superclasses {
+					def.Superclasses = append(def.Superclasses, super.Name)
+				}
+				for _, slot := range c.Slots {
+					def.Slots[slot.Name.Name] = staticSlot(slot)
+				}
+				ret.Classes[def.Name] = def
+			}
+		}
+	}
+	for _, def := range ret.Classes {
+		ret.inherit(def, map[string]bool{})
+	}
+	return ret
+}
+
+// inherit copies slots of superclasses which the class does not override
+func (s *Schema) inherit(def *Definition, seen map[string]bool) {
+	if seen[def.Name] {
+		return
+	}
+	seen[def.Name] = true
+	for _, name := range def.Superclasses {
+		super, ok := s.Classes[name]
+		if !ok {
+			continue
+		}
+		s.inherit(super, seen)
+		for slotname, slot := range super.Slots {
+			if _, ok := def.Slots[slotname]; !ok {
+				def.Slots[slotname] = slot
+			}
+		}
+	}
+}
+
+// Merge adds the definitions of other to the schema, replacing any with the same name
+func (s *Schema) Merge(other *Schema) {
+	if other == nil {
+		return
+	}
+	for name, def := range other.Templates {
+		s.Templates[name] = def
+	}
+	for name, def := range other.Classes {
+		s.Classes[name] = def
+	}
+}
+
+var allowedAttributes = map[string][]string{
+	"allowed-symbols":        {"SYMBOL"},
+	"allowed-strings":        {"STRING"},
+	"allowed-lexemes":        {"SYMBOL", "STRING"},
+	"allowed-integers":       {"INTEGER"},
+	"allowed-floats":         {"FLOAT"},
+	"allowed-numbers":        {"INTEGER", "FLOAT"},
+	"allowed-instance-names": {"INSTANCE-NAME"},
+}
+
+func staticSlot(slot *parser.Slot) *SlotInfo {
+	ret := &SlotInfo{Name: slot.Name.Name, Multifield: slot.Multi}
+	for _, t := range slot.Types() {
+		if t != "?VARIABLE" {
+			ret.Types = append(ret.Types, t)
+		}
+	}
+	for _, attr := range slot.Attributes {
+		types, restricts := allowedAttributes[attr.Name]
+		if !restricts && attr.Name != "allowed-values" {
+			continue
+		}
+		values := constants(attr.Values)
+		if values == nil {
+			continue
+		}
+		if ret.Allowed == nil {
+			ret.Allowed = make(map[string][]string)
+		}
+		if restricts {
+			for _, t := range types {
+				ret.Allowed[t] = []string{}
+			}
+		}
+		for _, v := range values {
+			t := TypeOf(v.Kind)
+			ret.Allowed[t] = append(ret.Allowed[t], v.Value)
+		}
+	}
+	return ret
+}
+
+// constants returns the values if they are all constants, or nil if any is ?VARIABLE
+func constants(exprs []parser.Expr) []*parser.Constant {
+	ret := make([]*parser.Constant, 0, len(exprs))
+	for _, e := range exprs {
+		c, ok := e.(*parser.Constant)
+		if !ok {
+			return nil
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+// TypeOf returns the CLIPS type name for a constant token
+func TypeOf(kind lexer.Kind) string {
+	switch kind {
+	case lexer.INTEGER:
+		return "INTEGER"
+	case lexer.FLOAT:
+		return "FLOAT"
+	case lexer.STRING:
+		return "STRING"
+	case lexer.INSTANCE_NAME:
+		return "INSTANCE-NAME"
+	}
+	return "SYMBOL"
+}
+
+// typeGroups expands CLIPS type names which stand for several types
+var typeGroups = map[string][]string{
+	"NUMBER":   {"INTEGER", "FLOAT"},
+	"LEXEME":   {"SYMBOL", "STRING"},
+	"INSTANCE": {"INSTANCE-NAME", "INSTANCE-ADDRESS"},
+}
+
+// accepts returns true if a value of the given type may be stored in the slot
+func (slot *SlotInfo) accepts(t string) bool {
+	if len(slot.Types) == 0 {
+		return true
+	}
+	for _, allowed := range slot.Types {
+		if allowed == t {
+			return true
+		}
+		for _, member := range typeGroups[allowed] {
+			if member == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows returns true if the value is among the allowed values for its type
+func (slot *SlotInfo) allows(c *parser.Constant) bool {
+	t := TypeOf(c.Kind)
+	values, restricted := slot.Allowed[t]
+	if !restricted {
+		return true
+	}
+	for _, v := range values {
+		if sameValue(t, v, c.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameValue(t, a, b string) bool {
+	switch t {
+	case "INTEGER", "FLOAT":
+		fa, erra := strconv.ParseFloat(a, 64)
+		fb, errb := strconv.ParseFloat(b, 64)
+		if erra == nil && errb == nil {
+			return fa == fb
+		}
+	case "STRING":
+		return unquote(a) == unquote(b)
+	}
+	return a == b
+}
+
+func unquote(str string) string {
+	if ret, err := strconv.Unquote(str); err == nil {
+		return ret
+	}
+	return strings.Trim(str, `"`)
+}
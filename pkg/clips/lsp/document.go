@@ -0,0 +1,139 @@
+package lsp
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// Document is a source file known to the server, either open in the editor or found in
+// the workspace
+type Document struct {
+	URI  string
+	Text string
+	// File is the parsed source. It holds every construct which parsed successfully
+	File *parser.File
+	// Errors holds the syntax errors found by the parser
+	Errors parser.ErrorList
+
+	lines   []int
+	symbols []*symbol
+}
+
+// NewDocument parses the text of a document
+func NewDocument(uri string, text string) *Document {
+	d := &Document{URI: uri, Text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	file, err := parser.ParseFile(uriPath(uri), []byte(text))
+	if errs, ok := err.(parser.ErrorList); ok {
+		d.Errors = errs
+	}
+	d.File = file
+	d.symbols = symbols(file)
+	return d
+}
+
+// Source returns the text of a node
+func (d *Document) Source(n parser.Node) string {
+	return d.Text[n.Pos().Offset:n.End().Offset]
+}
+
+// Position converts a byte offset into a position
+func (d *Document) Position(offset int) Position {
+	if offset > len(d.Text) {
+		offset = len(d.Text)
+	}
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	character := 0
+	for _, r := range d.Text[d.lines[line]:offset] {
+		character++
+		if r >= 0x10000 {
+			// characters outside the basic multilingual plane are two UTF-16 code units
+			character++
+		}
+	}
+	return Position{Line: line, Character: character}
+}
+
+// Offset converts a position into a byte offset, clamped to the line
+func (d *Document) Offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.Text)
+	}
+	offset := d.lines[p.Line]
+	for character := 0; character < p.Character && offset < len(d.Text) && d.Text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.Text[offset:])
+		offset += size
+		character++
+		if r >= 0x10000 {
+			character++
+		}
+	}
+	return offset
+}
+
+// Range returns the range covered by a node
+func (d *Document) Range(n parser.Node) Range {
+	return d.span(n.Pos(), n.End())
+}
+
+func (d *Document) span(start lexer.Pos, end lexer.Pos) Range {
+	return Range{Start: d.Position(start.Offset), End: d.Position(end.Offset)}
+}
+
+// wordAt returns the start offset of the word being typed at the given offset, and the
+// part of it before the offset
+func (d *Document) wordAt(offset int) (int, string) {
+	start := offset
+	for start > 0 && !lexer.IsDelimiter(d.Text[start-1]) {
+		start--
+	}
+	return start, d.Text[start:offset]
+}
+
+// uriPath returns the file path of a file: URI, or the URI itself for other schemes
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI returns the file: URI of a path
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
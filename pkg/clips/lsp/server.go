@@ -0,0 +1,465 @@
+package lsp
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/format"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// Checker supplies what the server can only learn from a CLIPS environment. The clipsgo lsp
+// command implements it by loading documents into a scratch Environment
+type Checker interface {
+	// Check loads the constructs of deps and then of doc, returning the errors for doc.
+	// The other documents of the workspace are given as deps so that the constructs they
+	// define are known
+	Check(deps []*Document, doc *Document) []Diagnostic
+	// Describe returns a markdown description of the slots of a template or class, or ""
+	// if it is not known. It reflects the most recent Check
+	Describe(kind SymbolKind, name string) string
+	// Complete returns the completions for a partially typed word
+	Complete(prefix string) []CompletionItem
+}
+
+// Server is a language server for CLIPS source
+type Server struct {
+	checker Checker
+	// docs holds open documents and the .clp files of the workspace, by URI
+	docs map[string]*Document
+	out  io.Writer
+
+	shutdown bool
+}
+
+// NewServer returns a server using the given checker
+func NewServer(checker Checker) *Server {
+	return &Server{
+		checker: checker,
+		docs:    make(map[string]*Document),
+	}
+}
+
+// Serve handles requests read from r, writing responses and notifications to w, until
+// the client sends exit or r is closed
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	in := bufio.NewReader(r)
+	s.out = w
+	for {
+		msg, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		if rerr, ok := err.(*responseError); ok {
+			if err := s.reply(nil, nil, rerr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			// notifications have no response
+			continue
+		}
+		if err != nil {
+			rerr, ok := err.(*responseError)
+			if !ok {
+				rerr = &responseError{Code: requestFailed, Message: err.Error()}
+			}
+			err = s.reply(msg.ID, nil, rerr)
+		} else {
+			err = s.reply(msg.ID, result, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) error {
+	msg := &message{ID: id, Error: rerr}
+	if id == nil {
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+	if rerr == nil {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = body
+	}
+	return writeMessage(s.out, msg)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: body})
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.initialize(params), nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			// the server asks for full document sync, so the last change is the whole text
+			return nil, s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params documentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.close(params.TextDocument.URI)
+	case "textDocument/definition":
+		return s.withPosition(msg, s.definition)
+	case "textDocument/references":
+		return s.withPosition(msg, s.references)
+	case "textDocument/hover":
+		return s.withPosition(msg, s.hover)
+	case "textDocument/completion":
+		return s.withPosition(msg, s.completion)
+	case "textDocument/formatting":
+		var params documentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.formatting(params.TextDocument.URI)
+	}
+	if msg.ID != nil && !strings.HasPrefix(msg.Method, "$/") {
+		return nil, &responseError{Code: methodNotFound, Message: "unsupported method " + msg.Method}
+	}
+	return nil, nil
+}
+
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) withPosition(msg *message, fn func(*Document, int, positionParams) interface{}) (interface{}, error) {
+	var params positionParams
+	if err := unmarshal(msg.Params, &params); err != nil {
+		return nil, err
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("unknown document %s", params.TextDocument.URI)
+	}
+	return fn(doc, doc.Offset(params.Position), params), nil
+}
+
+func (s *Server) initialize(params initializeParams) interface{} {
+	root := params.RootPath
+	if params.RootURI != "" {
+		root = uriPath(params.RootURI)
+	}
+	if root != "" {
+		s.scan(root)
+	}
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			// full document sync
+			"textDocumentSync":   1,
+			"definitionProvider": true,
+			"referencesProvider": true,
+			"hoverProvider":      true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"(", "?"},
+			},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "clipsgo"},
+	}
+}
+
+// scan adds the .clp files beneath root, so that definitions in files which are not open
+// can be found
+func (s *Server) scan(root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".clp" {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err == nil {
+			uri := pathURI(path)
+			s.docs[uri] = NewDocument(uri, string(src))
+		}
+		return nil
+	})
+}
+
+// update replaces the text of a document and publishes its diagnostics
+func (s *Server) update(uri string, text string) error {
+	doc := NewDocument(uri, text)
+	s.docs[uri] = doc
+
+	diagnostics := []Diagnostic{}
+	for _, e := range doc.Errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.span(e.Pos, e.Pos),
+			Severity: SeverityError,
+			Source:   "clipsgo",
+			Message:  e.Msg,
+		})
+	}
+	if s.checker != nil {
+		diagnostics = append(diagnostics, s.checker.Check(s.others(uri), doc)...)
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// others returns the documents other than the given one, ordered by URI
+func (s *Server) others(uri string) []*Document {
+	var ret []*Document
+	for u, doc := range s.docs {
+		if u != uri {
+			ret = append(ret, doc)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].URI < ret[j].URI })
+	return ret
+}
+
+// close reverts a document to the saved file, or forgets it if there is none
+func (s *Server) close(uri string) error {
+	delete(s.docs, uri)
+	if src, err := ioutil.ReadFile(uriPath(uri)); err == nil {
+		s.docs[uri] = NewDocument(uri, string(src))
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{}})
+}
+
+type located struct {
+	doc *Document
+	sym *symbol
+}
+
+// find returns the symbols of every document with the given kind and name, ordered by
+// URI and position
+func (s *Server) find(kind SymbolKind, name string, defs bool) []located {
+	var ret []located
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		doc := s.docs[uri]
+		for _, sym := range doc.symbols {
+			if sym.kind == kind && sym.name == name && (!defs || sym.def != nil) {
+				ret = append(ret, located{doc, sym})
+			}
+		}
+	}
+	return ret
+}
+
+func (s *Server) definition(doc *Document, offset int, params positionParams) interface{} {
+	ret := []Location{}
+	if sym := doc.symbolAt(offset); sym != nil {
+		for _, l := range s.find(sym.kind, sym.name, true) {
+			ret = append(ret, Location{URI: l.doc.URI, Range: l.doc.Range(l.sym.span)})
+		}
+	}
+	return ret
+}
+
+func (s *Server) references(doc *Document, offset int, params positionParams) interface{} {
+	ret := []Location{}
+	if sym := doc.symbolAt(offset); sym != nil {
+		for _, l := range s.find(sym.kind, sym.name, false) {
+			if l.sym.def == nil || params.Context.IncludeDeclaration {
+				ret = append(ret, Location{URI: l.doc.URI, Range: l.doc.Range(l.sym.span)})
+			}
+		}
+	}
+	return ret
+}
+
+func (s *Server) hover(doc *Document, offset int, params positionParams) interface{} {
+	sym := doc.symbolAt(offset)
+	if sym == nil {
+		return nil
+	}
+	var parts []string
+	if (sym.kind == TEMPLATE || sym.kind == CLASS) && s.checker != nil {
+		if description := s.checker.Describe(sym.kind, sym.name); description != "" {
+			parts = append(parts, description)
+		}
+	}
+	if len(parts) == 0 {
+		for _, l := range s.find(sym.kind, sym.name, true) {
+			parts = append(parts, describe(l.doc, l.sym))
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	r := doc.Range(sym.span)
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: strings.Join(parts, "\n\n---\n\n")},
+		Range:    &r,
+	}
+}
+
+// describe returns a markdown description of a definition from its source
+func describe(doc *Document, sym *symbol) string {
+	var code, comment string
+	switch def := sym.def.(type) {
+	case *parser.Deffunction:
+		code = signature(def.Keyword(), def.Name, def.Params, def.Wildcard)
+		comment = def.Comment
+	case *parser.Defmethod:
+		var params []string
+		for _, p := range def.Params {
+			params = append(params, doc.Source(p))
+		}
+		if def.Wildcard != nil {
+			params = append(params, doc.Source(def.Wildcard))
+		}
+		code = fmt.Sprintf("(defmethod %s (%s))", def.Name, strings.Join(params, " "))
+		comment = def.Comment
+	case *parser.Defgeneric:
+		code = fmt.Sprintf("(defgeneric %s)", def.Name)
+		comment = def.Comment
+	case *parser.GlobalAssignment:
+		code = fmt.Sprintf("%s = %s", def.Var, doc.Source(def.Value))
+	default:
+		code = doc.Source(sym.def)
+	}
+	ret := "```clips\n" + code + "\n```"
+	if comment != "" {
+		ret += "\n\n" + comment
+	}
+	return ret
+}
+
+func signature(keyword string, name *parser.Ident, params []*parser.Variable, wildcard *parser.Variable) string {
+	var names []string
+	for _, p := range params {
+		names = append(names, p.String())
+	}
+	if wildcard != nil {
+		names = append(names, wildcard.String())
+	}
+	return fmt.Sprintf("(%s %s (%s))", keyword, name, strings.Join(names, " "))
+}
+
+func (s *Server) completion(doc *Document, offset int, params positionParams) interface{} {
+	_, prefix := doc.wordAt(offset)
+	ret := []CompletionItem{}
+	seen := make(map[string]bool)
+	add := func(item CompletionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			ret = append(ret, item)
+		}
+	}
+	if s.checker != nil {
+		for _, item := range s.checker.Complete(prefix) {
+			add(item)
+		}
+	}
+	// constructs of the workspace which have not been loaded, such as those following
+	// a syntax error
+	kinds := map[SymbolKind]int{
+		TEMPLATE: StructCompletion,
+		CLASS:    ClassCompletion,
+		FUNCTION: FunctionCompletion,
+		GLOBAL:   VariableCompletion,
+	}
+	for _, d := range append(s.others(doc.URI), doc) {
+		for _, sym := range d.symbols {
+			label := sym.name
+			if sym.kind == GLOBAL {
+				label = "?*" + label + "*"
+			}
+			if sym.def != nil && strings.HasPrefix(label, prefix) {
+				add(CompletionItem{Label: label, Kind: kinds[sym.kind], Detail: sym.kind.String()})
+			}
+		}
+	}
+	return ret
+}
+
+func (s *Server) formatting(uri string) (interface{}, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, fmt.Errorf("unknown document %s", uri)
+	}
+	formatted, err := format.String(doc.Text)
+	if err != nil {
+		return nil, err
+	}
+	if formatted == doc.Text {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: doc.Position(len(doc.Text))},
+		NewText: formatted,
+	}}, nil
+}
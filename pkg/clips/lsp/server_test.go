@@ -0,0 +1,268 @@
+package lsp
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+const rules = `(deftemplate order (slot id) (slot state))
+(defglobal ?*limit* = 10)
+; order processing
+(deffunction next-id "Returns the next order id" (?base) (+ ?base 1))
+(defrule ship
+   ?o <- (order (id ?id) (state new))
+   (test (< ?id ?*limit*))
+   =>
+   (modify ?o (state shipped))
+   (assert (order (id (next-id ?id)))))
+`
+
+type fakeChecker struct {
+	checked []string
+}
+
+func (c *fakeChecker) Check(deps []*Document, doc *Document) []Diagnostic {
+	for _, d := range deps {
+		c.checked = append(c.checked, d.URI)
+	}
+	c.checked = append(c.checked, doc.URI)
+	var ret []Diagnostic
+	for _, con := range doc.File.Constructs {
+		if con.Header().Name != nil && con.Header().Name.Name == "broken" {
+			ret = append(ret, Diagnostic{Range: doc.Range(con.Header().Name), Severity: SeverityError, Source: "clips", Message: "cannot build"})
+		}
+	}
+	return ret
+}
+
+func (c *fakeChecker) Describe(kind SymbolKind, name string) string {
+	if kind == TEMPLATE && name == "order" {
+		return "slots id, state"
+	}
+	return ""
+}
+
+func (c *fakeChecker) Complete(prefix string) []CompletionItem {
+	var ret []CompletionItem
+	for _, name := range []string{"assert", "modify", "next-id"} {
+		if strings.HasPrefix(name, prefix) {
+			ret = append(ret, CompletionItem{Label: name, Kind: FunctionCompletion})
+		}
+	}
+	return ret
+}
+
+type session struct {
+	in   bytes.Buffer
+	next int
+}
+
+func (s *session) request(method string, params interface{}) {
+	s.next++
+	id := json.RawMessage(strconv.Itoa(s.next))
+	s.send(&id, method, params)
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.send(nil, method, params)
+}
+
+func (s *session) send(id *json.RawMessage, method string, params interface{}) {
+	body, _ := json.Marshal(params)
+	writeMessage(&s.in, &message{ID: id, Method: method, Params: body})
+}
+
+// run serves the session, returning the messages written by the server
+func (s *session) run(t *testing.T, checker Checker) []*message {
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+	var out bytes.Buffer
+	assert.NilError(t, NewServer(checker).Serve(&s.in, &out))
+	var ret []*message
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err == io.EOF {
+			return ret
+		}
+		assert.NilError(t, err)
+		ret = append(ret, msg)
+	}
+}
+
+func position(params map[string]interface{}, uri string, line int, character int) map[string]interface{} {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	params["textDocument"] = map[string]string{"uri": uri}
+	params["position"] = Position{Line: line, Character: character}
+	return params
+}
+
+func open(uri string, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": textDocumentItem{URI: uri, LanguageID: "clips", Version: 1, Text: text},
+	}
+}
+
+func TestServer(t *testing.T) {
+	const uri = "file:///work/rules.clp"
+
+	t.Run("Diagnostics", func(t *testing.T) {
+		s := &session{}
+		s.notify("textDocument/didOpen", open(uri, "(deftemplate broken (slot a))\n(defrule r => (foo)\n"))
+		checker := &fakeChecker{}
+		msgs := s.run(t, checker)
+		assert.Equal(t, msgs[0].Method, "textDocument/publishDiagnostics")
+		var params publishDiagnosticsParams
+		assert.NilError(t, json.Unmarshal(msgs[0].Params, &params))
+		assert.Equal(t, params.URI, uri)
+		assert.Equal(t, len(params.Diagnostics), 2)
+		assert.Equal(t, params.Diagnostics[0].Message, "unbalanced (")
+		assert.Equal(t, params.Diagnostics[0].Range.Start, Position{Line: 1, Character: 0})
+		assert.Equal(t, params.Diagnostics[1].Message, "cannot build")
+		assert.Equal(t, params.Diagnostics[1].Range, Range{Start: Position{0, 13}, End: Position{0, 19}})
+		assert.DeepEqual(t, checker.checked, []string{uri})
+	})
+
+	t.Run("Navigation", func(t *testing.T) {
+		s := &session{}
+		s.notify("textDocument/didOpen", open(uri, rules))
+		// ?*limit* in the test CE
+		s.request("textDocument/definition", position(nil, uri, 6, 19))
+		// next-id in the assert
+		s.request("textDocument/references", position(map[string]interface{}{
+			"context": map[string]bool{"includeDeclaration": true},
+		}, uri, 9, 27))
+		// order in the pattern
+		s.request("textDocument/references", position(nil, uri, 5, 11))
+		msgs := s.run(t, nil)
+
+		var locations []Location
+		assert.NilError(t, json.Unmarshal(msgs[1].Result, &locations))
+		assert.DeepEqual(t, locations, []Location{{URI: uri, Range: Range{Start: Position{1, 11}, End: Position{1, 19}}}})
+
+		assert.NilError(t, json.Unmarshal(msgs[2].Result, &locations))
+		assert.DeepEqual(t, locations, []Location{
+			{URI: uri, Range: Range{Start: Position{3, 13}, End: Position{3, 20}}},
+			{URI: uri, Range: Range{Start: Position{9, 23}, End: Position{9, 30}}},
+		})
+
+		assert.NilError(t, json.Unmarshal(msgs[3].Result, &locations))
+		assert.DeepEqual(t, locations, []Location{
+			{URI: uri, Range: Range{Start: Position{5, 10}, End: Position{5, 15}}},
+			{URI: uri, Range: Range{Start: Position{9, 12}, End: Position{9, 17}}},
+		})
+	})
+
+	t.Run("Hover", func(t *testing.T) {
+		s := &session{}
+		s.notify("textDocument/didOpen", open(uri, rules))
+		s.request("textDocument/hover", position(nil, uri, 0, 15))
+		s.request("textDocument/hover", position(nil, uri, 9, 27))
+		s.request("textDocument/hover", position(nil, uri, 6, 19))
+		s.request("textDocument/hover", position(nil, uri, 4, 2))
+		msgs := s.run(t, &fakeChecker{})
+
+		var h hover
+		assert.NilError(t, json.Unmarshal(msgs[1].Result, &h))
+		assert.Equal(t, h.Contents.Value, "slots id, state")
+		assert.NilError(t, json.Unmarshal(msgs[2].Result, &h))
+		assert.Equal(t, h.Contents.Value, "```clips\n(deffunction next-id (?base))\n```\n\nReturns the next order id")
+		assert.NilError(t, json.Unmarshal(msgs[3].Result, &h))
+		assert.Equal(t, h.Contents.Value, "```clips\n?*limit* = 10\n```")
+		assert.Equal(t, string(msgs[4].Result), "null")
+	})
+
+	t.Run("Completion", func(t *testing.T) {
+		s := &session{}
+		s.notify("textDocument/didOpen", open(uri, rules+"(defrule more => (ne"))
+		s.request("textDocument/completion", position(nil, uri, 10, 20))
+		s.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   textDocumentIdentifier{URI: uri},
+			"contentChanges": []map[string]string{{"text": rules + "(defrule more => (printout t ?*l"}},
+		})
+		s.request("textDocument/completion", position(nil, uri, 10, 32))
+		msgs := s.run(t, &fakeChecker{})
+
+		var items []CompletionItem
+		assert.NilError(t, json.Unmarshal(msgs[1].Result, &items))
+		assert.DeepEqual(t, items, []CompletionItem{{Label: "next-id", Kind: FunctionCompletion}})
+		assert.NilError(t, json.Unmarshal(msgs[3].Result, &items))
+		assert.DeepEqual(t, items, []CompletionItem{{Label: "?*limit*", Kind: VariableCompletion, Detail: "defglobal"}})
+	})
+
+	t.Run("Formatting", func(t *testing.T) {
+		s := &session{}
+		s.notify("textDocument/didOpen", open(uri, "(defrule r (a) => (b))"))
+		s.request("textDocument/formatting", map[string]interface{}{"textDocument": textDocumentIdentifier{URI: uri}})
+		s.request("textDocument/unknown", nil)
+		msgs := s.run(t, nil)
+
+		var edits []TextEdit
+		assert.NilError(t, json.Unmarshal(msgs[1].Result, &edits))
+		assert.Equal(t, len(edits), 1)
+		assert.Equal(t, edits[0].Range.End, Position{Line: 0, Character: 22})
+		assert.Equal(t, edits[0].NewText, "(defrule r\n   (a)\n   =>\n   (b))\n")
+		assert.Equal(t, msgs[2].Error.Code, methodNotFound)
+	})
+
+	t.Run("Workspace", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "lsp")
+		assert.NilError(t, err)
+		defer os.RemoveAll(dir)
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "rules.clp"), []byte(rules), 0644))
+		other := pathURI(filepath.Join(dir, "main.clp"))
+
+		s := &session{}
+		s.request("initialize", initializeParams{RootURI: pathURI(dir)})
+		s.notify("textDocument/didOpen", open(other, "(defrule main (order) => (next-id 1))"))
+		s.request("textDocument/definition", position(nil, other, 0, 28))
+		checker := &fakeChecker{}
+		msgs := s.run(t, checker)
+
+		assert.DeepEqual(t, checker.checked, []string{pathURI(filepath.Join(dir, "rules.clp")), other})
+		var locations []Location
+		assert.NilError(t, json.Unmarshal(msgs[2].Result, &locations))
+		assert.DeepEqual(t, locations, []Location{{
+			URI:   pathURI(filepath.Join(dir, "rules.clp")),
+			Range: Range{Start: Position{3, 13}, End: Position{3, 20}},
+		}})
+	})
+}
+
+func TestDocument(t *testing.T) {
+	doc := NewDocument("file:///a.clp", "(a)\n; é𝄞\n(b)")
+	assert.Equal(t, doc.Position(0), Position{0, 0})
+	assert.Equal(t, doc.Position(6), Position{1, 2})
+	// é is two bytes but one UTF-16 unit, 𝄞 is four bytes and two units
+	assert.Equal(t, doc.Position(12), Position{1, 5})
+	assert.Equal(t, doc.Offset(Position{1, 5}), 12)
+	assert.Equal(t, doc.Offset(Position{1, 99}), 12)
+	assert.Equal(t, doc.Offset(Position{2, 1}), 14)
+	assert.Equal(t, uriPath("file:///tmp/a%20b.clp"), filepath.FromSlash("/tmp/a b.clp"))
+}
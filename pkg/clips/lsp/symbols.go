@@ -0,0 +1,322 @@
+package lsp
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
+)
+
+// SymbolKind is the kind of name which the server can navigate between
+type SymbolKind int
+
+const (
+	TEMPLATE SymbolKind = iota
+	CLASS
+	FUNCTION
+	GLOBAL
+)
+
+var symbolKindNames = [...]string{
+	"deftemplate",
+	"defclass",
+	"deffunction",
+	"defglobal",
+}
+
+func (sk SymbolKind) String() string {
+	return symbolKindNames[sk]
+}
+
+// symbol is a definition of, or reference to, a name within a document. Names are
+// compared without their module, so a reference may resolve to several definitions
+type symbol struct {
+	kind SymbolKind
+	name string
+	span parser.Span
+	// def is the defining construct, or the global assignment, for definitions
+	def parser.Node
+}
+
+type indexer struct {
+	symbols []*symbol
+}
+
+// symbols returns the symbols within a file in source order
+func symbols(file *parser.File) []*symbol {
+	ix := &indexer{}
+	if file == nil {
+		return nil
+	}
+	for _, c := range file.Constructs {
+		ix.construct(c)
+	}
+	ix.exprs(file.Commands)
+	return ix.symbols
+}
+
+func (ix *indexer) add(kind SymbolKind, name string, span parser.Span, def parser.Node) {
+	if name != "" {
+		ix.symbols = append(ix.symbols, &symbol{kind: kind, name: name, span: span, def: def})
+	}
+}
+
+func (ix *indexer) ident(kind SymbolKind, id *parser.Ident, def parser.Node) {
+	if id != nil {
+		ix.add(kind, id.Name, id.Span, def)
+	}
+}
+
+func (ix *indexer) construct(c parser.Construct) {
+	h := c.Header()
+	switch c := c.(type) {
+	case *parser.Defrule:
+		ix.exprs([]parser.Expr{c.Salience, c.AutoFocus})
+		ix.ces(c.LHS)
+		ix.exprs(c.RHS)
+	case *parser.Deftemplate:
+		ix.ident(TEMPLATE, h.Name, c)
+		ix.slots(c.Slots)
+	case *parser.Defclass:
+		ix.ident(CLASS, h.Name, c)
+		for _, super := range c.Superclasses {
+			ix.ident(CLASS, super, nil)
+		}
+		ix.slots(c.Slots)
+	case *parser.Deffunction:
+		ix.ident(FUNCTION, h.Name, c)
+		ix.exprs(c.Body)
+	case *parser.Defgeneric:
+		ix.ident(FUNCTION, h.Name, c)
+	case *parser.Defmethod:
+		// a defmethod without a defgeneric declares the generic implicitly
+		ix.ident(FUNCTION, h.Name, c)
+		params := c.Params
+		if c.Wildcard != nil {
+			params = append(params[:len(params):len(params)], c.Wildcard)
+		}
+		for _, p := range params {
+			for _, t := range p.Types {
+				ix.ident(CLASS, t, nil)
+			}
+			ix.exprs([]parser.Expr{p.Query})
+		}
+		ix.exprs(c.Body)
+	case *parser.DefmessageHandler:
+		ix.ident(CLASS, c.Class, nil)
+		ix.exprs(c.Body)
+	case *parser.Defglobal:
+		for _, g := range c.Globals {
+			ix.add(GLOBAL, g.Var.Name, g.Var.Span, g)
+			ix.exprs([]parser.Expr{g.Value})
+		}
+	case *parser.Deffacts:
+		for _, f := range c.Facts {
+			ix.fact(f)
+		}
+	case *parser.Definstances:
+		for _, inst := range c.Instances {
+			ix.instance(inst)
+		}
+	case *parser.Defmodule:
+		for _, spec := range append(c.Imports[:len(c.Imports):len(c.Imports)], c.Exports...) {
+			kind, ok := portKinds[spec.Construct]
+			if !ok {
+				continue
+			}
+			for _, name := range spec.Names {
+				ix.ident(kind, name, nil)
+			}
+		}
+	}
+}
+
+// portKinds maps the construct types named in imports and exports to symbol kinds
+var portKinds = map[string]SymbolKind{
+	"deftemplate": TEMPLATE,
+	"defclass":    CLASS,
+	"deffunction": FUNCTION,
+	"defgeneric":  FUNCTION,
+	"defglobal":   GLOBAL,
+}
+
+func (ix *indexer) slots(slots []*parser.Slot) {
+	for _, s := range slots {
+		for _, a := range s.Attributes {
+			if a.Name == "allowed-classes" {
+				for _, v := range a.Values {
+					ix.symbolConstant(CLASS, v)
+				}
+				continue
+			}
+			ix.exprs(a.Values)
+		}
+	}
+}
+
+// symbolConstant adds a reference for a symbol naming a construct, such as a class name
+func (ix *indexer) symbolConstant(kind SymbolKind, e parser.Expr) {
+	if c, ok := e.(*parser.Constant); ok && c.Kind == lexer.SYMBOL {
+		ix.add(kind, c.Value, c.Span, nil)
+	}
+}
+
+func (ix *indexer) ces(ces []parser.CE) {
+	for _, ce := range ces {
+		switch ce := ce.(type) {
+		case *parser.GroupCE:
+			ix.ces(ce.CEs)
+		case *parser.TestCE:
+			ix.exprs([]parser.Expr{ce.Expr})
+		case *parser.PatternCE:
+			if !ce.Object {
+				ix.ident(TEMPLATE, ce.Template, nil)
+			}
+			ix.constraints(ce.Fields, nil)
+			for _, s := range ce.Slots {
+				var kind *SymbolKind
+				if ce.Object && s.Name.Name == "is-a" {
+					class := CLASS
+					kind = &class
+				}
+				ix.constraints(s.Fields, kind)
+			}
+		}
+	}
+}
+
+// constraints indexes the expressions within pattern constraints. If kind is given, literal
+// symbols are references of that kind, such as the classes in an is-a constraint
+func (ix *indexer) constraints(constraints []*parser.Constraint, kind *SymbolKind) {
+	for _, c := range constraints {
+		for _, alt := range c.Alternatives {
+			for _, term := range alt {
+				if term.Kind == parser.LITERAL_TERM && kind != nil {
+					ix.symbolConstant(*kind, term.Value)
+				} else {
+					ix.exprs([]parser.Expr{term.Value})
+				}
+			}
+		}
+	}
+}
+
+func (ix *indexer) fact(f *parser.Fact) {
+	ix.ident(TEMPLATE, f.Template, nil)
+	ix.exprs(f.Values)
+	ix.slotValues(f.Slots)
+}
+
+func (ix *indexer) instance(inst *parser.InstanceDef) {
+	ix.exprs([]parser.Expr{inst.Name})
+	ix.ident(CLASS, inst.Class, nil)
+	ix.slotValues(inst.Slots)
+}
+
+func (ix *indexer) slotValues(slots []*parser.SlotValue) {
+	for _, s := range slots {
+		ix.exprs(s.Values)
+	}
+}
+
+// queryFunctions are the instance-set query functions, whose first argument lists the
+// classes to query
+var queryFunctions = map[string]bool{
+	"any-instancep":                true,
+	"find-instance":                true,
+	"find-all-instances":           true,
+	"do-for-instance":              true,
+	"do-for-all-instances":         true,
+	"delayed-do-for-all-instances": true,
+}
+
+func (ix *indexer) exprs(exprs []parser.Expr) {
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		parser.Inspect(e, func(n parser.Node) bool {
+			switch n := n.(type) {
+			case *parser.Variable:
+				if n.Global {
+					ix.add(GLOBAL, n.Name, n.Span, nil)
+				}
+			case *parser.Call:
+				return ix.call(n)
+			}
+			return true
+		})
+	}
+}
+
+// call indexes a function call, returning false if it has dealt with the arguments
+func (ix *indexer) call(c *parser.Call) bool {
+	switch c.Function.Name {
+	case "assert":
+		for _, arg := range c.Args {
+			if fact, ok := arg.(*parser.Call); ok {
+				ix.fact(parser.FactFromCall(fact))
+			} else {
+				ix.exprs([]parser.Expr{arg})
+			}
+		}
+		return false
+	case "make-instance":
+		if inst := parser.InstanceFromCall(c); inst != nil {
+			ix.instance(inst)
+			return false
+		}
+	case "modify", "duplicate", "modify-instance", "message-modify-instance",
+		"active-modify-instance", "active-message-modify-instance":
+		// the slot overrides are not function calls
+		for i, arg := range c.Args {
+			if override, ok := arg.(*parser.Call); ok && i > 0 {
+				ix.exprs(override.Args)
+			} else {
+				ix.exprs([]parser.Expr{arg})
+			}
+		}
+		return false
+	}
+	ix.ident(FUNCTION, c.Function, nil)
+	if queryFunctions[c.Function.Name] && len(c.Args) > 0 {
+		if templates, ok := c.Args[0].(*parser.List); ok {
+			for _, t := range templates.Elems {
+				if t, ok := t.(*parser.List); ok {
+					for _, class := range t.Elems {
+						ix.symbolConstant(CLASS, class)
+					}
+				}
+			}
+			ix.exprs(c.Args[1:])
+			return false
+		}
+	}
+	return true
+}
+
+// symbolAt returns the symbol at an offset, or the one ending there
+func (doc *Document) symbolAt(offset int) *symbol {
+	var ending *symbol
+	for _, sym := range doc.symbols {
+		if sym.span.Contains(offset) {
+			return sym
+		}
+		if sym.span.Stop.Offset == offset {
+			ending = sym
+		}
+	}
+	return ending
+}
@@ -0,0 +1,226 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runBuckets are the upper bounds, in seconds, of the buckets of the Run duration histogram
+var runBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// envStats are the counts an environment keeps for Metrics
+type envStats struct {
+	// runs counts the runs within each of runBuckets, the last counting those above all
+	runs      []int64
+	runTime   time.Duration
+	callbacks map[string]*callbackStats
+}
+
+type callbackStats struct {
+	calls  int64
+	errors int64
+}
+
+func newEnvStats() envStats {
+	return envStats{
+		runs:      make([]int64, len(runBuckets)+1),
+		callbacks: make(map[string]*callbackStats),
+	}
+}
+
+func (s *envStats) observeRun(d time.Duration) {
+	idx := sort.SearchFloat64s(runBuckets, d.Seconds())
+	s.runs[idx]++
+	s.runTime += d
+}
+
+func (s *envStats) callback(name string) *callbackStats {
+	ret, ok := s.callbacks[name]
+	if !ok {
+		ret = &callbackStats{}
+		s.callbacks[name] = ret
+	}
+	return ret
+}
+
+// Metrics serves the metrics of a set of environments in the Prometheus text format. For
+// each environment it gives the number of facts, instances and activations, the rules fired,
+// the memory CLIPS has in use, a histogram of the duration of Run and the calls to Go
+// functions and their errors. The number of live environments in the process is given too
+type Metrics struct {
+	mu   sync.Mutex
+	envs []*metricsEnv
+}
+
+type metricsEnv struct {
+	env  *Environment
+	name string
+	lock sync.Locker
+}
+
+// NewMetrics returns a collector with no environments
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Register adds an environment, labelled with the given name. Environments are not safe for
+// concurrent use, so if env is used by other goroutines while metrics are served, lock must be
+// the lock they hold while using it. Otherwise lock may be nil. Deleted environments are
+// dropped from the metrics
+func (m *Metrics) Register(env *Environment, name string, lock sync.Locker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.envs = append(m.envs, &metricsEnv{env: env, name: name, lock: lock})
+}
+
+// Unregister removes an environment
+func (m *Metrics) Unregister(env *Environment) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ii, entry := range m.envs {
+		if entry.env == env {
+			m.envs = append(m.envs[:ii], m.envs[ii+1:]...)
+			return
+		}
+	}
+}
+
+// metricFamily gathers the samples of one metric
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples bytes.Buffer
+}
+
+func (f *metricFamily) add(suffix string, labels []string, value float64) {
+	f.samples.WriteString(f.name + suffix)
+	if len(labels) > 0 {
+		f.samples.WriteString("{")
+		for ii := 0; ii < len(labels); ii += 2 {
+			if ii > 0 {
+				f.samples.WriteString(",")
+			}
+			fmt.Fprintf(&f.samples, `%s="%s"`, labels[ii], escapeLabel(labels[ii+1]))
+		}
+		f.samples.WriteString("}")
+	}
+	f.samples.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	environments := &metricFamily{name: "clips_environments", typ: "gauge", help: "Number of live CLIPS environments."}
+	facts := &metricFamily{name: "clips_facts", typ: "gauge", help: "Number of facts."}
+	instances := &metricFamily{name: "clips_instances", typ: "gauge", help: "Number of instances."}
+	agenda := &metricFamily{name: "clips_agenda_size", typ: "gauge", help: "Number of activations on the agendas of all modules."}
+	fired := &metricFamily{name: "clips_rules_fired_total", typ: "counter", help: "Number of rules fired."}
+	ruleFired := &metricFamily{name: "clips_rule_fired_total", typ: "counter", help: "Number of times each rule fired."}
+	runs := &metricFamily{name: "clips_run_duration_seconds", typ: "histogram", help: "Duration of Run."}
+	memory := &metricFamily{name: "clips_memory_used_bytes", typ: "gauge", help: "Memory in use by CLIPS."}
+	calls := &metricFamily{name: "clips_callback_calls_total", typ: "counter", help: "Number of calls to Go functions."}
+	errors := &metricFamily{name: "clips_callback_errors_total", typ: "counter", help: "Number of calls to Go functions which failed."}
+	families := []*metricFamily{environments, facts, instances, agenda, fired, ruleFired, runs, memory, calls, errors}
+
+	environments.add("", nil, float64(atomic.LoadInt64(&liveEnvironments)))
+
+	m.mu.Lock()
+	live := m.envs[:0]
+	for _, entry := range m.envs {
+		if entry.lock != nil {
+			entry.lock.Lock()
+		}
+		env := entry.env
+		if env.check() != nil {
+			if entry.lock != nil {
+				entry.lock.Unlock()
+			}
+			continue
+		}
+		live = append(live, entry)
+		label := []string{"env", entry.name}
+
+		facts.add("", label, float64(env.factCount()))
+		instances.add("", label, float64(env.instanceCount()))
+		agenda.add("", label, float64(env.agendaSize()))
+		memory.add("", label, float64(env.MemUsed()))
+
+		var total int64
+		for _, stat := range env.RuleStats() {
+			total += stat.Fired
+			ruleFired.add("", []string{"env", entry.name, "module", stat.Module, "rule", stat.Rule}, float64(stat.Fired))
+		}
+		fired.add("", label, float64(total))
+
+		var count int64
+		for ii, bound := range runBuckets {
+			count += env.stats.runs[ii]
+			runs.add("_bucket", append(label, "le", strconv.FormatFloat(bound, 'g', -1, 64)), float64(count))
+		}
+		count += env.stats.runs[len(runBuckets)]
+		runs.add("_bucket", append(label, "le", "+Inf"), float64(count))
+		runs.add("_sum", label, env.stats.runTime.Seconds())
+		runs.add("_count", label, float64(count))
+
+		names := make([]string, 0, len(env.stats.callbacks))
+		for name := range env.stats.callbacks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			stat := env.stats.callbacks[name]
+			calls.add("", []string{"env", entry.name, "function", name}, float64(stat.calls))
+			errors.add("", []string{"env", entry.name, "function", name}, float64(stat.errors))
+		}
+
+		if entry.lock != nil {
+			entry.lock.Unlock()
+		}
+	}
+	m.envs = live
+	m.mu.Unlock()
+
+	var out bytes.Buffer
+	for _, family := range families {
+		if family.samples.Len() == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.typ)
+		out.Write(family.samples.Bytes())
+	}
+	return out.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
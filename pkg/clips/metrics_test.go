@@ -0,0 +1,99 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	env := CreateEnvironment()
+	defer env.Delete()
+
+	err := env.DefineFunction("check", func(val int) (int, error) {
+		if val < 0 {
+			return 0, fmt.Errorf("negative")
+		}
+		return val, nil
+	})
+	assert.NilError(t, err)
+	err = env.Build(`(defrule ship (order ?id) => (assert (shipped (check ?id))))`)
+	assert.NilError(t, err)
+	err = env.Build(`(defrule never (refund ?id) =>)`)
+	assert.NilError(t, err)
+	_, err = env.AssertString(`(order 1)`)
+	assert.NilError(t, err)
+	_, err = env.AssertString(`(order 2)`)
+	assert.NilError(t, err)
+	env.Run(-1)
+	_, err = env.Eval(`(check -1)`)
+	assert.ErrorContains(t, err, "")
+
+	var mu sync.Mutex
+	metrics := NewMetrics()
+	metrics.Register(env, `orders "east"`, &mu)
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	assert.Assert(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	text := string(body)
+
+	label := `env="orders \"east\""`
+	for _, line := range []string{
+		"# TYPE clips_facts gauge",
+		// initial-fact and initial-object are counted too
+		"clips_facts{" + label + "} 5",
+		"clips_instances{" + label + "} 1",
+		"clips_agenda_size{" + label + "} 0",
+		"clips_rules_fired_total{" + label + "} 2",
+		"clips_rule_fired_total{" + label + `,module="MAIN",rule="ship"} 2`,
+		"clips_rule_fired_total{" + label + `,module="MAIN",rule="never"} 0`,
+		"# TYPE clips_run_duration_seconds histogram",
+		"clips_run_duration_seconds_bucket{" + label + `,le="+Inf"} 1`,
+		"clips_run_duration_seconds_count{" + label + "} 1",
+		"clips_callback_calls_total{" + label + `,function="check"} 3`,
+		"clips_callback_errors_total{" + label + `,function="check"} 1`,
+	} {
+		assert.Assert(t, strings.Contains(text, line+"\n"), "%s not in\n%s", line, text)
+	}
+	assert.Assert(t, strings.Contains(text, "clips_memory_used_bytes{"+label+"} "))
+	assert.Assert(t, strings.Contains(text, "\nclips_environments "))
+
+	other := CreateEnvironment()
+	metrics.Register(other, "other", nil)
+	var buf strings.Builder
+	_, err = metrics.WriteTo(&buf)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(buf.String(), `clips_facts{env="other"} 1`))
+
+	other.Delete()
+	metrics.Unregister(env)
+	buf.Reset()
+	_, err = metrics.WriteTo(&buf)
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(buf.String(), "clips_facts{"))
+}
@@ -21,42 +21,64 @@ import (
 	"fmt"
 	"strings"
 	"unsafe"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/parser"
 )
 
-// Module represents a CLIPS module
+// Module represents a CLIPS module. Modules are stale once the environment is cleared. Like
+// every Construct, its methods without an error result panic with ErrEnvironmentClosed after
+// the environment is deleted
 type Module struct {
-	env    *Environment
-	modptr unsafe.Pointer
+	env     *Environment
+	modptr  unsafe.Pointer
+	name    string
+	cleared uint64
+}
+
+// ModulePort is a construct imported or exported by a module
+type ModulePort struct {
+	// Module is the module imported from; it is empty for exports
+	Module string
+	// Construct is the construct type, such as "deftemplate", or empty for all construct types
+	Construct string
+	// Name is the name of the construct, or ?ALL or ?NONE
+	Name string
 }
 
 // CurrentModule returns the current module of the env
 func (env *Environment) CurrentModule() *Module {
-	modptr := C.EnvGetCurrentModule(env.env)
+	modptr := C.EnvGetCurrentModule(env.ptr())
 	return createModule(env, modptr)
 }
 
-// SetModule sets the current module for the CLIPS env
+// SetModule sets the current module for the CLIPS env. A stale module is ignored
 func (env *Environment) SetModule(module *Module) {
-	C.EnvSetCurrentModule(env.env, module.modptr)
+	if !valid(module.check()) {
+		return
+	}
+	C.EnvSetCurrentModule(env.ptr(), module.modptr)
 }
 
 // Modules returns the list of modulesb
 func (env *Environment) Modules() []*Module {
-	modptr := C.EnvGetNextDefmodule(env.env, nil)
+	modptr := C.EnvGetNextDefmodule(env.ptr(), nil)
 
 	ret := make([]*Module, 0, 10)
 	for modptr != nil {
 		ret = append(ret, createModule(env, modptr))
-		modptr = C.EnvGetNextDefmodule(env.env, modptr)
+		modptr = C.EnvGetNextDefmodule(env.ptr(), modptr)
 	}
 	return ret
 }
 
 // FindModule returns the module with the given name
 func (env *Environment) FindModule(name string) (*Module, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	modptr := C.EnvFindDefmodule(env.env, cname)
+	modptr := C.EnvFindDefmodule(env.ptr(), cname)
 	if modptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Module "%s" not found`, name))
 	}
@@ -65,23 +87,211 @@ func (env *Environment) FindModule(name string) (*Module, error) {
 
 func createModule(env *Environment, modptr unsafe.Pointer) *Module {
 	return &Module{
-		env:    env,
-		modptr: modptr,
+		env:     env,
+		modptr:  modptr,
+		name:    C.GoString(C.EnvGetDefmoduleName(env.ptr(), modptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the module can no longer be used. A module
+// is stale once cleared
+func (m *Module) check() error {
+	return checkConstruct(m.env, DEFMODULE, m.modptr, m.name, m.cleared)
+}
+
 // Equal returns true if the other module references the same CLIPS module
 func (m *Module) Equal(other *Module) bool {
 	return m.modptr == other.modptr
 }
 
 func (m *Module) String() string {
-	module := C.EnvGetDefmodulePPForm(m.env.env, m.modptr)
+	if !valid(m.check()) {
+		return fmt.Sprintf("<Module-%s stale>", m.name)
+	}
+	module := C.EnvGetDefmodulePPForm(m.env.ptr(), m.modptr)
 	return strings.TrimRight(C.GoString(module), "\n")
 }
 
 // Name returns the name of this module
 func (m *Module) Name() string {
-	name := C.EnvGetDefmoduleName(m.env.env, m.modptr)
-	return C.GoString(name)
+	if err := m.env.check(); err != nil {
+		panic(err)
+	}
+	return m.name
+}
+
+// Module returns the module itself, so that modules implement Construct
+func (m *Module) Module() *Module {
+	return m
+}
+
+// Deletable returns false, since CLIPS cannot undefine modules
+func (m *Module) Deletable() bool {
+	return false
+}
+
+// Undefine returns an error, since CLIPS cannot undefine modules
+func (m *Module) Undefine() error {
+	return fmt.Errorf(`Module "%s" cannot be undefined`, m.Name())
+}
+
+// Imports returns the constructs imported by this module
+func (m *Module) Imports() ([]ModulePort, error) {
+	def, err := m.definition()
+	if err != nil || def == nil {
+		return nil, err
+	}
+	return modulePorts(def.Imports), nil
+}
+
+// Exports returns the constructs exported by this module
+func (m *Module) Exports() ([]ModulePort, error) {
+	def, err := m.definition()
+	if err != nil || def == nil {
+		return nil, err
+	}
+	return modulePorts(def.Exports), nil
+}
+
+// definition parses the defmodule, returning nil for a module without one, such as MAIN
+func (m *Module) definition() (*parser.Defmodule, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	src := m.String()
+	if src == "" {
+		return nil, nil
+	}
+	file, err := parser.ParseString(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, construct := range file.Constructs {
+		if def, ok := construct.(*parser.Defmodule); ok {
+			return def, nil
+		}
+	}
+	return nil, fmt.Errorf(`Unable to read definition of module "%s"`, m.Name())
+}
+
+func modulePorts(specs []*parser.PortSpec) []ModulePort {
+	ret := make([]ModulePort, 0, len(specs))
+	for _, spec := range specs {
+		port := ModulePort{Module: spec.Module, Construct: spec.Construct}
+		switch {
+		case spec.All:
+			port.Name = "?ALL"
+		case spec.None:
+			port.Name = "?NONE"
+		default:
+			for _, name := range spec.Names {
+				port.Name = name.Name
+				ret = append(ret, port)
+			}
+			continue
+		}
+		ret = append(ret, port)
+	}
+	return ret
+}
+
+// within calls fn with this module as the current module, then restores the current module
+func (m *Module) within(fn func()) {
+	current := C.EnvGetCurrentModule(m.env.ptr())
+	C.EnvSetCurrentModule(m.env.ptr(), m.modptr)
+	defer C.EnvSetCurrentModule(m.env.ptr(), current)
+	fn()
+}
+
+// Build builds the construct within this module. The current module is left unchanged
+func (m *Module) Build(construct string) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	var err error
+	m.within(func() {
+		err = m.env.Build(construct)
+	})
+	return err
+}
+
+// Rules returns the rules defined in this module
+func (m *Module) Rules() (ret []*Rule) {
+	if !valid(m.check()) {
+		return nil
+	}
+	m.within(func() {
+		ret = m.env.Rules()
+	})
+	return
+}
+
+// Templates returns the templates defined in this module
+func (m *Module) Templates() (ret []*Template) {
+	if !valid(m.check()) {
+		return nil
+	}
+	m.within(func() {
+		ret = m.env.Templates()
+	})
+	return
+}
+
+// Classes returns the classes defined in this module
+func (m *Module) Classes() (ret []*Class) {
+	if !valid(m.check()) {
+		return nil
+	}
+	m.within(func() {
+		ret = m.env.Classes()
+	})
+	return
+}
+
+// Functions returns the functions defined in this module
+func (m *Module) Functions() (ret []*Function) {
+	if !valid(m.check()) {
+		return nil
+	}
+	m.within(func() {
+		ret = m.env.Functions()
+	})
+	return
+}
+
+// Globals returns the globals defined in this module
+func (m *Module) Globals() (ret []*Global) {
+	if !valid(m.check()) {
+		return nil
+	}
+	m.within(func() {
+		ret = m.env.Globals()
+	})
+	return
+}
+
+// Activations returns the activations on the agenda of this module
+func (m *Module) Activations() (ret []*Activation) {
+	if !valid(m.check()) {
+		return nil
+	}
+	m.within(func() {
+		ret = m.env.Activations()
+	})
+	return
+}
+
+// Facts returns the facts of the templates defined in this module
+func (m *Module) Facts() []Fact {
+	if !valid(m.check()) {
+		return nil
+	}
+	ret := make([]Fact, 0, 10)
+	for _, fact := range m.env.Facts() {
+		if fact.Template().Module().Equal(m) {
+			ret = append(ret, fact)
+		}
+	}
+	return ret
 }
@@ -103,4 +103,120 @@ func TestModules(t *testing.T) {
 		assert.NilError(t, err)
 		assert.Assert(t, !module.Equal(module2))
 	})
+
+	t.Run("Imports and exports", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defmodule Foo (export deftemplate order item) (export defclass ?ALL))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defmodule Bar (import Foo deftemplate order) (import Foo ?ALL) (export ?NONE))`)
+		assert.NilError(t, err)
+
+		foo, err := env.FindModule("Foo")
+		assert.NilError(t, err)
+		exports, err := foo.Exports()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, exports, []ModulePort{
+			{Construct: "deftemplate", Name: "order"},
+			{Construct: "deftemplate", Name: "item"},
+			{Construct: "defclass", Name: "?ALL"},
+		})
+		imports, err := foo.Imports()
+		assert.NilError(t, err)
+		assert.Equal(t, len(imports), 0)
+
+		bar, err := env.FindModule("Bar")
+		assert.NilError(t, err)
+		imports, err = bar.Imports()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, imports, []ModulePort{
+			{Module: "Foo", Construct: "deftemplate", Name: "order"},
+			{Module: "Foo", Name: "?ALL"},
+		})
+		exports, err = bar.Exports()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, exports, []ModulePort{{Name: "?NONE"}})
+	})
+
+	t.Run("Module constructs", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defmodule Foo (export ?ALL))`)
+		assert.NilError(t, err)
+		main, err := env.FindModule("MAIN")
+		assert.NilError(t, err)
+		env.SetModule(main)
+
+		foo, err := env.FindModule("Foo")
+		assert.NilError(t, err)
+		for _, construct := range []string{
+			`(deftemplate order (slot id))`,
+			`(defclass Person (is-a USER))`,
+			`(deffunction double (?x) (* ?x 2))`,
+			`(defglobal ?*count* = 0)`,
+			`(defrule ship (order (id ?id)) =>)`,
+		} {
+			err = foo.Build(construct)
+			assert.NilError(t, err)
+		}
+		assert.Assert(t, env.CurrentModule().Equal(main))
+
+		assert.Equal(t, len(foo.Templates()), 1)
+		assert.Equal(t, foo.Templates()[0].Name(), "order")
+		assert.Equal(t, len(foo.Classes()), 1)
+		assert.Equal(t, foo.Classes()[0].Name(), "Person")
+		assert.Equal(t, len(foo.Functions()), 1)
+		assert.Equal(t, foo.Functions()[0].Name(), "double")
+		assert.Equal(t, len(foo.Globals()), 1)
+		assert.Equal(t, foo.Globals()[0].Name(), "count")
+		assert.Equal(t, len(foo.Rules()), 1)
+		assert.Equal(t, foo.Rules()[0].Name(), "ship")
+		assert.Equal(t, len(main.Rules()), 0)
+
+		_, err = env.AssertString(`(Foo::order (id 1))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(other 1)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(foo.Facts()), 1)
+		assert.Equal(t, len(foo.Activations()), 1)
+		assert.Equal(t, len(main.Activations()), 0)
+		assert.Assert(t, env.CurrentModule().Equal(main))
+
+		err = foo.Build(`(defrule broken`)
+		assert.Assert(t, err != nil)
+		assert.Assert(t, env.CurrentModule().Equal(main))
+	})
+
+	t.Run("Focus stack", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defmodule Foo (export ?ALL))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defmodule Bar (export ?ALL))`)
+		assert.NilError(t, err)
+
+		env.ClearFocus()
+		assert.Equal(t, len(env.FocusStack()), 0)
+		assert.Assert(t, env.PopFocus() == nil)
+
+		foo, err := env.FindModule("Foo")
+		assert.NilError(t, err)
+		bar, err := env.FindModule("Bar")
+		assert.NilError(t, err)
+		env.SetFocus(foo)
+		env.SetFocus(bar)
+
+		stack := env.FocusStack()
+		assert.Equal(t, len(stack), 2)
+		assert.Equal(t, stack[0].Name(), "Bar")
+		assert.Equal(t, stack[1].Name(), "Foo")
+
+		assert.Equal(t, env.PopFocus().Name(), "Bar")
+		stack = env.FocusStack()
+		assert.Equal(t, len(stack), 1)
+		assert.Equal(t, stack[0].Name(), "Foo")
+	})
 }
@@ -0,0 +1,125 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+)
+
+// Option configures an environment as it is created. Options are applied in the order given,
+// so functions should come before the files which call them
+type Option func(env *Environment) error
+
+// WithLogger routes CLIPS output to the logger, through a LoggingRouter
+func WithLogger(logger *log.Logger) Option {
+	return func(env *Environment) error {
+		CreateLoggingRouter(env, logger)
+		return nil
+	}
+}
+
+// WithStrategy sets the conflict resolution strategy
+func WithStrategy(strategy Strategy) Option {
+	return func(env *Environment) error {
+		if strategy < 0 || int(strategy) >= len(clipsStrategies) {
+			return fmt.Errorf("Invalid strategy %d", int(strategy))
+		}
+		env.SetStrategy(strategy)
+		return nil
+	}
+}
+
+// WithSettings applies the given settings
+func WithSettings(s Settings) Option {
+	return func(env *Environment) error {
+		return env.ApplySettings(s)
+	}
+}
+
+// WithFunctions defines Go functions within CLIPS, keyed by the name they are called by
+func WithFunctions(functions map[string]interface{}) Option {
+	return func(env *Environment) error {
+		names := make([]string, 0, len(functions))
+		for name := range functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := env.DefineFunction(name, functions[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithFiles loads the constructs in the files of fsys matching each of the glob patterns, as
+// for fs.Glob. Files are loaded in the order of the patterns, and by name within each. It is
+// an error for a pattern to match no files
+func WithFiles(fsys fs.FS, globs ...string) Option {
+	return func(env *Environment) error {
+		loaded := make(map[string]bool)
+		for _, glob := range globs {
+			matches, err := fs.Glob(fsys, glob)
+			if err != nil {
+				return err
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf(`No files match "%s"`, glob)
+			}
+			for _, name := range matches {
+				if loaded[name] {
+					continue
+				}
+				loaded[name] = true
+				src, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					return err
+				}
+				if err := env.LoadFromString(string(src)); err != nil {
+					return fmt.Errorf(`Unable to load "%s": %v`, name, err)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// WithRouters adds routers to the environment. Since a router is bound to its environment
+// when created, each is given as a function creating it, such as
+//
+//	func(env *clips.Environment) clips.Router { return clips.CreateLoggingRouter(env, logger) }
+func WithRouters(routers ...func(env *Environment) Router) Option {
+	return func(env *Environment) error {
+		for _, create := range routers {
+			if create(env) == nil {
+				return fmt.Errorf("Router function returned nil")
+			}
+		}
+		return nil
+	}
+}
+
+// WithResetAfterLoad resets the environment, asserting deffacts and making definstances. Give
+// it after WithFiles
+func WithResetAfterLoad() Option {
+	return func(env *Environment) error {
+		env.Reset()
+		return nil
+	}
+}
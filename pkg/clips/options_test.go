@@ -0,0 +1,95 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestOptions(t *testing.T) {
+	rules := fstest.MapFS{
+		"rules/a.clp": {Data: []byte(`
+(deftemplate order (slot id))
+(deffacts orders (order (id 1)) (order (id 2)))`)},
+		"rules/b.clp": {Data: []byte(`
+(defrule ship (order (id ?id)) => (printout t "ship " (twice ?id) crlf))`)},
+		"broken.clp": {Data: []byte(`(defrule broken`)},
+	}
+
+	t.Run("All options", func(t *testing.T) {
+		var buf bytes.Buffer
+		settings := DefaultSettings()
+		settings.FactDuplication = true
+		env, err := NewEnvironment(
+			WithLogger(log.New(&buf, "", 0)),
+			WithSettings(settings),
+			WithStrategy(BREADTH),
+			WithFunctions(map[string]interface{}{
+				"twice": func(x int64) int64 { return 2 * x },
+			}),
+			WithFiles(rules, "rules/*.clp"),
+			WithResetAfterLoad(),
+		)
+		assert.NilError(t, err)
+		defer env.Delete()
+
+		assert.Equal(t, env.Strategy(), BREADTH)
+		assert.Assert(t, env.FactDuplication())
+		assert.Equal(t, len(env.Facts()), 3)
+		assert.Equal(t, env.Run(-1), int64(2))
+		assert.Equal(t, buf.String(), "ship 2\nship 4\n")
+	})
+
+	t.Run("Routers", func(t *testing.T) {
+		var buf bytes.Buffer
+		env := CreateEnvironment(WithRouters(func(env *Environment) Router {
+			return CreateLoggingRouter(env, log.New(&buf, "", 0))
+		}))
+		defer env.Delete()
+
+		err := env.SendCommand(`(printout t "hello" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, buf.String(), "hello\n")
+	})
+
+	t.Run("Option errors", func(t *testing.T) {
+		_, err := NewEnvironment(WithFiles(rules, "missing/*.clp"))
+		assert.ErrorContains(t, err, `No files match "missing/*.clp"`)
+
+		_, err = NewEnvironment(WithFiles(rules, "broken.clp"))
+		assert.ErrorContains(t, err, `Unable to load "broken.clp"`)
+
+		_, err = NewEnvironment(WithStrategy(Strategy(42)))
+		assert.ErrorContains(t, err, "Invalid strategy")
+
+		_, err = NewEnvironment(func(env *Environment) error {
+			return fmt.Errorf("failed")
+		})
+		assert.ErrorContains(t, err, "failed")
+	})
+
+	t.Run("Create panics", func(t *testing.T) {
+		defer func() {
+			assert.Assert(t, recover() != nil)
+		}()
+		CreateEnvironment(WithStrategy(Strategy(42)))
+	})
+}
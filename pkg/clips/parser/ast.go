@@ -0,0 +1,458 @@
+package parser
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+)
+
+// Node is implemented by every element of the syntax tree
+type Node interface {
+	// Pos returns the position of the first character of the node
+	Pos() lexer.Pos
+	// End returns the position immediately after the node
+	End() lexer.Pos
+}
+
+// Span records the extent of a node within the source
+type Span struct {
+	Start lexer.Pos
+	Stop  lexer.Pos
+}
+
+// Pos returns the position of the first character of the node
+func (s Span) Pos() lexer.Pos {
+	return s.Start
+}
+
+// End returns the position immediately after the node
+func (s Span) End() lexer.Pos {
+	return s.Stop
+}
+
+// Contains returns true if the given offset lies within the span
+func (s Span) Contains(offset int) bool {
+	return offset >= s.Start.Offset && offset < s.Stop.Offset
+}
+
+// File is the result of parsing one source file
+type File struct {
+	Span
+	Name       string
+	Constructs []Construct
+	// Commands holds top-level expressions which are not constructs, such as (reset) in a batch file
+	Commands []Expr
+	Comments []*Comment
+}
+
+// Comment is a ; comment
+type Comment struct {
+	Span
+	Text string
+}
+
+// Ident is a possibly module-qualified name, such as MAIN::foo
+type Ident struct {
+	Span
+	Module string
+	Name   string
+}
+
+func (id *Ident) String() string {
+	if id == nil {
+		return ""
+	}
+	if id.Module != "" {
+		return id.Module + "::" + id.Name
+	}
+	return id.Name
+}
+
+// Expr is implemented by expressions: constants, variables, function calls and other lists
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Constant is a literal value such as a symbol, string, number or instance name
+type Constant struct {
+	Span
+	Kind  lexer.Kind
+	Value string
+}
+
+// Variable is a single-field (?x), multifield ($?x) or global (?*x*) variable. The name is
+// empty for the wildcards ? and $?
+type Variable struct {
+	Span
+	Name       string
+	Multifield bool
+	Global     bool
+}
+
+// Call is a function call, or any other list beginning with a symbol
+type Call struct {
+	Span
+	Function *Ident
+	Args     []Expr
+}
+
+// List is a parenthesized list which does not begin with a symbol
+type List struct {
+	Span
+	Elems []Expr
+}
+
+func (*Constant) exprNode() {}
+func (*Variable) exprNode() {}
+func (*Call) exprNode()     {}
+func (*List) exprNode()     {}
+
+// String returns the variable as it is written in source
+func (v *Variable) String() string {
+	var b strings.Builder
+	if v.Multifield {
+		b.WriteString("$")
+	}
+	b.WriteString("?")
+	if v.Global {
+		b.WriteString("*" + v.Name + "*")
+	} else {
+		b.WriteString(v.Name)
+	}
+	return b.String()
+}
+
+// Construct is implemented by every construct type
+type Construct interface {
+	Node
+	// Keyword returns the construct keyword, such as "defrule"
+	Keyword() string
+	// Header returns the common construct header
+	Header() *ConstructHeader
+}
+
+// ConstructHeader holds what every construct has in common
+type ConstructHeader struct {
+	Span
+	Name *Ident
+	// Module is the module the construct belongs to, either from a qualified name or
+	// from the most recent defmodule in the file
+	Module  string
+	Comment string
+}
+
+// Header returns the common construct header
+func (h *ConstructHeader) Header() *ConstructHeader {
+	return h
+}
+
+// Defrule is a (defrule) construct
+type Defrule struct {
+	ConstructHeader
+	Salience  Expr
+	AutoFocus Expr
+	LHS       []CE
+	RHS       []Expr
+}
+
+// CE is a conditional element on the left hand side of a rule
+type CE interface {
+	Node
+	ceNode()
+}
+
+// PatternCE matches a fact or, when Object is set, an instance
+type PatternCE struct {
+	Span
+	// Binding is the fact-address variable in ?f <- (pattern)
+	Binding  *Variable
+	Template *Ident
+	Object   bool
+	// Fields holds the constraints of an ordered pattern
+	Fields []*Constraint
+	// Slots holds the constraints of a template or object pattern
+	Slots []*SlotConstraint
+}
+
+// SlotConstraint constrains one slot of a template or object pattern
+type SlotConstraint struct {
+	Span
+	Name   *Ident
+	Fields []*Constraint
+}
+
+// TestCE is a (test) conditional element
+type TestCE struct {
+	Span
+	Expr Expr
+}
+
+// GroupCE is one of the (and), (or), (not), (exists), (forall) and (logical) conditional elements
+type GroupCE struct {
+	Span
+	Kind string
+	CEs  []CE
+}
+
+func (*PatternCE) ceNode() {}
+func (*TestCE) ceNode()    {}
+func (*GroupCE) ceNode()   {}
+
+// Constraint is a connected constraint matching a single field, such as ?x&~red|blue.
+// Alternatives are separated by | and each contains terms joined by &
+type Constraint struct {
+	Span
+	Alternatives [][]*Term
+}
+
+// TermKind distinguishes the forms a constraint term may take
+type TermKind int
+
+const (
+	LITERAL_TERM TermKind = iota
+	VARIABLE_TERM
+	PREDICATE_TERM
+	RETURN_VALUE_TERM
+)
+
+var termKinds = [...]string{
+	"LITERAL_TERM",
+	"VARIABLE_TERM",
+	"PREDICATE_TERM",
+	"RETURN_VALUE_TERM",
+}
+
+func (tk TermKind) String() string {
+	return termKinds[int(tk)]
+}
+
+// Term is a single term of a constraint: a literal, a variable, :(predicate) or =(expression),
+// optionally negated with ~
+type Term struct {
+	Span
+	Kind  TermKind
+	Not   bool
+	Value Expr
+}
+
+// Deftemplate is a (deftemplate) construct
+type Deftemplate struct {
+	ConstructHeader
+	Slots []*Slot
+}
+
+// Slot is a slot definition within a deftemplate or defclass
+type Slot struct {
+	Span
+	Multi      bool
+	Name       *Ident
+	Attributes []*Attribute
+}
+
+// Attribute is a slot attribute or class facet such as (type INTEGER) or (default 0)
+type Attribute struct {
+	Span
+	Name   string
+	Values []Expr
+}
+
+// Attribute returns the named attribute, or nil
+func (s *Slot) Attribute(name string) *Attribute {
+	for _, a := range s.Attributes {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Types returns the values of the type attribute, or nil if it is not given
+func (s *Slot) Types() []string {
+	a := s.Attribute("type")
+	if a == nil {
+		return nil
+	}
+	ret := make([]string, 0, len(a.Values))
+	for _, v := range a.Values {
+		if c, ok := v.(*Constant); ok {
+			ret = append(ret, c.Value)
+		}
+	}
+	return ret
+}
+
+// Defclass is a (defclass) construct
+type Defclass struct {
+	ConstructHeader
+	Superclasses []*Ident
+	Role         string
+	PatternMatch string
+	Slots        []*Slot
+	Handlers     []*HandlerDecl
+}
+
+// HandlerDecl is a (message-handler) documentation declaration within a defclass
+type HandlerDecl struct {
+	Span
+	Name *Ident
+	Type string
+}
+
+// Deffunction is a (deffunction) construct
+type Deffunction struct {
+	ConstructHeader
+	Params   []*Variable
+	Wildcard *Variable
+	Body     []Expr
+}
+
+// Defgeneric is a (defgeneric) construct
+type Defgeneric struct {
+	ConstructHeader
+}
+
+// Defmethod is a (defmethod) construct
+type Defmethod struct {
+	ConstructHeader
+	Index    int
+	Params   []*MethodParam
+	Wildcard *MethodParam
+	Body     []Expr
+}
+
+// MethodParam is a parameter restriction of a defmethod
+type MethodParam struct {
+	Span
+	Var   *Variable
+	Types []*Ident
+	Query Expr
+}
+
+// DefmessageHandler is a (defmessage-handler) construct. The header name is the message name
+type DefmessageHandler struct {
+	ConstructHeader
+	Class       *Ident
+	HandlerType string
+	Params      []*Variable
+	Wildcard    *Variable
+	Body        []Expr
+}
+
+// Defglobal is a (defglobal) construct. The header name is nil
+type Defglobal struct {
+	ConstructHeader
+	Globals []*GlobalAssignment
+}
+
+// GlobalAssignment is one ?*name* = value pair of a defglobal
+type GlobalAssignment struct {
+	Span
+	Var   *Variable
+	Value Expr
+}
+
+// Deffacts is a (deffacts) construct
+type Deffacts struct {
+	ConstructHeader
+	Facts []*Fact
+}
+
+// Fact is a fact as written in deffacts or an assert, either ordered or with slots
+type Fact struct {
+	Span
+	Template *Ident
+	// Values holds the fields of an ordered fact
+	Values []Expr
+	// Slots holds the slots of a template fact
+	Slots []*SlotValue
+}
+
+// SlotValue is a slot name with its values, as in (name "Joe") within a fact or instance
+type SlotValue struct {
+	Span
+	Name   *Ident
+	Values []Expr
+}
+
+// Definstances is a (definstances) construct
+type Definstances struct {
+	ConstructHeader
+	Active    bool
+	Instances []*InstanceDef
+}
+
+// InstanceDef is an instance definition as written in definstances or make-instance
+type InstanceDef struct {
+	Span
+	// Name is nil for anonymous instances
+	Name  Expr
+	Class *Ident
+	Slots []*SlotValue
+}
+
+// Defmodule is a (defmodule) construct
+type Defmodule struct {
+	ConstructHeader
+	Imports []*PortSpec
+	Exports []*PortSpec
+}
+
+// PortSpec is an (import) or (export) specification of a defmodule
+type PortSpec struct {
+	Span
+	// Module is the module imported from; it is empty for exports
+	Module string
+	// Construct is the construct type, such as "deftemplate", or empty for all constructs
+	Construct string
+	All       bool
+	None      bool
+	Names     []*Ident
+}
+
+// Keyword returns the construct keyword
+func (*Defrule) Keyword() string { return "defrule" }
+
+// Keyword returns the construct keyword
+func (*Deftemplate) Keyword() string { return "deftemplate" }
+
+// Keyword returns the construct keyword
+func (*Defclass) Keyword() string { return "defclass" }
+
+// Keyword returns the construct keyword
+func (*Deffunction) Keyword() string { return "deffunction" }
+
+// Keyword returns the construct keyword
+func (*Defgeneric) Keyword() string { return "defgeneric" }
+
+// Keyword returns the construct keyword
+func (*Defmethod) Keyword() string { return "defmethod" }
+
+// Keyword returns the construct keyword
+func (*DefmessageHandler) Keyword() string { return "defmessage-handler" }
+
+// Keyword returns the construct keyword
+func (*Defglobal) Keyword() string { return "defglobal" }
+
+// Keyword returns the construct keyword
+func (*Deffacts) Keyword() string { return "deffacts" }
+
+// Keyword returns the construct keyword
+func (*Definstances) Keyword() string { return "definstances" }
+
+// Keyword returns the construct keyword
+func (*Defmodule) Keyword() string { return "defmodule" }
@@ -0,0 +1,171 @@
+package parser
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+)
+
+// ces parses a sequence of conditional elements, including ?f <- (pattern) bindings
+func (p *parser) ces(elems []*sexp) []CE {
+	ret := make([]CE, 0, len(elems))
+	for ii := 0; ii < len(elems); ii++ {
+		e := elems[ii]
+		if !e.list {
+			if e.tok.Kind != lexer.VARIABLE || ii+2 >= len(elems) || !elems[ii+1].isAtom("<-") {
+				p.fail(e.tok.Pos, "expected a conditional element, found %s", describe(e))
+			}
+			target := elems[ii+2]
+			pattern, ok := p.ce(target).(*PatternCE)
+			if !ok {
+				p.fail(target.tok.Pos, "only a pattern may be bound to %s", e.tok.Value)
+			}
+			pattern.Binding = variable(e)
+			pattern.Start = e.tok.Pos
+			ret = append(ret, pattern)
+			ii += 2
+			continue
+		}
+		ret = append(ret, p.ce(e))
+	}
+	return ret
+}
+
+func (p *parser) ce(s *sexp) CE {
+	if !s.list {
+		p.fail(s.tok.Pos, "expected a conditional element, found %s", describe(s))
+	}
+	if len(s.elems) == 0 {
+		p.fail(s.tok.Pos, "empty pattern")
+	}
+	switch kind := s.head(); kind {
+	case "test":
+		if len(s.elems) != 2 {
+			p.fail(s.tok.Pos, "test expects a single expression")
+		}
+		return &TestCE{Span: s.span(), Expr: p.expr(s.elems[1])}
+	case "and", "or", "not", "exists", "forall", "logical":
+		if len(s.elems) < 2 {
+			p.fail(s.tok.Pos, "%s expects at least one conditional element", kind)
+		}
+		if kind == "not" && len(s.elems) != 2 {
+			p.fail(s.tok.Pos, "not expects a single conditional element")
+		}
+		return &GroupCE{Span: s.span(), Kind: kind, CEs: p.ces(s.elems[1:])}
+	case "object":
+		ret := &PatternCE{Span: s.span(), Object: true}
+		ret.Slots = p.slotConstraints(s.elems[1:])
+		return ret
+	}
+	ret := &PatternCE{Span: s.span(), Template: p.ident(s.elems[0])}
+	slotted := false
+	for ii, e := range s.elems[1:] {
+		// the list in a :(predicate) or =(expression) term is not a slot
+		if e.list && !s.elems[ii].isAtom(":") && !s.elems[ii].isAtom("=") {
+			slotted = true
+			break
+		}
+	}
+	if slotted {
+		ret.Slots = p.slotConstraints(s.elems[1:])
+	} else {
+		ret.Fields = p.constraints(s.elems[1:])
+	}
+	return ret
+}
+
+func (p *parser) slotConstraints(elems []*sexp) []*SlotConstraint {
+	ret := make([]*SlotConstraint, 0, len(elems))
+	for _, e := range elems {
+		if !e.list || len(e.elems) == 0 {
+			p.fail(e.tok.Pos, "expected a slot constraint, found %s", describe(e))
+		}
+		ret = append(ret, &SlotConstraint{
+			Span:   e.span(),
+			Name:   p.ident(e.elems[0]),
+			Fields: p.constraints(e.elems[1:]),
+		})
+	}
+	return ret
+}
+
+// constraints parses a sequence of connected constraints, one per field
+func (p *parser) constraints(elems []*sexp) []*Constraint {
+	var ret []*Constraint
+	for at := 0; at < len(elems); {
+		c := &Constraint{Span: Span{Start: elems[at].tok.Pos}}
+		var terms []*Term
+		for {
+			var term *Term
+			term, at = p.term(elems, at)
+			terms = append(terms, term)
+			c.Stop = term.Stop
+			if at >= len(elems) || elems[at].list || elems[at].tok.Kind != lexer.OPERATOR {
+				break
+			}
+			switch elems[at].tok.Value {
+			case "&":
+			case "|":
+				c.Alternatives = append(c.Alternatives, terms)
+				terms = nil
+			default:
+				p.fail(elems[at].tok.Pos, "unexpected %s in constraint", elems[at].tok.Value)
+			}
+			at++
+			if at >= len(elems) {
+				p.fail(c.Stop, "expected a term after connective")
+			}
+		}
+		c.Alternatives = append(c.Alternatives, terms)
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+// term parses one term at elems[at], returning it with the index following it
+func (p *parser) term(elems []*sexp, at int) (*Term, int) {
+	e := elems[at]
+	term := &Term{Span: e.span()}
+	if e.isAtom("~") {
+		term.Not = true
+		at++
+		if at >= len(elems) {
+			p.fail(e.end, "expected a term after ~")
+		}
+		e = elems[at]
+	}
+	switch {
+	case e.list:
+		p.fail(e.tok.Pos, "unexpected list in pattern")
+	case (e.isAtom(":") || e.isAtom("=")) && at+1 < len(elems) && elems[at+1].list:
+		term.Kind = PREDICATE_TERM
+		if e.tok.Value == "=" {
+			term.Kind = RETURN_VALUE_TERM
+		}
+		at++
+		e = elems[at]
+		term.Value = p.expr(e)
+	case e.tok.Kind == lexer.VARIABLE || e.tok.Kind == lexer.GLOBAL_VARIABLE:
+		term.Kind = VARIABLE_TERM
+		term.Value = variable(e)
+	case e.tok.Kind == lexer.OPERATOR:
+		p.fail(e.tok.Pos, "unexpected %s in constraint", e.tok.Value)
+	default:
+		term.Kind = LITERAL_TERM
+		term.Value = p.expr(e)
+	}
+	term.Stop = e.end
+	return term, at + 1
+}
@@ -0,0 +1,759 @@
+// Package parser parses CLIPS source into a typed syntax tree without requiring
+// a CLIPS environment
+package parser
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+)
+
+// ErrorList is returned when one or more parts of a file could not be parsed
+type ErrorList []*lexer.Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// sexp is the untyped tree the constructs are interpreted from
+type sexp struct {
+	tok   lexer.Token
+	end   lexer.Pos
+	list  bool
+	elems []*sexp
+}
+
+func (s *sexp) span() Span {
+	return Span{Start: s.tok.Pos, Stop: s.end}
+}
+
+// closing returns the position of the closing parenthesis of a list
+func (s *sexp) closing() lexer.Pos {
+	pos := s.end
+	if s.list {
+		pos.Offset--
+		pos.Column--
+	}
+	return pos
+}
+
+func (s *sexp) isAtom(value string) bool {
+	return s != nil && !s.list && s.tok.Value == value
+}
+
+func (s *sexp) isSymbol() bool {
+	return s != nil && !s.list && s.tok.Kind == lexer.SYMBOL
+}
+
+func (s *sexp) head() string {
+	if s == nil || !s.list || len(s.elems) == 0 || s.elems[0].list {
+		return ""
+	}
+	return s.elems[0].tok.Value
+}
+
+// bailout is used to abandon the construct being parsed
+type bailout struct{}
+
+type parser struct {
+	toks   []lexer.Token
+	idx    int
+	file   *File
+	errors ErrorList
+	module string
+}
+
+// ParseFile parses CLIPS source. Constructs which cannot be parsed are skipped and
+// reported in the returned ErrorList, so a partial File is returned alongside any error
+func ParseFile(filename string, src []byte) (*File, error) {
+	p := &parser{
+		file:   &File{Name: filename},
+		module: "MAIN",
+	}
+	s := lexer.NewScanner(string(src))
+	for {
+		tok, err := s.Next()
+		if err != nil {
+			if lerr, ok := err.(*lexer.Error); ok {
+				p.errors = append(p.errors, lerr)
+			} else {
+				p.errors = append(p.errors, &lexer.Error{Pos: tok.Pos, Msg: err.Error()})
+			}
+			break
+		}
+		if tok.Kind == lexer.COMMENT {
+			p.file.Comments = append(p.file.Comments, &Comment{
+				Span: Span{Start: tok.Pos, Stop: tok.End},
+				Text: tok.Value,
+			})
+			continue
+		}
+		p.toks = append(p.toks, tok)
+		if tok.Kind == lexer.EOF {
+			p.file.Span = Span{Stop: tok.End}
+			p.file.Start.Line = 1
+			p.file.Start.Column = 1
+			break
+		}
+	}
+
+	for p.idx < len(p.toks) && p.toks[p.idx].Kind != lexer.EOF {
+		s, ok := p.read()
+		if !ok {
+			break
+		}
+		p.topLevel(s)
+	}
+	if len(p.errors) > 0 {
+		return p.file, p.errors
+	}
+	return p.file, nil
+}
+
+// ParseString parses CLIPS source held in a string
+func ParseString(src string) (*File, error) {
+	return ParseFile("", []byte(src))
+}
+
+// ParseExpr parses a single expression, such as a function call
+func ParseExpr(src string) (Expr, error) {
+	p := &parser{module: "MAIN"}
+	toks, err := lexer.Tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, tok := range toks {
+		if tok.Kind != lexer.COMMENT {
+			p.toks = append(p.toks, tok)
+		}
+	}
+	if len(p.toks) == 0 {
+		return nil, &lexer.Error{Pos: lexer.Pos{Line: 1, Column: 1}, Msg: "empty expression"}
+	}
+	s, ok := p.read()
+	if !ok {
+		return nil, p.errors
+	}
+	if p.idx < len(p.toks) {
+		return nil, &lexer.Error{Pos: p.toks[p.idx].Pos, Msg: "unexpected " + p.toks[p.idx].Value}
+	}
+	var ret Expr
+	if !p.guard(func() { ret = p.expr(s) }) {
+		return nil, p.errors
+	}
+	return ret, nil
+}
+
+func (p *parser) errorf(pos lexer.Pos, format string, args ...interface{}) {
+	p.errors = append(p.errors, &lexer.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// fail records an error and abandons the current construct
+func (p *parser) fail(pos lexer.Pos, format string, args ...interface{}) {
+	p.errorf(pos, format, args...)
+	panic(bailout{})
+}
+
+// guard runs fn, returning false if it bailed out
+func (p *parser) guard(fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isBailout := r.(bailout); !isBailout {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// read builds the next complete expression from the token stream
+func (p *parser) read() (*sexp, bool) {
+	tok := p.toks[p.idx]
+	p.idx++
+	switch tok.Kind {
+	case lexer.RPAREN:
+		p.errorf(tok.Pos, "unexpected )")
+		return nil, false
+	case lexer.EOF:
+		p.errorf(tok.Pos, "unexpected end of input")
+		return nil, false
+	case lexer.LPAREN:
+		s := &sexp{tok: tok, list: true}
+		for {
+			if p.idx >= len(p.toks) || p.toks[p.idx].Kind == lexer.EOF {
+				p.errorf(tok.Pos, "unbalanced (")
+				return nil, false
+			}
+			if p.toks[p.idx].Kind == lexer.RPAREN {
+				s.end = p.toks[p.idx].End
+				p.idx++
+				return s, true
+			}
+			elem, ok := p.read()
+			if !ok {
+				return nil, false
+			}
+			s.elems = append(s.elems, elem)
+		}
+	}
+	return &sexp{tok: tok, end: tok.End}, true
+}
+
+func (p *parser) topLevel(s *sexp) {
+	keyword := s.head()
+	if !lexer.IsConstruct(keyword) {
+		p.guard(func() {
+			p.file.Commands = append(p.file.Commands, p.expr(s))
+		})
+		return
+	}
+	var c Construct
+	if !p.guard(func() { c = p.construct(keyword, s) }) {
+		return
+	}
+	h := c.Header()
+	h.Span = s.span()
+	if h.Name != nil && h.Name.Module != "" {
+		h.Module = h.Name.Module
+	} else if h.Module == "" {
+		h.Module = p.module
+	}
+	if dm, ok := c.(*Defmodule); ok {
+		h.Module = dm.Name.Name
+		p.module = dm.Name.Name
+	}
+	p.file.Constructs = append(p.file.Constructs, c)
+}
+
+func (p *parser) construct(keyword string, s *sexp) Construct {
+	switch keyword {
+	case "defrule":
+		return p.defrule(s)
+	case "deftemplate":
+		return p.deftemplate(s)
+	case "defclass":
+		return p.defclass(s)
+	case "deffunction":
+		return p.deffunction(s)
+	case "defgeneric":
+		h, _ := p.header(s, 1)
+		return &Defgeneric{ConstructHeader: h}
+	case "defmethod":
+		return p.defmethod(s)
+	case "defmessage-handler":
+		return p.defmessageHandler(s)
+	case "defglobal":
+		return p.defglobal(s)
+	case "deffacts":
+		return p.deffacts(s)
+	case "definstances":
+		return p.definstances(s)
+	case "defmodule":
+		return p.defmodule(s)
+	}
+	p.fail(s.tok.Pos, "unknown construct %s", keyword)
+	return nil
+}
+
+// header parses the construct name at index at and an optional comment, returning the
+// index of the first element that follows
+func (p *parser) header(s *sexp, at int) (ConstructHeader, int) {
+	if at >= len(s.elems) {
+		p.fail(s.closing(), "expected %s name", s.head())
+	}
+	h := ConstructHeader{Name: p.ident(s.elems[at])}
+	at++
+	if at < len(s.elems) && !s.elems[at].list && s.elems[at].tok.Kind == lexer.STRING {
+		h.Comment = unquote(s.elems[at].tok.Value)
+		at++
+	}
+	return h, at
+}
+
+// ident interprets a symbol as a possibly module-qualified name
+func (p *parser) ident(s *sexp) *Ident {
+	if !s.isSymbol() {
+		p.fail(s.tok.Pos, "expected a name, found %s", describe(s))
+	}
+	id := &Ident{Span: s.span(), Name: s.tok.Value}
+	if idx := strings.Index(id.Name, "::"); idx >= 0 {
+		id.Module = id.Name[:idx]
+		id.Name = id.Name[idx+2:]
+	}
+	return id
+}
+
+func (p *parser) expr(s *sexp) Expr {
+	if !s.list {
+		switch s.tok.Kind {
+		case lexer.VARIABLE, lexer.GLOBAL_VARIABLE:
+			return variable(s)
+		}
+		return &Constant{Span: s.span(), Kind: s.tok.Kind, Value: s.tok.Value}
+	}
+	if len(s.elems) > 0 && s.elems[0].isSymbol() {
+		return &Call{
+			Span:     s.span(),
+			Function: p.ident(s.elems[0]),
+			Args:     p.exprs(s.elems[1:]),
+		}
+	}
+	return &List{Span: s.span(), Elems: p.exprs(s.elems)}
+}
+
+func (p *parser) exprs(elems []*sexp) []Expr {
+	ret := make([]Expr, 0, len(elems))
+	for _, e := range elems {
+		ret = append(ret, p.expr(e))
+	}
+	return ret
+}
+
+func (p *parser) variable(s *sexp) *Variable {
+	if s.list || (s.tok.Kind != lexer.VARIABLE && s.tok.Kind != lexer.GLOBAL_VARIABLE) {
+		p.fail(s.tok.Pos, "expected a variable, found %s", describe(s))
+	}
+	return variable(s)
+}
+
+func variable(s *sexp) *Variable {
+	v := &Variable{Span: s.span()}
+	name := s.tok.Value
+	if strings.HasPrefix(name, "$") {
+		v.Multifield = true
+		name = name[1:]
+	}
+	name = strings.TrimPrefix(name, "?")
+	if s.tok.Kind == lexer.GLOBAL_VARIABLE {
+		v.Global = true
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "*"), "*")
+	}
+	v.Name = name
+	return v
+}
+
+func describe(s *sexp) string {
+	if s.list {
+		return "a list"
+	}
+	return s.tok.Value
+}
+
+func unquote(str string) string {
+	if ret, err := strconv.Unquote(str); err == nil {
+		return ret
+	}
+	return strings.Trim(str, `"`)
+}
+
+func (p *parser) defrule(s *sexp) *Defrule {
+	h, at := p.header(s, 1)
+	ret := &Defrule{ConstructHeader: h}
+	if at < len(s.elems) && s.elems[at].head() == "declare" {
+		for _, decl := range s.elems[at].elems[1:] {
+			if !decl.list || len(decl.elems) != 2 {
+				p.fail(decl.tok.Pos, "invalid rule declaration")
+			}
+			switch decl.head() {
+			case "salience":
+				ret.Salience = p.expr(decl.elems[1])
+			case "auto-focus":
+				ret.AutoFocus = p.expr(decl.elems[1])
+			default:
+				p.fail(decl.tok.Pos, "unknown rule declaration %s", decl.head())
+			}
+		}
+		at++
+	}
+	arrow := -1
+	for ii := at; ii < len(s.elems); ii++ {
+		if s.elems[ii].isAtom("=>") {
+			arrow = ii
+			break
+		}
+	}
+	if arrow < 0 {
+		p.fail(s.closing(), "expected => in defrule %s", h.Name.Name)
+	}
+	ret.LHS = p.ces(s.elems[at:arrow])
+	ret.RHS = p.exprs(s.elems[arrow+1:])
+	return ret
+}
+
+func (p *parser) deftemplate(s *sexp) *Deftemplate {
+	h, at := p.header(s, 1)
+	ret := &Deftemplate{ConstructHeader: h}
+	for _, e := range s.elems[at:] {
+		switch e.head() {
+		case "slot", "field":
+			ret.Slots = append(ret.Slots, p.slot(e, false))
+		case "multislot", "multifield":
+			ret.Slots = append(ret.Slots, p.slot(e, true))
+		default:
+			p.fail(e.tok.Pos, "expected slot definition, found %s", describe(e))
+		}
+	}
+	return ret
+}
+
+func (p *parser) slot(s *sexp, multi bool) *Slot {
+	if len(s.elems) < 2 {
+		p.fail(s.tok.Pos, "expected slot name")
+	}
+	ret := &Slot{Span: s.span(), Multi: multi, Name: p.ident(s.elems[1])}
+	for _, e := range s.elems[2:] {
+		if !e.list || len(e.elems) == 0 || !e.elems[0].isSymbol() {
+			p.fail(e.tok.Pos, "expected slot attribute, found %s", describe(e))
+		}
+		ret.Attributes = append(ret.Attributes, &Attribute{
+			Span:   e.span(),
+			Name:   e.elems[0].tok.Value,
+			Values: p.exprs(e.elems[1:]),
+		})
+	}
+	return ret
+}
+
+func (p *parser) defclass(s *sexp) *Defclass {
+	h, at := p.header(s, 1)
+	ret := &Defclass{ConstructHeader: h}
+	for _, e := range s.elems[at:] {
+		switch e.head() {
+		case "is-a":
+			for _, super := range e.elems[1:] {
+				ret.Superclasses = append(ret.Superclasses, p.ident(super))
+			}
+		case "role":
+			ret.Role = p.symbolArg(e)
+		case "pattern-match":
+			ret.PatternMatch = p.symbolArg(e)
+		case "slot", "single-slot":
+			ret.Slots = append(ret.Slots, p.slot(e, false))
+		case "multislot":
+			ret.Slots = append(ret.Slots, p.slot(e, true))
+		case "message-handler":
+			if len(e.elems) < 2 || len(e.elems) > 3 {
+				p.fail(e.tok.Pos, "invalid message-handler declaration")
+			}
+			decl := &HandlerDecl{Span: e.span(), Name: p.ident(e.elems[1]), Type: "primary"}
+			if len(e.elems) == 3 {
+				decl.Type = p.ident(e.elems[2]).Name
+			}
+			ret.Handlers = append(ret.Handlers, decl)
+		default:
+			p.fail(e.tok.Pos, "unexpected %s in defclass", describe(e))
+		}
+	}
+	return ret
+}
+
+func (p *parser) symbolArg(s *sexp) string {
+	if len(s.elems) != 2 || !s.elems[1].isSymbol() {
+		p.fail(s.tok.Pos, "expected a single symbol for %s", s.head())
+	}
+	return s.elems[1].tok.Value
+}
+
+// params parses a parameter list of variables, the last of which may be a multifield wildcard
+func (p *parser) params(s *sexp) ([]*Variable, *Variable) {
+	if !s.list {
+		p.fail(s.tok.Pos, "expected parameter list, found %s", describe(s))
+	}
+	var params []*Variable
+	for ii, e := range s.elems {
+		v := p.variable(e)
+		if v.Global {
+			p.fail(e.tok.Pos, "global variable %s is not a valid parameter", v)
+		}
+		if v.Multifield {
+			if ii != len(s.elems)-1 {
+				p.fail(e.tok.Pos, "wildcard parameter %s must be last", v)
+			}
+			return params, v
+		}
+		params = append(params, v)
+	}
+	return params, nil
+}
+
+func (p *parser) deffunction(s *sexp) *Deffunction {
+	h, at := p.header(s, 1)
+	if at >= len(s.elems) {
+		p.fail(s.closing(), "expected parameter list")
+	}
+	ret := &Deffunction{ConstructHeader: h}
+	ret.Params, ret.Wildcard = p.params(s.elems[at])
+	ret.Body = p.exprs(s.elems[at+1:])
+	return ret
+}
+
+func (p *parser) defmethod(s *sexp) *Defmethod {
+	if len(s.elems) < 2 {
+		p.fail(s.closing(), "expected defmethod name")
+	}
+	ret := &Defmethod{}
+	ret.Name = p.ident(s.elems[1])
+	at := 2
+	if at < len(s.elems) && !s.elems[at].list && s.elems[at].tok.Kind == lexer.INTEGER {
+		ret.Index, _ = strconv.Atoi(s.elems[at].tok.Value)
+		at++
+	}
+	if at < len(s.elems) && !s.elems[at].list && s.elems[at].tok.Kind == lexer.STRING {
+		ret.Comment = unquote(s.elems[at].tok.Value)
+		at++
+	}
+	if at >= len(s.elems) || !s.elems[at].list {
+		p.fail(s.closing(), "expected parameter list")
+	}
+	params := s.elems[at].elems
+	for ii, e := range params {
+		param := &MethodParam{Span: e.span()}
+		if e.list {
+			if len(e.elems) == 0 {
+				p.fail(e.tok.Pos, "expected parameter restriction")
+			}
+			param.Var = p.variable(e.elems[0])
+			for _, r := range e.elems[1:] {
+				if r.isSymbol() {
+					param.Types = append(param.Types, p.ident(r))
+				} else if param.Query == nil {
+					param.Query = p.expr(r)
+				} else {
+					p.fail(r.tok.Pos, "unexpected %s in parameter restriction", describe(r))
+				}
+			}
+		} else {
+			param.Var = p.variable(e)
+		}
+		if param.Var.Multifield {
+			if ii != len(params)-1 {
+				p.fail(e.tok.Pos, "wildcard parameter %s must be last", param.Var)
+			}
+			ret.Wildcard = param
+			break
+		}
+		ret.Params = append(ret.Params, param)
+	}
+	ret.Body = p.exprs(s.elems[at+1:])
+	return ret
+}
+
+func (p *parser) defmessageHandler(s *sexp) *DefmessageHandler {
+	if len(s.elems) < 3 {
+		p.fail(s.closing(), "expected class and message names")
+	}
+	ret := &DefmessageHandler{Class: p.ident(s.elems[1]), HandlerType: "primary"}
+	ret.Name = p.ident(s.elems[2])
+	at := 3
+	if at < len(s.elems) && s.elems[at].isSymbol() {
+		ret.HandlerType = s.elems[at].tok.Value
+		at++
+	}
+	if at < len(s.elems) && !s.elems[at].list && s.elems[at].tok.Kind == lexer.STRING {
+		ret.Comment = unquote(s.elems[at].tok.Value)
+		at++
+	}
+	if at >= len(s.elems) {
+		p.fail(s.closing(), "expected parameter list")
+	}
+	ret.Params, ret.Wildcard = p.params(s.elems[at])
+	ret.Body = p.exprs(s.elems[at+1:])
+	return ret
+}
+
+func (p *parser) defglobal(s *sexp) *Defglobal {
+	ret := &Defglobal{}
+	at := 1
+	if at < len(s.elems) && s.elems[at].isSymbol() {
+		ret.Module = s.elems[at].tok.Value
+		at++
+	}
+	for at < len(s.elems) {
+		e := s.elems[at]
+		if e.list || e.tok.Kind != lexer.GLOBAL_VARIABLE {
+			p.fail(e.tok.Pos, "expected global variable, found %s", describe(e))
+		}
+		if at+2 >= len(s.elems) || !s.elems[at+1].isAtom("=") {
+			p.fail(e.end, "expected = and a value for %s", e.tok.Value)
+		}
+		value := s.elems[at+2]
+		ret.Globals = append(ret.Globals, &GlobalAssignment{
+			Span:  Span{Start: e.tok.Pos, Stop: value.end},
+			Var:   variable(e),
+			Value: p.expr(value),
+		})
+		at += 3
+	}
+	return ret
+}
+
+func (p *parser) deffacts(s *sexp) *Deffacts {
+	h, at := p.header(s, 1)
+	ret := &Deffacts{ConstructHeader: h}
+	for _, e := range s.elems[at:] {
+		call, ok := p.expr(e).(*Call)
+		if !ok {
+			p.fail(e.tok.Pos, "expected a fact, found %s", describe(e))
+		}
+		ret.Facts = append(ret.Facts, FactFromCall(call))
+	}
+	return ret
+}
+
+func (p *parser) definstances(s *sexp) *Definstances {
+	h, at := p.header(s, 1)
+	ret := &Definstances{ConstructHeader: h}
+	if at < len(s.elems) && s.elems[at].isAtom("active") {
+		ret.Active = true
+		at++
+		if at < len(s.elems) && !s.elems[at].list && s.elems[at].tok.Kind == lexer.STRING {
+			ret.Comment = unquote(s.elems[at].tok.Value)
+			at++
+		}
+	}
+	for _, e := range s.elems[at:] {
+		if !e.list {
+			p.fail(e.tok.Pos, "expected an instance, found %s", describe(e))
+		}
+		inst := instanceDef(e.span(), p.exprs(e.elems))
+		if inst == nil {
+			p.fail(e.tok.Pos, "expected (name of class slot-overrides...)")
+		}
+		ret.Instances = append(ret.Instances, inst)
+	}
+	return ret
+}
+
+func (p *parser) defmodule(s *sexp) *Defmodule {
+	h, at := p.header(s, 1)
+	ret := &Defmodule{ConstructHeader: h}
+	for _, e := range s.elems[at:] {
+		switch e.head() {
+		case "import":
+			if len(e.elems) < 3 || !e.elems[1].isSymbol() {
+				p.fail(e.tok.Pos, "expected (import module-name port-specification)")
+			}
+			spec := p.portSpec(e, e.elems[2:])
+			spec.Module = e.elems[1].tok.Value
+			ret.Imports = append(ret.Imports, spec)
+		case "export":
+			ret.Exports = append(ret.Exports, p.portSpec(e, e.elems[1:]))
+		default:
+			p.fail(e.tok.Pos, "unexpected %s in defmodule", describe(e))
+		}
+	}
+	return ret
+}
+
+func (p *parser) portSpec(s *sexp, elems []*sexp) *PortSpec {
+	ret := &PortSpec{Span: s.span()}
+	if len(elems) == 0 {
+		p.fail(s.closing(), "expected port specification")
+	}
+	if !elems[0].list && (elems[0].tok.Value == "?ALL" || elems[0].tok.Value == "?NONE") {
+		ret.All = elems[0].tok.Value == "?ALL"
+		ret.None = !ret.All
+		return ret
+	}
+	ret.Construct = p.ident(elems[0]).Name
+	if len(elems) < 2 {
+		p.fail(s.closing(), "expected ?ALL, ?NONE or construct names")
+	}
+	for _, e := range elems[1:] {
+		switch {
+		case e.isAtom("?ALL"):
+			ret.All = true
+		case e.isAtom("?NONE"):
+			ret.None = true
+		default:
+			ret.Names = append(ret.Names, p.ident(e))
+		}
+	}
+	return ret
+}
+
+// FactFromCall interprets the arguments of an assert, or an element of deffacts, as a fact.
+// A fact whose values are all lists is taken to be a template fact
+func FactFromCall(c *Call) *Fact {
+	ret := &Fact{Span: c.Span, Template: c.Function}
+	slotted := len(c.Args) > 0
+	for _, arg := range c.Args {
+		if _, ok := arg.(*Call); !ok {
+			slotted = false
+			break
+		}
+	}
+	if !slotted {
+		ret.Values = c.Args
+		return ret
+	}
+	for _, arg := range c.Args {
+		call := arg.(*Call)
+		ret.Slots = append(ret.Slots, &SlotValue{Span: call.Span, Name: call.Function, Values: call.Args})
+	}
+	return ret
+}
+
+// InstanceFromCall interprets a make-instance call as an instance definition, returning nil
+// if it is not of the form (make-instance [name] of class slot-overrides...)
+func InstanceFromCall(c *Call) *InstanceDef {
+	return instanceDef(c.Span, c.Args)
+}
+
+func instanceDef(span Span, elems []Expr) *InstanceDef {
+	ret := &InstanceDef{Span: span}
+	at := 0
+	if at < len(elems) && !isSymbol(elems[at], "of") {
+		ret.Name = elems[at]
+		at++
+	}
+	if at+1 >= len(elems) || !isSymbol(elems[at], "of") {
+		return nil
+	}
+	class, ok := elems[at+1].(*Constant)
+	if !ok || class.Kind != lexer.SYMBOL {
+		return nil
+	}
+	ret.Class = &Ident{Span: class.Span, Name: class.Value}
+	if idx := strings.Index(class.Value, "::"); idx >= 0 {
+		ret.Class.Module = class.Value[:idx]
+		ret.Class.Name = class.Value[idx+2:]
+	}
+	for _, e := range elems[at+2:] {
+		call, ok := e.(*Call)
+		if !ok {
+			return nil
+		}
+		ret.Slots = append(ret.Slots, &SlotValue{Span: call.Span, Name: call.Function, Values: call.Args})
+	}
+	return ret
+}
+
+func isSymbol(e Expr, value string) bool {
+	c, ok := e.(*Constant)
+	return ok && c.Kind == lexer.SYMBOL && c.Value == value
+}
@@ -0,0 +1,260 @@
+package parser
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
+	"gotest.tools/assert"
+)
+
+func parseOne(t *testing.T, src string) Construct {
+	file, err := ParseString(src)
+	assert.NilError(t, err)
+	assert.Equal(t, len(file.Constructs), 1)
+	return file.Constructs[0]
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Testdata", func(t *testing.T) {
+		src, err := ioutil.ReadFile("../testdata/dopey.clp")
+		assert.NilError(t, err)
+		file, err := ParseFile("dopey.clp", src)
+		assert.NilError(t, err)
+		assert.Equal(t, len(file.Constructs), 3)
+		assert.Equal(t, len(file.Comments), 4)
+
+		tmpl := file.Constructs[0].(*Deftemplate)
+		assert.Equal(t, tmpl.Name.Name, "prospect")
+		assert.Equal(t, tmpl.Module, "MAIN")
+		assert.Equal(t, len(tmpl.Slots), 3)
+		assert.Assert(t, tmpl.Slots[0].Multi)
+		assert.DeepEqual(t, tmpl.Slots[1].Types(), []string{"SYMBOL"})
+		assert.Equal(t, len(tmpl.Slots[1].Attribute("allowed-symbols").Values), 4)
+		assert.Equal(t, tmpl.Slots[2].Pos().String(), "9:5")
+
+		rule := file.Constructs[1].(*Defrule)
+		assert.Equal(t, rule.Name.Name, "happy_relationship")
+		assert.Equal(t, len(rule.RHS), 1)
+		pattern := rule.LHS[0].(*PatternCE)
+		assert.Equal(t, pattern.Template.Name, "prospect")
+		assert.Equal(t, len(pattern.Slots), 3)
+		v := pattern.Slots[0].Fields[0].Alternatives[0][0].Value.(*Variable)
+		assert.Equal(t, v.Name, "name")
+		assert.Assert(t, v.Multifield)
+
+		facts := file.Constructs[2].(*Deffacts)
+		assert.Equal(t, len(facts.Facts), 1)
+		assert.Equal(t, facts.Facts[0].Slots[0].Name.Name, "name")
+		assert.Equal(t, len(facts.Facts[0].Slots[0].Values), 2)
+
+		src, err = ioutil.ReadFile("../testdata/dopey.save")
+		assert.NilError(t, err)
+		file, err = ParseFile("dopey.save", src)
+		assert.NilError(t, err)
+		assert.Equal(t, file.Constructs[0].Header().Name.Module, "MAIN")
+	})
+
+	t.Run("Rule", func(t *testing.T) {
+		rule := parseOne(t, `(defrule r "doc"
+   (declare (salience 10) (auto-focus TRUE))
+   ?f <- (a ?x&:(> ?x 1)|~red $?)
+   (not (b ?x))
+   (or (c) (and (d) (test (eq 1 1))))
+   (object (is-a Foo) (bar =(+ 1 2)))
+   =>
+   (retract ?f))`).(*Defrule)
+		assert.Equal(t, rule.Comment, "doc")
+		assert.Equal(t, rule.Salience.(*Constant).Value, "10")
+		assert.Equal(t, rule.AutoFocus.(*Constant).Value, "TRUE")
+		assert.Equal(t, len(rule.LHS), 4)
+
+		a := rule.LHS[0].(*PatternCE)
+		assert.Equal(t, a.Binding.Name, "f")
+		assert.Equal(t, a.Pos().Column, 4)
+		assert.Equal(t, len(a.Fields), 2)
+		c := a.Fields[0]
+		assert.Equal(t, len(c.Alternatives), 2)
+		assert.Equal(t, c.Alternatives[0][0].Kind, VARIABLE_TERM)
+		assert.Equal(t, c.Alternatives[0][1].Kind, PREDICATE_TERM)
+		assert.Equal(t, c.Alternatives[0][1].Value.(*Call).Function.Name, ">")
+		assert.Assert(t, c.Alternatives[1][0].Not)
+		assert.Equal(t, c.Alternatives[1][0].Kind, LITERAL_TERM)
+		assert.Equal(t, a.Fields[1].Alternatives[0][0].Value.(*Variable).Name, "")
+
+		not := rule.LHS[1].(*GroupCE)
+		assert.Equal(t, not.Kind, "not")
+		or := rule.LHS[2].(*GroupCE)
+		assert.Equal(t, or.CEs[1].(*GroupCE).CEs[1].(*TestCE).Expr.(*Call).Function.Name, "eq")
+
+		obj := rule.LHS[3].(*PatternCE)
+		assert.Assert(t, obj.Object)
+		assert.Equal(t, obj.Slots[0].Name.Name, "is-a")
+		assert.Equal(t, obj.Slots[1].Fields[0].Alternatives[0][0].Kind, RETURN_VALUE_TERM)
+	})
+
+	t.Run("Class and handlers", func(t *testing.T) {
+		file, err := ParseString(`
+(defclass Foo "a class" (is-a USER Bar)
+   (role concrete)
+   (pattern-match reactive)
+   (slot a (type INTEGER) (access read-write))
+   (multislot b)
+   (message-handler greet before))
+(defmessage-handler Foo greet before (?who $?rest)
+   (printout t ?who crlf))`)
+		assert.NilError(t, err)
+		class := file.Constructs[0].(*Defclass)
+		assert.Equal(t, class.Comment, "a class")
+		assert.Equal(t, len(class.Superclasses), 2)
+		assert.Equal(t, class.Role, "concrete")
+		assert.Equal(t, class.PatternMatch, "reactive")
+		assert.Equal(t, len(class.Slots), 2)
+		assert.Equal(t, class.Handlers[0].Type, "before")
+
+		handler := file.Constructs[1].(*DefmessageHandler)
+		assert.Equal(t, handler.Class.Name, "Foo")
+		assert.Equal(t, handler.Name.Name, "greet")
+		assert.Equal(t, handler.HandlerType, "before")
+		assert.Equal(t, len(handler.Params), 1)
+		assert.Equal(t, handler.Wildcard.Name, "rest")
+	})
+
+	t.Run("Functions and generics", func(t *testing.T) {
+		file, err := ParseString(`
+(deffunction add (?a ?b $?more) (+ ?a ?b))
+(defgeneric area "doc")
+(defmethod area 2 ((?s SQUARE RECTANGLE (> ?s 0)) ?scale ($?rest NUMBER)) (* ?s ?s))`)
+		assert.NilError(t, err)
+		fn := file.Constructs[0].(*Deffunction)
+		assert.Equal(t, len(fn.Params), 2)
+		assert.Equal(t, fn.Wildcard.Name, "more")
+		assert.Equal(t, len(fn.Body), 1)
+
+		gen := file.Constructs[1].(*Defgeneric)
+		assert.Equal(t, gen.Name.Name, "area")
+		assert.Equal(t, gen.Comment, "doc")
+
+		method := file.Constructs[2].(*Defmethod)
+		assert.Equal(t, method.Index, 2)
+		assert.Equal(t, len(method.Params), 2)
+		assert.Equal(t, len(method.Params[0].Types), 2)
+		assert.Equal(t, method.Params[0].Query.(*Call).Function.Name, ">")
+		assert.Equal(t, method.Wildcard.Types[0].Name, "NUMBER")
+	})
+
+	t.Run("Globals, instances and modules", func(t *testing.T) {
+		file, err := ParseString(`
+(defglobal ?*x* = 3 ?*y* = (create$ a b))
+(defmodule A (export deftemplate foo bar) (import MAIN ?ALL))
+(defglobal A ?*z* = 0)
+(definstances people active (joe of Person (age 3)) (of Person))
+(deftemplate MAIN::thing)
+(reset)`)
+		assert.NilError(t, err)
+		global := file.Constructs[0].(*Defglobal)
+		assert.Equal(t, len(global.Globals), 2)
+		assert.Assert(t, global.Globals[0].Var.Global)
+		assert.Equal(t, global.Globals[0].Var.Name, "x")
+		assert.Equal(t, global.Globals[1].Value.(*Call).Function.Name, "create$")
+
+		module := file.Constructs[1].(*Defmodule)
+		assert.Equal(t, module.Exports[0].Construct, "deftemplate")
+		assert.Equal(t, len(module.Exports[0].Names), 2)
+		assert.Equal(t, module.Imports[0].Module, "MAIN")
+		assert.Assert(t, module.Imports[0].All)
+
+		assert.Equal(t, file.Constructs[2].Header().Module, "A")
+		insts := file.Constructs[3].(*Definstances)
+		assert.Equal(t, insts.Module, "A")
+		assert.Assert(t, insts.Active)
+		assert.Equal(t, insts.Instances[0].Name.(*Constant).Value, "joe")
+		assert.Equal(t, insts.Instances[0].Class.Name, "Person")
+		assert.Equal(t, insts.Instances[0].Slots[0].Name.Name, "age")
+		assert.Assert(t, insts.Instances[1].Name == nil)
+		assert.Equal(t, file.Constructs[4].Header().Module, "MAIN")
+
+		assert.Equal(t, len(file.Commands), 1)
+		assert.Equal(t, file.Commands[0].(*Call).Function.Name, "reset")
+	})
+
+	t.Run("Errors are collected", func(t *testing.T) {
+		file, err := ParseString(`
+(deftemplate ok)
+(defrule broken (a) (b))
+(deffunction f (?a $?b ?c))
+(deftemplate also-ok)`)
+		assert.Equal(t, len(file.Constructs), 2)
+		errs := err.(ErrorList)
+		assert.Equal(t, len(errs), 2)
+		assert.Equal(t, errs[0].Error(), "3:24: expected => in defrule broken")
+		assert.ErrorContains(t, errs[1], "4:20: wildcard parameter $?b must be last")
+
+		_, err = ParseString("(defrule foo (a) =>")
+		assert.ErrorContains(t, err, "1:1: unbalanced (")
+	})
+
+	t.Run("Expressions", func(t *testing.T) {
+		expr, err := ParseExpr(`(assert (person (name "Joe") (age 3)))`)
+		assert.NilError(t, err)
+		fact := FactFromCall(expr.(*Call).Args[0].(*Call))
+		assert.Equal(t, fact.Template.Name, "person")
+		assert.Equal(t, len(fact.Slots), 2)
+
+		expr, err = ParseExpr(`(assert (count 1 ?x))`)
+		assert.NilError(t, err)
+		fact = FactFromCall(expr.(*Call).Args[0].(*Call))
+		assert.Equal(t, len(fact.Values), 2)
+
+		expr, err = ParseExpr(`(make-instance [joe] of Person (age 3))`)
+		assert.NilError(t, err)
+		inst := InstanceFromCall(expr.(*Call))
+		assert.Equal(t, inst.Class.Name, "Person")
+		assert.Equal(t, inst.Name.(*Constant).Kind, lexer.INSTANCE_NAME)
+
+		_, err = ParseExpr("(a) (b)")
+		assert.ErrorContains(t, err, "1:5: unexpected (")
+	})
+}
+
+func TestInspect(t *testing.T) {
+	file, err := ParseString(`(defrule r (a ?x) => (assert (b ?x)) (foo ?x))`)
+	assert.NilError(t, err)
+	var calls []string
+	vars := 0
+	Inspect(file, func(n Node) bool {
+		switch n := n.(type) {
+		case *Call:
+			calls = append(calls, n.Function.Name)
+		case *Variable:
+			vars++
+		}
+		return true
+	})
+	assert.DeepEqual(t, calls, []string{"assert", "b", "foo"})
+	assert.Equal(t, vars, 3)
+
+	idents := 0
+	Inspect(file, func(n Node) bool {
+		if _, ok := n.(*Ident); ok {
+			idents++
+		}
+		_, isCE := n.(CE)
+		return !isCE
+	})
+	assert.Equal(t, idents, 4)
+}
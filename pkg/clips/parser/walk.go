@@ -0,0 +1,199 @@
+package parser
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+// Inspect traverses the tree in depth-first order, calling f for each node. If f returns
+// false the children of that node are skipped
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	walkIdent := func(id *Ident) {
+		if id != nil {
+			Inspect(id, f)
+		}
+	}
+	walkExprs := func(exprs []Expr) {
+		for _, e := range exprs {
+			Inspect(e, f)
+		}
+	}
+	walkVars := func(vars []*Variable) {
+		for _, v := range vars {
+			Inspect(v, f)
+		}
+	}
+	walkSlotValues := func(slots []*SlotValue) {
+		for _, s := range slots {
+			Inspect(s, f)
+		}
+	}
+
+	switch n := node.(type) {
+	case *File:
+		for _, c := range n.Constructs {
+			Inspect(c, f)
+		}
+		walkExprs(n.Commands)
+	case *Call:
+		walkIdent(n.Function)
+		walkExprs(n.Args)
+	case *List:
+		walkExprs(n.Elems)
+	case *Defrule:
+		walkIdent(n.Name)
+		if n.Salience != nil {
+			Inspect(n.Salience, f)
+		}
+		if n.AutoFocus != nil {
+			Inspect(n.AutoFocus, f)
+		}
+		for _, ce := range n.LHS {
+			Inspect(ce, f)
+		}
+		walkExprs(n.RHS)
+	case *PatternCE:
+		if n.Binding != nil {
+			Inspect(n.Binding, f)
+		}
+		walkIdent(n.Template)
+		for _, c := range n.Fields {
+			Inspect(c, f)
+		}
+		for _, s := range n.Slots {
+			Inspect(s, f)
+		}
+	case *SlotConstraint:
+		walkIdent(n.Name)
+		for _, c := range n.Fields {
+			Inspect(c, f)
+		}
+	case *Constraint:
+		for _, alt := range n.Alternatives {
+			for _, term := range alt {
+				Inspect(term, f)
+			}
+		}
+	case *Term:
+		Inspect(n.Value, f)
+	case *TestCE:
+		Inspect(n.Expr, f)
+	case *GroupCE:
+		for _, ce := range n.CEs {
+			Inspect(ce, f)
+		}
+	case *Deftemplate:
+		walkIdent(n.Name)
+		for _, s := range n.Slots {
+			Inspect(s, f)
+		}
+	case *Slot:
+		walkIdent(n.Name)
+		for _, a := range n.Attributes {
+			Inspect(a, f)
+		}
+	case *Attribute:
+		walkExprs(n.Values)
+	case *Defclass:
+		walkIdent(n.Name)
+		for _, super := range n.Superclasses {
+			Inspect(super, f)
+		}
+		for _, s := range n.Slots {
+			Inspect(s, f)
+		}
+		for _, h := range n.Handlers {
+			Inspect(h, f)
+		}
+	case *HandlerDecl:
+		walkIdent(n.Name)
+	case *Deffunction:
+		walkIdent(n.Name)
+		walkVars(n.Params)
+		if n.Wildcard != nil {
+			Inspect(n.Wildcard, f)
+		}
+		walkExprs(n.Body)
+	case *Defgeneric:
+		walkIdent(n.Name)
+	case *Defmethod:
+		walkIdent(n.Name)
+		for _, param := range n.Params {
+			Inspect(param, f)
+		}
+		if n.Wildcard != nil {
+			Inspect(n.Wildcard, f)
+		}
+		walkExprs(n.Body)
+	case *MethodParam:
+		Inspect(n.Var, f)
+		for _, t := range n.Types {
+			Inspect(t, f)
+		}
+		if n.Query != nil {
+			Inspect(n.Query, f)
+		}
+	case *DefmessageHandler:
+		walkIdent(n.Class)
+		walkIdent(n.Name)
+		walkVars(n.Params)
+		if n.Wildcard != nil {
+			Inspect(n.Wildcard, f)
+		}
+		walkExprs(n.Body)
+	case *Defglobal:
+		for _, g := range n.Globals {
+			Inspect(g, f)
+		}
+	case *GlobalAssignment:
+		Inspect(n.Var, f)
+		Inspect(n.Value, f)
+	case *Deffacts:
+		walkIdent(n.Name)
+		for _, fact := range n.Facts {
+			Inspect(fact, f)
+		}
+	case *Fact:
+		walkIdent(n.Template)
+		walkExprs(n.Values)
+		walkSlotValues(n.Slots)
+	case *SlotValue:
+		walkIdent(n.Name)
+		walkExprs(n.Values)
+	case *Definstances:
+		walkIdent(n.Name)
+		for _, inst := range n.Instances {
+			Inspect(inst, f)
+		}
+	case *InstanceDef:
+		if n.Name != nil {
+			Inspect(n.Name, f)
+		}
+		walkIdent(n.Class)
+		walkSlotValues(n.Slots)
+	case *Defmodule:
+		walkIdent(n.Name)
+		for _, spec := range n.Imports {
+			Inspect(spec, f)
+		}
+		for _, spec := range n.Exports {
+			Inspect(spec, f)
+		}
+	case *PortSpec:
+		for _, name := range n.Names {
+			Inspect(name, f)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProfileMode is an enumeration of what the CLIPS profiler measures
+type ProfileMode int
+
+const (
+	PROFILE_OFF ProfileMode = iota
+	PROFILE_CONSTRUCTS
+	PROFILE_USER_FUNCTIONS
+)
+
+var clipsProfileModes = [...]string{
+	"off",
+	"constructs",
+	"user-functions",
+}
+
+// String returns the argument to (profile) for the mode, such as "constructs"
+func (mode ProfileMode) String() string {
+	if mode < 0 || int(mode) >= len(clipsProfileModes) {
+		return fmt.Sprintf("ProfileMode(%d)", int(mode))
+	}
+	return clipsProfileModes[int(mode)]
+}
+
+// ProfileEntry is the time spent in a rule, function or other construct while profiling
+type ProfileEntry struct {
+	// Kind is the heading CLIPS lists the entry under, such as "Defrules" or "Deffunctions"
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Calls int64  `json:"calls"`
+	// Self is the time spent in the entry itself, and Total includes the time spent in the
+	// functions and constructs it called
+	Self  time.Duration `json:"self_ns"`
+	Total time.Duration `json:"total_ns"`
+}
+
+// ProfileReport is the result of profiling, as printed by (profile-info)
+type ProfileReport struct {
+	Elapsed time.Duration  `json:"elapsed_ns"`
+	Entries []ProfileEntry `json:"entries"`
+}
+
+// Profile starts profiling constructs or user functions, or stops profiling with PROFILE_OFF.
+// Equivalent to (profile <mode>)
+func (env *Environment) Profile(mode ProfileMode) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	if mode < 0 || int(mode) >= len(clipsProfileModes) {
+		return fmt.Errorf("Invalid profile mode %d", int(mode))
+	}
+	ret, err := env.Eval(fmt.Sprintf("(profile %s)", mode))
+	if err != nil {
+		return err
+	}
+	if ret != true {
+		return EnvError(env, `Unable to set profile mode "%s"`, mode)
+	}
+	return nil
+}
+
+// ProfileReset clears the times and counts gathered by profiling. Equivalent to
+// (profile-reset)
+func (env *Environment) ProfileReset() error {
+	_, err := env.Eval("(profile-reset)")
+	return err
+}
+
+// ProfileReport returns the times and counts gathered by profiling so far
+func (env *Environment) ProfileReport() (*ProfileReport, error) {
+	out, _, err := env.Capture(func() error {
+		_, err := env.Eval("(profile-info)")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseProfileInfo(out), nil
+}
+
+var (
+	profileElapsed = regexp.MustCompile(`^Profile elapsed time = ([0-9.eE+-]+) seconds`)
+	profileHeading = regexp.MustCompile(`^\*\*\* (.+) \*\*\*$`)
+	profileRow     = regexp.MustCompile(`^(.+?)\s+(\d+)\s+([0-9.eE+-]+)\s+[0-9.]+%\s+([0-9.eE+-]+)\s+[0-9.]+%$`)
+)
+
+// parseProfileInfo parses the table printed by (profile-info)
+func parseProfileInfo(info string) *ProfileReport {
+	ret := &ProfileReport{Entries: []ProfileEntry{}}
+	kind := ""
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := profileElapsed.FindStringSubmatch(line); m != nil {
+			ret.Elapsed = seconds(m[1])
+		} else if m := profileHeading.FindStringSubmatch(line); m != nil {
+			kind = m[1]
+		} else if m := profileRow.FindStringSubmatch(line); m != nil && kind != "" {
+			calls, _ := strconv.ParseInt(m[2], 10, 64)
+			ret.Entries = append(ret.Entries, ProfileEntry{
+				Kind:  kind,
+				Name:  m[1],
+				Calls: calls,
+				Self:  seconds(m[3]),
+				Total: seconds(m[4]),
+			})
+		}
+	}
+	return ret
+}
+
+func seconds(s string) time.Duration {
+	val, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(val * float64(time.Second))
+}
+
+// Rules returns the entries for rules
+func (r *ProfileReport) Rules() []ProfileEntry {
+	ret := make([]ProfileEntry, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		if entry.Kind == "Defrules" {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+// Functions returns the entries for everything other than rules, such as deffunctions,
+// message handlers and user functions
+func (r *ProfileReport) Functions() []ProfileEntry {
+	ret := make([]ProfileEntry, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		if entry.Kind != "Defrules" {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+// WriteJSON writes the report as JSON. Times are given in nanoseconds
+func (r *ProfileReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WritePprof writes the report as a gzipped profile in the pprof format, for use with go tool
+// pprof. Each entry is a sample of its calls and its self and total time, with the kind of
+// entry as its file name. CLIPS does not record call stacks, so each sample is a single frame
+func (r *ProfileReport) WritePprof(w io.Writer) error {
+	strs := []string{""}
+	index := make(map[string]int64)
+	str := func(s string) uint64 {
+		if idx, ok := index[s]; ok || s == "" {
+			return uint64(idx)
+		}
+		index[s] = int64(len(strs))
+		strs = append(strs, s)
+		return uint64(index[s])
+	}
+
+	var profile protoBuffer
+	for _, vt := range [][2]string{{"calls", "count"}, {"self", "nanoseconds"}, {"total", "nanoseconds"}} {
+		var valueType protoBuffer
+		valueType.uint64Field(1, str(vt[0]))
+		valueType.uint64Field(2, str(vt[1]))
+		profile.bytesField(1, valueType.Bytes())
+	}
+	for ii, entry := range r.Entries {
+		id := uint64(ii + 1)
+
+		var sample protoBuffer
+		sample.packedField(1, []uint64{id})
+		sample.packedField(2, []uint64{uint64(entry.Calls), uint64(entry.Self), uint64(entry.Total)})
+		profile.bytesField(2, sample.Bytes())
+
+		var line, location protoBuffer
+		line.uint64Field(1, id)
+		location.uint64Field(1, id)
+		location.bytesField(4, line.Bytes())
+		profile.bytesField(4, location.Bytes())
+
+		var function protoBuffer
+		function.uint64Field(1, id)
+		function.uint64Field(2, str(entry.Name))
+		function.uint64Field(3, str(entry.Name))
+		function.uint64Field(4, str(entry.Kind))
+		profile.bytesField(5, function.Bytes())
+	}
+	for _, s := range strs {
+		profile.bytesField(6, []byte(s))
+	}
+	profile.uint64Field(10, uint64(r.Elapsed))
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes protocol buffer fields, enough to write a pprof profile
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.WriteByte(byte(x))
+}
+
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protoBuffer) packedField(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytesField(field, packed.Bytes())
+}
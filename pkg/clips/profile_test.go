@@ -0,0 +1,160 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+const profileInfo = `
+Profile elapsed time = 0.001234 seconds
+
+Construct Name               Entries   Time           %      Time+Kids     %+Kids
+-------------                -------   ------        -----   ---------     ------
+
+*** Deffunctions ***
+
+double                         3      0.000010    10.00%      0.000010    10.00%
+
+*** Defrules ***
+
+ship                           1      0.000020    20.00%      0.000030    30.00%
+`
+
+func TestProfile(t *testing.T) {
+	t.Run("Parse", func(t *testing.T) {
+		report := parseProfileInfo(profileInfo)
+		assert.Equal(t, report.Elapsed, 1234*time.Microsecond)
+		assert.DeepEqual(t, report.Rules(), []ProfileEntry{
+			{Kind: "Defrules", Name: "ship", Calls: 1, Self: 20 * time.Microsecond, Total: 30 * time.Microsecond},
+		})
+		assert.DeepEqual(t, report.Functions(), []ProfileEntry{
+			{Kind: "Deffunctions", Name: "double", Calls: 3, Self: 10 * time.Microsecond, Total: 10 * time.Microsecond},
+		})
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		report := parseProfileInfo(profileInfo)
+
+		var buf bytes.Buffer
+		err := report.WriteJSON(&buf)
+		assert.NilError(t, err)
+		var decoded ProfileReport
+		err = json.Unmarshal(buf.Bytes(), &decoded)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, &decoded, report)
+
+		buf.Reset()
+		err = report.WritePprof(&buf)
+		assert.NilError(t, err)
+		gz, err := gzip.NewReader(&buf)
+		assert.NilError(t, err)
+		data, err := ioutil.ReadAll(gz)
+		assert.NilError(t, err)
+		assert.Assert(t, bytes.Contains(data, []byte("ship")))
+		assert.Assert(t, bytes.Contains(data, []byte("nanoseconds")))
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(deffunction double (?x) (* ?x 2))`)
+		assert.NilError(t, err)
+		err = env.Build(`(defrule ship (order ?id) => (double ?id))`)
+		assert.NilError(t, err)
+
+		err = env.Profile(PROFILE_CONSTRUCTS)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(order 1)`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(order 2)`)
+		assert.NilError(t, err)
+		env.Run(-1)
+		err = env.Profile(PROFILE_OFF)
+		assert.NilError(t, err)
+
+		report, err := env.ProfileReport()
+		assert.NilError(t, err)
+		rules := report.Rules()
+		assert.Equal(t, len(rules), 1)
+		assert.Equal(t, rules[0].Name, "ship")
+		assert.Equal(t, rules[0].Calls, int64(2))
+		functions := report.Functions()
+		assert.Equal(t, len(functions), 1)
+		assert.Equal(t, functions[0].Name, "double")
+		assert.Equal(t, functions[0].Calls, int64(2))
+
+		err = env.ProfileReset()
+		assert.NilError(t, err)
+		err = env.Profile(ProfileMode(7))
+		assert.ErrorContains(t, err, "Invalid profile mode")
+	})
+}
+
+func TestRuleStats(t *testing.T) {
+	env := CreateEnvironment()
+	defer env.Delete()
+
+	err := env.Build(`(defrule ship (order ?id) => (assert (shipped ?id)))`)
+	assert.NilError(t, err)
+	err = env.Build(`(defrule bill (shipped ?id) => (printout t "bill " ?id crlf))`)
+	assert.NilError(t, err)
+	err = env.Build(`(defrule never (refund ?id) =>)`)
+	assert.NilError(t, err)
+
+	_, err = env.AssertString(`(order 1)`)
+	assert.NilError(t, err)
+	_, err = env.AssertString(`(order 2)`)
+	assert.NilError(t, err)
+	env.Run(1)
+	env.Run(-1)
+	_, err = env.AssertString(`(order 3)`)
+	assert.NilError(t, err)
+	err = env.SendCommand(`(run)`)
+	assert.NilError(t, err)
+	// firings are counted however the agenda is run
+	err = env.Build(`(deffunction process () (run))`)
+	assert.NilError(t, err)
+	_, err = env.AssertString(`(order 4)`)
+	assert.NilError(t, err)
+	_, err = env.Eval(`(process)`)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, env.RuleStats(), []RuleStat{
+		{Module: "MAIN", Rule: "ship", Fired: 4, Defined: true},
+		{Module: "MAIN", Rule: "bill", Fired: 4, Defined: true},
+		{Module: "MAIN", Rule: "never", Fired: 0, Defined: true},
+	})
+
+	rule, err := env.FindRule("ship")
+	assert.NilError(t, err)
+	err = rule.Undefine()
+	assert.NilError(t, err)
+	stats := env.RuleStats()
+	assert.Equal(t, len(stats), 3)
+	assert.DeepEqual(t, stats[2], RuleStat{Module: "MAIN", Rule: "ship", Fired: 4})
+
+	env.ResetRuleStats()
+	assert.Equal(t, len(env.RuleStats()), 2)
+	assert.Equal(t, env.RuleStats()[0].Fired, int64(0))
+}
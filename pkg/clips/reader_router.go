@@ -0,0 +1,136 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// InputRouter is a Router whose input can end. CLIPS reads from it with ReadInput instead of
+// Getc, so that the end of input is seen as EOF
+type InputRouter interface {
+	Router
+
+	// ReadInput returns the next character of input for the logical name, or io.EOF once the
+	// input has ended
+	ReadInput(name string) (byte, error)
+
+	// UnreadEOF pushes the end of input back, so that the next ReadInput returns io.EOF again
+	UnreadEOF(name string)
+}
+
+// ReaderRouter is a router serving input, such as stdin, from an io.Reader. Characters pushed
+// back by CLIPS are read again before any more are read from the reader
+type ReaderRouter struct {
+	core     *RouterCore
+	reader   io.ByteReader
+	pushback []int
+}
+
+// eof marks the end of input in the pushback stack
+const eof = -1
+
+// CreateReaderRouter returns a new router reading input for the given logical names, or for
+// stdin if none are given, from reader
+func CreateReaderRouter(env *Environment, reader io.Reader, names ...string) *ReaderRouter {
+	if len(names) == 0 {
+		names = []string{"stdin"}
+	}
+	byteReader, ok := reader.(io.ByteReader)
+	if !ok {
+		byteReader = bufio.NewReader(reader)
+	}
+	ret := &ReaderRouter{
+		reader: byteReader,
+	}
+	ret.core = CreateRouterCore(env, ret, uniqueRouterName(env, "go-reader-router"), names, 20)
+	return ret
+}
+
+// uniqueRouterName returns name, numbered if the environment already has a router of that name
+func uniqueRouterName(env *Environment, name string) string {
+	ret := name
+	for ii := 2; env.router[ret] != nil; ii++ {
+		ret = fmt.Sprintf("%s-%d", name, ii)
+	}
+	return ret
+}
+
+// Name of this router
+func (r *ReaderRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *ReaderRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true. Output to an input logical name
+// is discarded
+func (r *ReaderRouter) Print(name string, message string) {
+}
+
+// ReadInput returns the next character of input, or io.EOF once the reader is exhausted
+func (r *ReaderRouter) ReadInput(name string) (byte, error) {
+	if n := len(r.pushback); n > 0 {
+		ch := r.pushback[n-1]
+		r.pushback = r.pushback[:n-1]
+		if ch == eof {
+			return 0, io.EOF
+		}
+		return byte(ch), nil
+	}
+	return r.reader.ReadByte()
+}
+
+// UnreadEOF pushes the end of input back
+func (r *ReaderRouter) UnreadEOF(name string) {
+	r.pushback = append(r.pushback, eof)
+}
+
+// Getc is called by CLIPS to obtain a character from input. It returns 0 at the end of input;
+// use ReadInput to tell the end of input apart
+func (r *ReaderRouter) Getc(name string) byte {
+	ch, _ := r.ReadInput(name)
+	return ch
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *ReaderRouter) Ungetc(name string, ch byte) error {
+	r.pushback = append(r.pushback, int(ch))
+	return nil
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *ReaderRouter) Exit(exitcode int) {
+}
+
+// Activate activates this router with the Env
+func (r *ReaderRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *ReaderRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete removes this router from the Env
+func (r *ReaderRouter) Delete() error {
+	return r.core.Delete()
+}
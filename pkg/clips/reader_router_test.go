@@ -0,0 +1,97 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestReaderRouter(t *testing.T) {
+	t.Run("Pushback", func(t *testing.T) {
+		r := &ReaderRouter{reader: strings.NewReader("ab")}
+
+		ch, err := r.ReadInput("stdin")
+		assert.NilError(t, err)
+		assert.Equal(t, ch, byte('a'))
+		assert.NilError(t, r.Ungetc("stdin", 'a'))
+		assert.NilError(t, r.Ungetc("stdin", 'z'))
+
+		ch, _ = r.ReadInput("stdin")
+		assert.Equal(t, ch, byte('z'))
+		ch, _ = r.ReadInput("stdin")
+		assert.Equal(t, ch, byte('a'))
+		ch, _ = r.ReadInput("stdin")
+		assert.Equal(t, ch, byte('b'))
+
+		_, err = r.ReadInput("stdin")
+		assert.Equal(t, err, io.EOF)
+		r.UnreadEOF("stdin")
+		_, err = r.ReadInput("stdin")
+		assert.Equal(t, err, io.EOF)
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		router := CreateReaderRouter(env, strings.NewReader("12 ignored\napples\n\"a string\"\nthe whole line\n"))
+		defer router.Delete()
+
+		// reading from stdin discards the rest of the line
+		ret, err := env.Eval("(read)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(12))
+		ret, err = env.Eval("(read)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("apples"))
+		ret, err = env.Eval("(read)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "a string")
+		ret, err = env.Eval("(readline)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, "the whole line")
+
+		ret, err = env.Eval("(read)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("EOF"))
+		ret, err = env.Eval("(readline)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, Symbol("EOF"))
+	})
+
+	t.Run("Other logical names", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		router := CreateReaderRouter(env, strings.NewReader("12 apples\n"), "answers")
+		defer router.Delete()
+		assert.Equal(t, router.Name(), "go-reader-router")
+		other := CreateReaderRouter(env, strings.NewReader(""), "other")
+		defer other.Delete()
+		assert.Equal(t, other.Name(), "go-reader-router-2")
+
+		// the character after 12 is pushed back and read again by readline
+		ret, err := env.Eval("(read answers)")
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(12))
+		ret, err = env.Eval("(readline answers)")
+		assert.NilError(t, err)
+		assert.Equal(t, strings.TrimSpace(ret.(string)), "apples")
+	})
+}
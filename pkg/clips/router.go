@@ -106,10 +106,25 @@ func CreateRouterCore(env *Environment, routerimpl Router, name string, handled
 		ret.handled[v] = nil
 	}
 	env.router[name] = routerimpl
-	C.addRouter(env.env, ret.routername, C.int(priority), ret.routername)
+	C.addRouter(env.ptr(), ret.routername, C.int(priority), ret.routername)
 	return ret
 }
 
+// callEnder is implemented by routers which gather output into records, and pass on any record
+// still being gathered once a call into CLIPS ends
+type callEnder interface {
+	endCall()
+}
+
+// endCall tells the routers of the env that a call into CLIPS has ended
+func (env *Environment) endCall() {
+	for _, router := range env.router {
+		if ender, ok := router.(callEnder); ok {
+			ender.endCall()
+		}
+	}
+}
+
 // Name returns the name of the router
 func (r *RouterCore) Name() string {
 	return r.name
@@ -128,7 +143,7 @@ func (r *RouterCore) Print(name string, message string) {
 
 // Activate activates the router in the Environment
 func (r *RouterCore) Activate() error {
-	errcode := int(C.EnvActivateRouter(r.env.env, r.routername))
+	errcode := int(C.EnvActivateRouter(r.env.ptr(), r.routername))
 	if errcode != 1 {
 		return EnvError(r.env, "Failed to activate router")
 	}
@@ -137,7 +152,7 @@ func (r *RouterCore) Activate() error {
 
 // Deactivate deactives the router in the environment
 func (r *RouterCore) Deactivate() error {
-	errcode := int(C.EnvDeactivateRouter(r.env.env, r.routername))
+	errcode := int(C.EnvDeactivateRouter(r.env.ptr(), r.routername))
 	if errcode != 1 {
 		return EnvError(r.env, "Failed to deactivate router")
 	}
@@ -147,10 +162,11 @@ func (r *RouterCore) Deactivate() error {
 // Delete deletes the router from the environment
 func (r *RouterCore) Delete() error {
 	defer C.free(unsafe.Pointer(r.routername))
-	errcode := int(C.EnvDeleteRouter(r.env.env, r.routername))
+	errcode := int(C.EnvDeleteRouter(r.env.ptr(), r.routername))
 	if errcode != 1 {
 		return EnvError(r.env, "Failed to delete router")
 	}
+	delete(r.env.router, r.name)
 	return nil
 }
 
@@ -23,7 +23,7 @@ import "C"
 import "unsafe"
 
 func lookupRouter(envptr unsafe.Pointer) Router {
-	env := environmentObj[envptr]
+	env, _ := lookupEnvironment(envptr)
 	routername := C.GoString(C.getNameFromContext(envptr))
 	return env.router[routername]
 }
@@ -46,16 +46,29 @@ func printFunction(envptr unsafe.Pointer, name *C.char, message *C.char) C.int {
 
 //export getcFunction
 func getcFunction(envptr unsafe.Pointer, name *C.char) C.int {
-	return C.int(lookupRouter(envptr).Getc(C.GoString(name)))
+	router := lookupRouter(envptr)
+	if input, ok := router.(InputRouter); ok {
+		ch, err := input.ReadInput(C.GoString(name))
+		if err != nil {
+			return C.EOF
+		}
+		return C.int(ch)
+	}
+	return C.int(router.Getc(C.GoString(name)))
 }
 
 //export ungetcFunction
 func ungetcFunction(envptr unsafe.Pointer, ch C.int, name *C.char) C.int {
-	err := lookupRouter(envptr).Ungetc(C.GoString(name), byte(ch))
-	if err != nil {
+	router := lookupRouter(envptr)
+	if input, ok := router.(InputRouter); ok && ch == C.EOF {
+		input.UnreadEOF(C.GoString(name))
 		return ch
 	}
-	return C.EOF
+	err := router.Ungetc(C.GoString(name), byte(ch))
+	if err != nil {
+		return C.EOF
+	}
+	return ch
 }
 
 //export exitFunction
@@ -3,6 +3,25 @@ package clips
 // #cgo CFLAGS: -I ../../clips_source
 // #cgo LDFLAGS: -L ../../clips_source -l clips -lm
 // #include <clips/clips.h>
+//
+// static void *activation_module(void *activation)
+// {
+//     return ((struct activation *) activation)->theRule->header.whichModule->theModule;
+// }
+//
+// static int on_agenda(void *env, void *module, void *activation)
+// {
+//     struct defruleModule *item = (struct defruleModule *)
+//         GetModuleItem(env, (struct defmodule *) module, DefruleData(env)->DefruleModuleIndex);
+//     struct activation *act;
+//
+//     for (act = item->agenda; act != NULL; act = act->next) {
+//         if (act == activation) {
+//             return 1;
+//         }
+//     }
+//     return 0;
+// }
 import "C"
 /*
    Copyright 2020 Keysight Technologies
@@ -18,21 +37,33 @@ import "C"
    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 */
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 	"unsafe"
 )
 
-// Rule represents a rule within CLIPS
+// Rule represents a rule within CLIPS. Like every Construct, its methods without an error
+// result panic with ErrEnvironmentClosed after the environment is deleted
 type Rule struct {
-	env  *Environment
-	rptr unsafe.Pointer
+	env     *Environment
+	rptr    unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
 }
 
-// Activation represents an activation from the agenda
+// Activation represents an activation from the agenda. Once it leaves the agenda, Remove returns
+// ErrStale and its other methods zero values. After the environment is deleted, its methods
+// panic with ErrEnvironmentClosed, other than Remove, which returns it
 type Activation struct {
 	env    *Environment
 	actptr unsafe.Pointer
+	name   string
+	// modptr is the module of the rule, on whose agenda the activation is
+	modptr unsafe.Pointer
+	resets uint64
 }
 
 // Strategy is used to specify the conflict resolution strategy
@@ -115,66 +146,103 @@ func (sm Verbosity) CVal() C.int {
 
 // AgendaChanged returns true if any rule activation changes have occurred since last call
 func (env *Environment) AgendaChanged() bool {
-	ret := C.EnvGetAgendaChanged(env.env)
-	C.EnvSetAgendaChanged(env.env, 0)
+	ret := C.EnvGetAgendaChanged(env.ptr())
+	C.EnvSetAgendaChanged(env.ptr(), 0)
 	if ret == 1 {
 		return true
 	}
 	return false
 }
 
-// Focus returns the module associated with the current focus
+// Focus returns the module associated with the current focus, or nil if the focus stack is
+// empty
 func (env *Environment) Focus() *Module {
-	modptr := C.EnvGetFocus(env.env)
+	modptr := C.EnvGetFocus(env.ptr())
+	if modptr == nil {
+		return nil
+	}
 	return createModule(env, modptr)
 }
 
-// SetFocus sets the current focus to the given module
+// SetFocus sets the current focus to the given module. A stale module is ignored
 func (env *Environment) SetFocus(module *Module) {
 	if env != module.env {
 		panic("SetFocus to module from another environment")
 	}
-	C.EnvFocus(env.env, module.modptr)
+	if !valid(module.check()) {
+		return
+	}
+	C.EnvFocus(env.ptr(), module.modptr)
+}
+
+// FocusStack returns the modules on the focus stack, starting with the current focus
+func (env *Environment) FocusStack() []*Module {
+	data := createDataObject(env)
+	defer data.Delete()
+
+	C.EnvGetFocusStack(env.ptr(), data.byRef())
+	names, _ := data.Value().([]interface{})
+	ret := make([]*Module, 0, len(names))
+	for _, name := range names {
+		module, err := env.FindModule(fmt.Sprint(name))
+		if err == nil {
+			ret = append(ret, module)
+		}
+	}
+	return ret
+}
+
+// PopFocus removes the current focus from the focus stack and returns it, or nil if the stack
+// is empty
+func (env *Environment) PopFocus() *Module {
+	modptr := C.EnvPopFocus(env.ptr())
+	if modptr == nil {
+		return nil
+	}
+	return createModule(env, modptr)
 }
 
 // Strategy returns the current conflict resolution strategy
 func (env *Environment) Strategy() Strategy {
-	ret := C.EnvGetStrategy(env.env)
+	ret := C.EnvGetStrategy(env.ptr())
 	return Strategy(ret)
 }
 
 // SetStrategy sets the conflict resolution strategy
 func (env *Environment) SetStrategy(strategy Strategy) {
-	C.EnvSetStrategy(env.env, strategy.CVal())
+	C.EnvSetStrategy(env.ptr(), strategy.CVal())
 }
 
 // SalienceEvaluation returns the salience evaulation behavior
 func (env *Environment) SalienceEvaluation() SalienceEvaluation {
-	ret := C.EnvGetSalienceEvaluation(env.env)
+	ret := C.EnvGetSalienceEvaluation(env.ptr())
 	return SalienceEvaluation(ret)
 }
 
 // SetSalienceEvaluation sets the salience evaluation behavior
 func (env *Environment) SetSalienceEvaluation(val SalienceEvaluation) {
-	C.EnvSetSalienceEvaluation(env.env, val.CVal())
+	C.EnvSetSalienceEvaluation(env.ptr(), val.CVal())
 }
 
 // Rules returns the list of all rules in the CLIPS environment
 func (env *Environment) Rules() []*Rule {
-	rptr := C.EnvGetNextDefrule(env.env, nil)
+	rptr := C.EnvGetNextDefrule(env.ptr(), nil)
 	ret := make([]*Rule, 0, 10)
 	for rptr != nil {
 		ret = append(ret, createRule(env, rptr))
-		rptr = C.EnvGetNextDefrule(env.env, rptr)
+		rptr = C.EnvGetNextDefrule(env.ptr(), rptr)
 	}
 	return ret
 }
 
 // FindRule returns the rule of the given name
 func (env *Environment) FindRule(name string) (*Rule, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	rptr := C.EnvFindDefrule(env.env, cname)
+	rptr := C.EnvFindDefrule(env.ptr(), cname)
 	if rptr == nil {
 		return nil, NotFoundError(fmt.Errorf(`Rule "%s" not found`, name))
 	}
@@ -185,34 +253,56 @@ func (env *Environment) FindRule(name string) (*Rule, error) {
 func (env *Environment) Reorder(module *Module) {
 	var modptr unsafe.Pointer
 	if module != nil {
+		if !valid(module.check()) {
+			return
+		}
 		modptr = module.modptr
 	}
-	C.EnvReorderAgenda(env.env, modptr)
+	C.EnvReorderAgenda(env.ptr(), modptr)
 }
 
 // Refresh recomputes the salience values of the Activations on the Agenda. If module is nil, the current module is used. To be called after changing the conflict resoution strategy
 func (env *Environment) Refresh(module *Module) {
 	var modptr unsafe.Pointer
 	if module != nil {
+		if !valid(module.check()) {
+			return
+		}
 		modptr = module.modptr
 	}
-	C.EnvRefreshAgenda(env.env, modptr)
+	C.EnvRefreshAgenda(env.ptr(), modptr)
 }
 
 // Activations returns the list of activations in the agenda
 func (env *Environment) Activations() []*Activation {
-	actptr := C.EnvGetNextActivation(env.env, nil)
+	actptr := C.EnvGetNextActivation(env.ptr(), nil)
 	ret := make([]*Activation, 0, 10)
 	for actptr != nil {
 		ret = append(ret, createActivation(env, actptr))
-		actptr = C.EnvGetNextActivation(env.env, actptr)
+		actptr = C.EnvGetNextActivation(env.ptr(), actptr)
+	}
+	return ret
+}
+
+// agendaSize returns the number of activations on the agendas of all modules
+func (env *Environment) agendaSize() int {
+	ret := 0
+	for _, module := range env.Modules() {
+		module.within(func() {
+			for actptr := C.EnvGetNextActivation(env.ptr(), nil); actptr != nil; actptr = C.EnvGetNextActivation(env.ptr(), actptr) {
+				ret++
+			}
+		})
 	}
 	return ret
 }
 
 // ClearAgenda deletes all activations in the agenda
 func (env *Environment) ClearAgenda() error {
-	ret := C.EnvDeleteActivation(env.env, nil)
+	if err := env.check(); err != nil {
+		return err
+	}
+	ret := C.EnvDeleteActivation(env.ptr(), nil)
 	if ret != 1 {
 		return EnvError(env, "Unable to clear agenda")
 	}
@@ -221,51 +311,116 @@ func (env *Environment) ClearAgenda() error {
 
 // ClearFocus removes all modules from the focus stack
 func (env *Environment) ClearFocus() {
-	C.EnvClearFocusStack(env.env)
+	C.EnvClearFocusStack(env.ptr())
 }
 
 // Run runs the activations in the agenda. If limit is not negative, only the first activations up to the limit will be run
 func (env *Environment) Run(limit int64) int64 {
+	defer env.endCall()
 	if limit < 0 {
 		limit = -1
 	}
-	ret := C.EnvRun(env.env, C.longlong(limit))
+	start := time.Now()
+	ret := C.EnvRun(env.ptr(), C.longlong(limit))
+	env.stats.observeRun(time.Since(start))
 	return int64(ret)
 }
 
+// RunContext runs the activations in the agenda as Run does, stopping early when ctx is done.
+// CLIPS is halted as soon as the context is done, even within the actions of a rule, and the
+// error of the context returned along with the number of rules fired
+func (env *Environment) RunContext(ctx context.Context, limit int64) (int64, error) {
+	if err := env.check(); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	var ret int64
+	err := env.haltWhenDone(ctx, func() {
+		ret = env.Run(limit)
+	})
+	return ret, err
+}
+
+// haltWhenDone calls fn, halting CLIPS if ctx is done before fn returns. The error of the
+// context is returned if CLIPS was halted
+func (env *Environment) haltWhenDone(ctx context.Context, fn func()) error {
+	envptr := env.ptr()
+	done := make(chan struct{})
+	halted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			C.SetHaltExecution(envptr, 1)
+			halted <- true
+		case <-done:
+			halted <- false
+		}
+	}()
+	fn()
+	close(done)
+	if <-halted {
+		C.SetHaltExecution(envptr, 0)
+		C.SetEvaluationError(envptr, 0)
+		return ctx.Err()
+	}
+	return nil
+}
+
 func createRule(env *Environment, rptr unsafe.Pointer) *Rule {
 	return &Rule{
-		env:  env,
-		rptr: rptr,
+		env:     env,
+		rptr:    rptr,
+		name:    C.GoString(C.EnvGetDefruleName(env.ptr(), rptr)),
+		module:  C.GoString(C.EnvDefruleModule(env.ptr(), rptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the rule can no longer be used. A rule is
+// stale once undefined or cleared
+func (r *Rule) check() error {
+	return checkConstruct(r.env, DEFRULE, r.rptr, qualify(r.module, r.name), r.cleared)
+}
+
 // Equal returns true if the other rule represents the same CLIPS rule as this one
 func (r *Rule) Equal(other *Rule) bool {
 	return r.rptr == other.rptr
 }
 
 func (r *Rule) String() string {
-	cstr := C.EnvGetDefrulePPForm(r.env.env, r.rptr)
+	if !valid(r.check()) {
+		return fmt.Sprintf("<Rule-%s stale>", r.name)
+	}
+	cstr := C.EnvGetDefrulePPForm(r.env.ptr(), r.rptr)
 	return strings.TrimRight(C.GoString(cstr), "\n")
 }
 
 // Name returns the name of this rule
 func (r *Rule) Name() string {
-	cname := C.EnvGetDefruleName(r.env.env, r.rptr)
-	return C.GoString(cname)
+	if err := r.env.check(); err != nil {
+		panic(err)
+	}
+	return r.name
 }
 
-// Module returns the module in which the rule is defined
+// Module returns the module in which the rule is defined, or nil if the rule is stale
 func (r *Rule) Module() *Module {
-	cmodname := C.EnvDefruleModule(r.env.env, r.rptr)
-	modptr := C.EnvFindDefmodule(r.env.env, cmodname)
+	if !valid(r.check()) {
+		return nil
+	}
+	cmodname := C.EnvDefruleModule(r.env.ptr(), r.rptr)
+	modptr := C.EnvFindDefmodule(r.env.ptr(), cmodname)
 	return createModule(r.env, modptr)
 }
 
 // Deletable returns true if the rule is unreferenced and can be deleted
 func (r *Rule) Deletable() bool {
-	ret := C.EnvIsDefruleDeletable(r.env.env, r.rptr)
+	if !valid(r.check()) {
+		return false
+	}
+	ret := C.EnvIsDefruleDeletable(r.env.ptr(), r.rptr)
 	if ret == 1 {
 		return true
 	}
@@ -274,7 +429,10 @@ func (r *Rule) Deletable() bool {
 
 // WatchedFirings returns true if rule firings are being watched
 func (r *Rule) WatchedFirings() bool {
-	ret := C.EnvGetDefruleWatchFirings(r.env.env, r.rptr)
+	if !valid(r.check()) {
+		return false
+	}
+	ret := C.EnvGetDefruleWatchFirings(r.env.ptr(), r.rptr)
 	if ret == 1 {
 		return true
 	}
@@ -283,16 +441,22 @@ func (r *Rule) WatchedFirings() bool {
 
 // WatchFirings sets whether rule firigns are watched
 func (r *Rule) WatchFirings(val bool) {
+	if !valid(r.check()) {
+		return
+	}
 	var cflag C.uint
 	if val {
 		cflag = 1
 	}
-	C.EnvSetDefruleWatchFirings(r.env.env, cflag, r.rptr)
+	C.EnvSetDefruleWatchFirings(r.env.ptr(), cflag, r.rptr)
 }
 
 // WatchedActivations returns true if rule activations are being watched
 func (r *Rule) WatchedActivations() bool {
-	ret := C.EnvGetDefruleWatchActivations(r.env.env, r.rptr)
+	if !valid(r.check()) {
+		return false
+	}
+	ret := C.EnvGetDefruleWatchActivations(r.env.ptr(), r.rptr)
 	if ret == 1 {
 		return true
 	}
@@ -301,20 +465,26 @@ func (r *Rule) WatchedActivations() bool {
 
 // WatchActivations sets whether rule activations should be watched
 func (r *Rule) WatchActivations(val bool) {
+	if !valid(r.check()) {
+		return
+	}
 	var cflag C.uint
 	if val {
 		cflag = 1
 	}
-	C.EnvSetDefruleWatchActivations(r.env.env, cflag, r.rptr)
+	C.EnvSetDefruleWatchActivations(r.env.ptr(), cflag, r.rptr)
 }
 
 // Matches shows partial matches and activations for the rule. Returns a list containing the
 // combined sum of the matches, the combined sum of partial matches, then the total activations.
 // Verbosity determines how much to output to stdout
 func (r *Rule) Matches(verbosity Verbosity) ([]interface{}, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
 	data := createDataObject(r.env)
 	defer data.Delete()
-	C.EnvMatches(r.env.env, r.rptr, verbosity.CVal(), data.byRef())
+	C.EnvMatches(r.env.ptr(), r.rptr, verbosity.CVal(), data.byRef())
 	retval := data.Value()
 	ret, ok := retval.([]interface{})
 	if !ok {
@@ -325,7 +495,10 @@ func (r *Rule) Matches(verbosity Verbosity) ([]interface{}, error) {
 
 // Refresh refreshes the rule
 func (r *Rule) Refresh() error {
-	ret := C.EnvRefresh(r.env.env, r.rptr)
+	if err := r.check(); err != nil {
+		return err
+	}
+	ret := C.EnvRefresh(r.env.ptr(), r.rptr)
 	if ret != 1 {
 		return EnvError(r.env, "Unable to refresh rule")
 	}
@@ -334,12 +507,18 @@ func (r *Rule) Refresh() error {
 
 // AddBreakpoint adds a breakpoint for the rule
 func (r *Rule) AddBreakpoint() {
-	C.EnvSetBreak(r.env.env, r.rptr)
+	if !valid(r.check()) {
+		return
+	}
+	C.EnvSetBreak(r.env.ptr(), r.rptr)
 }
 
 // RemoveBreakpoint removes a breakpoint for the rule
 func (r *Rule) RemoveBreakpoint() error {
-	ret := C.EnvRemoveBreak(r.env.env, r.rptr)
+	if err := r.check(); err != nil {
+		return err
+	}
+	ret := C.EnvRemoveBreak(r.env.ptr(), r.rptr)
 	if ret != 1 {
 		return EnvError(r.env, "Unable to remove breakpoint")
 	}
@@ -348,7 +527,10 @@ func (r *Rule) RemoveBreakpoint() error {
 
 // Undefine undefines a rule
 func (r *Rule) Undefine() error {
-	ret := C.EnvUndefrule(r.env.env, r.rptr)
+	if err := r.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndefrule(r.env.ptr(), r.rptr)
 	if ret != 1 {
 		return EnvError(r.env, "Unable to undef rule")
 	}
@@ -359,7 +541,24 @@ func createActivation(env *Environment, actptr unsafe.Pointer) *Activation {
 	return &Activation{
 		env:    env,
 		actptr: actptr,
+		name:   C.GoString(C.EnvGetActivationName(env.ptr(), actptr)),
+		modptr: C.activation_module(actptr),
+		resets: env.resets,
+	}
+}
+
+// check returns ErrEnvironmentClosed or ErrStale if the activation can no longer be used. An
+// activation is stale once it has left the agenda, by firing, being removed, or the agenda
+// being reset or cleared
+func (a *Activation) check() error {
+	if err := a.env.check(); err != nil {
+		return err
+	}
+	// the module outlives the activation unless the environment is cleared, which is a reset
+	if a.actptr == nil || a.resets != a.env.resets || C.on_agenda(a.env.ptr(), a.modptr, a.actptr) == 0 {
+		return fmt.Errorf("Activation of %s is no longer on the agenda: %w", a.name, ErrStale)
 	}
+	return nil
 }
 
 // Equal returns true if other activation represents the same CLIPS activation as this one
@@ -368,35 +567,49 @@ func (a *Activation) Equal(other *Activation) bool {
 }
 
 func (a *Activation) String() string {
+	if !valid(a.check()) {
+		return fmt.Sprintf("<Activation-%s stale>", a.name)
+	}
 	// TODO grow buf if we fill the 1k buffer, and try again
 	var bufsize C.ulong = 1024
 	buf := (*C.char)(C.malloc(C.sizeof_char * bufsize))
 	defer C.free(unsafe.Pointer(buf))
-	C.EnvGetActivationPPForm(a.env.env, buf, bufsize-1, a.actptr)
+	C.EnvGetActivationPPForm(a.env.ptr(), buf, bufsize-1, a.actptr)
 
 	return C.GoString(buf)
 }
 
 // Name returns the name of the rule of this activation
 func (a *Activation) Name() string {
-	ret := C.EnvGetActivationName(a.env.env, a.actptr)
-	return C.GoString(ret)
+	if err := a.env.check(); err != nil {
+		panic(err)
+	}
+	return a.name
 }
 
 // Salience returns the salience value for this activation
 func (a *Activation) Salience() int {
-	ret := C.EnvGetActivationSalience(a.env.env, a.actptr)
+	if !valid(a.check()) {
+		return 0
+	}
+	ret := C.EnvGetActivationSalience(a.env.ptr(), a.actptr)
 	return int(ret)
 }
 
 // SetSalience modifies the salience of this activation
 func (a *Activation) SetSalience(salience int) {
-	C.EnvSetActivationSalience(a.env.env, a.actptr, C.int(salience))
+	if !valid(a.check()) {
+		return
+	}
+	C.EnvSetActivationSalience(a.env.ptr(), a.actptr, C.int(salience))
 }
 
 // Remove removes this activation from the agenda. Renamed from "delete" to avoid confusion with other Deletes which always only drop references to CLIPS
 func (a *Activation) Remove() error {
-	ret := C.EnvDeleteActivation(a.env.env, a.actptr)
+	if err := a.check(); err != nil {
+		return err
+	}
+	ret := C.EnvDeleteActivation(a.env.ptr(), a.actptr)
 	if ret != 1 {
 		return EnvError(a.env, "Unable to remove activation from the agenda")
 	}
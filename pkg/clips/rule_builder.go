@@ -0,0 +1,349 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CE is a conditional element on the left hand side of a rule. An Expr is written as is
+type CE interface {
+	ceSource() (string, error)
+}
+
+// Action is an action on the right hand side of a rule, or in a message handler. An Expr is
+// written as is
+type Action interface {
+	actionSource() (string, error)
+}
+
+func (e Expr) ceSource() (string, error) {
+	return valueSource(e)
+}
+
+func (e Expr) actionSource() (string, error) {
+	return valueSource(e)
+}
+
+// PatternCE matches facts of a template, or ordered facts
+type PatternCE struct {
+	template string
+	ordered  bool
+	values   []interface{}
+	slots    []SlotValue
+	bind     Expr
+}
+
+// Pattern returns a pattern matching facts of the template whose slots match the given
+// values. Use an Expr for variables and constraints, as in With("id", Var("id"))
+func Pattern(template string, slots ...SlotValue) *PatternCE {
+	return &PatternCE{template: template, slots: slots}
+}
+
+// OrderedPattern returns a pattern matching ordered facts of the given relation
+func OrderedPattern(relation string, values ...interface{}) *PatternCE {
+	return &PatternCE{template: relation, ordered: true, values: values}
+}
+
+// As binds the matching fact to a variable, as in ?o <- (order)
+func (p *PatternCE) As(variable string) *PatternCE {
+	p.bind = Var(variable)
+	return p
+}
+
+func (p *PatternCE) ceSource() (string, error) {
+	if err := validName("template", p.template); err != nil {
+		return "", err
+	}
+	var body string
+	var err error
+	if p.ordered {
+		body, err = valuesSource(p.values...)
+		if body != "" {
+			body = " " + body
+		}
+	} else {
+		body, err = slotValuesSource(p.slots)
+	}
+	if err != nil {
+		return "", fmt.Errorf(`Pattern "%s": %v`, p.template, err)
+	}
+	src := "(" + p.template + body + ")"
+	if p.bind != "" {
+		if err := validVariable(p.bind); err != nil {
+			return "", err
+		}
+		src = string(p.bind) + " <- " + src
+	}
+	return src, nil
+}
+
+type groupCE struct {
+	keyword string
+	ces     []CE
+}
+
+func (g *groupCE) ceSource() (string, error) {
+	if len(g.ces) == 0 {
+		return "", fmt.Errorf(`Empty "%s" conditional element`, g.keyword)
+	}
+	items := []string{g.keyword}
+	for _, ce := range g.ces {
+		src, err := ce.ceSource()
+		if err != nil {
+			return "", err
+		}
+		items = append(items, src)
+	}
+	return "(" + strings.Join(items, " ") + ")", nil
+}
+
+// Test returns a CE which is satisfied when the expression is not FALSE
+func Test(expr Expr) CE {
+	return &groupCE{keyword: "test", ces: []CE{expr}}
+}
+
+// Not returns a CE which is satisfied when ce is not
+func Not(ce CE) CE {
+	return &groupCE{keyword: "not", ces: []CE{ce}}
+}
+
+// And returns a CE which is satisfied when all of ces are
+func And(ces ...CE) CE {
+	return &groupCE{keyword: "and", ces: ces}
+}
+
+// Or returns a CE which is satisfied when any of ces is
+func Or(ces ...CE) CE {
+	return &groupCE{keyword: "or", ces: ces}
+}
+
+// Exists returns a CE which is satisfied once when ces are satisfied at least once
+func Exists(ces ...CE) CE {
+	return &groupCE{keyword: "exists", ces: ces}
+}
+
+type callAction struct {
+	function string
+	// args writes the arguments of the call
+	args func() (string, error)
+}
+
+func (c *callAction) actionSource() (string, error) {
+	args, err := c.args()
+	if err != nil {
+		return "", fmt.Errorf(`Action "%s": %v`, c.function, err)
+	}
+	if args == "" {
+		return "(" + c.function + ")", nil
+	}
+	return "(" + c.function + " " + args + ")", nil
+}
+
+// Call returns an action calling a function with the given arguments. A slice argument is
+// spread into separate arguments
+func Call(function string, args ...interface{}) Action {
+	return &callAction{function: function, args: func() (string, error) {
+		if err := validName("function", function); err != nil {
+			return "", err
+		}
+		return valuesSource(args...)
+	}}
+}
+
+// Assert returns an action asserting a fact of the template with the given slot values
+func Assert(template string, slots ...SlotValue) Action {
+	return &callAction{function: "assert", args: func() (string, error) {
+		if err := validName("template", template); err != nil {
+			return "", err
+		}
+		body, err := slotValuesSource(slots)
+		return "(" + template + body + ")", err
+	}}
+}
+
+// AssertOrdered returns an action asserting an ordered fact
+func AssertOrdered(relation string, values ...interface{}) Action {
+	return &callAction{function: "assert", args: func() (string, error) {
+		return OrderedPattern(relation, values...).ceSource()
+	}}
+}
+
+// Modify returns an action changing slots of the fact bound to a variable
+func Modify(fact string, slots ...SlotValue) Action {
+	return &callAction{function: "modify", args: func() (string, error) {
+		if err := validVariable(Var(fact)); err != nil {
+			return "", err
+		}
+		body, err := slotValuesSource(slots)
+		return string(Var(fact)) + body, err
+	}}
+}
+
+// Retract returns an action retracting the facts bound to variables
+func Retract(facts ...string) Action {
+	return &callAction{function: "retract", args: func() (string, error) {
+		if len(facts) == 0 {
+			return "", fmt.Errorf("No facts to retract")
+		}
+		vars := make([]string, len(facts))
+		for ii, fact := range facts {
+			if err := validVariable(Var(fact)); err != nil {
+				return "", err
+			}
+			vars[ii] = string(Var(fact))
+		}
+		return strings.Join(vars, " "), nil
+	}}
+}
+
+// Bind returns an action binding a variable to a value
+func Bind(variable string, value interface{}) Action {
+	return &callAction{function: "bind", args: func() (string, error) {
+		if err := validVariable(Var(variable)); err != nil {
+			return "", err
+		}
+		src, err := valuesSource(value)
+		return string(Var(variable)) + " " + src, err
+	}}
+}
+
+// Printout returns an action printing items to a logical name, such as "t" for stdout. Use
+// Symbol("crlf") to end the line
+func Printout(router string, items ...interface{}) Action {
+	return &callAction{function: "printout", args: func() (string, error) {
+		if err := validName("router", router); err != nil {
+			return "", err
+		}
+		src, err := valuesSource(items...)
+		if src != "" {
+			src = " " + src
+		}
+		return router + src, err
+	}}
+}
+
+// RuleBuilder builds a defrule from Go
+type RuleBuilder struct {
+	name        string
+	comment     string
+	salience    int
+	hasSalience bool
+	autoFocus   bool
+	conditions  []CE
+	actions     []Action
+}
+
+// NewRule returns a builder for a defrule of the given name
+func NewRule(name string) *RuleBuilder {
+	return &RuleBuilder{name: name}
+}
+
+// Comment sets the comment of the rule
+func (r *RuleBuilder) Comment(text string) *RuleBuilder {
+	r.comment = text
+	return r
+}
+
+// Salience sets the salience of the rule, from -10000 to 10000
+func (r *RuleBuilder) Salience(salience int) *RuleBuilder {
+	r.salience = salience
+	r.hasSalience = true
+	return r
+}
+
+// AutoFocus sets whether the module of the rule is focused when the rule is activated
+func (r *RuleBuilder) AutoFocus(autoFocus bool) *RuleBuilder {
+	r.autoFocus = autoFocus
+	return r
+}
+
+// When adds conditional elements to the left hand side of the rule
+func (r *RuleBuilder) When(ces ...CE) *RuleBuilder {
+	r.conditions = append(r.conditions, ces...)
+	return r
+}
+
+// Then adds actions to the right hand side of the rule
+func (r *RuleBuilder) Then(actions ...Action) *RuleBuilder {
+	r.actions = append(r.actions, actions...)
+	return r
+}
+
+// Validate checks the names and values of the rule
+func (r *RuleBuilder) Validate() error {
+	_, err := r.source("")
+	return err
+}
+
+// Source returns the defrule as CLIPS source
+func (r *RuleBuilder) Source() (string, error) {
+	return r.source("")
+}
+
+func (r *RuleBuilder) source(module string) (string, error) {
+	if err := validName("rule", r.name); err != nil {
+		return "", err
+	}
+	if r.salience < -10000 || r.salience > 10000 {
+		return "", fmt.Errorf(`Salience %d of rule "%s" is outside -10000 to 10000`, r.salience, r.name)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "(defrule %s", qualify(module, r.name))
+	if r.comment != "" {
+		fmt.Fprintf(&b, " %s", clipsString(r.comment))
+	}
+	if r.hasSalience || r.autoFocus {
+		b.WriteString("\n   (declare")
+		if r.hasSalience {
+			fmt.Fprintf(&b, " (salience %d)", r.salience)
+		}
+		if r.autoFocus {
+			b.WriteString(" (auto-focus TRUE)")
+		}
+		b.WriteString(")")
+	}
+	for _, ce := range r.conditions {
+		src, err := ce.ceSource()
+		if err != nil {
+			return "", fmt.Errorf(`Rule "%s": %v`, r.name, err)
+		}
+		fmt.Fprintf(&b, "\n   %s", src)
+	}
+	b.WriteString("\n   =>")
+	for _, action := range r.actions {
+		src, err := action.actionSource()
+		if err != nil {
+			return "", fmt.Errorf(`Rule "%s": %v`, r.name, err)
+		}
+		fmt.Fprintf(&b, "\n   %s", src)
+	}
+	b.WriteString(")")
+	return b.String(), nil
+}
+
+// Build defines the rule within the named module, or the current module if module is empty.
+// The current module is left unchanged
+func (r *RuleBuilder) Build(env *Environment, module string) (*Rule, error) {
+	src, err := r.source(module)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.buildIn(module, src); err != nil {
+		return nil, err
+	}
+	return env.FindRule(qualify(module, r.name))
+}
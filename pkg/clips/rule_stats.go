@@ -0,0 +1,79 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+import (
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// RuleStat is the number of times a rule has fired
+type RuleStat struct {
+	Module string `json:"module"`
+	Rule   string `json:"rule"`
+	Fired  int64  `json:"fired"`
+	// Defined is false for rules which fired but have since been undefined
+	Defined bool `json:"defined"`
+}
+
+//export ruleFiring
+func ruleFiring(envptr unsafe.Pointer, rptr unsafe.Pointer) {
+	env, ok := lookupEnvironment(envptr)
+	if !ok {
+		return
+	}
+	module := C.GoString(C.EnvDefruleModule(envptr, rptr))
+	env.fired[qualify(module, C.GoString(C.EnvGetDefruleName(envptr, rptr)))]++
+}
+
+// RuleStats returns the number of times each rule has fired since the environment was
+// created, or ResetRuleStats called. Firings are counted across runs whether or not
+// profiling is on. Every rule defined is listed, module by module, so that rules which
+// never fired have Fired zero. Rules undefined after firing follow, with Defined false
+func (env *Environment) RuleStats() []RuleStat {
+	ret := make([]RuleStat, 0, len(env.fired))
+	seen := make(map[string]bool, len(env.fired))
+	for _, module := range env.Modules() {
+		modname := module.Name()
+		for _, rule := range module.Rules() {
+			name := rule.Name()
+			key := qualify(modname, name)
+			seen[key] = true
+			ret = append(ret, RuleStat{Module: modname, Rule: name, Fired: env.fired[key], Defined: true})
+		}
+	}
+	undefined := make([]string, 0)
+	for key := range env.fired {
+		if !seen[key] {
+			undefined = append(undefined, key)
+		}
+	}
+	sort.Strings(undefined)
+	for _, key := range undefined {
+		idx := strings.Index(key, "::")
+		ret = append(ret, RuleStat{Module: key[:idx], Rule: key[idx+2:], Fired: env.fired[key]})
+	}
+	return ret
+}
+
+// ResetRuleStats sets the fire counts of all rules back to zero
+func (env *Environment) ResetRuleStats() {
+	env.fired = make(map[string]int64)
+}
@@ -14,7 +14,9 @@ package clips
 */
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"gotest.tools/assert"
 )
@@ -241,6 +243,58 @@ func TestAgendaEnv(t *testing.T) {
 		acts = env.Activations()
 		assert.Equal(t, len(acts), 0)
 	})
+
+	t.Run("RunContext", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defrule foo => (printout t "fired"))`)
+		assert.NilError(t, err)
+		ran, err := env.RunContext(context.Background(), -1)
+		assert.NilError(t, err)
+		assert.Equal(t, ran, int64(1))
+
+		err = env.Build(`(defrule spin (spin) => (loop-for-count 1000000000))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(spin)`)
+		assert.NilError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err = env.RunContext(ctx, -1)
+		assert.Equal(t, err, context.DeadlineExceeded)
+		assert.Assert(t, time.Since(start) < 5*time.Second)
+
+		// the environment carries on once halted
+		ret, err := env.Eval(`(+ 1 2)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(3))
+
+		_, err = env.RunContext(ctx, -1)
+		assert.Equal(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("EvalContext", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		ret, err := env.EvalContext(context.Background(), `(+ 1 2)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(3))
+
+		err = env.Build(`(deffunction spin () (loop-for-count 1000000000))`)
+		assert.NilError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err = env.EvalContext(ctx, `(spin)`)
+		assert.Equal(t, err, context.DeadlineExceeded)
+		assert.Assert(t, time.Since(start) < 5*time.Second)
+
+		ret, err = env.Eval(`(+ 1 2)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(3))
+	})
 }
 
 func TestRule(t *testing.T) {
@@ -0,0 +1,678 @@
+// Package server serves CLIPS sessions as an HTTP/JSON decision service. Each session is an
+// environment of its own, started from a snapshot of a rule base
+package server
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips"
+)
+
+// Options configure a Server
+type Options struct {
+	// PoolSize is the number of environments kept loaded and ready for new sessions
+	PoolSize int
+	// Timeout limits the time a request may spend running rules or evaluating an expression.
+	// Zero means no limit
+	Timeout time.Duration
+}
+
+// Server is an http.Handler serving sessions. It must be closed once done with
+type Server struct {
+	opts     Options
+	snapshot string
+	metrics  *clips.Metrics
+	mux      *http.ServeMux
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	pool     chan *clips.Environment
+	closed   chan struct{}
+	filling  sync.WaitGroup
+}
+
+// session is an environment serving requests one at a time
+type session struct {
+	mu     sync.Mutex
+	env    *clips.Environment
+	output *strings.Builder
+	closed bool
+}
+
+// New loads the rule files in order and returns a server whose sessions start from a binary
+// snapshot of them
+func New(files []string, opts Options) (*Server, error) {
+	env, err := clips.NewEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	defer env.Delete()
+	for _, path := range files {
+		if err := env.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	snapshot, err := ioutil.TempFile("", "clipsgo-serve-*.bin")
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Close()
+	if err := env.Save(snapshot.Name(), true); err != nil {
+		os.Remove(snapshot.Name())
+		return nil, err
+	}
+
+	s := &Server{
+		opts:     opts,
+		snapshot: snapshot.Name(),
+		metrics:  clips.NewMetrics(),
+		sessions: make(map[string]*session),
+		pool:     make(chan *clips.Environment, opts.PoolSize),
+		closed:   make(chan struct{}),
+	}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/sessions", s.handleSessions)
+	s.mux.HandleFunc("/sessions/", s.handleSession)
+	s.mux.Handle("/metrics", s.metrics)
+	if opts.PoolSize > 0 {
+		s.filling.Add(1)
+		go s.fill()
+	}
+	return s, nil
+}
+
+// Dir returns the .clp files in a directory, sorted by name
+func Dir(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.clp"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No .clp files in %s", dir)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// newEnvironment returns an environment loaded from the snapshot and reset
+func (s *Server) newEnvironment() (*clips.Environment, error) {
+	env, err := clips.NewEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	if err := env.Load(s.snapshot); err != nil {
+		env.Delete()
+		return nil, err
+	}
+	env.Reset()
+	return env, nil
+}
+
+// fill keeps the pool full until the server is closed. If an environment cannot be loaded it
+// logs the error and stops, leaving sessions to load their own
+func (s *Server) fill() {
+	defer s.filling.Done()
+	for {
+		env, err := s.newEnvironment()
+		if err != nil {
+			log.Printf("Unable to fill the environment pool: %v", err)
+			return
+		}
+		select {
+		case s.pool <- env:
+		case <-s.closed:
+			env.Delete()
+			return
+		}
+	}
+}
+
+// Close deletes all sessions and pooled environments, and the snapshot
+func (s *Server) Close() error {
+	close(s.closed)
+	s.filling.Wait()
+	close(s.pool)
+	for env := range s.pool {
+		env.Delete()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		sess.close()
+		delete(s.sessions, id)
+	}
+	return os.Remove(s.snapshot)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// createSession takes an environment from the pool, or loads one if the pool is empty
+func (s *Server) createSession() (string, error) {
+	var env *clips.Environment
+	select {
+	case env = <-s.pool:
+	default:
+		var err error
+		if env, err = s.newEnvironment(); err != nil {
+			return "", err
+		}
+	}
+	sess := &session{env: env, output: &strings.Builder{}}
+	names := map[string]io.Writer{}
+	for _, name := range []string{"t", "stdout", "wdisplay", "wprompt", "wdialog", "wwarning", "werror"} {
+		names[name] = sess.output
+	}
+	clips.CreateWriterRouter(env, names)
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		env.Delete()
+		return "", err
+	}
+	ret := hex.EncodeToString(id)
+	s.mu.Lock()
+	s.sessions[ret] = sess
+	s.mu.Unlock()
+	s.metrics.Register(env, ret, &sess.mu)
+	return ret, nil
+}
+
+func (sess *session) close() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.env.Delete()
+	sess.closed = true
+}
+
+// httpError is an error with the status to respond with
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func respondError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if herr, ok := err.(*httpError); ok {
+		status = herr.status
+	}
+	respond(w, status, map[string]string{"error": err.Error()})
+}
+
+// handleSessions lists and creates sessions
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		ids := make([]string, 0, len(s.sessions))
+		for id := range s.sessions {
+			ids = append(ids, id)
+		}
+		s.mu.Unlock()
+		sort.Strings(ids)
+		respond(w, http.StatusOK, map[string][]string{"sessions": ids})
+	case http.MethodPost:
+		id, err := s.createSession()
+		if err != nil {
+			respondError(w, &httpError{status: http.StatusInternalServerError, err: err})
+			return
+		}
+		respond(w, http.StatusCreated, map[string]string{"id": id})
+	default:
+		respondError(w, errorf(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method))
+	}
+}
+
+// sessionHandlers maps the method and resource of a request within a session to its handler
+var sessionHandlers = map[string]func(s *Server, sess *session, r *http.Request) (int, interface{}, error){
+	"GET facts":      (*Server).getFacts,
+	"POST facts":     (*Server).postFacts,
+	"GET instances":  (*Server).getInstances,
+	"POST instances": (*Server).postInstances,
+	"GET agenda":     (*Server).getAgenda,
+	"GET globals":    (*Server).getGlobals,
+	"GET output":     (*Server).getOutput,
+	"POST run":       (*Server).postRun,
+	"POST eval":      (*Server).postEval,
+}
+
+// handleSession serves /sessions/{id} and the resources within it
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/sessions/"), "/")
+	id := parts[0]
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if ok && len(parts) == 1 && r.Method == http.MethodDelete {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		respondError(w, errorf(http.StatusNotFound, `Session "%s" not found`, id))
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodDelete {
+			respondError(w, errorf(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method))
+			return
+		}
+		s.metrics.Unregister(sess.env)
+		sess.close()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	handler, ok := sessionHandlers[r.Method+" "+strings.Join(parts[1:], "/")]
+	if !ok {
+		respondError(w, errorf(http.StatusNotFound, "No such resource %s %s", r.Method, r.URL.Path))
+		return
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.closed {
+		respondError(w, errorf(http.StatusNotFound, `Session "%s" not found`, id))
+		return
+	}
+	status, body, err := handler(s, sess, r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respond(w, status, body)
+}
+
+// decode decodes a JSON request body, keeping numbers as json.Number
+func decode(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return errorf(http.StatusBadRequest, "Invalid request body: %v", err)
+	}
+	return nil
+}
+
+// decodeOptional is decode for a body which may be empty, leaving v as it is
+func decodeOptional(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return errorf(http.StatusBadRequest, "Invalid request body: %v", err)
+	}
+	return nil
+}
+
+// FactRequest is a fact to assert. Give Fact as CLIPS source, or Template with Slots for a
+// deftemplate fact, or Template with Values for an ordered fact
+type FactRequest struct {
+	Fact     string                 `json:"fact,omitempty"`
+	Template string                 `json:"template,omitempty"`
+	Slots    map[string]interface{} `json:"slots,omitempty"`
+	Values   []interface{}          `json:"values,omitempty"`
+}
+
+// FactResponse describes a fact
+type FactResponse struct {
+	Index    int                    `json:"index"`
+	Template string                 `json:"template"`
+	Fact     string                 `json:"fact"`
+	Slots    map[string]interface{} `json:"slots,omitempty"`
+}
+
+func factResponse(fact clips.Fact) FactResponse {
+	ret := FactResponse{Index: fact.Index(), Fact: fact.String()}
+	if tmpl := fact.Template(); tmpl != nil {
+		ret.Template = tmpl.Name()
+		if !tmpl.Implied() {
+			if slots, err := fact.Slots(); err == nil {
+				ret.Slots = jsonSlots(slots)
+			}
+		}
+	}
+	return ret
+}
+
+func (s *Server) getFacts(sess *session, r *http.Request) (int, interface{}, error) {
+	facts := sess.env.Facts()
+	ret := make([]FactResponse, 0, len(facts))
+	for _, fact := range facts {
+		ret = append(ret, factResponse(fact))
+	}
+	return http.StatusOK, ret, nil
+}
+
+func (s *Server) postFacts(sess *session, r *http.Request) (int, interface{}, error) {
+	var reqs []FactRequest
+	if err := decode(r, &reqs); err != nil {
+		return 0, nil, err
+	}
+	ret := make([]FactResponse, 0, len(reqs))
+	for ii, req := range reqs {
+		fact, err := assertFact(sess.env, req)
+		if err != nil {
+			return 0, nil, fmt.Errorf("Fact %d: %v", ii, err)
+		}
+		ret = append(ret, factResponse(fact))
+	}
+	return http.StatusCreated, ret, nil
+}
+
+func assertFact(env *clips.Environment, req FactRequest) (clips.Fact, error) {
+	if req.Fact != "" {
+		return env.AssertString(req.Fact)
+	}
+	tmpl, err := env.FindTemplate(req.Template)
+	if err != nil {
+		return nil, err
+	}
+	fact, err := tmpl.NewFact()
+	if err != nil {
+		return nil, err
+	}
+	switch f := fact.(type) {
+	case *clips.ImpliedFact:
+		if err := f.Extend(coerceValues(req.Values, nil)); err != nil {
+			return nil, err
+		}
+	case *clips.TemplateFact:
+		slots := tmpl.Slots()
+		for name, value := range req.Slots {
+			slot, ok := slots[name]
+			if !ok {
+				return nil, fmt.Errorf(`Template "%s" has no slot "%s"`, req.Template, name)
+			}
+			if err := f.Set(name, coerce(value, slot.Types())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := fact.Assert(); err != nil {
+		return nil, err
+	}
+	return fact, nil
+}
+
+// InstanceRequest is an instance to make. If Name is empty, one is generated
+type InstanceRequest struct {
+	Name  string                 `json:"name,omitempty"`
+	Class string                 `json:"class"`
+	Slots map[string]interface{} `json:"slots,omitempty"`
+}
+
+// InstanceResponse describes an instance
+type InstanceResponse struct {
+	Name  string                 `json:"name"`
+	Class string                 `json:"class"`
+	Slots map[string]interface{} `json:"slots"`
+}
+
+func instanceResponse(inst *clips.Instance) InstanceResponse {
+	return InstanceResponse{
+		Name:  string(inst.Name()),
+		Class: inst.Class().Name(),
+		Slots: jsonSlots(inst.Slots(true)),
+	}
+}
+
+func (s *Server) getInstances(sess *session, r *http.Request) (int, interface{}, error) {
+	instances := sess.env.Instances()
+	ret := make([]InstanceResponse, 0, len(instances))
+	for _, inst := range instances {
+		ret = append(ret, instanceResponse(inst))
+	}
+	return http.StatusOK, ret, nil
+}
+
+func (s *Server) postInstances(sess *session, r *http.Request) (int, interface{}, error) {
+	var reqs []InstanceRequest
+	if err := decode(r, &reqs); err != nil {
+		return 0, nil, err
+	}
+	ret := make([]InstanceResponse, 0, len(reqs))
+	for ii, req := range reqs {
+		inst, err := makeInstance(sess.env, req)
+		if err != nil {
+			return 0, nil, fmt.Errorf("Instance %d: %v", ii, err)
+		}
+		ret = append(ret, instanceResponse(inst))
+	}
+	return http.StatusCreated, ret, nil
+}
+
+func makeInstance(env *clips.Environment, req InstanceRequest) (*clips.Instance, error) {
+	class, err := env.FindClass(req.Class)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := class.NewInstance(req.Name, false)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range req.Slots {
+		slot, err := class.Slot(name)
+		if err != nil {
+			inst.Unmake()
+			return nil, err
+		}
+		if err := inst.SetSlot(name, coerce(value, slot.Types())); err != nil {
+			inst.Unmake()
+			return nil, err
+		}
+	}
+	return inst, nil
+}
+
+// ActivationResponse describes an activation on the agenda
+type ActivationResponse struct {
+	Rule       string `json:"rule"`
+	Salience   int    `json:"salience"`
+	Activation string `json:"activation"`
+}
+
+func (s *Server) getAgenda(sess *session, r *http.Request) (int, interface{}, error) {
+	activations := sess.env.Activations()
+	ret := make([]ActivationResponse, 0, len(activations))
+	for _, act := range activations {
+		ret = append(ret, ActivationResponse{Rule: act.Name(), Salience: act.Salience(), Activation: act.String()})
+	}
+	return http.StatusOK, ret, nil
+}
+
+func (s *Server) getGlobals(sess *session, r *http.Request) (int, interface{}, error) {
+	ret := make(map[string]interface{})
+	for _, global := range sess.env.Globals() {
+		value, err := global.Value()
+		if err != nil {
+			return 0, nil, err
+		}
+		ret[global.Name()] = jsonValue(value)
+	}
+	return http.StatusOK, ret, nil
+}
+
+// getOutput returns the output printed since the last time it was got
+func (s *Server) getOutput(sess *session, r *http.Request) (int, interface{}, error) {
+	ret := sess.output.String()
+	sess.output.Reset()
+	return http.StatusOK, map[string]string{"output": ret}, nil
+}
+
+// context returns the context of a request, limited to the timeout of the server
+func (s *Server) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.opts.Timeout > 0 {
+		return context.WithTimeout(r.Context(), s.opts.Timeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// RunRequest runs the agenda. A negative or missing Limit runs it until it is empty
+type RunRequest struct {
+	Limit *int64 `json:"limit,omitempty"`
+}
+
+func (s *Server) postRun(sess *session, r *http.Request) (int, interface{}, error) {
+	var req RunRequest
+	if err := decodeOptional(r, &req); err != nil {
+		return 0, nil, err
+	}
+	limit := int64(-1)
+	if req.Limit != nil {
+		limit = *req.Limit
+	}
+	ctx, cancel := s.context(r)
+	defer cancel()
+	fired, err := sess.env.RunContext(ctx, limit)
+	if err != nil {
+		return 0, nil, &httpError{
+			status: http.StatusServiceUnavailable,
+			err:    fmt.Errorf("Run stopped after %d rules: %v", fired, err),
+		}
+	}
+	return http.StatusOK, map[string]int64{"fired": fired}, nil
+}
+
+// EvalRequest evaluates a CLIPS expression
+type EvalRequest struct {
+	Expression string `json:"expression"`
+}
+
+func (s *Server) postEval(sess *session, r *http.Request) (int, interface{}, error) {
+	var req EvalRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	ctx, cancel := s.context(r)
+	defer cancel()
+	ret, err := sess.env.EvalContext(ctx, req.Expression)
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return 0, nil, &httpError{
+			status: http.StatusServiceUnavailable,
+			err:    fmt.Errorf("Eval stopped: %v", err),
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]interface{}{"result": jsonValue(ret)}, nil
+}
+
+// coerce converts a value decoded from JSON to the CLIPS type a slot accepts. Whole numbers
+// are integers and strings are symbols, unless the slot does not accept them. A string in
+// double quotes, such as "\"text\"", is a CLIPS string
+func coerce(value interface{}, types []clips.Symbol) interface{} {
+	accepts := func(typ string) bool {
+		if len(types) == 0 {
+			return true
+		}
+		for _, t := range types {
+			if string(t) == typ {
+				return true
+			}
+		}
+		return false
+	}
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && accepts("INTEGER") {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case string:
+		if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) && accepts("STRING") {
+			return v[1 : len(v)-1]
+		}
+		if accepts("STRING") && !accepts("SYMBOL") {
+			return v
+		}
+		if accepts("SYMBOL") {
+			return clips.Symbol(v)
+		}
+		if accepts("INSTANCE-NAME") {
+			return clips.InstanceName(v)
+		}
+		return v
+	case []interface{}:
+		return coerceValues(v, types)
+	case nil:
+		return clips.Symbol("nil")
+	}
+	return value
+}
+
+func coerceValues(values []interface{}, types []clips.Symbol) []interface{} {
+	ret := make([]interface{}, len(values))
+	for ii, value := range values {
+		ret[ii] = coerce(value, types)
+	}
+	return ret
+}
+
+// jsonValue converts a value from CLIPS to one which encodes as JSON
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case clips.Fact:
+		return fmt.Sprintf("<Fact-%d>", v.Index())
+	case *clips.Instance:
+		return string(v.Name())
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for ii, item := range v {
+			ret[ii] = jsonValue(item)
+		}
+		return ret
+	}
+	return value
+}
+
+func jsonSlots(slots map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(slots))
+	for name, value := range slots {
+		ret[name] = jsonValue(value)
+	}
+	return ret
+}
@@ -0,0 +1,314 @@
+package server
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+const rules = `
+(deftemplate order
+	(slot id (type INTEGER))
+	(slot customer (type SYMBOL))
+	(slot note (type STRING))
+	(multislot items))
+
+(defclass CUSTOMER (is-a USER)
+	(slot name (type STRING))
+	(slot credit (type FLOAT)))
+
+(defglobal ?*shipped* = 0)
+
+(defrule ship
+	(order (id ?id) (customer ?c))
+	=>
+	(bind ?*shipped* (+ ?*shipped* 1))
+	(printout t "shipping " ?id " to " ?c crlf))
+
+(defrule urgent
+	(priority high ?weight&:(> ?weight 10))
+	=>)
+
+(defrule forever
+	(spin)
+	=>
+	(loop-for-count 100000000))
+`
+
+func newTestServer(t *testing.T, opts Options) (*Server, *httptest.Server) {
+	dir, err := ioutil.TempDir("", "clipsgo-serve")
+	assert.NilError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	err = ioutil.WriteFile(filepath.Join(dir, "orders.clp"), []byte(rules), 0644)
+	assert.NilError(t, err)
+
+	files, err := Dir(dir)
+	assert.NilError(t, err)
+	srv, err := New(files, opts)
+	assert.NilError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func request(t *testing.T, ts *httptest.Server, method, path, body string, status int, ret interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	assert.NilError(t, err)
+	resp, err := ts.Client().Do(req)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.StatusCode, status, string(data))
+	if ret != nil {
+		assert.NilError(t, json.Unmarshal(data, ret))
+	}
+}
+
+func createSession(t *testing.T, ts *httptest.Server) string {
+	t.Helper()
+	var created map[string]string
+	request(t, ts, "POST", "/sessions", "", http.StatusCreated, &created)
+	return created["id"]
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Sessions", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{PoolSize: 2})
+		first := createSession(t, ts)
+		second := createSession(t, ts)
+		assert.Assert(t, first != second)
+
+		var list map[string][]string
+		request(t, ts, "GET", "/sessions", "", http.StatusOK, &list)
+		assert.Equal(t, len(list["sessions"]), 2)
+
+		request(t, ts, "DELETE", "/sessions/"+first, "", http.StatusNoContent, nil)
+		request(t, ts, "DELETE", "/sessions/"+first, "", http.StatusNotFound, nil)
+		request(t, ts, "GET", "/sessions/"+first+"/facts", "", http.StatusNotFound, nil)
+		request(t, ts, "GET", "/sessions", "", http.StatusOK, &list)
+		assert.DeepEqual(t, list["sessions"], []string{second})
+
+		request(t, ts, "PUT", "/sessions", "", http.StatusMethodNotAllowed, nil)
+		request(t, ts, "GET", "/sessions/"+second+"/nothing", "", http.StatusNotFound, nil)
+	})
+
+	t.Run("Facts and run", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{})
+		id := createSession(t, ts)
+
+		var facts []FactResponse
+		request(t, ts, "POST", "/sessions/"+id+"/facts", `[
+			{"template": "order", "slots": {"id": 1, "customer": "acme", "note": "rush", "items": ["bolt", 2]}},
+			{"fact": "(order (id 2) (customer initech))"},
+			{"template": "priority", "values": ["high", 1.5]}
+		]`, http.StatusCreated, &facts)
+		assert.Equal(t, len(facts), 3)
+		assert.Equal(t, facts[0].Template, "order")
+		assert.Equal(t, facts[0].Fact, `(order (id 1) (customer acme) (note "rush") (items bolt 2))`)
+		assert.Equal(t, facts[2].Fact, `(priority high 1.5)`)
+
+		request(t, ts, "POST", "/sessions/"+id+"/facts", `[{"template": "order", "slots": {"weight": 1}}]`, http.StatusBadRequest, nil)
+		request(t, ts, "POST", "/sessions/"+id+"/facts", `not json`, http.StatusBadRequest, nil)
+
+		request(t, ts, "GET", "/sessions/"+id+"/facts", "", http.StatusOK, &facts)
+		assert.Equal(t, facts[1].Slots["customer"], "acme")
+		assert.DeepEqual(t, facts[1].Slots["items"], []interface{}{"bolt", float64(2)})
+
+		var agenda []ActivationResponse
+		request(t, ts, "GET", "/sessions/"+id+"/agenda", "", http.StatusOK, &agenda)
+		assert.Equal(t, len(agenda), 2)
+		assert.Equal(t, agenda[0].Rule, "ship")
+
+		var fired map[string]int64
+		request(t, ts, "POST", "/sessions/"+id+"/run", `{"limit": 1}`, http.StatusOK, &fired)
+		assert.Equal(t, fired["fired"], int64(1))
+		request(t, ts, "POST", "/sessions/"+id+"/run", "", http.StatusOK, &fired)
+		assert.Equal(t, fired["fired"], int64(1))
+		request(t, ts, "POST", "/sessions/"+id+"/run", "{", http.StatusBadRequest, nil)
+
+		// a body of unknown length is sent chunked, with a ContentLength of -1
+		request(t, ts, "POST", "/sessions/"+id+"/facts", `[{"fact": "(order (id 3) (customer globex))"}]`, http.StatusCreated, nil)
+		req, err := http.NewRequest("POST", ts.URL+"/sessions/"+id+"/run", ioutil.NopCloser(strings.NewReader("")))
+		assert.NilError(t, err)
+		resp, err := ts.Client().Do(req)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&fired))
+		assert.Equal(t, fired["fired"], int64(1))
+
+		var globals map[string]interface{}
+		request(t, ts, "GET", "/sessions/"+id+"/globals", "", http.StatusOK, &globals)
+		assert.Equal(t, globals["shipped"], float64(3))
+
+		var output map[string]string
+		request(t, ts, "GET", "/sessions/"+id+"/output", "", http.StatusOK, &output)
+		assert.Equal(t, output["output"], "shipping 2 to initech\nshipping 1 to acme\nshipping 3 to globex\n")
+		request(t, ts, "GET", "/sessions/"+id+"/output", "", http.StatusOK, &output)
+		assert.Equal(t, output["output"], "")
+	})
+
+	t.Run("Sessions are separate", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{PoolSize: 1})
+		first := createSession(t, ts)
+		second := createSession(t, ts)
+
+		request(t, ts, "POST", "/sessions/"+first+"/facts", `[{"fact": "(order (id 1))"}]`, http.StatusCreated, nil)
+		var facts []FactResponse
+		request(t, ts, "GET", "/sessions/"+second+"/facts", "", http.StatusOK, &facts)
+		for _, fact := range facts {
+			assert.Assert(t, fact.Template != "order")
+		}
+	})
+
+	t.Run("Instances", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{})
+		id := createSession(t, ts)
+
+		var instances []InstanceResponse
+		request(t, ts, "POST", "/sessions/"+id+"/instances", `[
+			{"name": "acme", "class": "CUSTOMER", "slots": {"name": "Acme", "credit": 100}}
+		]`, http.StatusCreated, &instances)
+		assert.Equal(t, len(instances), 1)
+		assert.Equal(t, instances[0].Name, "acme")
+		assert.Equal(t, instances[0].Slots["name"], "Acme")
+		assert.Equal(t, instances[0].Slots["credit"], float64(100))
+
+		request(t, ts, "POST", "/sessions/"+id+"/instances", `[{"class": "NOBODY"}]`, http.StatusBadRequest, nil)
+
+		request(t, ts, "GET", "/sessions/"+id+"/instances", "", http.StatusOK, &instances)
+		names := []string{}
+		for _, inst := range instances {
+			names = append(names, inst.Name)
+		}
+		assert.Assert(t, strings.Contains(strings.Join(names, " "), "acme"))
+	})
+
+	t.Run("Eval", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{})
+		id := createSession(t, ts)
+
+		var result map[string]interface{}
+		request(t, ts, "POST", "/sessions/"+id+"/eval", `{"expression": "(create$ a \"b\" 3)"}`, http.StatusOK, &result)
+		assert.DeepEqual(t, result["result"], []interface{}{"a", "b", float64(3)})
+		request(t, ts, "POST", "/sessions/"+id+"/eval", `{"expression": "(nosuchfunction)"}`, http.StatusBadRequest, nil)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{Timeout: 50 * time.Millisecond})
+		id := createSession(t, ts)
+
+		request(t, ts, "POST", "/sessions/"+id+"/facts", `[{"fact": "(spin)"}]`, http.StatusCreated, nil)
+		start := time.Now()
+		var body map[string]string
+		request(t, ts, "POST", "/sessions/"+id+"/run", "", http.StatusServiceUnavailable, &body)
+		assert.Assert(t, time.Since(start) < 5*time.Second)
+		assert.Assert(t, strings.Contains(body["error"], "deadline exceeded"), body["error"])
+
+		start = time.Now()
+		request(t, ts, "POST", "/sessions/"+id+"/eval", `{"expression": "(loop-for-count 1000000000)"}`, http.StatusServiceUnavailable, &body)
+		assert.Assert(t, time.Since(start) < 5*time.Second)
+		assert.Assert(t, strings.Contains(body["error"], "deadline exceeded"), body["error"])
+
+		// the session stays usable once halted
+		var result map[string]interface{}
+		request(t, ts, "POST", "/sessions/"+id+"/eval", `{"expression": "(+ 1 2)"}`, http.StatusOK, &result)
+		assert.Equal(t, result["result"], float64(3))
+	})
+
+	t.Run("Concurrent sessions", func(t *testing.T) {
+		// meant for go test -race: sessions run rules at once while the pool refills
+		_, ts := newTestServer(t, Options{PoolSize: 1})
+		ids := []string{createSession(t, ts), createSession(t, ts)}
+
+		post := func(path, body string) error {
+			resp, err := ts.Client().Post(ts.URL+path, "application/json", strings.NewReader(body))
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusMultipleChoices {
+				return fmt.Errorf("POST %s: %s", path, resp.Status)
+			}
+			return nil
+		}
+		errs := make(chan error, len(ids)+1)
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				for ii := 0; ii < 20; ii++ {
+					err := post("/sessions/"+id+"/facts", fmt.Sprintf(`[{"fact": "(order (id %d) (customer acme))"}]`, ii))
+					if err == nil {
+						err = post("/sessions/"+id+"/run", "")
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(id)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ii := 0; ii < 5; ii++ {
+				if err := post("/sessions", ""); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NilError(t, err)
+		}
+
+		for _, id := range ids {
+			var globals map[string]interface{}
+			request(t, ts, "GET", "/sessions/"+id+"/globals", "", http.StatusOK, &globals)
+			assert.Equal(t, globals["shipped"], float64(20))
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		_, ts := newTestServer(t, Options{})
+		id := createSession(t, ts)
+
+		resp, err := ts.Client().Get(ts.URL + "/metrics")
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(string(data), `clips_facts{env="`+id+`"}`))
+	})
+}
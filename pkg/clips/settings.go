@@ -0,0 +1,202 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+import "fmt"
+
+// Settings holds the behaviour settings of a CLIPS environment. Start from DefaultSettings or
+// env.Settings(), since the zero value turns off settings CLIPS enables by default
+type Settings struct {
+	Strategy           Strategy
+	SalienceEvaluation SalienceEvaluation
+	ClassDefaultsMode  ClassDefaultsMode
+	// FactDuplication allows asserting a fact identical to an existing one
+	FactDuplication bool
+	// IncrementalReset makes rules match existing facts as soon as they are defined
+	IncrementalReset bool
+	// ResetGlobals restores globals to their initial values on reset
+	ResetGlobals bool
+	// StaticConstraintChecking checks constraints when constructs are parsed
+	StaticConstraintChecking bool
+	// DynamicConstraintChecking checks slot values when facts and instances are created
+	DynamicConstraintChecking bool
+	// SequenceOperatorRecognition expands $? variables passed to functions
+	SequenceOperatorRecognition bool
+	// AutoFloatDividend converts the dividend of / to a float
+	AutoFloatDividend bool
+	// ConserveMemory drops the pretty-print forms of constructs
+	ConserveMemory bool
+}
+
+// DefaultSettings returns the settings of a new CLIPS environment
+func DefaultSettings() Settings {
+	return Settings{
+		Strategy:                 DEPTH,
+		SalienceEvaluation:       WHEN_DEFINED,
+		ClassDefaultsMode:        CONVENIENCE_MODE,
+		IncrementalReset:         true,
+		ResetGlobals:             true,
+		StaticConstraintChecking: true,
+		AutoFloatDividend:        true,
+	}
+}
+
+// Validate returns an error if an enumerated setting is out of range
+func (s Settings) Validate() error {
+	if s.Strategy < 0 || int(s.Strategy) >= len(clipsStrategies) {
+		return fmt.Errorf("Invalid strategy %d", int(s.Strategy))
+	}
+	if s.SalienceEvaluation < 0 || int(s.SalienceEvaluation) >= len(clipsSalienceEvaluations) {
+		return fmt.Errorf("Invalid salience evaluation %d", int(s.SalienceEvaluation))
+	}
+	if s.ClassDefaultsMode < 0 || int(s.ClassDefaultsMode) >= len(clipsClassDefaultsMode) {
+		return fmt.Errorf("Invalid class defaults mode %d", int(s.ClassDefaultsMode))
+	}
+	return nil
+}
+
+// Settings returns the current settings of the environment
+func (env *Environment) Settings() Settings {
+	return Settings{
+		Strategy:                    env.Strategy(),
+		SalienceEvaluation:          env.SalienceEvaluation(),
+		ClassDefaultsMode:           env.ClassDefaultsMode(),
+		FactDuplication:             env.FactDuplication(),
+		IncrementalReset:            env.IncrementalReset(),
+		ResetGlobals:                env.ResetGlobals(),
+		StaticConstraintChecking:    env.StaticConstraintChecking(),
+		DynamicConstraintChecking:   env.DynamicConstraintChecking(),
+		SequenceOperatorRecognition: env.SequenceOperatorRecognition(),
+		AutoFloatDividend:           env.AutoFloatDividend(),
+		ConserveMemory:              env.ConserveMemory(),
+	}
+}
+
+// ApplySettings changes every setting of the environment. The settings are validated first,
+// so that none are changed if any is invalid
+func (env *Environment) ApplySettings(s Settings) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	env.SetStrategy(s.Strategy)
+	env.SetSalienceEvaluation(s.SalienceEvaluation)
+	env.SetClassDefaultsMode(s.ClassDefaultsMode)
+	env.SetFactDuplication(s.FactDuplication)
+	env.SetIncrementalReset(s.IncrementalReset)
+	env.SetResetGlobals(s.ResetGlobals)
+	env.SetStaticConstraintChecking(s.StaticConstraintChecking)
+	env.SetDynamicConstraintChecking(s.DynamicConstraintChecking)
+	env.SetSequenceOperatorRecognition(s.SequenceOperatorRecognition)
+	env.SetAutoFloatDividend(s.AutoFloatDividend)
+	env.SetConserveMemory(s.ConserveMemory)
+	return nil
+}
+
+func cbool(val bool) C.int {
+	if val {
+		return 1
+	}
+	return 0
+}
+
+// FactDuplication returns true if identical facts may be asserted
+func (env *Environment) FactDuplication() bool {
+	return C.EnvGetFactDuplication(env.ptr()) == 1
+}
+
+// SetFactDuplication sets whether identical facts may be asserted
+func (env *Environment) SetFactDuplication(val bool) {
+	C.EnvSetFactDuplication(env.ptr(), cbool(val))
+}
+
+// IncrementalReset returns true if rules match existing facts as soon as they are defined
+func (env *Environment) IncrementalReset() bool {
+	return C.EnvGetIncrementalReset(env.ptr()) == 1
+}
+
+// SetIncrementalReset sets whether rules match existing facts as soon as they are defined
+func (env *Environment) SetIncrementalReset(val bool) {
+	C.EnvSetIncrementalReset(env.ptr(), cbool(val))
+}
+
+// ResetGlobals returns true if globals are restored to their initial values on reset
+func (env *Environment) ResetGlobals() bool {
+	return C.EnvGetResetGlobals(env.ptr()) == 1
+}
+
+// SetResetGlobals sets whether globals are restored to their initial values on reset
+func (env *Environment) SetResetGlobals(val bool) {
+	C.EnvSetResetGlobals(env.ptr(), cbool(val))
+}
+
+// StaticConstraintChecking returns true if constraints are checked when constructs are parsed
+func (env *Environment) StaticConstraintChecking() bool {
+	return C.EnvGetStaticConstraintChecking(env.ptr()) == 1
+}
+
+// SetStaticConstraintChecking sets whether constraints are checked when constructs are parsed
+func (env *Environment) SetStaticConstraintChecking(val bool) {
+	C.EnvSetStaticConstraintChecking(env.ptr(), cbool(val))
+}
+
+// DynamicConstraintChecking returns true if slot values are checked when facts and instances
+// are created
+func (env *Environment) DynamicConstraintChecking() bool {
+	return C.EnvGetDynamicConstraintChecking(env.ptr()) == 1
+}
+
+// SetDynamicConstraintChecking sets whether slot values are checked when facts and instances
+// are created
+func (env *Environment) SetDynamicConstraintChecking(val bool) {
+	C.EnvSetDynamicConstraintChecking(env.ptr(), cbool(val))
+}
+
+// SequenceOperatorRecognition returns true if $? variables passed to functions are expanded
+func (env *Environment) SequenceOperatorRecognition() bool {
+	return C.EnvGetSequenceOperatorRecognition(env.ptr()) == 1
+}
+
+// SetSequenceOperatorRecognition sets whether $? variables passed to functions are expanded
+func (env *Environment) SetSequenceOperatorRecognition(val bool) {
+	C.EnvSetSequenceOperatorRecognition(env.ptr(), cbool(val))
+}
+
+// AutoFloatDividend returns true if the dividend of / is converted to a float
+func (env *Environment) AutoFloatDividend() bool {
+	return C.EnvGetAutoFloatDividend(env.ptr()) == 1
+}
+
+// SetAutoFloatDividend sets whether the dividend of / is converted to a float
+func (env *Environment) SetAutoFloatDividend(val bool) {
+	C.EnvSetAutoFloatDividend(env.ptr(), cbool(val))
+}
+
+// ConserveMemory returns true if the pretty-print forms of constructs are dropped
+func (env *Environment) ConserveMemory() bool {
+	return C.EnvGetConserveMemory(env.ptr()) == 1
+}
+
+// SetConserveMemory sets whether the pretty-print forms of constructs are dropped, for
+// constructs defined afterwards
+func (env *Environment) SetConserveMemory(val bool) {
+	C.EnvSetConserveMemory(env.ptr(), cbool(val))
+}
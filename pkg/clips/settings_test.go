@@ -0,0 +1,92 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSettings(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		assert.DeepEqual(t, env.Settings(), DefaultSettings())
+	})
+
+	t.Run("Getters and setters", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		env.SetFactDuplication(true)
+		assert.Assert(t, env.FactDuplication())
+		_, err := env.AssertString(`(a 1)`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(a 1)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(env.Facts()), 2)
+
+		env.SetAutoFloatDividend(false)
+		assert.Assert(t, !env.AutoFloatDividend())
+		ret, err := env.Eval(`(/ 7 2)`)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, int64(3))
+
+		env.SetResetGlobals(false)
+		assert.Assert(t, !env.ResetGlobals())
+		env.SetIncrementalReset(false)
+		assert.Assert(t, !env.IncrementalReset())
+		env.SetStaticConstraintChecking(false)
+		assert.Assert(t, !env.StaticConstraintChecking())
+		env.SetDynamicConstraintChecking(true)
+		assert.Assert(t, env.DynamicConstraintChecking())
+		env.SetSequenceOperatorRecognition(true)
+		assert.Assert(t, env.SequenceOperatorRecognition())
+		env.SetConserveMemory(true)
+		assert.Assert(t, env.ConserveMemory())
+	})
+
+	t.Run("Apply settings", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		settings := DefaultSettings()
+		settings.Strategy = BREADTH
+		settings.FactDuplication = true
+		settings.DynamicConstraintChecking = true
+		err := env.ApplySettings(settings)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, env.Settings(), settings)
+
+		invalid := settings
+		invalid.FactDuplication = false
+		invalid.SalienceEvaluation = SalienceEvaluation(42)
+		err = env.ApplySettings(invalid)
+		assert.ErrorContains(t, err, "Invalid salience evaluation")
+		assert.DeepEqual(t, env.Settings(), settings)
+	})
+
+	t.Run("Settings option", func(t *testing.T) {
+		settings := DefaultSettings()
+		settings.SequenceOperatorRecognition = true
+		env := CreateEnvironment(WithSettings(settings))
+		defer env.Delete()
+
+		assert.Assert(t, env.SequenceOperatorRecognition())
+		assert.DeepEqual(t, env.Settings(), settings)
+	})
+}
@@ -34,6 +34,9 @@ const (
 
 // InsertClass creates a representation of a Go struct as a CLIPS defclass
 func (env *Environment) InsertClass(basis interface{}, opts ...InsertClassOption) (*Class, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	typ := reflect.TypeOf(basis)
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
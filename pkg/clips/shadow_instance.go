@@ -25,6 +25,9 @@ import (
 // Insert inserts the given object as a shadow instance in CLIPS. A shadow class
 // will be created if it does not already exist
 func (env *Environment) Insert(name string, basis interface{}, opts ...InsertClassOption) (*Instance, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
 	knownBases := make(map[reflect.Value]InstanceName)
 	return env.insertInstance(name, basis, knownBases)
 }
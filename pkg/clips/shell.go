@@ -18,13 +18,13 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"regexp"
 	"strings"
 
 	"github.com/alecthomas/chroma"
 	"github.com/alecthomas/chroma/formatters"
 	"github.com/alecthomas/chroma/styles"
 	"github.com/c-bata/go-prompt"
+	"github.com/mattsmi/clipsgo/v0.2.0/pkg/clips/lexer"
 )
 
 // ShellContext stores the context of the shell environment
@@ -458,24 +458,50 @@ func (hw *HighlightedWriter) SetColor(fg, bg prompt.Color, bold bool) {
 }
 
 func completer(d prompt.Document) []prompt.Suggest {
-	s := []prompt.Suggest{
-		/* Just leave it to syntax highlighting for now
-		{Text: "agenda", Description: "list agenda"},
-		{Text: "defclass", Description: "define a class"},
-		{Text: "deffunction", Description: "define a function"},
-		{Text: "defmessage-handler", Description: "define a function"},
-		{Text: "defrule", Description: "define a rule"},
-		{Text: "deftemplate", Description: "define a template fact"},
-		{Text: "facts", Description: "list current facts"},
-		{Text: "instances", Description: "list current instances"},
-		{Text: "matches", Description: "list matches for a rule"},
-		{Text: "watch", Description: "enable watch"},
-		{Text: "unwatch", Description: "disable watch"},
-		{Text: "rules", Description: "disable watch"},
-		{Text: "exit", Description: "exit the shell"},
-		*/
+	word := d.GetWordBeforeCursorUntilSeparator("( ")
+	if word == "" {
+		return nil
 	}
-	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), false)
+	return shellContext.env.Complete(word)
+}
+
+// Complete returns suggestions for a partially typed word: the builtin functions, the construct
+// keywords, and the functions, templates, classes and globals defined in the environment
+func (env *Environment) Complete(word string) []prompt.Suggest {
+	var s []prompt.Suggest
+	seen := make(map[string]bool)
+	add := func(text string, description string) {
+		if !seen[text] {
+			seen[text] = true
+			s = append(s, prompt.Suggest{Text: text, Description: description})
+		}
+	}
+	for _, fn := range env.Functions() {
+		add(fn.Name(), "deffunction")
+	}
+	for _, gen := range env.Generics() {
+		add(gen.Name(), "defgeneric")
+	}
+	for _, tmpl := range env.Templates() {
+		if !tmpl.Implied() {
+			add(tmpl.Name(), "deftemplate")
+		}
+	}
+	for _, class := range env.Classes() {
+		add(class.Name(), "defclass")
+	}
+	for _, global := range env.Globals() {
+		add("?*"+global.Name()+"*", "defglobal")
+	}
+	for _, kw := range keywords {
+		if strings.HasPrefix(kw, "def") {
+			add(kw, "construct")
+		}
+	}
+	for _, bi := range builtins {
+		add(bi, "function")
+	}
+	return prompt.FilterHasPrefix(s, word, false)
 }
 
 func changePrefix() (string, bool) {
@@ -510,52 +536,106 @@ func executor(in string) {
 }
 
 func initContext(env *Environment) {
-	rules := []chroma.Rule{
-		{Pattern: `;.*$`, Type: chroma.Comment, Mutator: nil},
-		{Pattern: `\s+`, Type: chroma.Text, Mutator: nil},
-		{Pattern: `-?\d+\.\d+`, Type: chroma.NumberFloat, Mutator: nil},
-		{Pattern: `-?\d+`, Type: chroma.NumberInteger, Mutator: nil},
-		{Pattern: `"(\\\\|\\"|[^"])*"`, Type: chroma.String, Mutator: nil},
-		{Pattern: `\[([^\]]+)\]`, Type: chroma.LiteralStringOther, Mutator: nil},
-		{Pattern: `<([^>]+)>`, Type: chroma.LiteralStringOther, Mutator: nil},
-		{Pattern: `(TRUE|FALSE|nil)`, Type: chroma.NameVariableInstance, Mutator: nil},
-		{Pattern: "('|#|`|,@|,|\\.)", Type: chroma.Operator, Mutator: nil},
+	shellContext = &ShellContext{
+		cmd:       strings.Builder{},
+		env:       env,
+		lexer:     newHighlightLexer(),
+		style:     styles.Get("native"),
+		formatter: formatters.Get("terminal256"),
+	}
+}
+
+// highlightLexer colours CLIPS source by the tokens of the lexer package, so that the shell
+// splits source the same way as the formatter and the parser
+type highlightLexer struct {
+	config   *chroma.Config
+	keywords map[string]bool
+	builtins map[string]bool
+}
+
+func newHighlightLexer() *highlightLexer {
+	ret := &highlightLexer{
+		config: &chroma.Config{
+			Name:      "CLIPS",
+			Aliases:   []string{"clips", "clp"},
+			Filenames: []string{"*.clp"},
+			MimeTypes: []string{"text/x-clips", "application/x-clips"},
+		},
+		keywords: make(map[string]bool, len(keywords)),
+		builtins: make(map[string]bool, len(builtins)),
 	}
 	for _, kw := range keywords {
-		rules = append(rules, chroma.Rule{
-			Pattern: fmt.Sprintf(`(%s)`, regexp.QuoteMeta(kw)),
-			Type:    chroma.Keyword,
-			Mutator: nil,
-		})
+		ret.keywords[kw] = true
 	}
 	for _, bi := range builtins {
-		rules = append(rules, chroma.Rule{
-			Pattern: fmt.Sprintf(`(?<=\(\s*)(%s)`, regexp.QuoteMeta(bi)),
-			Type:    chroma.NameBuiltin,
-			Mutator: nil,
-		})
+		ret.builtins[bi] = true
 	}
-	for _, rl := range []chroma.Rule{
-		{Pattern: `\?`, Type: chroma.NameLabel, Mutator: nil},
-		{Pattern: `(\(|\))`, Type: chroma.Punctuation, Mutator: nil},
-		{Pattern: `[\w!$%*+,/:<=>@^~|-]+`, Type: chroma.Text, Mutator: nil},
-	} {
-		rules = append(rules, rl)
+	return ret
+}
+
+// Config returns the description of the lexer
+func (l *highlightLexer) Config() *chroma.Config {
+	return l.config
+}
+
+// Tokenise returns the highlighted tokens of text. Source being typed may end part way
+// through a string or instance name, so the rest of it is given as that token
+func (l *highlightLexer) Tokenise(options *chroma.TokeniseOptions, text string) (chroma.Iterator, error) {
+	ret := make([]chroma.Token, 0, len(text)/4)
+	scanner := lexer.NewScanner(text)
+	offset := 0
+	prev := lexer.EOF
+	for {
+		tok, err := scanner.Next()
+		if tok.Pos.Offset > offset {
+			ret = append(ret, chroma.Token{Type: chroma.Text, Value: text[offset:tok.Pos.Offset]})
+		}
+		if err != nil {
+			tok.Value = text[tok.Pos.Offset:]
+		} else if tok.Kind == lexer.EOF {
+			break
+		}
+		ret = append(ret, chroma.Token{Type: l.tokenType(tok, prev), Value: tok.Value})
+		if err != nil {
+			break
+		}
+		offset = tok.End.Offset
+		prev = tok.Kind
 	}
-	shellContext = &ShellContext{
-		cmd: strings.Builder{},
-		env: env,
-		lexer: chroma.MustNewLexer(&chroma.Config{
-			Name:      "CLIPS",
-			Aliases:   []string{"clips", "clp"},
-			Filenames: []string{"*.clp"},
-			MimeTypes: []string{"text/x-clips", "application/x-clips"},
-		}, chroma.Rules{
-			"root": rules,
-		}),
-		style:     styles.Get("native"),
-		formatter: formatters.Get("terminal256"),
+	return chroma.Literator(ret...), nil
+}
+
+func (l *highlightLexer) tokenType(tok lexer.Token, prev lexer.Kind) chroma.TokenType {
+	switch tok.Kind {
+	case lexer.LPAREN, lexer.RPAREN:
+		return chroma.Punctuation
+	case lexer.COMMENT:
+		return chroma.Comment
+	case lexer.STRING:
+		return chroma.String
+	case lexer.INTEGER:
+		return chroma.NumberInteger
+	case lexer.FLOAT:
+		return chroma.NumberFloat
+	case lexer.INSTANCE_NAME:
+		return chroma.LiteralStringOther
+	case lexer.VARIABLE, lexer.GLOBAL_VARIABLE:
+		return chroma.NameLabel
+	case lexer.OPERATOR:
+		return chroma.Operator
+	}
+	switch {
+	case tok.Value == "TRUE" || tok.Value == "FALSE" || tok.Value == "nil":
+		return chroma.NameVariableInstance
+	case strings.HasPrefix(tok.Value, "<") && strings.HasSuffix(tok.Value, ">") && len(tok.Value) > 2:
+		// addresses as printed, such as <Fact-1>
+		return chroma.LiteralStringOther
+	case l.keywords[tok.Value]:
+		return chroma.Keyword
+	case prev == lexer.LPAREN && l.builtins[tok.Value]:
+		return chroma.NameBuiltin
 	}
+	return chroma.Text
 }
 
 // Shell sets up an interactive CLIPS shell within the given environment
@@ -0,0 +1,264 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ShellOption configures a shell served by ServeShell
+type ShellOption func(s *shellServer)
+
+// ShellReadOnly refuses commands which may change the environment, allowing only those which
+// list or print constructs, facts, instances and the agenda, and functions without side effects
+func ShellReadOnly() ShellOption {
+	return func(s *shellServer) {
+		s.readOnly = true
+	}
+}
+
+// ShellLock sets the lock held while each command runs. Environments are not safe for
+// concurrent use, so if env is used by other goroutines while the shell is served, lock must
+// be the lock they hold while using it
+func ShellLock(lock sync.Locker) ShellOption {
+	return func(s *shellServer) {
+		s.lock = lock
+	}
+}
+
+// shellReadOnlyFunctions are the functions allowed in a read-only shell
+var shellReadOnlyFunctions = make(map[string]bool)
+
+func init() {
+	for _, name := range strings.Fields(`
+		facts instances agenda matches list-focus-stack get-focus get-focus-stack
+		list-defrules list-deftemplates list-deffacts list-defglobals list-deffunctions
+		list-defgenerics list-defmethods list-defclasses list-definstances list-defmodules
+		list-defmessage-handlers show-defglobals browse-classes describe-class
+		ppdefrule ppdeftemplate ppdeffacts ppdefglobal ppdeffunction ppdefgeneric ppdefmethod
+		ppdefclass ppdefinstances ppdefmodule ppdefmessage-handler
+		get-defrule-list get-deftemplate-list get-deffacts-list get-defglobal-list
+		get-deffunction-list get-defgeneric-list get-defclass-list get-definstances-list
+		get-defmodule-list get-strategy get-salience-evaluation get-current-module mem-used
+		profile-info
+		fact-existp fact-index fact-relation fact-slot-names fact-slot-value
+		any-factp find-fact find-all-facts
+		instance-existp instance-name instance-address instancep class class-slots class-superclasses
+		class-subclasses slot-existp any-instancep find-instance find-all-instances
+		deftemplate-slot-names deftemplate-slot-types deftemplate-slot-multip
+		+ - * / div mod abs max min integer float round = <> < > <= >= eq neq and or not
+		numberp integerp floatp symbolp stringp lexemep multifieldp evenp oddp
+		str-cat sym-cat str-length str-index sub-string upcase lowcase str-compare
+		create$ length$ nth$ member$ subseq$ first$ rest$ implode$ explode$ subsetp
+	`) {
+		shellReadOnlyFunctions[name] = true
+	}
+}
+
+// shellServer serves shells on the connections of a listener
+type shellServer struct {
+	env      *Environment
+	readOnly bool
+	lock     sync.Locker
+}
+
+// ServeShell accepts connections on listener, running a line-based shell within the
+// environment on each until the client closes it or sends (exit). Output of each command goes
+// to the connection which sent it, and input read by (read) or (readline) comes from it.
+// Commands from all connections run one at a time. ServeShell returns once the listener is
+// closed, with the error from Accept
+func (env *Environment) ServeShell(listener net.Listener, opts ...ShellOption) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	s := &shellServer{env: env}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.lock == nil {
+		s.lock = &sync.Mutex{}
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// ListenShell listens on a Unix socket at path for ServeShell. The socket is given the
+// permissions perm, such as 0600, so that only the users allowed to write to it can attach to
+// the shell. The socket is made in a directory only the process can reach, and moved to path
+// once it has its permissions, so that it is never open to others. A socket left behind at path
+// is removed first; any other file at path is an error, and is left alone
+func ListenShell(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".clipsgo-shell")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "shell.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, perm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &shellListener{UnixListener: listener, path: path}, nil
+}
+
+// shellListener is a listener on a Unix socket moved to path after it was made
+type shellListener struct {
+	*net.UnixListener
+	path string
+}
+
+// Addr returns the address of the socket at path
+func (l *shellListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// Close stops listening and removes the socket
+func (l *shellListener) Close() error {
+	err := l.UnixListener.Close()
+	if rmErr := os.Remove(l.path); err == nil && rmErr != nil && !os.IsNotExist(rmErr) {
+		err = rmErr
+	}
+	return err
+}
+
+// serve runs the shell for one connection
+func (s *shellServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var cmd strings.Builder
+	for {
+		prompt := primaryPrompt
+		if cmd.Len() > 0 {
+			prompt = secondaryPrompt
+		}
+		if _, err := io.WriteString(conn, prompt); err != nil {
+			return
+		}
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			return
+		}
+		cmd.WriteString(strings.TrimRight(line, "\r\n") + "\n")
+		cmdstr := cmd.String()
+		if strings.TrimSpace(cmdstr) == "" {
+			cmd.Reset()
+			continue
+		}
+
+		s.lock.Lock()
+		complete, err := s.env.CompleteCommand(cmdstr)
+		s.lock.Unlock()
+		if err != nil {
+			fmt.Fprintf(conn, "[SHELL]: %s\n", err.Error())
+			cmd.Reset()
+			continue
+		}
+		if complete {
+			cmd.Reset()
+			if !s.execute(conn, reader, strings.TrimRight(cmdstr, "\n")) {
+				return
+			}
+		}
+	}
+}
+
+// execute runs a complete command, returning false if the connection should be closed
+func (s *shellServer) execute(conn net.Conn, reader *bufio.Reader, cmdstr string) bool {
+	for ii, name := range shellCalls(cmdstr) {
+		if name == "exit" {
+			// (exit) would end the whole process, so it ends the connection instead
+			if ii == 0 {
+				return false
+			}
+			fmt.Fprintf(conn, "[SHELL]: exit is only allowed on its own\n")
+			return true
+		}
+		if s.readOnly && !shellReadOnlyFunctions[name] {
+			fmt.Fprintf(conn, "[SHELL]: %s is not allowed in a read-only shell\n", name)
+			return true
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writers := make(map[string]io.Writer, len(stdoutNames)+len(stderrNames))
+	for _, name := range stdoutNames {
+		writers[name] = conn
+	}
+	for _, name := range stderrNames {
+		writers[name] = conn
+	}
+	// at the level of Capture, so that output goes to this connection and nowhere else
+	output := createWriterRouter(s.env, "go-shell-router", writers, 35)
+	defer output.Delete()
+	input := CreateReaderRouter(s.env, reader)
+	defer input.Delete()
+
+	if err := s.env.SendCommand(cmdstr); err != nil {
+		fmt.Fprintf(conn, "[SHELL]: %s\n", err.Error())
+	}
+	return true
+}
+
+var (
+	shellIgnored = regexp.MustCompile(`"(\\.|[^"\\])*"|;[^\n]*`)
+	shellCall    = regexp.MustCompile(`\(\s*([^\s()"]+)`)
+)
+
+// shellCalls returns the names of the functions and constructs called within a command,
+// ignoring strings, comments and variables. Calls are listed for every parenthesis, so that
+// the patterns of rules are included too
+func shellCalls(cmd string) []string {
+	cmd = shellIgnored.ReplaceAllString(cmd, `""`)
+	ret := make([]string, 0)
+	for _, m := range shellCall.FindAllStringSubmatch(cmd, -1) {
+		if strings.HasPrefix(m[1], "?") || strings.HasPrefix(m[1], "$?") {
+			continue
+		}
+		ret = append(ret, m[1])
+	}
+	return ret
+}
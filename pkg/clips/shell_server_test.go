@@ -0,0 +1,197 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// shellClient sends commands to a served shell, reading the output up to each prompt
+type shellClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialShell(t *testing.T, listener net.Listener) *shellClient {
+	conn, err := net.Dial(listener.Addr().Network(), listener.Addr().String())
+	assert.NilError(t, err)
+	ret := &shellClient{conn: conn, reader: bufio.NewReader(conn)}
+	assert.Equal(t, ret.prompt(t), "")
+	return ret
+}
+
+// prompt returns the output before the next prompt
+func (c *shellClient) prompt(t *testing.T) string {
+	var out strings.Builder
+	for {
+		ch, _, err := c.reader.ReadRune()
+		assert.NilError(t, err)
+		out.WriteRune(ch)
+		for _, p := range []string{primaryPrompt, secondaryPrompt} {
+			if strings.HasSuffix(out.String(), p) {
+				return strings.TrimSuffix(out.String(), p)
+			}
+		}
+	}
+}
+
+func (c *shellClient) send(t *testing.T, line string) string {
+	_, err := io.WriteString(c.conn, line+"\n")
+	assert.NilError(t, err)
+	return c.prompt(t)
+}
+
+func TestServeShell(t *testing.T) {
+	t.Run("Commands", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NilError(t, err)
+		defer listener.Close()
+		var mu sync.Mutex
+		go env.ServeShell(listener, ShellLock(&mu))
+
+		client := dialShell(t, listener)
+		defer client.conn.Close()
+		assert.Equal(t, client.send(t, `(printout t "hello" crlf)`), "hello\n")
+		assert.Equal(t, client.send(t, `(+ 1 2)`), "3\n")
+		assert.Equal(t, client.send(t, `(defrule greet (name ?n)`), "")
+		assert.Equal(t, client.send(t, `=> (printout t "hi " ?n crlf))`), "")
+		assert.Equal(t, client.send(t, `(assert (name bob))`), "<Fact-1>\n")
+		assert.Equal(t, client.send(t, `(run)`), "hi bob\n")
+		assert.Equal(t, client.send(t, ``), "")
+		assert.Assert(t, strings.Contains(client.send(t, `(nosuchfunction)`), "[SHELL]"))
+
+		// (readline) reads from the connection
+		assert.Equal(t, client.send(t, "(readline)\nthe answer"), `"the answer"`+"\n")
+
+		mu.Lock()
+		_, err = env.FindRule("greet")
+		mu.Unlock()
+		assert.NilError(t, err)
+
+		// (exit) ends the connection and not the process
+		_, err = io.WriteString(client.conn, "(exit)\n")
+		assert.NilError(t, err)
+		_, err = client.reader.ReadByte()
+		assert.Equal(t, err, io.EOF)
+	})
+
+	t.Run("Output goes to its connection", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NilError(t, err)
+		defer listener.Close()
+		go env.ServeShell(listener)
+
+		var out strings.Builder
+		router := CreateWriterRouter(env, map[string]io.Writer{"t": &out})
+		defer router.Delete()
+
+		first := dialShell(t, listener)
+		defer first.conn.Close()
+		second := dialShell(t, listener)
+		defer second.conn.Close()
+		assert.Equal(t, first.send(t, `(printout t "first" crlf)`), "first\n")
+		assert.Equal(t, second.send(t, `(printout t "second" crlf)`), "second\n")
+		assert.Equal(t, out.String(), "")
+	})
+
+	t.Run("Read only", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+		err := env.Build(`(deftemplate order (slot id))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(order (id 1))`)
+		assert.NilError(t, err)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NilError(t, err)
+		defer listener.Close()
+		go env.ServeShell(listener, ShellReadOnly())
+
+		client := dialShell(t, listener)
+		defer client.conn.Close()
+		assert.Assert(t, strings.Contains(client.send(t, `(facts)`), "(order (id 1))"))
+		assert.Equal(t, client.send(t, `(find-all-facts ((?f order)) (> ?f:id 0))`), "(<Fact-1>)\n")
+		assert.Equal(t, client.send(t, `(assert (order (id 2)))`), "[SHELL]: assert is not allowed in a read-only shell\n")
+		assert.Equal(t, client.send(t, `(+ 1 (retract 1))`), "[SHELL]: retract is not allowed in a read-only shell\n")
+		assert.Equal(t, client.send(t, `(str-cat "(assert (x))")`), "\"(assert (x))\"\n")
+		assert.Equal(t, len(env.Facts()), 2)
+	})
+
+	t.Run("Unix socket", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "clipsgo-shell")
+		assert.NilError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "shell.sock")
+		// a socket left behind is replaced
+		stale, err := net.Listen("unix", path)
+		assert.NilError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		env := CreateEnvironment()
+		defer env.Delete()
+		listener, err := ListenShell(path, 0600)
+		assert.NilError(t, err)
+		defer listener.Close()
+		info, err := os.Stat(path)
+		assert.NilError(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+		// the directory the socket was made in is gone
+		entries, err := ioutil.ReadDir(dir)
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 1)
+
+		done := make(chan error)
+		go func() { done <- env.ServeShell(listener) }()
+		client := dialShell(t, listener)
+		assert.Equal(t, client.send(t, `(* 6 7)`), "42\n")
+		client.conn.Close()
+
+		listener.Close()
+		assert.Assert(t, <-done != nil)
+		_, err = os.Lstat(path)
+		assert.Assert(t, os.IsNotExist(err))
+
+		// any other file is not replaced
+		other := filepath.Join(dir, "notes.txt")
+		err = ioutil.WriteFile(other, []byte("keep"), 0644)
+		assert.NilError(t, err)
+		_, err = ListenShell(other, 0600)
+		assert.ErrorContains(t, err, "exists and is not a socket")
+		data, err := ioutil.ReadFile(other)
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), "keep")
+	})
+}
+
+func TestShellCalls(t *testing.T) {
+	assert.DeepEqual(t, shellCalls(`(facts)`), []string{"facts"})
+	assert.DeepEqual(t, shellCalls(`(printout t "(assert (x))" (+ 1 2)) ; (retract 1)`), []string{"printout", "+"})
+	assert.DeepEqual(t, shellCalls(`(do-for-fact ((?f order)) TRUE (retract ?f))`), []string{"do-for-fact", "retract"})
+	assert.DeepEqual(t, shellCalls(`?*global*`), []string{})
+}
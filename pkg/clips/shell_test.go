@@ -0,0 +1,70 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"testing"
+
+	"github.com/alecthomas/chroma"
+	"github.com/c-bata/go-prompt"
+	"gotest.tools/assert"
+)
+
+func TestComplete(t *testing.T) {
+	env := CreateEnvironment()
+	defer env.Delete()
+
+	err := env.Build(`(deftemplate order-line (slot qty))`)
+	assert.NilError(t, err)
+	err = env.Build(`(deffunction order-total (?x) ?x)`)
+	assert.NilError(t, err)
+	err = env.Build(`(defglobal ?*orders* = 0)`)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, env.Complete("order"), []prompt.Suggest{
+		{Text: "order-total", Description: "deffunction"},
+		{Text: "order-line", Description: "deftemplate"},
+	})
+	assert.DeepEqual(t, env.Complete("?*o"), []prompt.Suggest{
+		{Text: "?*orders*", Description: "defglobal"},
+	})
+	assert.DeepEqual(t, env.Complete("deft"), []prompt.Suggest{
+		{Text: "deftemplate", Description: "construct"},
+	})
+	assert.DeepEqual(t, env.Complete("asse"), []prompt.Suggest{
+		{Text: "assert", Description: "function"},
+	})
+}
+
+func TestHighlight(t *testing.T) {
+	iterator, err := newHighlightLexer().Tokenise(nil, `(assert (order ?x TRUE 1.5)) ; done
+(printout t "unfinished`)
+	assert.NilError(t, err)
+	types := make([]chroma.TokenType, 0)
+	values := ""
+	for _, tok := range iterator.Tokens() {
+		if tok.Type != chroma.Text {
+			types = append(types, tok.Type)
+		}
+		values += tok.Value
+	}
+	assert.DeepEqual(t, types, []chroma.TokenType{
+		chroma.Punctuation, chroma.NameBuiltin, chroma.Punctuation, chroma.NameLabel,
+		chroma.NameVariableInstance, chroma.NumberFloat, chroma.Punctuation, chroma.Punctuation,
+		chroma.Comment, chroma.Punctuation, chroma.NameBuiltin, chroma.String,
+	})
+	// every character is kept, including the white space between tokens
+	assert.Equal(t, values, "(assert (order ?x TRUE 1.5)) ; done\n(printout t \"unfinished")
+}
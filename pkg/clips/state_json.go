@@ -0,0 +1,465 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportOptions select the facts and instances written by ExportJSON
+type ExportOptions struct {
+	// Templates limits the facts written to those of the named templates, given as name or
+	// MODULE::name. Facts of all templates are written if it is empty
+	Templates []string
+	// Classes limits the instances written to those of the named classes, not including
+	// subclasses. Instances of all classes are written if it is empty
+	Classes []string
+	// SkipFacts and SkipInstances leave out all facts or all instances
+	SkipFacts     bool
+	SkipInstances bool
+	// Indent indents the JSON written, such as by "  ". It is written on a single line if empty
+	Indent string
+}
+
+// stateJSON is the document written by ExportJSON and read by ImportJSON
+type stateJSON struct {
+	Facts     map[string][]factJSON `json:"facts"`
+	Instances []instanceJSON        `json:"instances"`
+}
+
+type factJSON struct {
+	Index  *int                   `json:"index,omitempty"`
+	Slots  map[string]interface{} `json:"slots,omitempty"`
+	Values []interface{}          `json:"values,omitempty"`
+}
+
+type instanceJSON struct {
+	Name  string                 `json:"name"`
+	Class string                 `json:"class"`
+	Slots map[string]interface{} `json:"slots,omitempty"`
+}
+
+// ExportJSON writes facts and instances as JSON, in the form
+//
+//	{
+//	  "facts": {
+//	    "MAIN::order": [{"index": 1, "slots": {"id": 1, "customer": {"symbol": "acme"}, "items": ["bolt", 2.5]}}],
+//	    "MAIN::point": [{"index": 2, "values": [1, 2]}]
+//	  },
+//	  "instances": [{"name": "acme", "class": "CUSTOMER", "slots": {"credit": 100.0}}]
+//	}
+//
+// Facts are grouped by template, keyed by the name of the template qualified by its module, with the slots of deftemplate facts as a map and the fields
+// of ordered facts as "values". Instances give their class, name and slots. Values are
+//
+//	CLIPS                JSON
+//	STRING               "text"
+//	INTEGER              1
+//	FLOAT                1.0, always with a decimal point or exponent
+//	SYMBOL               {"symbol": "acme"}, except nil, TRUE and FALSE, which are null, true and false
+//	INSTANCE-NAME        {"instance-name": "acme"}
+//	FACT-ADDRESS         {"fact": 1}, the index of the fact
+//	INSTANCE-ADDRESS     {"instance": "acme"}, the name of the instance
+//	MULTIFIELD           an array
+//
+// The initial-fact and initial-object are not written. External addresses cannot be written
+func (env *Environment) ExportJSON(w io.Writer, opts ExportOptions) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	doc := stateJSON{
+		Facts:     make(map[string][]factJSON),
+		Instances: make([]instanceJSON, 0),
+	}
+	if !opts.SkipFacts {
+		templates := exportFilter(opts.Templates)
+		for _, fact := range env.Facts() {
+			tmpl := fact.Template()
+			name := tmpl.Name()
+			key := qualify(tmpl.Module().Name(), name)
+			if name == "initial-fact" || !(templates(name) || templates(key)) {
+				continue
+			}
+			entry, err := exportFact(fact, tmpl)
+			if err != nil {
+				return fmt.Errorf("Fact f-%d: %v", fact.Index(), err)
+			}
+			doc.Facts[key] = append(doc.Facts[key], entry)
+		}
+	}
+	if !opts.SkipInstances {
+		classes := exportFilter(opts.Classes)
+		for _, inst := range env.Instances() {
+			class := inst.Class().Name()
+			if class == "INITIAL-OBJECT" || !classes(class) {
+				continue
+			}
+			slots, err := exportSlots(inst.Slots(true))
+			if err != nil {
+				return fmt.Errorf("Instance [%s]: %v", inst.Name(), err)
+			}
+			doc.Instances = append(doc.Instances, instanceJSON{Name: string(inst.Name()), Class: class, Slots: slots})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", opts.Indent)
+	return enc.Encode(doc)
+}
+
+// exportFilter returns a function telling whether a name is one of names, or true for every
+// name if there are none
+func exportFilter(names []string) func(string) bool {
+	if len(names) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return func(name string) bool { return set[name] }
+}
+
+func exportFact(fact Fact, tmpl *Template) (factJSON, error) {
+	index := fact.Index()
+	ret := factJSON{Index: &index}
+	slots, err := fact.Slots()
+	if err != nil {
+		return ret, err
+	}
+	if tmpl.Implied() {
+		values, err := exportValue(slots[""])
+		if err != nil {
+			return ret, err
+		}
+		ret.Values, _ = values.([]interface{})
+		return ret, nil
+	}
+	ret.Slots, err = exportSlots(slots)
+	return ret, err
+}
+
+func exportSlots(slots map[string]interface{}) (map[string]interface{}, error) {
+	ret := make(map[string]interface{}, len(slots))
+	for name, value := range slots {
+		var err error
+		if ret[name], err = exportValue(value); err != nil {
+			return nil, fmt.Errorf(`Slot "%s": %v`, name, err)
+		}
+	}
+	return ret, nil
+}
+
+// exportValue returns the JSON form of a value from CLIPS
+func exportValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, int64, string:
+		return v, nil
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, fmt.Errorf("Unable to write %v as JSON", v)
+		}
+		ret := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(ret, ".e") {
+			// without a decimal point ImportJSON would read an integer
+			ret += ".0"
+		}
+		return json.Number(ret), nil
+	case Symbol:
+		return map[string]string{"symbol": string(v)}, nil
+	case InstanceName:
+		return map[string]string{"instance-name": string(v)}, nil
+	case Fact:
+		return map[string]int{"fact": v.Index()}, nil
+	case *Instance:
+		return map[string]string{"instance": string(v.Name())}, nil
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for ii, item := range v {
+			var err error
+			if ret[ii], err = exportValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("Unable to write %T as JSON", value)
+}
+
+// importedFact is a fact read by ImportJSON, in the order it is asserted
+type importedFact struct {
+	template string
+	factJSON
+}
+
+// ImportJSON asserts the facts and makes the instances written by ExportJSON. Instances are
+// made first, and their slots set once the facts are asserted, so that slots of either may
+// refer to the other. Facts are asserted in the order of their index, and those without one
+// after them. A fact address refers to a fact in the document by its index. Slots which
+// cannot be written once an instance is made keep the value it was made with. Slots left
+// out of the document take their default values. Templates may be named with or without
+// their module. If an error is returned, the facts asserted and instances made so far are
+// retracted and unmade again, though instances replaced by one of the same name are not
+// restored
+func (env *Environment) ImportJSON(r io.Reader) (err error) {
+	if err := env.check(); err != nil {
+		return err
+	}
+	var doc stateJSON
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	imp := &importer{env: env, facts: make(map[int]Fact)}
+	if facts := env.Facts(); len(facts) > 0 {
+		imp.last = facts[len(facts)-1].Index()
+	}
+	defer func() {
+		if err != nil {
+			imp.undo()
+		}
+	}()
+
+	instances := make([]*Instance, len(doc.Instances))
+	for ii, entry := range doc.Instances {
+		class, err := env.FindClass(entry.Class)
+		if err != nil {
+			return err
+		}
+		if instances[ii], err = class.NewInstance(entry.Name, false); err != nil {
+			return fmt.Errorf("Instance [%s]: %v", entry.Name, err)
+		}
+		imp.made = append(imp.made, instances[ii])
+	}
+
+	templates := make([]string, 0, len(doc.Facts))
+	for name := range doc.Facts {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	facts := make([]importedFact, 0)
+	for _, name := range templates {
+		for _, entry := range doc.Facts[name] {
+			facts = append(facts, importedFact{template: name, factJSON: entry})
+		}
+	}
+	sort.SliceStable(facts, func(i, j int) bool {
+		if facts[i].Index == nil || facts[j].Index == nil {
+			return facts[j].Index == nil && facts[i].Index != nil
+		}
+		return *facts[i].Index < *facts[j].Index
+	})
+	for _, entry := range facts {
+		fact, err := imp.assert(entry)
+		if err != nil {
+			if entry.Index != nil {
+				return fmt.Errorf("Fact %d of template \"%s\": %v", *entry.Index, entry.template, err)
+			}
+			return fmt.Errorf("Fact of template \"%s\": %v", entry.template, err)
+		}
+		if fact.Index() > imp.last {
+			// an assert of a duplicate gives the fact already there, which is left alone
+			imp.asserted = append(imp.asserted, fact)
+		}
+		if entry.Index != nil {
+			imp.facts[*entry.Index] = fact
+		}
+	}
+
+	for ii, entry := range doc.Instances {
+		if err := imp.setSlots(instances[ii], entry.Slots); err != nil {
+			return fmt.Errorf("Instance [%s]: %v", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// importer converts values read by ImportJSON, resolving references to facts and instances
+type importer struct {
+	env   *Environment
+	facts map[int]Fact
+	// last is the index of the last fact before the import
+	last int
+	// asserted and made are the facts and instances added, to undo them on error
+	asserted []Fact
+	made     []*Instance
+}
+
+// undo retracts the facts and unmakes the instances added by the import
+func (imp *importer) undo() {
+	for ii := len(imp.asserted) - 1; ii >= 0; ii-- {
+		imp.asserted[ii].Retract()
+	}
+	for ii := len(imp.made) - 1; ii >= 0; ii-- {
+		imp.made[ii].Unmake()
+	}
+}
+
+func (imp *importer) assert(entry importedFact) (Fact, error) {
+	tmpl, err := imp.env.FindTemplate(entry.template)
+	if err != nil && entry.Slots == nil {
+		// CLIPS only creates the template of ordered facts once they are asserted or matched
+		return imp.assertString(entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fact, err := tmpl.NewFact()
+	if err != nil {
+		return nil, err
+	}
+	switch f := fact.(type) {
+	case *ImpliedFact:
+		values, err := imp.values(entry.Values)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Extend(values); err != nil {
+			return nil, err
+		}
+	case *TemplateFact:
+		for name, value := range entry.Slots {
+			val, err := imp.value(value)
+			if err != nil {
+				return nil, fmt.Errorf(`Slot "%s": %v`, name, err)
+			}
+			if err := f.Set(name, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := fact.Assert(); err != nil {
+		return nil, err
+	}
+	return fact, nil
+}
+
+// assertString asserts an ordered fact written as text, for templates not yet defined
+func (imp *importer) assertString(entry importedFact) (Fact, error) {
+	values, err := imp.values(entry.Values)
+	if err != nil {
+		return nil, err
+	}
+	name := entry.template
+	if split := strings.Index(name, "::"); split >= 0 {
+		// an ordered fact cannot be asserted by a qualified name, only in its module
+		module, err := imp.env.FindModule(name[:split])
+		if err != nil {
+			return nil, err
+		}
+		current := imp.env.CurrentModule()
+		defer imp.env.SetModule(current)
+		imp.env.SetModule(module)
+		name = name[split+2:]
+	}
+	fields := []string{name}
+	for _, value := range values {
+		field, err := clipsLiteral(value)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return imp.env.AssertString("(" + strings.Join(fields, " ") + ")")
+}
+
+func (imp *importer) setSlots(inst *Instance, slots map[string]interface{}) error {
+	class := inst.Class()
+	for name, value := range slots {
+		slot, err := class.Slot(name)
+		if err != nil {
+			return err
+		}
+		if !slot.Writable() {
+			continue
+		}
+		val, err := imp.value(value)
+		if err != nil {
+			return fmt.Errorf(`Slot "%s": %v`, name, err)
+		}
+		if err := inst.SetSlot(name, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value converts a value decoded from JSON to its CLIPS value, as described for ExportJSON
+func (imp *importer) value(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return Symbol("nil"), nil
+	case bool, string:
+		return v, nil
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return v.Float64()
+		}
+		return v.Int64()
+	case []interface{}:
+		return imp.values(v)
+	case map[string]interface{}:
+		if len(v) != 1 {
+			break
+		}
+		for tag, tagged := range v {
+			switch tag {
+			case "symbol":
+				if s, ok := tagged.(string); ok {
+					return Symbol(s), nil
+				}
+			case "instance-name":
+				if s, ok := tagged.(string); ok {
+					return InstanceName(s), nil
+				}
+			case "instance":
+				if s, ok := tagged.(string); ok {
+					return imp.env.FindInstance(InstanceName(s), "")
+				}
+			case "fact":
+				if n, ok := tagged.(json.Number); ok {
+					index, err := n.Int64()
+					if err != nil {
+						return nil, err
+					}
+					fact, ok := imp.facts[int(index)]
+					if !ok {
+						return nil, NotFoundError(fmt.Errorf("Fact %d not found", index))
+					}
+					return fact, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("Invalid value %v", value)
+}
+
+func (imp *importer) values(values []interface{}) ([]interface{}, error) {
+	ret := make([]interface{}, len(values))
+	for ii, value := range values {
+		var err error
+		if ret[ii], err = imp.value(value); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,227 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+const stateConstructs = `
+(deftemplate order
+	(slot id (type INTEGER))
+	(slot customer)
+	(slot note)
+	(slot weight (type FLOAT))
+	(multislot items)
+	(slot parent))
+(defclass CUSTOMER (is-a USER)
+	(slot name)
+	(slot credit (type FLOAT))
+	(slot best-order)
+	(slot friend (type INSTANCE)))
+`
+
+func stateEnvironment(t *testing.T) *Environment {
+	env := CreateEnvironment()
+	err := env.LoadFromString(stateConstructs)
+	assert.NilError(t, err)
+	return env
+}
+
+func TestExportJSON(t *testing.T) {
+	t.Run("Values", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		_, err := env.AssertString(`(order (id 1) (customer acme) (note "acme") (weight 2.0) (items bolt "nut" 3 [acme]))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(point 1 2.5 TRUE)`)
+		assert.NilError(t, err)
+
+		var out strings.Builder
+		err = env.ExportJSON(&out, ExportOptions{SkipInstances: true})
+		assert.NilError(t, err)
+		assert.Equal(t, out.String(), `{"facts":{"MAIN::order":[{"index":1,"slots":{"customer":{"symbol":"acme"},"id":1,`+
+			`"items":[{"symbol":"bolt"},"nut",3,{"instance-name":"acme"}],"note":"acme","parent":null,"weight":2.0}}],`+
+			`"MAIN::point":[{"index":2,"values":[1,2.5,true]}]},"instances":[]}`+"\n")
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		_, err := env.AssertString(`(order (id 1))`)
+		assert.NilError(t, err)
+		_, err = env.AssertString(`(point 1 2)`)
+		assert.NilError(t, err)
+		_, err = env.MakeInstance(`(acme of CUSTOMER)`)
+		assert.NilError(t, err)
+
+		var doc map[string]map[string]interface{}
+		var out strings.Builder
+		err = env.ExportJSON(&out, ExportOptions{Templates: []string{"point"}, SkipInstances: true, Indent: "  "})
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(out.String(), "\n  \"facts\""))
+		err = json.Unmarshal([]byte(out.String()), &doc)
+		assert.NilError(t, err)
+		assert.Equal(t, len(doc["facts"]), 1)
+		assert.Assert(t, doc["facts"]["MAIN::point"] != nil)
+
+		out.Reset()
+		err = env.ExportJSON(&out, ExportOptions{Classes: []string{"CUSTOMER"}, SkipFacts: true})
+		assert.NilError(t, err)
+		assert.Assert(t, strings.HasPrefix(out.String(), `{"facts":{},"instances":[{"name":"acme","class":"CUSTOMER"`))
+	})
+}
+
+func TestImportJSON(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		first, err := env.AssertString(`(order (id 1) (customer acme) (note "acme") (weight 2.0) (items bolt "nut" 3))`)
+		assert.NilError(t, err)
+		// fact addresses cannot be given as text, so the slot is set from Go
+		tmpl, err := env.FindTemplate("order")
+		assert.NilError(t, err)
+		second, err := tmpl.NewFact()
+		assert.NilError(t, err)
+		assert.NilError(t, second.(*TemplateFact).Set("id", 2))
+		assert.NilError(t, second.(*TemplateFact).Set("parent", first))
+		assert.NilError(t, second.Assert())
+		_, err = env.AssertString(`(point 1 2.5 nil)`)
+		assert.NilError(t, err)
+		acme, err := env.MakeInstance(`(acme of CUSTOMER (name "Acme") (credit 100.0))`)
+		assert.NilError(t, err)
+		initech, err := env.MakeInstance(`(initech of CUSTOMER (name initech))`)
+		assert.NilError(t, err)
+		assert.NilError(t, acme.SetSlot("friend", initech))
+		assert.NilError(t, acme.SetSlot("best-order", second))
+
+		var out strings.Builder
+		err = env.ExportJSON(&out, ExportOptions{})
+		assert.NilError(t, err)
+
+		imported := stateEnvironment(t)
+		defer imported.Delete()
+		err = imported.ImportJSON(strings.NewReader(out.String()))
+		assert.NilError(t, err)
+
+		facts := imported.Facts()
+		assert.Equal(t, len(facts), 4)
+		assert.Equal(t, facts[1].String(), `(order (id 1) (customer acme) (note "acme") (weight 2.0) (items bolt "nut" 3) (parent nil))`)
+		parent, err := facts[2].Slot("parent")
+		assert.NilError(t, err)
+		assert.Assert(t, parent.(Fact).Equal(facts[1]))
+		assert.Equal(t, facts[3].String(), `(point 1 2.5 nil)`)
+
+		inst, err := imported.FindInstance("acme", "")
+		assert.NilError(t, err)
+		slots := inst.Slots(true)
+		assert.Equal(t, slots["name"], "Acme")
+		assert.Equal(t, slots["credit"], 100.0)
+		assert.Equal(t, slots["friend"].(*Instance).Name(), InstanceName("initech"))
+		assert.Assert(t, slots["best-order"].(Fact).Equal(facts[2]))
+		inst, err = imported.FindInstance("initech", "")
+		assert.NilError(t, err)
+		assert.Equal(t, inst.Slots(true)["name"], Symbol("initech"))
+
+		// exporting the imported environment gives the same document
+		var again strings.Builder
+		err = imported.ExportJSON(&again, ExportOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, again.String(), out.String())
+	})
+
+	t.Run("Hand written", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		err := env.ImportJSON(strings.NewReader(`{
+			"facts": {
+				"order": [{"slots": {"id": 7, "customer": {"symbol": "acme"}}}],
+				"point": [{"values": [1, 2]}]
+			}
+		}`))
+		assert.NilError(t, err)
+		facts := env.Facts()
+		assert.Equal(t, len(facts), 3)
+		assert.Equal(t, facts[1].String(), `(order (id 7) (customer acme) (note nil) (weight 0.0) (items) (parent nil))`)
+		assert.Equal(t, facts[2].String(), `(point 1 2)`)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		err := env.ImportJSON(strings.NewReader(`{"facts": {"order": [{"slots": {"id": {"color": "red"}}}]}}`))
+		assert.ErrorContains(t, err, "Invalid value")
+		err = env.ImportJSON(strings.NewReader(`{"facts": {"order": [{"slots": {"parent": {"fact": 9}}}]}}`))
+		assert.ErrorContains(t, err, "Fact 9 not found")
+		err = env.ImportJSON(strings.NewReader(`{"instances": [{"name": "x", "class": "NOBODY"}]}`))
+		assert.ErrorContains(t, err, "")
+		err = env.ImportJSON(strings.NewReader(`not json`))
+		assert.ErrorContains(t, err, "")
+	})
+
+	t.Run("Modules", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		err := env.LoadFromString(`
+(defmodule OTHER)
+(deftemplate OTHER::order (slot sku))`)
+		assert.NilError(t, err)
+		main, err := env.FindModule("MAIN")
+		assert.NilError(t, err)
+		env.SetModule(main)
+
+		err = env.ImportJSON(strings.NewReader(`{"facts": {
+			"MAIN::order": [{"index": 1, "slots": {"id": 1}}],
+			"OTHER::order": [{"index": 2, "slots": {"sku": "bolt"}}],
+			"OTHER::point": [{"index": 3, "values": [1, 2]}]
+		}}`))
+		assert.NilError(t, err)
+		assert.Equal(t, env.CurrentModule().Name(), "MAIN")
+
+		var out strings.Builder
+		err = env.ExportJSON(&out, ExportOptions{Templates: []string{"OTHER::order", "OTHER::point"}})
+		assert.NilError(t, err)
+		assert.Equal(t, out.String(), `{"facts":{"OTHER::order":[{"index":2,"slots":{"sku":"bolt"}}],`+
+			`"OTHER::point":[{"index":3,"values":[1,2]}]},"instances":[]}`+"\n")
+	})
+
+	t.Run("Undone on error", func(t *testing.T) {
+		env := stateEnvironment(t)
+		defer env.Delete()
+
+		_, err := env.AssertString(`(point 1 2)`)
+		assert.NilError(t, err)
+		err = env.ImportJSON(strings.NewReader(`{
+			"facts": {"point": [{"index": 1, "values": [1, 2]}, {"index": 2, "values": [3, 4]}, {"index": 3, "values": [{"fact": 9}]}]},
+			"instances": [{"name": "acme", "class": "CUSTOMER"}]
+		}`))
+		assert.ErrorContains(t, err, "Fact 9 not found")
+		facts := env.Facts()
+		assert.Equal(t, len(facts), 2)
+		assert.Equal(t, facts[1].String(), `(point 1 2)`)
+		_, err = env.FindInstance("acme", "")
+		assert.ErrorContains(t, err, "")
+	})
+}
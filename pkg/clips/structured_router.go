@@ -0,0 +1,265 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogLevel is the severity of a LogRecord. The values match those of log/slog
+type LogLevel int
+
+// Levels of log records, from the least to the most severe
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// levelOf returns the level of output to a logical name
+func levelOf(name string) LogLevel {
+	switch name {
+	case "werror":
+		return LevelError
+	case "wwarning":
+		return LevelWarn
+	case "wtrace":
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// LogRecord is a message printed by CLIPS. Messages spanning several lines, such as syntax
+// errors, are combined into one record
+type LogRecord struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+	// Logical is the logical name the message was printed to
+	Logical string
+	// EnvID is the ID of the environment which printed the message
+	EnvID uint64
+	// Code is the CLIPS error code, such as PRNTUTIL2, if the message began with one
+	Code string
+}
+
+// MarshalJSON writes the record with the keys used by the JSON handler of log/slog: time,
+// level and msg, followed by logical, env and code
+func (r LogRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Level   string    `json:"level"`
+		Message string    `json:"msg"`
+		Logical string    `json:"logical"`
+		EnvID   uint64    `json:"env"`
+		Code    string    `json:"code,omitempty"`
+	}{r.Time, r.Level.String(), r.Message, r.Logical, r.EnvID, r.Code})
+}
+
+// LogHandler is called with each record of a StructuredRouter
+type LogHandler func(record LogRecord)
+
+// JSONLogHandler returns a handler writing each record to w as a line of JSON
+func JSONLogHandler(w io.Writer) LogHandler {
+	enc := json.NewEncoder(w)
+	return func(record LogRecord) {
+		enc.Encode(record)
+	}
+}
+
+// errorCode matches the [CODE] which begins CLIPS error and warning messages
+var errorCode = regexp.MustCompile(`^\[([A-Z]+[0-9]+)\]\s*`)
+
+// StructuredRouter is a router passing CLIPS output to a LogHandler as structured records.
+// Errors and warnings are gathered into one record from their [CODE] line until the next
+// record begins, the call into CLIPS which printed them returns, or Flush is called. Other
+// output makes a record of each line
+type StructuredRouter struct {
+	core     *RouterCore
+	handler  LogHandler
+	level    LogLevel
+	line     strings.Builder
+	lineName string
+	pending  *LogRecord
+}
+
+// CreateStructuredRouter returns a new router passing all CLIPS output, including errors,
+// warnings and watch output, to handler
+func CreateStructuredRouter(env *Environment, handler LogHandler) *StructuredRouter {
+	ret := &StructuredRouter{
+		handler: handler,
+		level:   LevelDebug,
+	}
+	names := append(append([]string{}, stdoutNames...), stderrNames...)
+	ret.core = CreateRouterCore(env, ret, uniqueRouterName(env, "go-structured-router"), names, 30)
+	return ret
+}
+
+// SetLevel drops records below the given level. All records are passed on by default
+func (r *StructuredRouter) SetLevel(level LogLevel) {
+	r.level = level
+}
+
+// Name of this router
+func (r *StructuredRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *StructuredRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true
+func (r *StructuredRouter) Print(name string, message string) {
+	if r.line.Len() > 0 && name != r.lineName {
+		r.endLine()
+	}
+	r.lineName = name
+	for {
+		idx := strings.IndexByte(message, '\n')
+		if idx < 0 {
+			r.line.WriteString(message)
+			return
+		}
+		r.line.WriteString(message[:idx])
+		r.endLine()
+		message = message[idx+1:]
+	}
+}
+
+// endLine adds the buffered line to the pending record, or makes a record of it
+func (r *StructuredRouter) endLine() {
+	text := strings.TrimSpace(r.line.String())
+	r.line.Reset()
+	name := r.lineName
+
+	if match := errorCode.FindStringSubmatch(text); match != nil {
+		r.emit()
+		r.pending = r.record(name, text[len(match[0]):])
+		r.pending.Code = match[1]
+		return
+	}
+	if r.pending != nil && r.pending.Logical == name {
+		if text != "" {
+			if r.pending.Message != "" {
+				r.pending.Message += "\n"
+			}
+			r.pending.Message += text
+		}
+		return
+	}
+	r.emit()
+	if text == "" {
+		return
+	}
+	r.pending = r.record(name, text)
+	if levelOf(name) < LevelWarn {
+		r.emit()
+	}
+}
+
+func (r *StructuredRouter) record(name string, message string) *LogRecord {
+	return &LogRecord{
+		Time:    time.Now(),
+		Level:   levelOf(name),
+		Message: message,
+		Logical: name,
+		EnvID:   r.core.env.ID(),
+	}
+}
+
+// emit passes the pending record to the handler
+func (r *StructuredRouter) emit() {
+	if r.pending == nil {
+		return
+	}
+	record := *r.pending
+	r.pending = nil
+	if record.Level >= r.level {
+		r.handler(record)
+	}
+}
+
+// Flush passes on any record still being gathered, including a line not yet ended
+func (r *StructuredRouter) Flush() {
+	if r.line.Len() > 0 {
+		r.endLine()
+	}
+	r.emit()
+}
+
+// endCall passes on the record being gathered, since CLIPS has finished printing it. A line
+// not yet ended is kept, unless it belongs to the record
+func (r *StructuredRouter) endCall() {
+	if r.pending == nil {
+		return
+	}
+	if r.line.Len() > 0 && r.lineName == r.pending.Logical {
+		r.endLine()
+	}
+	r.emit()
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *StructuredRouter) Getc(name string) byte {
+	return 0
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *StructuredRouter) Ungetc(name string, ch byte) error {
+	return fmt.Errorf("Not implemented")
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *StructuredRouter) Exit(exitcode int) {
+	r.Flush()
+}
+
+// Activate activates this router with the Env
+func (r *StructuredRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *StructuredRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete flushes any pending record and removes this router from the Env
+func (r *StructuredRouter) Delete() error {
+	r.Flush()
+	return r.core.Delete()
+}
@@ -0,0 +1,139 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestStructuredRouter(t *testing.T) {
+	t.Run("Output", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var records []LogRecord
+		router := CreateStructuredRouter(env, func(record LogRecord) {
+			records = append(records, record)
+		})
+		defer router.Delete()
+
+		err := env.SendCommand(`(printout t "first" crlf "second" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 2)
+		assert.Equal(t, records[0].Message, "first")
+		assert.Equal(t, records[0].Level, LevelInfo)
+		assert.Equal(t, records[0].Logical, "t")
+		assert.Equal(t, records[0].EnvID, env.ID())
+		assert.Equal(t, records[0].Code, "")
+		assert.Equal(t, records[1].Message, "second")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var records []LogRecord
+		router := CreateStructuredRouter(env, func(record LogRecord) {
+			records = append(records, record)
+		})
+		defer router.Delete()
+
+		err := env.Build(`(defrule broken (a) => (undefined-function))`)
+		assert.Assert(t, err != nil)
+		router.Flush()
+		assert.Assert(t, len(records) > 0)
+		record := records[0]
+		assert.Equal(t, record.Level, LevelError)
+		assert.Equal(t, record.Logical, "werror")
+		assert.Equal(t, record.Code, "EXPRNPSR3")
+		assert.Assert(t, strings.HasPrefix(record.Message, "Missing function declaration"), record.Message)
+		// the construct in error is part of the same record
+		assert.Assert(t, strings.Contains(record.Message, "\nERROR:\n"), record.Message)
+	})
+
+	t.Run("Error at end of call", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var records []LogRecord
+		router := CreateStructuredRouter(env, func(record LogRecord) {
+			records = append(records, record)
+		})
+		defer router.Delete()
+
+		// nothing is printed after the error, and Flush is not called
+		_, err := env.Eval(`(printout werror "[TEST2] alone" crlf "second line" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 1)
+		assert.Equal(t, records[0].Code, "TEST2")
+		assert.Equal(t, records[0].Message, "alone\nsecond line")
+
+		err = env.Build(`(defrule broken (a) => (undefined-function))`)
+		assert.Assert(t, err != nil)
+		assert.Assert(t, len(records) > 1)
+		assert.Equal(t, records[1].Code, "EXPRNPSR3")
+	})
+
+	t.Run("Levels", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var records []LogRecord
+		router := CreateStructuredRouter(env, func(record LogRecord) {
+			records = append(records, record)
+		})
+		defer router.Delete()
+		router.SetLevel(LevelWarn)
+
+		err := env.SendCommand(`(printout t "dropped" crlf)`)
+		assert.NilError(t, err)
+		err = env.SendCommand(`(printout wwarning "[TEST1] careful" crlf)`)
+		assert.NilError(t, err)
+		router.Flush()
+		assert.Equal(t, len(records), 1)
+		assert.Equal(t, records[0].Level, LevelWarn)
+		assert.Equal(t, records[0].Code, "TEST1")
+		assert.Equal(t, records[0].Message, "careful")
+		assert.Equal(t, levelOf("wtrace"), LevelDebug)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var buf bytes.Buffer
+		router := CreateStructuredRouter(env, JSONLogHandler(&buf))
+		defer router.Delete()
+
+		err := env.SendCommand(`(printout t "hello")`)
+		assert.NilError(t, err)
+		router.Flush()
+
+		var record map[string]interface{}
+		err = json.Unmarshal(buf.Bytes(), &record)
+		assert.NilError(t, err)
+		assert.Equal(t, record["level"], "INFO")
+		assert.Equal(t, record["msg"], "hello")
+		assert.Equal(t, record["logical"], "t")
+		assert.Equal(t, record["env"], float64(env.ID()))
+		_, ok := record["code"]
+		assert.Assert(t, !ok)
+	})
+}
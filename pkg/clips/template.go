@@ -25,13 +25,19 @@ import (
 	"unsafe"
 )
 
-// Template is a formal representation of the fact data structure, defined by deftemplate in CLIPS
+// Template is a formal representation of the fact data structure, defined by deftemplate in CLIPS.
+// Like every Construct, its methods without an error result panic with ErrEnvironmentClosed
+// after the environment is deleted
 type Template struct {
-	env    *Environment
-	tplptr unsafe.Pointer
+	env     *Environment
+	tplptr  unsafe.Pointer
+	name    string
+	module  string
+	cleared uint64
 }
 
-// TemplateSlot defines one slot within a template
+// TemplateSlot defines one slot within a template. Its methods give zero values once the
+// template is stale, and panic with ErrEnvironmentClosed after the environment is deleted
 type TemplateSlot struct {
 	tpl  *Template
 	name string
@@ -63,11 +69,20 @@ func (tsdt TemplateSlotDefaultType) CVal() C.int {
 
 func createTemplate(env *Environment, tplptr unsafe.Pointer) *Template {
 	return &Template{
-		env:    env,
-		tplptr: tplptr,
+		env:     env,
+		tplptr:  tplptr,
+		name:    C.GoString(C.EnvGetDeftemplateName(env.ptr(), tplptr)),
+		module:  C.GoString(C.EnvDeftemplateModule(env.ptr(), tplptr)),
+		cleared: env.cleared,
 	}
 }
 
+// check returns ErrEnvironmentClosed or ErrStale if the template can no longer be used. A
+// template is stale once undefined or cleared
+func (t *Template) check() error {
+	return checkConstruct(t.env, DEFTEMPLATE, t.tplptr, qualify(t.module, t.name), t.cleared)
+}
+
 // Equal returns true if this template represents the same template as the given one
 func (t *Template) Equal(other *Template) bool {
 	return t.tplptr == other.tplptr
@@ -75,30 +90,40 @@ func (t *Template) Equal(other *Template) bool {
 
 // String returns a string representation of the template
 func (t *Template) String() string {
-	cstr := C.EnvGetDeftemplatePPForm(t.env.env, t.tplptr)
+	if !valid(t.check()) {
+		return fmt.Sprintf("<Template-%s stale>", t.name)
+	}
+	cstr := C.EnvGetDeftemplatePPForm(t.env.ptr(), t.tplptr)
 	if cstr != nil {
 		return strings.TrimRight(C.GoString(cstr), "\n")
 	}
-	cmodule := C.EnvDeftemplateModule(t.env.env, t.tplptr)
-	name := t.Name()
-	return fmt.Sprintf("(deftemplate %s::%s", C.GoString(cmodule), name)
+	return fmt.Sprintf("(deftemplate %s::%s", t.module, t.name)
 }
 
 // Name returns the name of this template
 func (t *Template) Name() string {
-	cname := C.EnvGetDeftemplateName(t.env.env, t.tplptr)
-	return C.GoString(cname)
+	if err := t.env.check(); err != nil {
+		panic(err)
+	}
+	return t.name
 }
 
-// Module returns the module in which the template is defined. Equivalent to (deftempalte-module)
+// Module returns the module in which the template is defined, or nil if the template is stale.
+// Equivalent to (deftempalte-module)
 func (t *Template) Module() *Module {
-	cmodname := C.EnvDeftemplateModule(t.env.env, t.tplptr)
-	modptr := C.EnvFindDefmodule(t.env.env, cmodname)
+	if !valid(t.check()) {
+		return nil
+	}
+	cmodname := C.EnvDeftemplateModule(t.env.ptr(), t.tplptr)
+	modptr := C.EnvFindDefmodule(t.env.ptr(), cmodname)
 	return createModule(t.env, modptr)
 }
 
-// Implied returns whether the template is implied
+// Implied returns whether the template is implied, or false if it is stale
 func (t *Template) Implied() bool {
+	if !valid(t.check()) {
+		return false
+	}
 	if C.implied_deftemplate(t.tplptr) == 1 {
 		return true
 	}
@@ -107,7 +132,10 @@ func (t *Template) Implied() bool {
 
 // Watched returns whether or not the template is being watched
 func (t *Template) Watched() bool {
-	ret := C.EnvGetDeftemplateWatch(t.env.env, t.tplptr)
+	if !valid(t.check()) {
+		return false
+	}
+	ret := C.EnvGetDeftemplateWatch(t.env.ptr(), t.tplptr)
 	if ret == 1 {
 		return true
 	}
@@ -116,24 +144,33 @@ func (t *Template) Watched() bool {
 
 // Watch sets whether or not the template should be watched
 func (t *Template) Watch(val bool) {
+	if !valid(t.check()) {
+		return
+	}
 	var cval C.uint = 0
 	if val {
 		cval = 1
 	}
-	C.EnvSetDeftemplateWatch(t.env.env, cval, t.tplptr)
+	C.EnvSetDeftemplateWatch(t.env.ptr(), cval, t.tplptr)
 }
 
 // Deletable returns true if the Template can be deleted from CLIPS
 func (t *Template) Deletable() bool {
-	ret := C.EnvIsDeftemplateDeletable(t.env.env, t.tplptr)
+	if !valid(t.check()) {
+		return false
+	}
+	ret := C.EnvIsDeftemplateDeletable(t.env.ptr(), t.tplptr)
 	if ret == 1 {
 		return true
 	}
 	return false
 }
 
-// Slots returns the slot definitions contained in this template
+// Slots returns the slot definitions contained in this template, or nil if the template is stale
 func (t *Template) Slots() map[string]*TemplateSlot {
+	if !valid(t.check()) {
+		return nil
+	}
 	if t.Implied() {
 		return make(map[string]*TemplateSlot)
 	}
@@ -141,7 +178,7 @@ func (t *Template) Slots() map[string]*TemplateSlot {
 	data := createDataObject(t.env)
 	defer data.Delete()
 
-	C.EnvDeftemplateSlotNames(t.env.env, t.tplptr, data.byRef())
+	C.EnvDeftemplateSlotNames(t.env.ptr(), t.tplptr, data.byRef())
 	namesblob := data.Value()
 	names, ok := namesblob.([]interface{})
 	if !ok {
@@ -160,16 +197,35 @@ func (t *Template) Slots() map[string]*TemplateSlot {
 
 // NewFact creates a new fact from this template
 func (t *Template) NewFact() (Fact, error) {
-	factptr := C.EnvCreateFact(t.env.env, t.tplptr)
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	factptr := C.EnvCreateFact(t.env.ptr(), t.tplptr)
 	if factptr == nil {
 		return nil, EnvError(t.env, "Unable to create fact from template %s", t.Name())
 	}
 	return t.env.newFact(unsafe.Pointer(factptr)), nil
 }
 
+// Facts returns a slice of the facts of this template, in the order they were asserted, or nil
+// if the template is stale
+func (t *Template) Facts() []Fact {
+	if !valid(t.check()) {
+		return nil
+	}
+	ret := make([]Fact, 0, 10)
+	for factptr := C.EnvGetNextFactInTemplate(t.env.ptr(), t.tplptr, nil); factptr != nil; factptr = C.EnvGetNextFactInTemplate(t.env.ptr(), t.tplptr, factptr) {
+		ret = append(ret, t.env.newFact(factptr))
+	}
+	return ret
+}
+
 // Undefine the template. Equivalent to (undeftemplate). This object is unusable after this call
 func (t *Template) Undefine() error {
-	ret := C.EnvUndeftemplate(t.env.env, t.tplptr)
+	if err := t.check(); err != nil {
+		return err
+	}
+	ret := C.EnvUndeftemplate(t.env.ptr(), t.tplptr)
 	if ret != 1 {
 		return EnvError(t.env, "Unable to undefine template %s", t.Name())
 	}
@@ -202,9 +258,12 @@ func (ts *TemplateSlot) Name() string {
 
 // Multifield returns true if the slot is a multifield slot
 func (ts *TemplateSlot) Multifield() bool {
+	if !valid(ts.tpl.check()) {
+		return false
+	}
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvDeftemplateSlotMultiP(ts.tpl.env.env, ts.tpl.tplptr, cname)
+	ret := C.EnvDeftemplateSlotMultiP(ts.tpl.env.ptr(), ts.tpl.tplptr, cname)
 	if ret == 1 {
 		return true
 	}
@@ -213,12 +272,15 @@ func (ts *TemplateSlot) Multifield() bool {
 
 // Types returns the set of value types for this slot
 func (ts *TemplateSlot) Types() []Symbol {
+	if !valid(ts.tpl.check()) {
+		return nil
+	}
 	data := createDataObject(ts.tpl.env)
 	defer data.Delete()
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvDeftemplateSlotTypes(ts.tpl.env.env, ts.tpl.tplptr, cname, data.byRef())
+	C.EnvDeftemplateSlotTypes(ts.tpl.env.ptr(), ts.tpl.tplptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok {
@@ -238,12 +300,15 @@ func (ts *TemplateSlot) Types() []Symbol {
 
 // IntRange returns the numeric range for the slot for integer values - e.g. low, haslow, high, hashigh := ts.Range()
 func (ts *TemplateSlot) IntRange() (low int64, hasLow bool, high int64, hasHigh bool) {
+	if !valid(ts.tpl.check()) {
+		return
+	}
 	data := createDataObject(ts.tpl.env)
 	defer data.Delete()
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvDeftemplateSlotRange(ts.tpl.env.env, ts.tpl.tplptr, cname, data.byRef())
+	C.EnvDeftemplateSlotRange(ts.tpl.env.ptr(), ts.tpl.tplptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok {
@@ -262,12 +327,15 @@ func (ts *TemplateSlot) IntRange() (low int64, hasLow bool, high int64, hasHigh
 
 // FloatRange returns the numeric range for the slot for floating point values - e.g. low, haslow, high, hashigh := ts.Range()
 func (ts *TemplateSlot) FloatRange() (low float64, hasLow bool, high float64, hasHigh bool) {
+	if !valid(ts.tpl.check()) {
+		return
+	}
 	data := createDataObject(ts.tpl.env)
 	defer data.Delete()
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvDeftemplateSlotRange(ts.tpl.env.env, ts.tpl.tplptr, cname, data.byRef())
+	C.EnvDeftemplateSlotRange(ts.tpl.env.ptr(), ts.tpl.tplptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok {
@@ -286,12 +354,15 @@ func (ts *TemplateSlot) FloatRange() (low float64, hasLow bool, high float64, ha
 
 // Cardinality returns the cardinality for the slot
 func (ts *TemplateSlot) Cardinality() (low int64, high int64, hasHigh bool) {
+	if !valid(ts.tpl.check()) {
+		return
+	}
 	data := createDataObject(ts.tpl.env)
 	defer data.Delete()
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvDeftemplateSlotCardinality(ts.tpl.env.env, ts.tpl.tplptr, cname, data.byRef())
+	C.EnvDeftemplateSlotCardinality(ts.tpl.env.ptr(), ts.tpl.tplptr, cname, data.byRef())
 	dv := data.Value()
 	ilist, ok := dv.([]interface{})
 	if !ok || len(ilist) != 2 {
@@ -304,31 +375,40 @@ func (ts *TemplateSlot) Cardinality() (low int64, high int64, hasHigh bool) {
 
 // DefaultType returns the type of default value for this slot
 func (ts *TemplateSlot) DefaultType() TemplateSlotDefaultType {
+	if !valid(ts.tpl.check()) {
+		return NO_DEFAULT
+	}
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
-	ret := C.EnvDeftemplateSlotDefaultP(ts.tpl.env.env, ts.tpl.tplptr, cname)
+	ret := C.EnvDeftemplateSlotDefaultP(ts.tpl.env.ptr(), ts.tpl.tplptr, cname)
 	return TemplateSlotDefaultType(ret)
 }
 
 // DefaultValue returns a default value for the slot.  (This might be a new, unique value for DYNAMIC_DEFAULT defaults)
 func (ts *TemplateSlot) DefaultValue() interface{} {
+	if !valid(ts.tpl.check()) {
+		return nil
+	}
 	data := createDataObject(ts.tpl.env)
 	defer data.Delete()
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvDeftemplateSlotDefaultValue(ts.tpl.env.env, ts.tpl.tplptr, cname, data.byRef())
+	C.EnvDeftemplateSlotDefaultValue(ts.tpl.env.ptr(), ts.tpl.tplptr, cname, data.byRef())
 	return data.Value()
 }
 
 // AllowedValues returns the set of allowed values for this slot, if specified
 func (ts *TemplateSlot) AllowedValues() (values []interface{}, ok bool) {
+	if !valid(ts.tpl.check()) {
+		return
+	}
 	data := createDataObject(ts.tpl.env)
 	defer data.Delete()
 	cname := C.CString(ts.name)
 	defer C.free(unsafe.Pointer(cname))
 
-	C.EnvDeftemplateSlotAllowedValues(ts.tpl.env.env, ts.tpl.tplptr, cname, data.byRef())
+	C.EnvDeftemplateSlotAllowedValues(ts.tpl.env.ptr(), ts.tpl.tplptr, cname, data.byRef())
 	dv := data.Value()
 	values, ok = dv.([]interface{})
 	return
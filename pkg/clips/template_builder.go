@@ -0,0 +1,128 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TemplateBuilder builds a deftemplate from Go. Facets such as Default apply to the slot
+// added last
+type TemplateBuilder struct {
+	slotList
+	name    string
+	comment string
+}
+
+// NewTemplate returns a builder for a deftemplate of the given name
+func NewTemplate(name string) *TemplateBuilder {
+	return &TemplateBuilder{name: name}
+}
+
+// Comment sets the comment of the template
+func (t *TemplateBuilder) Comment(text string) *TemplateBuilder {
+	t.comment = text
+	return t
+}
+
+// Slot adds a single-field slot accepting the given types, or any type if none are given
+func (t *TemplateBuilder) Slot(name string, types ...Type) *TemplateBuilder {
+	t.add(name, false, types)
+	return t
+}
+
+// Multislot adds a multifield slot whose values are of the given types, or any type if none
+// are given
+func (t *TemplateBuilder) Multislot(name string, types ...Type) *TemplateBuilder {
+	t.add(name, true, types)
+	return t
+}
+
+// Default sets the default value of the last slot. Expr("?NONE") makes the slot required
+func (t *TemplateBuilder) Default(values ...interface{}) *TemplateBuilder {
+	t.facet("default", values...)
+	return t
+}
+
+// DefaultDynamic sets an expression evaluated for the last slot each time a fact is asserted
+func (t *TemplateBuilder) DefaultDynamic(expr Expr) *TemplateBuilder {
+	t.facet("default-dynamic", expr)
+	return t
+}
+
+// Allowed restricts the last slot to the given values
+func (t *TemplateBuilder) Allowed(values ...interface{}) *TemplateBuilder {
+	t.facet("allowed-values", values...)
+	return t
+}
+
+// Range restricts the last slot to numbers between low and high. Expr("?VARIABLE") leaves a
+// bound open
+func (t *TemplateBuilder) Range(low interface{}, high interface{}) *TemplateBuilder {
+	t.facet("range", low, high)
+	return t
+}
+
+// Cardinality restricts the number of values of the last slot, which must be a multislot. A
+// negative max leaves the number unbounded
+func (t *TemplateBuilder) Cardinality(min int, max int) *TemplateBuilder {
+	t.cardinality(min, max)
+	return t
+}
+
+// Validate checks the names and types of the template
+func (t *TemplateBuilder) Validate() error {
+	_, err := t.source("")
+	return err
+}
+
+// Source returns the deftemplate as CLIPS source
+func (t *TemplateBuilder) Source() (string, error) {
+	return t.source("")
+}
+
+func (t *TemplateBuilder) source(module string) (string, error) {
+	if err := validName("template", t.name); err != nil {
+		return "", err
+	}
+	slots, err := t.slotList.source(fmt.Sprintf(`template "%s"`, t.name))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "(deftemplate %s", qualify(module, t.name))
+	if t.comment != "" {
+		fmt.Fprintf(&b, " %s", clipsString(t.comment))
+	}
+	for _, slot := range slots {
+		fmt.Fprintf(&b, "\n   %s", slot)
+	}
+	b.WriteString(")")
+	return b.String(), nil
+}
+
+// Build defines the template within the named module, or the current module if module is
+// empty. The current module is left unchanged
+func (t *TemplateBuilder) Build(env *Environment, module string) (*Template, error) {
+	src, err := t.source(module)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.buildIn(module, src); err != nil {
+		return nil, err
+	}
+	return env.FindTemplate(qualify(module, t.name))
+}
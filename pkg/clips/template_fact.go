@@ -28,6 +28,7 @@ import (
 type TemplateFact struct {
 	env     *Environment
 	factptr unsafe.Pointer
+	id      factID
 }
 
 func createTemplateFact(env *Environment, factptr unsafe.Pointer) *TemplateFact {
@@ -35,7 +36,8 @@ func createTemplateFact(env *Environment, factptr unsafe.Pointer) *TemplateFact
 		env:     env,
 		factptr: factptr,
 	}
-	C.EnvIncrementFactCount(env.env, factptr)
+	C.EnvIncrementFactCount(env.ptr(), factptr)
+	ret.id = readFactID(env, factptr)
 	runtime.SetFinalizer(ret, func(*TemplateFact) {
 		ret.Drop()
 	})
@@ -44,23 +46,31 @@ func createTemplateFact(env *Environment, factptr unsafe.Pointer) *TemplateFact
 
 // Drop drops the reference to the fact in CLIPS. should be called when done with the fact
 func (f *TemplateFact) Drop() {
-	if f.factptr != nil {
-		C.EnvDecrementFactCount(f.env.env, f.factptr)
-		f.factptr = nil
+	if f.factptr != nil && f.env.env != nil {
+		C.EnvDecrementFactCount(f.env.ptr(), f.factptr)
 	}
+	f.factptr = nil
+}
+
+// check returns ErrEnvironmentClosed or ErrStale if the fact can no longer be used
+func (f *TemplateFact) check() error {
+	return checkFact(f.env, f.factptr, f.id)
 }
 
 // Index returns the index number of this fact within CLIPS
 func (f *TemplateFact) Index() int {
-	return int(C.EnvFactIndex(f.env.env, f.factptr))
+	if f.check() != nil {
+		return f.id.index
+	}
+	return int(C.EnvFactIndex(f.env.ptr(), f.factptr))
 }
 
 // Asserted returns true if the fact has been asserted.
 func (f *TemplateFact) Asserted() bool {
-	if f.Index() == 0 {
+	if f.check() != nil || f.Index() == 0 {
 		return false
 	}
-	if C.EnvFactExistp(f.env.env, f.factptr) != 1 {
+	if C.EnvFactExistp(f.env.ptr(), f.factptr) != 1 {
 		return false
 	}
 	return true
@@ -68,39 +78,52 @@ func (f *TemplateFact) Asserted() bool {
 
 // Assert asserts the fact
 func (f *TemplateFact) Assert() error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Fact already asserted")
 	}
 
-	ret := C.EnvAssignFactSlotDefaults(f.env.env, f.factptr)
+	ret := C.EnvAssignFactSlotDefaults(f.env.ptr(), f.factptr)
 	if ret != 1 {
 		return EnvError(f.env, "Unable to set defaults for fact")
 	}
 
-	factptr := C.EnvAssert(f.env.env, f.factptr)
+	factptr := C.EnvAssert(f.env.ptr(), f.factptr)
 	if factptr == nil {
 		return EnvError(f.env, "Unable to assert fact")
 	}
+	f.id = readFactID(f.env, f.factptr)
 	return nil
 }
 
 // Retract retracts the fact from CLIPS
 func (f *TemplateFact) Retract() error {
-	ret := C.EnvRetract(f.env.env, f.factptr)
+	if err := f.check(); err != nil {
+		return err
+	}
+	ret := C.EnvRetract(f.env.ptr(), f.factptr)
 	if ret != 1 {
 		return EnvError(f.env, "Unable to retract fact")
 	}
 	return nil
 }
 
-// Template returns the template defining this fact
+// Template returns the template defining this fact, or nil if the fact is stale
 func (f *TemplateFact) Template() *Template {
-	tplptr := C.EnvFactDeftemplate(f.env.env, f.factptr)
+	if f.check() != nil {
+		return nil
+	}
+	tplptr := C.EnvFactDeftemplate(f.env.ptr(), f.factptr)
 	return createTemplate(f.env, tplptr)
 }
 
 // String returns a string representation of the fact
 func (f *TemplateFact) String() string {
+	if f.check() != nil {
+		return fmt.Sprintf("<Fact-%d stale>", f.id.index)
+	}
 	ret := factPPString(f.env, f.factptr)
 	split := strings.SplitN(ret, "     ", 2)
 	return strings.TrimRight(split[len(split)-1], "\n")
@@ -117,11 +140,14 @@ func (f *TemplateFact) Equal(otherfact Fact) bool {
 
 // Slots returns a function that can be called to get the next slot for this fact. Will return nil when no more slots remain
 func (f *TemplateFact) Slots() (map[string]interface{}, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
 	data := createDataObject(f.env)
 	defer data.Delete()
 
-	tplptr := C.EnvFactDeftemplate(f.env.env, f.factptr)
-	C.EnvDeftemplateSlotNames(f.env.env, tplptr, data.byRef())
+	tplptr := C.EnvFactDeftemplate(f.env.ptr(), f.factptr)
+	C.EnvDeftemplateSlotNames(f.env.ptr(), tplptr, data.byRef())
 	namesblob := data.Value()
 	names, ok := namesblob.([]interface{})
 	if !ok {
@@ -147,6 +173,9 @@ func (f *TemplateFact) Slots() (map[string]interface{}, error) {
 
 // Slot returns the value stored in the given slot
 func (f *TemplateFact) Slot(name string) (interface{}, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
 	data, err := slotValue(f.env, f.factptr, Symbol(name))
 	if err != nil {
 		return nil, err
@@ -157,6 +186,9 @@ func (f *TemplateFact) Slot(name string) (interface{}, error) {
 
 // ExtractSlot unmarshals the given slot value into the object provided by the user
 func (f *TemplateFact) ExtractSlot(retval interface{}, name string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	data, err := slotValue(f.env, f.factptr, Symbol(name))
 	if err != nil {
 		return err
@@ -167,6 +199,9 @@ func (f *TemplateFact) ExtractSlot(retval interface{}, name string) error {
 
 // Set alters the item at a specific in the multifield
 func (f *TemplateFact) Set(slot string, value interface{}) error {
+	if err := f.check(); err != nil {
+		return err
+	}
 	if f.Asserted() {
 		return fmt.Errorf("Unable to change asserted fact")
 	}
@@ -177,7 +212,7 @@ func (f *TemplateFact) Set(slot string, value interface{}) error {
 
 	data.SetValue(value)
 
-	ret := C.EnvPutFactSlot(f.env.env, f.factptr, cslot, data.byRef())
+	ret := C.EnvPutFactSlot(f.env.ptr(), f.factptr, cslot, data.byRef())
 	if ret != 1 {
 		slots := f.Template().Slots()
 		_, ok := slots[slot]
@@ -0,0 +1,326 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TraceEvent is a line of CLIPS watch output parsed by a TraceRouter. Use a type switch to
+// tell the kinds of event apart. Values are given as CLIPS prints them
+type TraceEvent interface {
+	// Text returns the watch output the event was parsed from
+	Text() string
+}
+
+type traceText string
+
+// Text returns the watch output the event was parsed from
+func (t traceText) Text() string {
+	return string(t)
+}
+
+// FactEvent is a fact being asserted or retracted, watched with (watch facts)
+type FactEvent struct {
+	traceText
+	Asserted bool
+	Index    int
+	// Fact is the fact as printed, such as (point (x 1))
+	Fact string
+}
+
+// ActivationEvent is a rule being activated or deactivated, watched with (watch activations)
+type ActivationEvent struct {
+	traceText
+	Activated bool
+	Salience  int
+	Rule      string
+	// Basis lists the facts and instances matching the rule, as in f-1 or [p1]
+	Basis []string
+}
+
+// FireEvent is a rule firing, watched with (watch rules)
+type FireEvent struct {
+	traceText
+	// Count is the number of rules fired so far by this run
+	Count int
+	Rule  string
+	// Basis lists the facts and instances matching the rule, as in f-1 or [p1]
+	Basis []string
+}
+
+// InstanceEvent is an instance being made or unmade, watched with (watch instances)
+type InstanceEvent struct {
+	traceText
+	Made  bool
+	Name  InstanceName
+	Class string
+}
+
+// SlotEvent is a slot of an instance being changed, watched with (watch slots)
+type SlotEvent struct {
+	traceText
+	Instance InstanceName
+	Slot     string
+	Shared   bool
+	Value    string
+}
+
+// GlobalEvent is a global being changed, watched with (watch globals)
+type GlobalEvent struct {
+	traceText
+	Name     string
+	Value    string
+	OldValue string
+}
+
+// FocusEvent is a module being pushed onto or popped from the focus stack, watched with
+// (watch focus)
+type FocusEvent struct {
+	traceText
+	Pushed bool
+	Module string
+	// Other is the module focused before a push, or after a pop, if printed
+	Other string
+}
+
+// CallKind is an enumeration of the kinds of call traced by a CallEvent
+type CallKind int
+
+const (
+	TRACE_DEFFUNCTION CallKind = iota
+	TRACE_GENERIC
+	TRACE_METHOD
+	TRACE_MESSAGE
+	TRACE_HANDLER
+)
+
+var clipsCallKinds = [...]string{
+	"DFN",
+	"GNC",
+	"MTH",
+	"MSG",
+	"HND",
+}
+
+// String returns the tag CLIPS prints for the kind of call, such as "DFN"
+func (kind CallKind) String() string {
+	if kind < 0 || int(kind) >= len(clipsCallKinds) {
+		return fmt.Sprintf("CallKind(%d)", int(kind))
+	}
+	return clipsCallKinds[int(kind)]
+}
+
+// CallEvent is a deffunction, generic function, method, message or message handler being
+// entered or left, watched with (watch deffunctions), (watch methods) and so on
+type CallEvent struct {
+	traceText
+	Kind  CallKind
+	Enter bool
+	// Name is the name of the function, message or handler. Methods are named as in foo:#1
+	Name string
+	// Depth is the evaluation depth of the call
+	Depth int
+	// Args are the arguments of the call, as printed
+	Args string
+	// HandlerType and Class are given for message handlers only
+	HandlerType string
+	Class       string
+}
+
+// TextEvent is watch output which is not parsed otherwise, such as that of (watch
+// compilations) and (watch statistics)
+type TextEvent struct {
+	traceText
+}
+
+var (
+	traceFact       = regexp.MustCompile(`^(==>|<==) f-(\d+)\s+(.*)$`)
+	traceActivation = regexp.MustCompile(`^(==>|<==) Activation\s+(-?\d+)\s+(\S+):\s*(.*)$`)
+	traceFire       = regexp.MustCompile(`^FIRE\s+(\d+)\s+(\S+):\s*(.*)$`)
+	traceInstance   = regexp.MustCompile(`^(==>|<==) instance \[?([^\]\s]+)\]? of (\S+)$`)
+	traceSlot       = regexp.MustCompile(`^::= (local|shared) slot (\S+) in instance \[?([^\]\s]+)\]? <- (.*)$`)
+	traceGlobal     = regexp.MustCompile(`^:== \?\*(\S+)\* ==> (.*?)(?: <== (.*))?$`)
+	traceFocus      = regexp.MustCompile(`^(==>|<==) Focus (\S+)(?: (?:from|to) (\S+))?$`)
+	traceCall       = regexp.MustCompile(`^(DFN|GNC|MTH|MSG|HND) (>>|<<) (\S+)(?: (\S+) in class (\S+))?\s*(?:ED:(\d+)\s*(.*))?$`)
+)
+
+// ParseTrace parses a line of watch output, returning a TextEvent for lines in no known format
+func ParseTrace(line string) TraceEvent {
+	line = strings.TrimRight(line, "\r\n")
+	text := traceText(line)
+	if m := traceFact.FindStringSubmatch(line); m != nil {
+		index, _ := strconv.Atoi(m[2])
+		return &FactEvent{traceText: text, Asserted: m[1] == "==>", Index: index, Fact: m[3]}
+	}
+	if m := traceActivation.FindStringSubmatch(line); m != nil {
+		salience, _ := strconv.Atoi(m[2])
+		return &ActivationEvent{traceText: text, Activated: m[1] == "==>", Salience: salience, Rule: m[3], Basis: traceBasis(m[4])}
+	}
+	if m := traceFire.FindStringSubmatch(line); m != nil {
+		count, _ := strconv.Atoi(m[1])
+		return &FireEvent{traceText: text, Count: count, Rule: m[2], Basis: traceBasis(m[3])}
+	}
+	if m := traceInstance.FindStringSubmatch(line); m != nil {
+		return &InstanceEvent{traceText: text, Made: m[1] == "==>", Name: InstanceName(m[2]), Class: m[3]}
+	}
+	if m := traceSlot.FindStringSubmatch(line); m != nil {
+		return &SlotEvent{traceText: text, Shared: m[1] == "shared", Slot: m[2], Instance: InstanceName(m[3]), Value: m[4]}
+	}
+	if m := traceGlobal.FindStringSubmatch(line); m != nil {
+		return &GlobalEvent{traceText: text, Name: m[1], Value: m[2], OldValue: m[3]}
+	}
+	if m := traceFocus.FindStringSubmatch(line); m != nil {
+		return &FocusEvent{traceText: text, Pushed: m[1] == "==>", Module: m[2], Other: m[3]}
+	}
+	if m := traceCall.FindStringSubmatch(line); m != nil {
+		ret := &CallEvent{traceText: text, Enter: m[2] == ">>", Name: m[3], HandlerType: m[4], Class: m[5], Args: m[7]}
+		for kind, tag := range clipsCallKinds {
+			if tag == m[1] {
+				ret.Kind = CallKind(kind)
+			}
+		}
+		ret.Depth, _ = strconv.Atoi(m[6])
+		return ret
+	}
+	return &TextEvent{traceText: text}
+}
+
+// traceBasis splits the facts and instances printed after a rule name
+func traceBasis(basis string) []string {
+	basis = strings.TrimSpace(basis)
+	if basis == "" {
+		return nil
+	}
+	ret := strings.Split(basis, ",")
+	for ii := range ret {
+		ret[ii] = strings.TrimSpace(ret[ii])
+	}
+	return ret
+}
+
+// TraceRouter is a router parsing CLIPS watch output into TraceEvents passed to a callback.
+// The output is not passed on to other routers, so it is not also printed
+type TraceRouter struct {
+	core     *RouterCore
+	callback func(event TraceEvent)
+	line     strings.Builder
+	// handler holds a message handler line until the line giving its depth and arguments
+	handler string
+}
+
+// CreateTraceRouter returns a new router passing each line of watch output to callback
+func CreateTraceRouter(env *Environment, callback func(event TraceEvent)) *TraceRouter {
+	ret := &TraceRouter{
+		callback: callback,
+	}
+	ret.core = CreateRouterCore(env, ret, uniqueRouterName(env, "go-trace-router"), []string{"wtrace"}, 36)
+	return ret
+}
+
+// Name of this router
+func (r *TraceRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *TraceRouter) Query(name string) bool {
+	return r.core.Query(name)
+}
+
+// Print is called with a message if Query has returned true
+func (r *TraceRouter) Print(name string, message string) {
+	for {
+		idx := strings.IndexByte(message, '\n')
+		if idx < 0 {
+			r.line.WriteString(message)
+			return
+		}
+		r.line.WriteString(message[:idx])
+		line := r.line.String()
+		r.line.Reset()
+		r.endLine(line)
+		message = message[idx+1:]
+	}
+}
+
+func (r *TraceRouter) endLine(line string) {
+	if r.handler != "" {
+		pending := r.handler
+		r.handler = ""
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "ED:") {
+			r.callback(ParseTrace(pending + " " + trimmed))
+			return
+		}
+		r.callback(ParseTrace(pending))
+	}
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if strings.HasPrefix(line, "HND ") && !strings.Contains(line, "ED:") {
+		// CLIPS prints the depth and arguments of a handler on the next line
+		r.handler = line
+		return
+	}
+	r.callback(ParseTrace(line))
+}
+
+// Flush passes on any line of watch output not yet ended
+func (r *TraceRouter) Flush() {
+	if r.line.Len() > 0 {
+		line := r.line.String()
+		r.line.Reset()
+		r.endLine(line)
+	}
+	if r.handler != "" {
+		pending := r.handler
+		r.handler = ""
+		r.callback(ParseTrace(pending))
+	}
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *TraceRouter) Getc(name string) byte {
+	return 0
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *TraceRouter) Ungetc(name string, ch byte) error {
+	return fmt.Errorf("Not implemented")
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *TraceRouter) Exit(exitcode int) {
+	r.Flush()
+}
+
+// Activate activates this router with the Env
+func (r *TraceRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *TraceRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete flushes any pending output and removes this router from the Env
+func (r *TraceRouter) Delete() error {
+	r.Flush()
+	return r.core.Delete()
+}
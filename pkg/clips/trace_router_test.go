@@ -0,0 +1,148 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseTrace(t *testing.T) {
+	t.Run("Facts", func(t *testing.T) {
+		event := ParseTrace("==> f-1     (point (x 1) (y 2))")
+		fact, ok := event.(*FactEvent)
+		assert.Assert(t, ok)
+		assert.Assert(t, fact.Asserted)
+		assert.Equal(t, fact.Index, 1)
+		assert.Equal(t, fact.Fact, "(point (x 1) (y 2))")
+		assert.Equal(t, fact.Text(), "==> f-1     (point (x 1) (y 2))")
+
+		fact = ParseTrace("<== f-12    (a)").(*FactEvent)
+		assert.Assert(t, !fact.Asserted)
+		assert.Equal(t, fact.Index, 12)
+	})
+
+	t.Run("Rules", func(t *testing.T) {
+		act := ParseTrace("==> Activation -10    ship: f-1,f-2").(*ActivationEvent)
+		assert.Assert(t, act.Activated)
+		assert.Equal(t, act.Salience, -10)
+		assert.Equal(t, act.Rule, "ship")
+		assert.DeepEqual(t, act.Basis, []string{"f-1", "f-2"})
+
+		act = ParseTrace("<== Activation 0      ship: f-1,*").(*ActivationEvent)
+		assert.Assert(t, !act.Activated)
+		assert.DeepEqual(t, act.Basis, []string{"f-1", "*"})
+
+		fire := ParseTrace("FIRE    2 MAIN::ship: f-3,[p1]").(*FireEvent)
+		assert.Equal(t, fire.Count, 2)
+		assert.Equal(t, fire.Rule, "MAIN::ship")
+		assert.DeepEqual(t, fire.Basis, []string{"f-3", "[p1]"})
+	})
+
+	t.Run("Objects", func(t *testing.T) {
+		inst := ParseTrace("==> instance [p1] of point").(*InstanceEvent)
+		assert.Assert(t, inst.Made)
+		assert.Equal(t, inst.Name, InstanceName("p1"))
+		assert.Equal(t, inst.Class, "point")
+
+		slot := ParseTrace("::= local slot x in instance p1 <- (1 2)").(*SlotEvent)
+		assert.Equal(t, slot.Instance, InstanceName("p1"))
+		assert.Equal(t, slot.Slot, "x")
+		assert.Assert(t, !slot.Shared)
+		assert.Equal(t, slot.Value, "(1 2)")
+
+		global := ParseTrace(":== ?*count* ==> 5 <== 4").(*GlobalEvent)
+		assert.Equal(t, global.Name, "count")
+		assert.Equal(t, global.Value, "5")
+		assert.Equal(t, global.OldValue, "4")
+
+		focus := ParseTrace("==> Focus B from MAIN").(*FocusEvent)
+		assert.Assert(t, focus.Pushed)
+		assert.Equal(t, focus.Module, "B")
+		assert.Equal(t, focus.Other, "MAIN")
+	})
+
+	t.Run("Calls", func(t *testing.T) {
+		call := ParseTrace("DFN >> double ED:1 (2)").(*CallEvent)
+		assert.Equal(t, call.Kind, TRACE_DEFFUNCTION)
+		assert.Assert(t, call.Enter)
+		assert.Equal(t, call.Name, "double")
+		assert.Equal(t, call.Depth, 1)
+		assert.Equal(t, call.Args, "(2)")
+
+		call = ParseTrace("MTH << area:#1 ED:2 (<Instance-c1>)").(*CallEvent)
+		assert.Equal(t, call.Kind, TRACE_METHOD)
+		assert.Assert(t, !call.Enter)
+		assert.Equal(t, call.Name, "area:#1")
+
+		call = ParseTrace("HND >> init primary in class USER ED:1 (<Instance-p1>)").(*CallEvent)
+		assert.Equal(t, call.Kind, TRACE_HANDLER)
+		assert.Equal(t, call.HandlerType, "primary")
+		assert.Equal(t, call.Class, "USER")
+		assert.Equal(t, call.Args, "(<Instance-p1>)")
+
+		_, ok := ParseTrace("Defining defrule: ship +j+j").(*TextEvent)
+		assert.Assert(t, ok)
+	})
+}
+
+func TestTraceRouter(t *testing.T) {
+	env := CreateEnvironment()
+	defer env.Delete()
+
+	var events []TraceEvent
+	router := CreateTraceRouter(env, func(event TraceEvent) {
+		events = append(events, event)
+	})
+	defer router.Delete()
+
+	err := env.Build(`(defrule ship (order ?id) => (assert (shipped ?id)))`)
+	assert.NilError(t, err)
+	err = env.Watch(WATCH_FACTS, WATCH_RULES)
+	assert.NilError(t, err)
+	assert.Assert(t, env.Watching(WATCH_FACTS))
+	assert.Assert(t, !env.Watching(WATCH_ACTIVATIONS))
+
+	_, err = env.AssertString(`(order 1)`)
+	assert.NilError(t, err)
+	env.Run(-1)
+
+	assert.Equal(t, len(events), 3)
+	order := events[0].(*FactEvent)
+	assert.Equal(t, order.Fact, "(order 1)")
+	fire := events[1].(*FireEvent)
+	assert.Equal(t, fire.Rule, "ship")
+	assert.DeepEqual(t, fire.Basis, []string{"f-" + fmt.Sprint(order.Index)})
+	shipped := events[2].(*FactEvent)
+	assert.Equal(t, shipped.Fact, "(shipped 1)")
+
+	err = env.Unwatch(WATCH_ALL)
+	assert.NilError(t, err)
+	assert.Assert(t, !env.Watching(WATCH_FACTS))
+
+	err = env.Watch(WatchItem(99))
+	assert.ErrorContains(t, err, "Invalid watch item")
+
+	// handlers print their depth and arguments on a second line
+	events = nil
+	router.Print("wtrace", "HND >> init primary in class USER\n       ED:1 (<Instance-p1>)\n")
+	assert.Equal(t, len(events), 1)
+	call := events[0].(*CallEvent)
+	assert.Equal(t, call.Name, "init")
+	assert.Equal(t, call.Depth, 1)
+	assert.Equal(t, call.Args, "(<Instance-p1>)")
+}
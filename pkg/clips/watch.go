@@ -0,0 +1,116 @@
+package clips
+
+// #cgo CFLAGS: -I ../../clips_source
+// #cgo LDFLAGS: -L ../../clips_source -l clips -lm
+// #include <clips/clips.h>
+import "C"
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+import (
+	"fmt"
+	"unsafe"
+)
+
+// WatchItem is an enumeration of the items CLIPS can watch
+type WatchItem int
+
+const (
+	WATCH_ALL WatchItem = iota
+	WATCH_FACTS
+	WATCH_INSTANCES
+	WATCH_SLOTS
+	WATCH_RULES
+	WATCH_ACTIVATIONS
+	WATCH_MESSAGES
+	WATCH_MESSAGE_HANDLERS
+	WATCH_GENERIC_FUNCTIONS
+	WATCH_METHODS
+	WATCH_DEFFUNCTIONS
+	WATCH_COMPILATIONS
+	WATCH_STATISTICS
+	WATCH_GLOBALS
+	WATCH_FOCUS
+)
+
+var clipsWatchItems = [...]string{
+	"all",
+	"facts",
+	"instances",
+	"slots",
+	"rules",
+	"activations",
+	"messages",
+	"message-handlers",
+	"generic-functions",
+	"methods",
+	"deffunctions",
+	"compilations",
+	"statistics",
+	"globals",
+	"focus",
+}
+
+// String returns the name of the item as given to (watch), such as "facts"
+func (item WatchItem) String() string {
+	if item < 0 || int(item) >= len(clipsWatchItems) {
+		return fmt.Sprintf("WatchItem(%d)", int(item))
+	}
+	return clipsWatchItems[int(item)]
+}
+
+func (env *Environment) setWatch(watch bool, items []WatchItem) error {
+	if err := env.check(); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item < 0 || int(item) >= len(clipsWatchItems) {
+			return fmt.Errorf("Invalid watch item %d", int(item))
+		}
+		cname := C.CString(item.String())
+		var ret C.int
+		if watch {
+			ret = C.EnvWatch(env.ptr(), cname)
+		} else {
+			ret = C.EnvUnwatch(env.ptr(), cname)
+		}
+		C.free(unsafe.Pointer(cname))
+		if ret != 1 {
+			return EnvError(env, `Unable to set watch item "%s"`, item)
+		}
+	}
+	return nil
+}
+
+// Watch turns on the given watch items for all constructs, so that CLIPS traces them to
+// wtrace. Equivalent to (watch <item>) for each item. Use a TraceRouter to receive the
+// output as events
+func (env *Environment) Watch(items ...WatchItem) error {
+	return env.setWatch(true, items)
+}
+
+// Unwatch turns off the given watch items. Equivalent to (unwatch <item>) for each item
+func (env *Environment) Unwatch(items ...WatchItem) error {
+	return env.setWatch(false, items)
+}
+
+// Watching returns true if the given item is being watched. WATCH_ALL is never reported
+func (env *Environment) Watching(item WatchItem) bool {
+	if item == WATCH_ALL || int(item) >= len(clipsWatchItems) || item < 0 {
+		return false
+	}
+	cname := C.CString(item.String())
+	defer C.free(unsafe.Pointer(cname))
+	return C.EnvGetWatchItem(env.ptr(), cname) == 1
+}
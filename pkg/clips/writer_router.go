@@ -0,0 +1,134 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// stdoutNames are the logical names of regular CLIPS output, including watch output
+var stdoutNames = []string{"t", "stdout", "wdisplay", "wprompt", "wdialog", "wclips", "wtrace"}
+
+// stderrNames are the logical names of CLIPS errors and warnings
+var stderrNames = []string{"werror", "wwarning"}
+
+// WriterRouter is a router writing the output of each logical name to its own io.Writer.
+// Names may include those used with printout, such as (printout audit ...)
+type WriterRouter struct {
+	core    *RouterCore
+	writers map[string]io.Writer
+}
+
+// CreateWriterRouter returns a new router writing the output of each logical name to the
+// writer it maps to
+func CreateWriterRouter(env *Environment, writers map[string]io.Writer) *WriterRouter {
+	return createWriterRouter(env, "go-writer-router", writers, 30)
+}
+
+func createWriterRouter(env *Environment, name string, writers map[string]io.Writer, priority int) *WriterRouter {
+	ret := &WriterRouter{
+		writers: make(map[string]io.Writer, len(writers)),
+	}
+	names := make([]string, 0, len(writers))
+	for name, w := range writers {
+		ret.writers[name] = w
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret.core = CreateRouterCore(env, ret, uniqueRouterName(env, name), names, priority)
+	return ret
+}
+
+// SetWriter sets the writer for a logical name, or stops handling the name if w is nil
+func (r *WriterRouter) SetWriter(name string, w io.Writer) {
+	if w == nil {
+		delete(r.writers, name)
+		return
+	}
+	r.writers[name] = w
+}
+
+// Name of this router
+func (r *WriterRouter) Name() string {
+	return r.core.Name()
+}
+
+// Query should return true if the router handles the given logical IO name
+func (r *WriterRouter) Query(name string) bool {
+	_, ok := r.writers[name]
+	return ok
+}
+
+// Print is called with a message if Query has returned true
+func (r *WriterRouter) Print(name string, message string) {
+	if w, ok := r.writers[name]; ok {
+		io.WriteString(w, message)
+	}
+}
+
+// Getc is called by CLIPS to obtain a character from input
+func (r *WriterRouter) Getc(name string) byte {
+	return 0
+}
+
+// Ungetc is called by CLIPS to push a character back into the input queue
+func (r *WriterRouter) Ungetc(name string, ch byte) error {
+	return fmt.Errorf("Not implemented")
+}
+
+// Exit is called by CLIPS before CLIPS itself exits
+func (r *WriterRouter) Exit(exitcode int) {
+}
+
+// Activate activates this router with the Env
+func (r *WriterRouter) Activate() error {
+	return r.core.Activate()
+}
+
+// Deactivate deactivates this router with the Env
+func (r *WriterRouter) Deactivate() error {
+	return r.core.Deactivate()
+}
+
+// Delete removes this router from the Env
+func (r *WriterRouter) Delete() error {
+	return r.core.Delete()
+}
+
+// Capture calls fn, collecting everything CLIPS prints meanwhile. Errors and warnings are
+// returned as stderr, and all other output, including watch output, as stdout. err is the
+// error returned by fn
+func (env *Environment) Capture(fn func() error) (stdout string, stderr string, err error) {
+	if err := env.check(); err != nil {
+		return "", "", err
+	}
+	var out, errout strings.Builder
+	writers := make(map[string]io.Writer, len(stdoutNames)+len(stderrNames))
+	for _, name := range stdoutNames {
+		writers[name] = &out
+	}
+	for _, name := range stderrNames {
+		writers[name] = &errout
+	}
+	// below the error router, which passes errors on, and above other output routers
+	router := createWriterRouter(env, "go-capture-router", writers, 35)
+	defer router.Delete()
+
+	err = fn()
+	return out.String(), errout.String(), err
+}
@@ -0,0 +1,91 @@
+package clips
+
+/*
+   Copyright 2020 Keysight Technologies
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestWriterRouter(t *testing.T) {
+	t.Run("Per logical name", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		var out, audit bytes.Buffer
+		router := CreateWriterRouter(env, map[string]io.Writer{
+			"t":     &out,
+			"audit": &audit,
+		})
+		defer router.Delete()
+
+		err := env.SendCommand(`(printout t "to t" crlf)`)
+		assert.NilError(t, err)
+		err = env.SendCommand(`(printout audit "to audit" crlf)`)
+		assert.NilError(t, err)
+		assert.Equal(t, out.String(), "to t\n")
+		assert.Equal(t, audit.String(), "to audit\n")
+
+		router.SetWriter("audit", nil)
+		assert.Assert(t, !router.Query("audit"))
+		var extra bytes.Buffer
+		router.SetWriter("extra", &extra)
+		err = env.SendCommand(`(printout extra "more")`)
+		assert.NilError(t, err)
+		assert.Equal(t, extra.String(), "more")
+	})
+
+	t.Run("Capture", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		err := env.Build(`(defrule hello (greet ?who) => (printout t "Hello " ?who crlf))`)
+		assert.NilError(t, err)
+
+		stdout, stderr, err := env.Capture(func() error {
+			_, err := env.AssertString(`(greet world)`)
+			env.Run(-1)
+			return err
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, stdout, "Hello world\n")
+		assert.Equal(t, stderr, "")
+
+		// output is no longer captured afterwards
+		assert.Equal(t, len(env.router), 1)
+	})
+
+	t.Run("Capture errors", func(t *testing.T) {
+		env := CreateEnvironment()
+		defer env.Delete()
+
+		stdout, stderr, err := env.Capture(func() error {
+			return env.Build(`(defrule broken`)
+		})
+		assert.ErrorContains(t, err, "Unable to parse construct")
+		assert.Equal(t, stdout, "")
+		assert.Assert(t, strings.Contains(stderr, "[PRNTUTIL"), stderr)
+
+		_, _, err = env.Capture(func() error {
+			return fmt.Errorf("failed")
+		})
+		assert.ErrorContains(t, err, "failed")
+	})
+}